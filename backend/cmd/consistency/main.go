@@ -0,0 +1,72 @@
+// Command consistency reports dangling references between collections and,
+// with -repair, fixes the ones that have a safe repair.
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/config"
+	"github.com/a2sv/safeware/internal/consistency"
+	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/repository"
+)
+
+func main() {
+	repair := flag.Bool("repair", false, "repair issues that have a safe fix")
+	asJSON := flag.Bool("json", false, "print the report as JSON")
+	flag.Parse()
+
+	cfg := config.Load()
+	if err := database.ConnectMongoDB(cfg.Database.URI, cfg.Database.Database); err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	defer database.Close()
+
+	repos := repository.NewMongoRepositories(database.Database)
+	auditService := audit.NewAuditService(cfg.JWT.Secret, repos.Audit)
+
+	report, err := consistency.NewChecker(auditService, database.Database).Run(context.Background(), *repair)
+	auditService.Close()
+	if err != nil {
+		log.Fatalf("Consistency check failed: %v", err)
+	}
+
+	if *asJSON {
+		json.NewEncoder(os.Stdout).Encode(report)
+	} else {
+		printReport(report)
+	}
+
+	if report.Unresolved() > 0 {
+		os.Exit(1)
+	}
+}
+
+func printReport(report *consistency.Report) {
+	if len(report.Issues) == 0 {
+		fmt.Println("No issues found")
+		return
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "KIND\tCOLLECTION\tID\tSTATUS\tDETAIL")
+	for _, issue := range report.Issues {
+		status := "report only"
+		switch {
+		case issue.Repaired:
+			status = "repaired"
+		case issue.Repairable:
+			status = "repairable"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n", issue.Kind, issue.Collection, issue.ID.Hex(), status, issue.Detail)
+	}
+	w.Flush()
+	fmt.Printf("\n%d issue(s), %d repaired\n", len(report.Issues), report.Repaired)
+}
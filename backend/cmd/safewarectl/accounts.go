@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"time"
+
+	"github.com/a2sv/safeware/internal/auth"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func createCompany(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("create-company", flag.ExitOnError)
+	name := fs.String("name", "", "company name (required)")
+	managerName := fs.String("manager-name", "", "full name of the first Manager (required)")
+	email := fs.String("manager-email", "", "email of the first Manager (required)")
+	password := fs.String("password", "", "initial password; generated when empty")
+	fs.Parse(args)
+
+	if *name == "" || *managerName == "" || *email == "" {
+		fs.Usage()
+		return errors.New("-name, -manager-name and -manager-email are required")
+	}
+
+	company, manager, initial, err := a.newCompany(ctx, *name, *managerName, *email, *password)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Company:  %s (%s)\n", company.Name, company.ID.Hex())
+	fmt.Printf("Manager:  %s (%s)\n", manager.Email, manager.ID.Hex())
+	if *password == "" {
+		fmt.Printf("Password: %s\n", initial)
+	}
+	return nil
+}
+
+// newCompany creates a company with a verified Manager in one transaction and
+// returns the Manager's initial password
+func (a *app) newCompany(ctx context.Context, name, managerName, email, password string) (*models.Company, *models.User, string, error) {
+	password, hash, err := passwordHash(password)
+	if err != nil {
+		return nil, nil, "", err
+	}
+	if exists, err := a.repos.Users.EmailExists(ctx, email); err != nil {
+		return nil, nil, "", err
+	} else if exists {
+		return nil, nil, "", fmt.Errorf("email %s is already registered", email)
+	}
+
+	now := time.Now()
+	company := &models.Company{
+		ID:        primitive.NewObjectID(),
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	manager := &models.User{
+		ID:           primitive.NewObjectID(),
+		CompanyID:    company.ID,
+		FullName:     managerName,
+		Email:        email,
+		PasswordHash: hash,
+		Role:         "Manager",
+		IsVerified:   true,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+
+	err = a.repos.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if err := a.repos.Companies.Create(ctx, company); err != nil {
+			return err
+		}
+		return a.repos.Users.Create(ctx, manager)
+	})
+	if err == repository.ErrDuplicate {
+		return nil, nil, "", fmt.Errorf("email %s is already registered", email)
+	}
+	if err != nil {
+		return nil, nil, "", err
+	}
+
+	a.audit("CREATE", "COMPANY", company.ID, &company.ID, map[string]interface{}{"name": company.Name})
+	a.audit("CREATE", "EMPLOYEE", company.ID, &manager.ID, map[string]interface{}{"role": manager.Role, "email": manager.Email})
+	return company, manager, password, nil
+}
+
+func resetPassword(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("reset-password", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user (required)")
+	password := fs.String("password", "", "new password; generated when empty")
+	fs.Parse(args)
+
+	user, err := a.userByEmail(ctx, *email, fs)
+	if err != nil {
+		return err
+	}
+	newPassword, hash, err := passwordHash(*password)
+	if err != nil {
+		return err
+	}
+	if err := a.repos.Users.SetPassword(ctx, user.ID, hash); err != nil {
+		return err
+	}
+
+	a.audit("RESET_PASSWORD", "USER", user.CompanyID, &user.ID, map[string]interface{}{"email": user.Email})
+	fmt.Printf("Password reset for %s\n", user.Email)
+	if *password == "" {
+		fmt.Printf("New password: %s\n", newPassword)
+	}
+	return nil
+}
+
+func resetMFA(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("reset-mfa", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user (required)")
+	fs.Parse(args)
+
+	user, err := a.userByEmail(ctx, *email, fs)
+	if err != nil {
+		return err
+	}
+	if user.TOTPSecret == "" {
+		fmt.Printf("%s has no MFA enrollment\n", user.Email)
+		return nil
+	}
+	if err := a.repos.Users.ClearMFA(ctx, user.ID); err != nil {
+		return err
+	}
+
+	a.audit("RESET_MFA", "USER", user.CompanyID, &user.ID, map[string]interface{}{"email": user.Email})
+	fmt.Printf("MFA reset for %s\n", user.Email)
+	return nil
+}
+
+func unlock(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("unlock", flag.ExitOnError)
+	email := fs.String("email", "", "email of the user to unlock")
+	companyID := fs.String("company", "", "unlock every locked user of this company ID instead")
+	fs.Parse(args)
+
+	var users []models.User
+	switch {
+	case *email != "":
+		user, err := a.userByEmail(ctx, *email, fs)
+		if err != nil {
+			return err
+		}
+		users = append(users, *user)
+	case *companyID != "":
+		id, err := primitive.ObjectIDFromHex(*companyID)
+		if err != nil {
+			return fmt.Errorf("invalid company ID %q", *companyID)
+		}
+		if users, err = a.repos.Users.List(ctx, repository.UserFilter{CompanyID: id}); err != nil {
+			return err
+		}
+	default:
+		fs.Usage()
+		return errors.New("-email or -company is required")
+	}
+
+	unlocked := 0
+	for _, user := range users {
+		if user.FailedLogins == 0 && user.LockedUntil == nil {
+			continue
+		}
+		if err := a.repos.Users.Unlock(ctx, user.ID); err != nil {
+			return err
+		}
+		a.audit("UNLOCK", "USER", user.CompanyID, &user.ID, map[string]interface{}{
+			"email":         user.Email,
+			"failed_logins": user.FailedLogins,
+		})
+		fmt.Printf("Unlocked %s\n", user.Email)
+		unlocked++
+	}
+	fmt.Printf("%d account(s) unlocked\n", unlocked)
+	return nil
+}
+
+func (a *app) userByEmail(ctx context.Context, email string, fs *flag.FlagSet) (*models.User, error) {
+	if email == "" {
+		fs.Usage()
+		return nil, errors.New("-email is required")
+	}
+	user, err := a.repos.Users.GetByEmail(ctx, email)
+	if err == repository.ErrNotFound {
+		return nil, fmt.Errorf("no user with email %s", email)
+	}
+	return user, err
+}
+
+// passwordHash validates password, or generates one when it is empty, and hashes it
+func passwordHash(password string) (string, string, error) {
+	if password == "" {
+		generated, err := generatePassword()
+		if err != nil {
+			return "", "", err
+		}
+		password = generated
+	} else if err := auth.ValidatePasswordPolicy(password); err != nil {
+		return "", "", errors.New("password must be at least 12 characters with uppercase, lowercase, number, and symbol")
+	}
+
+	hash, err := auth.HashPassword(password)
+	return password, hash, err
+}
+
+// generatePassword returns a random 20 character password meeting the password policy
+func generatePassword() (string, error) {
+	classes := []string{
+		"ABCDEFGHJKLMNPQRSTUVWXYZ",
+		"abcdefghijkmnpqrstuvwxyz",
+		"23456789",
+		"!#%+-=?@_",
+	}
+	all := classes[0] + classes[1] + classes[2] + classes[3]
+
+	pick := func(set string) (byte, error) {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(len(set))))
+		if err != nil {
+			return 0, err
+		}
+		return set[n.Int64()], nil
+	}
+
+	password := make([]byte, 20)
+	for i := range password {
+		set := all
+		if i < len(classes) {
+			set = classes[i]
+		}
+		c, err := pick(set)
+		if err != nil {
+			return "", err
+		}
+		password[i] = c
+	}
+
+	// Shuffle so the guaranteed classes are not always first
+	for i := len(password) - 1; i > 0; i-- {
+		n, err := rand.Int(rand.Reader, big.NewInt(int64(i+1)))
+		if err != nil {
+			return "", err
+		}
+		j := n.Int64()
+		password[i], password[j] = password[j], password[i]
+	}
+	return string(password), nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func generateKey(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("generate-key", flag.ExitOnError)
+	size := fs.Int("bytes", 32, "key size in bytes")
+	fs.Parse(args)
+
+	key := make([]byte, *size)
+	if _, err := rand.Read(key); err != nil {
+		return err
+	}
+	fmt.Println(hex.EncodeToString(key))
+	return nil
+}
+
+// rotateKeys re-encrypts stored data after secrets were changed in .env. It is
+// run with the new settings loaded and the previous values passed as flags;
+// data already under the new key is skipped, so it is safe to run again.
+func rotateKeys(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("rotate-keys", flag.ExitOnError)
+	oldAuditKey := fs.String("old-audit-key", "", "previous JWT_SECRET, which encrypts audit details")
+	oldArchiveKey := fs.String("old-archive-key", "", "previous AUDIT_ARCHIVE_KEY")
+	oldBackupKey := fs.String("old-backup-key", "", "previous BACKUP_ENCRYPTION_KEY")
+	fs.Parse(args)
+
+	// Archive and backup keys fall back to the JWT secret when unset, so they
+	// change along with it
+	archiveFrom := *oldArchiveKey
+	rotateArchives := archiveFrom != "" || (*oldAuditKey != "" && a.cfg.Audit.ArchiveKey == "")
+	backupFrom := *oldBackupKey
+	if backupFrom == "" && a.cfg.Backup.EncryptionKey == "" {
+		backupFrom = *oldAuditKey
+	}
+
+	if *oldAuditKey == "" && !rotateArchives && backupFrom == "" {
+		fs.Usage()
+		return errors.New("pass at least one previous key")
+	}
+
+	if *oldAuditKey != "" {
+		result, err := a.auditService.RotateKey(ctx, *oldAuditKey)
+		if err != nil {
+			return fmt.Errorf("audit details: %w", err)
+		}
+		a.reportRotation("audit details", result.Rewritten, result.Current, result.Unreadable)
+	}
+
+	if rotateArchives {
+		// Without an explicit old archive key, the old one was derived from the old audit key
+		oldAudit := *oldAuditKey
+		if oldAudit == "" {
+			oldAudit = a.cfg.JWT.Secret
+		}
+		retention := audit.NewRetentionService(a.auditService, a.repos.Retention, a.cfg.Audit.ArchivePath, a.cfg.Audit.ArchiveKey)
+		result, err := retention.RotateKey(ctx, archiveFrom, oldAudit)
+		if err != nil {
+			return fmt.Errorf("audit archives: %w", err)
+		}
+		a.reportRotation("audit archives", result.Rewritten, result.Current, result.Unreadable)
+	}
+
+	if backupFrom != "" {
+		result, err := a.backupService().RotateKey(ctx, backupFrom)
+		if err != nil {
+			return fmt.Errorf("backups: %w", err)
+		}
+		a.reportRotation("backups", int64(result.Rewritten), int64(result.Current), result.Unreadable)
+	}
+	return nil
+}
+
+func (a *app) reportRotation(target string, rewritten, current int64, unreadable []primitive.ObjectID) {
+	a.audit("ROTATE_KEY", "SYSTEM", primitive.NilObjectID, nil, map[string]interface{}{
+		"target":     target,
+		"rewritten":  rewritten,
+		"current":    current,
+		"unreadable": len(unreadable),
+	})
+
+	fmt.Printf("%s: %d re-encrypted, %d already current, %d unreadable\n", target, rewritten, current, len(unreadable))
+	for _, id := range unreadable {
+		fmt.Printf("  unreadable: %s\n", id.Hex())
+	}
+}
@@ -0,0 +1,120 @@
+// Command safewarectl performs operational tasks against the SafeWare database
+// using the same configuration as the server. Every change it makes is audited
+// with the "system" actor.
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/config"
+	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// app holds the connections and services shared by all commands
+type app struct {
+	cfg          *config.Config
+	repos        *repository.Repositories
+	auditService *audit.AuditService
+}
+
+type command struct {
+	summary string
+	run     func(ctx context.Context, a *app, args []string) error
+}
+
+var commands = map[string]command{
+	"create-company": {"Create a company and its first Manager", createCompany},
+	"reset-password": {"Set a new password for a user", resetPassword},
+	"reset-mfa":      {"Remove a user's TOTP enrollment", resetMFA},
+	"unlock":         {"Clear failed logins and lockouts for a user or a whole company", unlock},
+	"generate-key":   {"Print a random key for secrets in .env", generateKey},
+	"rotate-keys":    {"Re-encrypt audit details, audit archives and backups after a key change", rotateKeys},
+	"migrate":        {"Apply pending schema migrations, or show their status", runMigrations},
+	"check-audit":    {"Check that audit details decrypt and archives match their checksums", checkAudit},
+	"backup":         {"Back up one company, or everything with -all", runBackup},
+	"list-backups":   {"List a company's backups", listBackups},
+	"restore":        {"Restore a company from a backup", runRestore},
+	"seed-demo":      {"Create a demo company with users, warehouses and items", seedDemo},
+}
+
+func main() {
+	log.SetFlags(0)
+	if len(os.Args) < 2 || os.Args[1] == "help" || os.Args[1] == "-h" || os.Args[1] == "--help" {
+		usage()
+		return
+	}
+
+	cmd, ok := commands[os.Args[1]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n", os.Args[1])
+		usage()
+		os.Exit(2)
+	}
+
+	// generate-key needs no database
+	if os.Args[1] == "generate-key" {
+		if err := cmd.run(context.Background(), nil, os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+
+	cfg := config.Load()
+	if err := database.ConnectMongoDB(cfg.Database.URI, cfg.Database.Database); err != nil {
+		log.Fatalf("Failed to connect to MongoDB: %v", err)
+	}
+	repos := repository.NewMongoRepositories(database.Database)
+	a := &app{
+		cfg:          cfg,
+		repos:        repos,
+		auditService: audit.NewAuditService(cfg.JWT.Secret, repos.Audit),
+	}
+
+	err := cmd.run(context.Background(), a, os.Args[2:])
+
+	// Flush audit entries before disconnecting
+	a.auditService.Close()
+	database.Close()
+	if err != nil {
+		log.Fatalf("%s: %v", os.Args[1], err)
+	}
+}
+
+func usage() {
+	fmt.Println("Usage: safewarectl <command> [flags]")
+	fmt.Println()
+	fmt.Println("Commands:")
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		fmt.Printf("  %-16s %s\n", name, commands[name].summary)
+	}
+	fmt.Println()
+	fmt.Println("Run safewarectl <command> -h for the flags of a command.")
+}
+
+// audit records a successful action taken by the CLI as the system actor
+func (a *app) audit(action, resourceType string, companyID primitive.ObjectID, resourceID *primitive.ObjectID, details map[string]interface{}) {
+	a.auditStatus(action, resourceType, companyID, resourceID, details, "SUCCESS")
+}
+
+func (a *app) auditStatus(action, resourceType string, companyID primitive.ObjectID, resourceID *primitive.ObjectID, details map[string]interface{}, status string) {
+	if details == nil {
+		details = map[string]interface{}{}
+	}
+	details["source"] = "safewarectl"
+	if operator := os.Getenv("USER"); operator != "" {
+		details["operator"] = operator
+	}
+	a.auditService.LogAction(context.Background(), primitive.NilObjectID, companyID, "system", action, resourceType, resourceID, details, "", "", status)
+}
@@ -0,0 +1,245 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/backup"
+	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/migrate"
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func runMigrations(ctx context.Context, a *app, args []string) error {
+	runner := migrate.NewRunner(database.Database)
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		ran, err := runner.Up(ctx)
+		versions := make([]int, 0, len(ran))
+		for _, m := range ran {
+			versions = append(versions, m.Version)
+			fmt.Printf("Applied %d: %s\n", m.Version, m.Description)
+		}
+		if len(ran) > 0 {
+			a.audit("MIGRATE", "DATABASE", primitive.NilObjectID, nil, map[string]interface{}{"versions": versions})
+		}
+		if err != nil {
+			return err
+		}
+		fmt.Printf("%d migration(s) applied\n", len(ran))
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			return err
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, applied, status.Description)
+		}
+		w.Flush()
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected up or status", command)
+	}
+	return nil
+}
+
+// checkAudit runs the audit integrity check. It is not a chain verification:
+// entries are not hash-chained, so deleted entries are not detected.
+func checkAudit(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("check-audit", flag.ExitOnError)
+	company := fs.String("company", "", "only check this company ID")
+	fs.Parse(args)
+
+	companyID, err := optionalID(*company)
+	if err != nil {
+		return err
+	}
+
+	retention := audit.NewRetentionService(a.auditService, a.repos.Retention, a.cfg.Audit.ArchivePath, a.cfg.Audit.ArchiveKey)
+	report, err := retention.Check(ctx, companyID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Entries checked:   %d\n", report.Entries)
+	fmt.Printf("Archives checked:  %d\n", report.Archives)
+	printIDs("Undecryptable entry", report.Undecryptable)
+	printIDs("Missing archive", report.MissingArchives)
+	printIDs("Tampered archive", report.TamperedArchives)
+
+	a.audit("CHECK", "AUDIT_LOG", companyID, nil, map[string]interface{}{
+		"entries":           report.Entries,
+		"archives":          report.Archives,
+		"undecryptable":     len(report.Undecryptable),
+		"missing_archives":  len(report.MissingArchives),
+		"tampered_archives": len(report.TamperedArchives),
+	})
+
+	if !report.OK() {
+		return errors.New("audit data failed the integrity check")
+	}
+	fmt.Println("OK")
+	return nil
+}
+
+func runBackup(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	company := fs.String("company", "", "company ID to back up")
+	all := fs.Bool("all", false, "back up every company and the global collections")
+	notes := fs.String("notes", "", "notes stored with the backup")
+	fs.Parse(args)
+
+	backups := a.backupService()
+	if *all {
+		result, err := backups.BackupAll(ctx, *notes)
+		if err != nil {
+			return err
+		}
+		a.audit("BACKUP", "BACKUP", primitive.NilObjectID, &result.ID, map[string]interface{}{
+			"backup_type":  result.BackupType,
+			"record_count": result.RecordCount,
+			"sha256":       result.SHA256,
+		})
+		printBackup(result)
+		return nil
+	}
+
+	if *company == "" {
+		fs.Usage()
+		return errors.New("-company or -all is required")
+	}
+	companyID, err := primitive.ObjectIDFromHex(*company)
+	if err != nil {
+		return fmt.Errorf("invalid company ID %q", *company)
+	}
+	// A zero creator is audited by the backup service as the system actor
+	result, err := backups.BackupCompany(ctx, companyID, primitive.NilObjectID, backup.TypeCompany, *notes)
+	if err != nil {
+		return err
+	}
+	printBackup(result)
+	return nil
+}
+
+func listBackups(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("list-backups", flag.ExitOnError)
+	company := fs.String("company", "", "company ID (required)")
+	fs.Parse(args)
+
+	if *company == "" {
+		fs.Usage()
+		return errors.New("-company is required")
+	}
+	companyID, err := primitive.ObjectIDFromHex(*company)
+	if err != nil {
+		return fmt.Errorf("invalid company ID %q", *company)
+	}
+	list, err := a.backupService().List(ctx, companyID)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tTYPE\tCREATED\tRECORDS\tSIZE\tNOTES")
+	for _, b := range list {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%s\n", b.ID.Hex(), b.BackupType, b.CreatedAt.Format("2006-01-02 15:04:05"), b.RecordCount, b.FileSize, b.Notes)
+	}
+	return w.Flush()
+}
+
+func runRestore(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	backupFlag := fs.String("backup", "", "backup ID (required)")
+	company := fs.String("company", "", "company ID to restore (required)")
+	confirm := fs.String("confirm", "", "must be RESTORE")
+	fs.Parse(args)
+
+	if *backupFlag == "" || *company == "" {
+		fs.Usage()
+		return errors.New("-backup and -company are required")
+	}
+	if *confirm != "RESTORE" {
+		return errors.New("restore replaces the company's current data; confirm with -confirm RESTORE")
+	}
+	backupID, err := primitive.ObjectIDFromHex(*backupFlag)
+	if err != nil {
+		return fmt.Errorf("invalid backup ID %q", *backupFlag)
+	}
+	companyID, err := primitive.ObjectIDFromHex(*company)
+	if err != nil {
+		return fmt.Errorf("invalid company ID %q", *company)
+	}
+
+	backups := a.backupService()
+	source, err := backups.Get(ctx, backupID, primitive.NilObjectID)
+	if err != nil {
+		return err
+	}
+	result, err := backups.Restore(ctx, source, companyID, primitive.NilObjectID)
+
+	status := "SUCCESS"
+	details := map[string]interface{}{"backup_created_at": source.CreatedAt}
+	if result != nil {
+		details["safety_backup_id"] = result.SafetyBackupID.Hex()
+		details["restored_documents"] = result.RestoredDocuments
+	}
+	if err != nil {
+		status = "FAILURE"
+		details["error"] = err.Error()
+	}
+	a.auditStatus("RESTORE", "BACKUP", companyID, &backupID, details, status)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Restored %s from backup %s\n", companyID.Hex(), backupID.Hex())
+	fmt.Printf("Safety backup: %s\n", result.SafetyBackupID.Hex())
+	for name, count := range result.RestoredDocuments {
+		fmt.Printf("  %-24s %d\n", name, count)
+	}
+	return nil
+}
+
+func (a *app) backupService() *backup.Service {
+	return backup.NewService(a.auditService, a.repos.Tx, a.repos.Backups, a.repos.Companies, database.Database, a.cfg.Backup.Path, a.cfg.Backup.RetentionDays, a.cfg.Backup.EncryptionKey, a.cfg.JWT.Secret)
+}
+
+func printBackup(b *models.Backup) {
+	fmt.Printf("Backup %s (%s): %d records, %d bytes\n", b.ID.Hex(), b.BackupType, b.RecordCount, b.FileSize)
+	fmt.Printf("  %s\n", b.FilePath)
+}
+
+func printIDs(label string, ids []primitive.ObjectID) {
+	for _, id := range ids {
+		fmt.Printf("%s: %s\n", label, id.Hex())
+	}
+}
+
+// optionalID parses an ObjectID flag, returning the zero ID when it is empty
+func optionalID(hex string) (primitive.ObjectID, error) {
+	if hex == "" {
+		return primitive.NilObjectID, nil
+	}
+	id, err := primitive.ObjectIDFromHex(hex)
+	if err != nil {
+		return primitive.NilObjectID, fmt.Errorf("invalid ID %q", hex)
+	}
+	return id, nil
+}
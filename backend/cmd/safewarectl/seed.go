@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type demoItem struct {
+	sku, name, quality, department string
+	price                          int64 // cents
+	quantity, warehouse            int
+}
+
+var demoItems = []demoItem{
+	{"DEMO-001", "Pallet Jack", "New", "Logistics", 42000, 4, 0},
+	{"DEMO-002", "Safety Helmet", "New", "Safety", 3500, 120, 0},
+	{"DEMO-003", "Hi-Vis Vest", "New", "Safety", 1250, 200, 0},
+	{"DEMO-004", "Barcode Scanner", "Used", "IT", 18000, 15, 0},
+	{"DEMO-005", "Stretch Wrap Roll", "New", "Packaging", 2200, 80, 1},
+	{"DEMO-006", "Shelving Unit", "Damaged", "Facilities", 15000, 3, 1},
+	{"DEMO-007", "Forklift Battery", "Used", "Logistics", 260000, 2, 1},
+	{"DEMO-008", "Cardboard Box (Large)", "New", "Packaging", 180, 500, 1},
+}
+
+// seedDemo creates a company with one user per role, two warehouses and a
+// handful of stocked items for trying out the API
+func seedDemo(ctx context.Context, a *app, args []string) error {
+	fs := flag.NewFlagSet("seed-demo", flag.ExitOnError)
+	name := fs.String("name", "Demo Company", "company name")
+	domain := fs.String("domain", "demo.safeware.local", "email domain of the demo users")
+	fs.Parse(args)
+
+	email := func(local string) string { return local + "@" + strings.TrimPrefix(*domain, "@") }
+
+	company, manager, managerPassword, err := a.newCompany(ctx, *name, "Demo Manager", email("manager"), "")
+	if err != nil {
+		return err
+	}
+	credentials := [][3]string{{manager.Role, manager.Email, managerPassword}}
+
+	now := time.Now()
+	warehouses := make([]*models.Warehouse, 2)
+	for i, spec := range [][2]string{{"Main Warehouse", "Addis Ababa"}, {"Overflow Warehouse", "Adama"}} {
+		warehouses[i] = &models.Warehouse{
+			ID:        primitive.NewObjectID(),
+			CompanyID: company.ID,
+			Name:      spec[0],
+			Location:  spec[1],
+			IsActive:  true,
+			CreatedAt: now,
+			UpdatedAt: now,
+		}
+		if err := a.repos.Warehouses.Create(ctx, warehouses[i]); err != nil {
+			return err
+		}
+		a.audit("CREATE", "WAREHOUSE", company.ID, &warehouses[i].ID, map[string]interface{}{"name": spec[0]})
+	}
+
+	mainWarehouse := warehouses[0].ID
+	for _, spec := range []struct {
+		role, local, fullName string
+		warehouse             *primitive.ObjectID
+	}{
+		{"Supervisor", "supervisor", "Demo Supervisor", &mainWarehouse},
+		{"Staff", "staff", "Demo Staff", &mainWarehouse},
+		{"Auditor", "auditor", "Demo Auditor", nil},
+	} {
+		password, hash, err := passwordHash("")
+		if err != nil {
+			return err
+		}
+		user := &models.User{
+			ID:           primitive.NewObjectID(),
+			CompanyID:    company.ID,
+			FullName:     spec.fullName,
+			Email:        email(spec.local),
+			PasswordHash: hash,
+			Role:         spec.role,
+			WarehouseID:  spec.warehouse,
+			IsVerified:   true,
+			CreatedAt:    now,
+			UpdatedAt:    now,
+		}
+		if err := a.repos.Users.Create(ctx, user); err != nil {
+			return fmt.Errorf("%s: %w", user.Email, err)
+		}
+		if spec.role == "Supervisor" {
+			if err := a.repos.Warehouses.SetSupervisor(ctx, mainWarehouse, user.ID); err != nil {
+				return err
+			}
+		}
+		a.audit("CREATE", "EMPLOYEE", company.ID, &user.ID, map[string]interface{}{"role": user.Role, "email": user.Email})
+		credentials = append(credentials, [3]string{user.Role, user.Email, password})
+	}
+
+	valuationService := valuation.NewService(a.repos.Tx, a.repos.Companies, a.repos.Warehouses, a.repos.Items, a.repos.Costs)
+	pricingService := pricing.NewService(a.repos.Tx, a.repos.Items, a.repos.Prices, valuationService, a.auditService)
+	for _, spec := range demoItems {
+		item := &models.Item{
+			ID:          primitive.NewObjectID(),
+			CompanyID:   company.ID,
+			SKU:         spec.sku,
+			Name:        spec.name,
+			Quality:     spec.quality,
+			Price:       spec.price,
+			Currency:    models.DefaultCurrency,
+			Department:  spec.department,
+			OwnerUserID: manager.ID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		location := &models.ItemLocation{
+			ID:          primitive.NewObjectID(),
+			ItemID:      item.ID,
+			WarehouseID: warehouses[spec.warehouse].ID,
+			Quantity:    spec.quantity,
+			UpdatedBy:   manager.ID,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		err := a.repos.Tx.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := a.repos.Items.Create(ctx, item, location); err != nil {
+				return err
+			}
+			if err := pricingService.Record(ctx, item, "Initial price", manager.ID); err != nil {
+				return err
+			}
+			_, err := valuationService.Record(ctx, valuation.Change{
+				Item:        item,
+				WarehouseID: location.WarehouseID,
+				Delta:       location.Quantity,
+				Source:      valuation.SourceCreate,
+				CreatedBy:   manager.ID,
+			})
+			return err
+		})
+		if err != nil {
+			return fmt.Errorf("%s: %w", spec.sku, err)
+		}
+	}
+
+	a.audit("SEED", "COMPANY", company.ID, &company.ID, map[string]interface{}{
+		"warehouses": len(warehouses),
+		"users":      len(credentials),
+		"items":      len(demoItems),
+	})
+
+	fmt.Printf("Company %s (%s) seeded\n\n", company.Name, company.ID.Hex())
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ROLE\tEMAIL\tPASSWORD")
+	for _, c := range credentials {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", c[0], c[1], c[2])
+	}
+	return w.Flush()
+}
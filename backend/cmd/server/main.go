@@ -1,16 +1,34 @@
 package main
 
 import (
+	"context"
 	"log"
 	"os"
 
+	"github.com/a2sv/safeware/internal/anomaly"
 	"github.com/a2sv/safeware/internal/audit"
 	"github.com/a2sv/safeware/internal/auth"
+	"github.com/a2sv/safeware/internal/backup"
+	"github.com/a2sv/safeware/internal/category"
 	"github.com/a2sv/safeware/internal/config"
 	"github.com/a2sv/safeware/internal/database"
 	"github.com/a2sv/safeware/internal/email"
 	"github.com/a2sv/safeware/internal/handlers"
+	"github.com/a2sv/safeware/internal/idempotency"
+	"github.com/a2sv/safeware/internal/itemarchive"
+	"github.com/a2sv/safeware/internal/itemimport"
+	"github.com/a2sv/safeware/internal/kit"
+	"github.com/a2sv/safeware/internal/label"
+	"github.com/a2sv/safeware/internal/layout"
 	"github.com/a2sv/safeware/internal/middleware"
+	"github.com/a2sv/safeware/internal/migrate"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/privacy"
+	"github.com/a2sv/safeware/internal/quality"
+	"github.com/a2sv/safeware/internal/report"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/sku"
+	"github.com/a2sv/safeware/internal/valuation"
 	"github.com/gin-gonic/gin"
 )
 
@@ -24,6 +42,19 @@ func main() {
 	}
 	defer database.Close()
 
+	// `server migrate [up|status]` manages schema migrations and exits
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		runMigrateCommand(os.Args[2:])
+		return
+	}
+	if cfg.Database.MigrateOnStart {
+		if _, err := migrate.NewRunner(database.Database).Up(context.Background()); err != nil {
+			log.Fatalf("Failed to run migrations: %v", err)
+		}
+	}
+
+	repos := repository.NewMongoRepositories(database.Database)
+
 	// Set Gin mode
 	if cfg.Server.GinMode != "" {
 		gin.SetMode(cfg.Server.GinMode)
@@ -39,28 +70,107 @@ func main() {
 		cfg.Email.SMTPFrom,
 		cfg.Email.FrontendURL,
 	)
-	auditService := audit.NewAuditService(cfg.JWT.Secret) // Using JWT secret as encryption key for MVP
+	auditService := audit.NewAuditService(cfg.JWT.Secret, repos.Audit) // Using JWT secret as encryption key for MVP
+	auditExporter := audit.NewExporter(auditService, cfg.Audit.SigningKey)
+	retentionService := audit.NewRetentionService(auditService, repos.Retention, cfg.Audit.ArchivePath, cfg.Audit.ArchiveKey)
+	privacyService := privacy.NewService(auditService, auditExporter, repos.Tx, repos.Users, repos.Alerts, database.Database)
+	backupService := backup.NewService(auditService, repos.Tx, repos.Backups, repos.Companies, database.Database, cfg.Backup.Path, cfg.Backup.RetentionDays, cfg.Backup.EncryptionKey, cfg.JWT.Secret)
+	valuationService := valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	pricingService := pricing.NewService(repos.Tx, repos.Items, repos.Prices, valuationService, auditService)
+	importService := itemimport.NewService(repos.Tx, repos.ImportJobs, repos.Items, repos.Warehouses, valuationService, pricingService, auditService)
+	categoryService := category.NewService(repos.Categories, repos.Items)
+	skuService := sku.NewService(repos.Companies, repos.Items, repos.Sequences)
+	layoutService := layout.NewService(repos.Tx, repos.Layout, repos.Items, repos.Warehouses)
+	kitService := kit.NewService(repos.Tx, repos.Kits, repos.Items, repos.Warehouses, valuationService)
+	qualityService := quality.NewService(repos.Tx, repos.QualityHolds, repos.Items, valuationService)
+	archiveService := itemarchive.NewService(repos.Tx, repos.Items, repos.Prices, repos.Kits, repos.QualityHolds, valuationService, cfg.Items.PurgeAfter)
+	reportService := report.NewService(repos.Items, repos.Warehouses, repos.Companies, pricingService, valuationService)
+
+	labelTemplates, err := label.ParseTemplates(cfg.Label.Templates)
+	if err != nil {
+		log.Fatalf("Failed to parse label templates: %v", err)
+	}
+	labelService := label.NewService(repos.Items, repos.Layout, repos.Warehouses, layoutService, labelTemplates)
+
+	// Forward security events to syslog/SIEM sinks
+	sinkConfigs, err := audit.ParseSinkConfigs(cfg.Audit.Sinks)
+	if err != nil {
+		log.Fatalf("Failed to parse audit sinks: %v", err)
+	}
+	for _, sinkConfig := range sinkConfigs {
+		sink, filter, err := audit.NewSinkFromConfig(sinkConfig)
+		if err != nil {
+			log.Fatalf("Failed to configure audit sink: %v", err)
+		}
+		auditService.AddSink(sink, filter)
+		log.Printf("Forwarding audit events to %s", sink.Name())
+	}
+	defer auditService.Close()
+
+	// Detect suspicious activity as audit events are logged
+	if cfg.Anomaly.Enabled {
+		rules, err := anomaly.ParseRules(cfg.Anomaly.Rules)
+		if err != nil {
+			log.Fatalf("Failed to parse anomaly rules: %v", err)
+		}
+		detector, err := anomaly.NewDetector(rules, repos.Audit, repos.Users, repos.Alerts, emailService, cfg.Anomaly.EmailAlerts)
+		if err != nil {
+			log.Fatalf("Failed to configure anomaly detection: %v", err)
+		}
+		auditService.AddSink(detector, audit.SinkFilter{})
+	}
 
 	// Initialize handlers
-	authHandler := handlers.NewAuthHandler(jwtService, emailService, auditService)
-	warehouseHandler := handlers.NewWarehouseHandler(auditService)
-	itemHandler := handlers.NewItemHandler(auditService)
+	authHandler := handlers.NewAuthHandler(repos.Users, repos.Companies, jwtService, emailService, auditService)
+	warehouseHandler := handlers.NewWarehouseHandler(repos.Warehouses, auditService)
+	itemHandler := handlers.NewItemHandler(repos.Tx, repos.Items, valuationService, pricingService, categoryService, skuService, auditService)
+	itemPriceHandler := handlers.NewItemPriceHandler(pricingService, auditService)
+	itemImportHandler := handlers.NewItemImportHandler(importService)
+	itemArchiveHandler := handlers.NewItemArchiveHandler(archiveService, categoryService, auditService)
+	reportHandler := handlers.NewReportHandler(reportService, auditService)
+	valuationHandler := handlers.NewValuationHandler(valuationService, auditService)
+	categoryHandler := handlers.NewCategoryHandler(categoryService, auditService)
+	layoutHandler := handlers.NewLayoutHandler(layoutService, auditService)
+	kitHandler := handlers.NewKitHandler(kitService, auditService)
+	skuHandler := handlers.NewSKUHandler(skuService, auditService)
+	qualityHandler := handlers.NewQualityHandler(qualityService, auditService)
+	labelHandler := handlers.NewLabelHandler(labelService, auditService)
 	// roleHandler := handlers.NewRoleHandler()
 	// permissionHandler := handlers.NewPermissionHandler()
-	// userHandler := handlers.NewUserHandler()
-	managerHandler := handlers.NewManagerHandler(auditService)
-	auditHandler := handlers.NewAuditHandler(auditService)
+	// userHandler := handlers.NewUserHandler(repos.Users)
+	managerHandler := handlers.NewManagerHandler(repos.Tx, repos.Users, repos.Warehouses, auditService)
+	auditHandler := handlers.NewAuditHandler(auditService, auditExporter)
+	retentionHandler := handlers.NewRetentionHandler(retentionService, auditService)
+	alertHandler := handlers.NewAlertHandler(repos.Alerts, auditService)
+	backupHandler := handlers.NewBackupHandler(backupService, auditService)
+	privacyHandler := handlers.NewPrivacyHandler(privacyService, auditService)
 
 	// Seed default permissions (run once on startup)
 	if err := database.SeedDefaultPermissions(); err != nil {
 		log.Printf("Warning: Failed to seed permissions: %v", err)
 	}
 
+	// Imports cannot resume after a restart, so stop reporting them as running
+	if err := importService.FailInterrupted(context.Background()); err != nil {
+		log.Printf("Warning: Failed to mark interrupted imports: %v", err)
+	}
+
+	// Apply future-dated item prices as they take effect
+	go pricingService.Start(context.Background(), cfg.Pricing.ScheduleInterval)
+
+	// Archive expired audit logs in the background
+	go retentionService.Start(context.Background(), cfg.Audit.RetentionInterval)
+
+	// Nightly per-company backups and backup retention
+	if cfg.Backup.ScheduleEnabled {
+		go backupService.StartScheduler(context.Background(), cfg.Backup.ScheduleHour)
+	}
+
 	// Initialize router
 	router := gin.Default()
 
 	// Global Middleware
-	router.Use(middleware.AuditMiddleware(auditService))
+	router.Use(middleware.AuditMiddleware(auditService, cfg.Audit.RedactFields))
 
 	// CORS middleware
 	router.Use(func(c *gin.Context) {
@@ -76,7 +186,8 @@ func main() {
 		// This is required when Access-Control-Allow-Credentials is true
 		c.Writer.Header().Set("Access-Control-Allow-Origin", origin)
 		c.Writer.Header().Set("Access-Control-Allow-Credentials", "true")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Content-Length, Accept-Encoding, X-CSRF-Token, Authorization, accept, origin, Cache-Control, X-Requested-With, X-Request-ID, If-Match, Idempotency-Key")
+		c.Writer.Header().Set("Access-Control-Expose-Headers", "X-Request-ID, ETag, Idempotent-Replayed")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "POST, OPTIONS, GET, PUT, PATCH, DELETE")
 
 		if c.Request.Method == "OPTIONS" {
@@ -111,6 +222,7 @@ func main() {
 		// Protected routes (require authentication)
 		protected := v1.Group("")
 		protected.Use(middleware.AuthMiddleware(jwtService))
+		protected.Use(middleware.IdempotencyMiddleware(idempotency.NewStore(repos.Idempotency, cfg.Server.IdempotencyTTL)))
 		{
 			// Common routes (all authenticated users)
 			protected.GET("/users/me", authHandler.GetProfile)
@@ -146,8 +258,69 @@ func main() {
 				manager.POST("/item/create", itemHandler.Create)
 				manager.PUT("/item/update/:id", itemHandler.Update) // Using PUT as per spec
 				manager.DELETE("/item/remove/:id", itemHandler.Delete)
+				manager.PATCH("/item/adjust/:id", itemHandler.AdjustQuantity)
+				manager.GET("/item/prices/:id", itemPriceHandler.History)
+				manager.GET("/item/price/:id", itemPriceHandler.PriceAt)
+				manager.POST("/item/prices/:id", itemPriceHandler.Schedule)
+				manager.DELETE("/item/prices/:id/:price_id", itemPriceHandler.Cancel)
 				manager.GET("/items/all", itemHandler.List)
 				manager.GET("/items/warehouse/:id", itemHandler.List) // Filter by warehouse
+				manager.POST("/items/import", itemImportHandler.Import)
+				manager.GET("/items/imports/:id", itemImportHandler.Status)
+				manager.GET("/items/archived", itemArchiveHandler.List)
+				manager.GET("/sku/pattern", skuHandler.GetPattern)
+				manager.PUT("/sku/pattern", skuHandler.UpdatePattern)
+				manager.POST("/sku/reserve", skuHandler.Reserve)
+				manager.POST("/item/restore/:id", itemArchiveHandler.Restore)
+				manager.POST("/item/purge/:id", itemArchiveHandler.Purge)
+				manager.GET("/reports/:report", reportHandler.Generate)
+				manager.GET("/valuation", valuationHandler.Summary)
+				manager.GET("/valuation/settings", valuationHandler.GetSettings)
+				manager.PUT("/valuation/settings", valuationHandler.UpdateSettings)
+
+				// Item Categories
+				manager.GET("/categories", categoryHandler.Tree)
+				manager.GET("/category/:id", categoryHandler.Get)
+				manager.POST("/category/create", categoryHandler.Create)
+				manager.PATCH("/category/update/:id", categoryHandler.Update)
+				manager.DELETE("/category/delete/:id", categoryHandler.Delete)
+
+				// Warehouse Layout and Bins
+				manager.GET("/layout", layoutHandler.Tree)
+				manager.POST("/layout/create", layoutHandler.Create)
+				manager.PATCH("/layout/update/:id", layoutHandler.Update)
+				manager.DELETE("/layout/delete/:id", layoutHandler.Delete)
+				manager.GET("/bins/stock", layoutHandler.BinStock)
+				manager.GET("/bins/stock/:id", layoutHandler.BinStock)
+				manager.POST("/stock/putaway", layoutHandler.Putaway)
+				manager.POST("/stock/move", layoutHandler.Move)
+
+				// Kits and Bills of Materials
+				manager.GET("/kits", kitHandler.List)
+				manager.GET("/kit/:id", kitHandler.Get)
+				manager.PUT("/kit/update/:id", kitHandler.Define)
+				manager.DELETE("/kit/delete/:id", kitHandler.Delete)
+				manager.GET("/kit/availability/:id", kitHandler.Availability)
+				manager.GET("/kit/builds/:id", kitHandler.Builds)
+				manager.POST("/kit/assemble/:id", kitHandler.Assemble)
+				manager.POST("/kit/disassemble/:id", kitHandler.Disassemble)
+
+				// Quality Holds
+				manager.GET("/quality/holds", qualityHandler.List)
+				manager.GET("/quality/hold/:id", qualityHandler.Get)
+				manager.POST("/quality/hold", qualityHandler.Hold)
+				manager.POST("/quality/inspect/:id", qualityHandler.Inspect)
+				manager.POST("/quality/release/:id", qualityHandler.Release)
+				manager.POST("/quality/scrap/:id", qualityHandler.Scrap)
+				manager.POST("/quality/return/:id", qualityHandler.Return)
+
+				// Labels and Scanning
+				manager.GET("/labels/templates", labelHandler.Templates)
+				manager.GET("/labels/item/:id", labelHandler.Item)
+				manager.GET("/labels/bin/:id", labelHandler.Location)
+				manager.GET("/labels/warehouse", labelHandler.Warehouse)
+				manager.GET("/labels/batch/:batch", labelHandler.Batch)
+				manager.POST("/scan/resolve", labelHandler.Resolve)
 			}
 
 			// SUPERVISOR ROUTES (Warehouse Bound + Time Restricted)
@@ -170,9 +343,57 @@ func main() {
 				supervisor.POST("/item/add", itemHandler.Create)
 				supervisor.PUT("/item/update/:id", itemHandler.Update)
 				supervisor.DELETE("/item/remove/:id", itemHandler.Delete)
+				supervisor.PATCH("/item/adjust/:id", itemHandler.AdjustQuantity)
 				supervisor.GET("/items", itemHandler.List)
 				supervisor.GET("/item/:id", itemHandler.Get)
+				supervisor.GET("/item/prices/:id", itemPriceHandler.History)
+				supervisor.GET("/item/price/:id", itemPriceHandler.PriceAt)
+				supervisor.POST("/items/import", itemImportHandler.Import)
+				supervisor.GET("/items/imports/:id", itemImportHandler.Status)
+				supervisor.GET("/items/archived", itemArchiveHandler.List)
+				supervisor.GET("/sku/pattern", skuHandler.GetPattern)
+				supervisor.POST("/sku/reserve", skuHandler.Reserve)
+				supervisor.POST("/item/restore/:id", itemArchiveHandler.Restore)
+				supervisor.GET("/reports/:report", reportHandler.Generate)
+				supervisor.GET("/valuation", valuationHandler.Summary)
 				supervisor.GET("/employees", managerHandler.ListWarehouseEmployees)
+				supervisor.GET("/categories", categoryHandler.Tree)
+				supervisor.GET("/category/:id", categoryHandler.Get)
+
+				// Warehouse Layout and Bins (Own Warehouse)
+				supervisor.GET("/layout", layoutHandler.Tree)
+				supervisor.POST("/layout/create", layoutHandler.Create)
+				supervisor.PATCH("/layout/update/:id", layoutHandler.Update)
+				supervisor.DELETE("/layout/delete/:id", layoutHandler.Delete)
+				supervisor.GET("/bins/stock", layoutHandler.BinStock)
+				supervisor.GET("/bins/stock/:id", layoutHandler.BinStock)
+				supervisor.POST("/stock/putaway", layoutHandler.Putaway)
+				supervisor.POST("/stock/move", layoutHandler.Move)
+
+				// Kit Assembly (Own Warehouse)
+				supervisor.GET("/kits", kitHandler.List)
+				supervisor.GET("/kit/:id", kitHandler.Get)
+				supervisor.GET("/kit/availability/:id", kitHandler.Availability)
+				supervisor.GET("/kit/builds/:id", kitHandler.Builds)
+				supervisor.POST("/kit/assemble/:id", kitHandler.Assemble)
+				supervisor.POST("/kit/disassemble/:id", kitHandler.Disassemble)
+
+				// Quality Holds (Own Warehouse)
+				supervisor.GET("/quality/holds", qualityHandler.List)
+				supervisor.GET("/quality/hold/:id", qualityHandler.Get)
+				supervisor.POST("/quality/hold", qualityHandler.Hold)
+				supervisor.POST("/quality/inspect/:id", qualityHandler.Inspect)
+				supervisor.POST("/quality/release/:id", qualityHandler.Release)
+				supervisor.POST("/quality/scrap/:id", qualityHandler.Scrap)
+				supervisor.POST("/quality/return/:id", qualityHandler.Return)
+
+				// Labels and Scanning
+				supervisor.GET("/labels/templates", labelHandler.Templates)
+				supervisor.GET("/labels/item/:id", labelHandler.Item)
+				supervisor.GET("/labels/bin/:id", labelHandler.Location)
+				supervisor.GET("/labels/warehouse", labelHandler.Warehouse)
+				supervisor.GET("/labels/batch/:batch", labelHandler.Batch)
+				supervisor.POST("/scan/resolve", labelHandler.Resolve)
 			}
 
 			// STAFF ROUTES (Warehouse Bound + Time Restricted)
@@ -184,8 +405,32 @@ func main() {
 				staff.POST("/item/add", itemHandler.Create)
 				staff.PUT("/item/update/:id", itemHandler.Update)
 				staff.DELETE("/item/remove/:id", itemHandler.Delete)
+				staff.PATCH("/item/adjust/:id", itemHandler.AdjustQuantity)
 				staff.GET("/items", itemHandler.List)
 				staff.GET("/item/:id", itemHandler.Get)
+				staff.GET("/sku/pattern", skuHandler.GetPattern)
+				staff.POST("/sku/reserve", skuHandler.Reserve)
+				staff.GET("/categories", categoryHandler.Tree)
+				staff.GET("/category/:id", categoryHandler.Get)
+				staff.GET("/layout", layoutHandler.Tree)
+				staff.GET("/bins/stock", layoutHandler.BinStock)
+				staff.GET("/bins/stock/:id", layoutHandler.BinStock)
+				staff.POST("/stock/putaway", layoutHandler.Putaway)
+				staff.POST("/stock/move", layoutHandler.Move)
+				staff.GET("/kits", kitHandler.List)
+				staff.GET("/kit/:id", kitHandler.Get)
+				staff.GET("/kit/availability/:id", kitHandler.Availability)
+				staff.GET("/kit/builds/:id", kitHandler.Builds)
+				staff.POST("/kit/assemble/:id", kitHandler.Assemble)
+				staff.POST("/kit/disassemble/:id", kitHandler.Disassemble)
+				staff.GET("/quality/holds", qualityHandler.List)
+				staff.GET("/quality/hold/:id", qualityHandler.Get)
+				staff.POST("/quality/hold", qualityHandler.Hold)
+				staff.GET("/labels/templates", labelHandler.Templates)
+				staff.GET("/labels/item/:id", labelHandler.Item)
+				staff.GET("/labels/bin/:id", labelHandler.Location)
+				staff.GET("/labels/batch/:batch", labelHandler.Batch)
+				staff.POST("/scan/resolve", labelHandler.Resolve)
 			}
 
 			// AUDITOR ROUTES (Read Only + Time Restricted)
@@ -196,11 +441,58 @@ func main() {
 				auditor.GET("/warehouses", warehouseHandler.List)
 				auditor.GET("/items/warehouse/:id", itemHandler.List)
 				auditor.GET("/items/all", itemHandler.List)
+				auditor.GET("/items/archived", itemArchiveHandler.List)
+				auditor.GET("/item/prices/:id", itemPriceHandler.History)
+				auditor.GET("/item/price/:id", itemPriceHandler.PriceAt)
+				auditor.GET("/reports/:report", reportHandler.Generate)
+				auditor.GET("/valuation", valuationHandler.Summary)
+				auditor.GET("/categories", categoryHandler.Tree)
+				auditor.GET("/category/:id", categoryHandler.Get)
+				auditor.GET("/layout", layoutHandler.Tree)
+				auditor.GET("/bins/stock", layoutHandler.BinStock)
+				auditor.GET("/kits", kitHandler.List)
+				auditor.GET("/kit/:id", kitHandler.Get)
+				auditor.GET("/kit/availability/:id", kitHandler.Availability)
+				auditor.GET("/kit/builds/:id", kitHandler.Builds)
+				auditor.GET("/quality/holds", qualityHandler.List)
+				auditor.GET("/quality/hold/:id", qualityHandler.Get)
 				auditor.GET("/audit-logs", auditHandler.List) // View audit logs
+				auditor.GET("/audit-logs/export", auditHandler.Export)
+				auditor.GET("/audit-logs/export/public-key", auditHandler.ExportPublicKey)
+				auditor.GET("/audit-archives", retentionHandler.ListArchives)
+				auditor.GET("/audit-archives/:id/search", retentionHandler.SearchArchive)
+				auditor.GET("/security-alerts", alertHandler.List)
 			}
 
 			// Manager Audit Logs
 			manager.GET("/audit-logs", auditHandler.List)
+			manager.GET("/audit-logs/export", auditHandler.Export)
+			manager.GET("/audit-logs/export/public-key", auditHandler.ExportPublicKey)
+
+			// Manager Audit Retention
+			manager.GET("/audit-retention", retentionHandler.GetPolicy)
+			manager.PUT("/audit-retention", retentionHandler.UpdatePolicy)
+			manager.POST("/audit-retention/holds", retentionHandler.CreateHold)
+			manager.DELETE("/audit-retention/holds/:id", retentionHandler.DeleteHold)
+			manager.POST("/audit-retention/run", retentionHandler.Run)
+			manager.GET("/audit-archives", retentionHandler.ListArchives)
+			manager.GET("/audit-archives/:id/search", retentionHandler.SearchArchive)
+			manager.POST("/audit-archives/:id/restore", retentionHandler.RestoreArchive)
+
+			// Manager Security Alerts
+			manager.GET("/security-alerts", alertHandler.List)
+			manager.PATCH("/security-alerts/:id", alertHandler.Update)
+
+			// Manager Backups
+			manager.POST("/backups", backupHandler.Create)
+			manager.GET("/backups", backupHandler.List)
+			manager.GET("/backups/:id", backupHandler.Get)
+			manager.POST("/backups/:id/restore", backupHandler.Restore)
+
+			// Manager Data Export & Erasure
+			manager.GET("/data-export", privacyHandler.ExportCompany)
+			manager.GET("/employees/:id/personal-data", privacyHandler.PersonalData)
+			manager.POST("/employees/:id/erase", privacyHandler.EraseEmployee)
 		}
 	}
 
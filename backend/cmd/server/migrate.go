@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+
+	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/migrate"
+)
+
+// runMigrateCommand handles `server migrate [up|status]`
+func runMigrateCommand(args []string) {
+	runner := migrate.NewRunner(database.Database)
+	ctx := context.Background()
+
+	command := "up"
+	if len(args) > 0 {
+		command = args[0]
+	}
+
+	switch command {
+	case "up":
+		ran, err := runner.Up(ctx)
+		if err != nil {
+			log.Fatalf("Migration failed: %v", err)
+		}
+		fmt.Printf("%d migration(s) applied\n", len(ran))
+	case "status":
+		statuses, err := runner.Status(ctx)
+		if err != nil {
+			log.Fatalf("Failed to read migration status: %v", err)
+		}
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "VERSION\tAPPLIED\tDESCRIPTION")
+		for _, status := range statuses {
+			applied := "pending"
+			if status.AppliedAt != nil {
+				applied = status.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\n", status.Version, applied, status.Description)
+		}
+		w.Flush()
+	default:
+		log.Fatalf("Unknown migrate command %q, expected up or status", command)
+	}
+}
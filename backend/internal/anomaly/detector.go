@@ -0,0 +1,447 @@
+package anomaly
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/email"
+	"github.com/a2sv/safeware/internal/middleware"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Rule names
+const (
+	RuleFailedLoginBurst = "failed_login_burst"
+	RuleMassDelete       = "mass_delete"
+	RuleNewIP            = "new_ip"
+	RuleNewUserAgent     = "new_user_agent"
+	RuleAccessWindowEdge = "access_window_edge"
+)
+
+// Alert statuses
+const (
+	StatusOpen         = "open"
+	StatusAcknowledged = "acknowledged"
+	StatusResolved     = "resolved"
+)
+
+// sweepEvery controls how often idle window keys are released
+const sweepEvery = 1000
+
+// roleCacheTTL bounds how long a looked-up user role is trusted
+const roleCacheTTL = 10 * time.Minute
+
+// knownValueTTL bounds how long a user's IP or user agent is remembered before
+// the audit log is asked again; the values are client-controlled, so the
+// caches must not grow for the life of the process
+const knownValueTTL = 24 * time.Hour
+
+// Rule configures one detection rule. Window is a Go duration string.
+type Rule struct {
+	Name        string `json:"name"`
+	Enabled     bool   `json:"enabled"`
+	Threshold   int    `json:"threshold,omitempty"`
+	Window      string `json:"window,omitempty"`
+	Severity    string `json:"severity"`
+	EdgeMinutes int    `json:"edge_minutes,omitempty"` // access_window_edge only
+}
+
+// DefaultRules is the rule set used when ANOMALY_RULES does not override it
+func DefaultRules() []Rule {
+	return []Rule{
+		{Name: RuleFailedLoginBurst, Enabled: true, Threshold: 5, Window: "5m", Severity: "high"},
+		{Name: RuleMassDelete, Enabled: true, Threshold: 20, Window: "10m", Severity: "high"},
+		{Name: RuleNewIP, Enabled: true, Severity: "medium"},
+		{Name: RuleNewUserAgent, Enabled: true, Severity: "low"},
+		{Name: RuleAccessWindowEdge, Enabled: true, EdgeMinutes: 10, Window: "12h", Severity: "low"},
+	}
+}
+
+// ParseRules applies a JSON array of rule overrides, matched by name, to the defaults
+func ParseRules(raw string) ([]Rule, error) {
+	rules := DefaultRules()
+	if strings.TrimSpace(raw) == "" {
+		return rules, nil
+	}
+
+	var overrides []Rule
+	if err := json.Unmarshal([]byte(raw), &overrides); err != nil {
+		return nil, fmt.Errorf("invalid anomaly rules: %w", err)
+	}
+	for _, override := range overrides {
+		found := false
+		for i := range rules {
+			if rules[i].Name == override.Name {
+				rules[i] = override
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown anomaly rule %q", override.Name)
+		}
+	}
+	return rules, nil
+}
+
+type roleEntry struct {
+	role      string
+	fetchedAt time.Time
+}
+
+// Detector consumes audit events as they are logged, keeps sliding-window
+// counters and records security alerts. It is registered as an audit sink.
+type Detector struct {
+	rules        map[string]Rule
+	windows      map[string]*slidingWindow
+	logs         repository.AuditRepository
+	users        repository.UserRepository
+	alerts       repository.AlertRepository
+	emailService *email.EmailService
+	emailAlerts  bool
+
+	mu       sync.Mutex
+	events   int
+	knownIPs map[string]time.Time
+	knownUAs map[string]time.Time
+	roles    map[primitive.ObjectID]roleEntry
+}
+
+// NewDetector creates a detector looking up past logins in logs and recording
+// alerts in alerts; when emailAlerts is set, company Managers are emailed
+func NewDetector(rules []Rule, logs repository.AuditRepository, users repository.UserRepository, alerts repository.AlertRepository, emailService *email.EmailService, emailAlerts bool) (*Detector, error) {
+	d := &Detector{
+		rules:        make(map[string]Rule),
+		windows:      make(map[string]*slidingWindow),
+		logs:         logs,
+		users:        users,
+		alerts:       alerts,
+		emailService: emailService,
+		emailAlerts:  emailAlerts,
+		knownIPs:     make(map[string]time.Time),
+		knownUAs:     make(map[string]time.Time),
+		roles:        make(map[primitive.ObjectID]roleEntry),
+	}
+
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if rule.Window != "" {
+			window, err := time.ParseDuration(rule.Window)
+			if err != nil || window <= 0 {
+				return nil, fmt.Errorf("invalid window %q for anomaly rule %s", rule.Window, rule.Name)
+			}
+			d.windows[rule.Name] = newSlidingWindow(window)
+		}
+		d.rules[rule.Name] = rule
+	}
+
+	return d, nil
+}
+
+// Name identifies the detector in sink logs
+func (d *Detector) Name() string {
+	return "anomaly-detector"
+}
+
+// Close releases nothing; counters live in memory only
+func (d *Detector) Close() error {
+	return nil
+}
+
+// Write evaluates every enabled rule against one audit event
+func (d *Detector) Write(ctx context.Context, event *audit.Event) error {
+	entry := event.Entry
+	// Events without a company (e.g. unauthenticated requests) cannot be attributed
+	if entry.CompanyID.IsZero() {
+		return nil
+	}
+
+	d.maybeSweep(entry.CreatedAt)
+
+	if rule, ok := d.rules[RuleFailedLoginBurst]; ok {
+		d.checkFailedLogins(ctx, rule, event)
+	}
+	if rule, ok := d.rules[RuleMassDelete]; ok {
+		d.checkMassDelete(ctx, rule, event)
+	}
+	if entry.Action == "LOGIN" && entry.Status == "SUCCESS" && !entry.UserID.IsZero() {
+		if rule, ok := d.rules[RuleNewIP]; ok && entry.IPAddress != "" {
+			d.checkNewValue(ctx, rule, event, "ip_address", entry.IPAddress, d.knownIPs)
+		}
+		if rule, ok := d.rules[RuleNewUserAgent]; ok && entry.UserAgent != "" {
+			d.checkNewValue(ctx, rule, event, "user_agent", entry.UserAgent, d.knownUAs)
+		}
+	}
+	if rule, ok := d.rules[RuleAccessWindowEdge]; ok {
+		d.checkAccessWindowEdge(ctx, rule, event)
+	}
+
+	return nil
+}
+
+func (d *Detector) maybeSweep(now time.Time) {
+	d.mu.Lock()
+	d.events++
+	sweep := d.events%sweepEvery == 0
+	d.mu.Unlock()
+
+	if sweep {
+		for _, window := range d.windows {
+			window.sweep(now)
+		}
+		d.sweepCaches(time.Now())
+	}
+}
+
+// sweepCaches drops remembered login values and roles that have expired
+func (d *Detector) sweepCaches(now time.Time) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	for _, known := range []map[string]time.Time{d.knownIPs, d.knownUAs} {
+		for key, seenAt := range known {
+			if now.Sub(seenAt) >= knownValueTTL {
+				delete(known, key)
+			}
+		}
+	}
+	for userID, cached := range d.roles {
+		if now.Sub(cached.fetchedAt) >= roleCacheTTL {
+			delete(d.roles, userID)
+		}
+	}
+}
+
+// checkFailedLogins alerts on a burst of failed logins from one IP
+func (d *Detector) checkFailedLogins(ctx context.Context, rule Rule, event *audit.Event) {
+	entry := event.Entry
+	if entry.Action != "LOGIN" || (entry.Status != "FAILED" && entry.Status != "FAILURE") || entry.IPAddress == "" {
+		return
+	}
+
+	window := d.windows[rule.Name]
+	key := entry.CompanyID.Hex() + "|" + entry.IPAddress
+	hits := window.add(key, hit{at: entry.CreatedAt, eventID: entry.ID})
+	if len(hits) < rule.Threshold || !window.shouldAlert(key, entry.CreatedAt) {
+		return
+	}
+
+	d.raise(ctx, rule, event, hits,
+		"Burst of failed logins",
+		fmt.Sprintf("%d failed login attempts from %s within %s", len(hits), entry.IPAddress, rule.Window))
+}
+
+// checkMassDelete alerts when one user deletes many distinct items in a short window
+func (d *Detector) checkMassDelete(ctx context.Context, rule Rule, event *audit.Event) {
+	entry := event.Entry
+	if entry.Action != "DELETE" || entry.ResourceType != "ITEM" || entry.Status != "SUCCESS" || entry.UserID.IsZero() {
+		return
+	}
+
+	// Handlers and the audit middleware may both log a delete, so count distinct items
+	distinct := entry.ResourceID.Hex()
+	if entry.ResourceID.IsZero() {
+		distinct = entry.ID.Hex()
+	}
+
+	window := d.windows[rule.Name]
+	key := entry.CompanyID.Hex() + "|" + entry.UserID.Hex()
+	hits := window.add(key, hit{at: entry.CreatedAt, eventID: entry.ID, distinct: distinct})
+	if len(hits) < rule.Threshold || !window.shouldAlert(key, entry.CreatedAt) {
+		return
+	}
+
+	d.raise(ctx, rule, event, hits,
+		"Mass item deletion",
+		fmt.Sprintf("%s deleted %d items within %s", displayName(entry), len(hits), rule.Window))
+}
+
+// checkNewValue alerts on a successful login from an IP or user agent never seen for the user
+func (d *Detector) checkNewValue(ctx context.Context, rule Rule, event *audit.Event, field, value string, known map[string]time.Time) {
+	entry := event.Entry
+	cacheKey := entry.UserID.Hex() + "|" + value
+
+	d.mu.Lock()
+	seenAt, seen := known[cacheKey]
+	d.mu.Unlock()
+	if seen && time.Since(seenAt) < knownValueTTL {
+		return
+	}
+
+	previous := repository.AuditQuery{
+		Action:    "^LOGIN$",
+		Status:    "^SUCCESS$",
+		UserID:    entry.UserID,
+		ExcludeID: entry.ID,
+	}
+	// A user's first ever login has nothing to compare against
+	anyLogin, err := d.logs.Exists(ctx, previous)
+	if err != nil {
+		log.Printf("Anomaly detector lookup failed: %v", err)
+		return
+	}
+
+	if field == "user_agent" {
+		previous.UserAgent = value
+	} else {
+		previous.IPAddress = value
+	}
+	sameValue, err := d.logs.Exists(ctx, previous)
+	if err != nil {
+		log.Printf("Anomaly detector lookup failed: %v", err)
+		return
+	}
+
+	d.mu.Lock()
+	known[cacheKey] = time.Now()
+	d.mu.Unlock()
+
+	if !anyLogin || sameValue {
+		return
+	}
+
+	title, description := "Login from new IP address", fmt.Sprintf("%s logged in from previously unseen IP %s", displayName(entry), value)
+	if field == "user_agent" {
+		title, description = "Login from new device", fmt.Sprintf("%s logged in with previously unseen user agent %q", displayName(entry), value)
+	}
+	d.raise(ctx, rule, event, []hit{{at: entry.CreatedAt, eventID: entry.ID}}, title, description)
+}
+
+// checkAccessWindowEdge alerts on non-manager activity in the first or last minutes
+// of the TimeEnforcementMiddleware window, once per user per rule window
+func (d *Detector) checkAccessWindowEdge(ctx context.Context, rule Rule, event *audit.Event) {
+	entry := event.Entry
+	if entry.Status != "SUCCESS" || entry.UserID.IsZero() || rule.EdgeMinutes <= 0 {
+		return
+	}
+
+	local := entry.CreatedAt.In(time.Local)
+	minute := local.Hour()*60 + local.Minute()
+	start := middleware.AccessWindowStartHour * 60
+	end := middleware.AccessWindowEndHour * 60
+
+	var edge string
+	switch {
+	case minute >= start && minute < start+rule.EdgeMinutes:
+		edge = "opening"
+	case minute < end && minute >= end-rule.EdgeMinutes:
+		edge = "closing"
+	default:
+		return
+	}
+
+	if d.userRole(ctx, event) == "Manager" {
+		return
+	}
+
+	window := d.windows[rule.Name]
+	key := entry.CompanyID.Hex() + "|" + entry.UserID.Hex() + "|" + edge
+	if !window.shouldAlert(key, entry.CreatedAt) {
+		return
+	}
+
+	d.raise(ctx, rule, event, []hit{{at: entry.CreatedAt, eventID: entry.ID}},
+		"Activity at edge of access window",
+		fmt.Sprintf("%s was active at %s, within %d minutes of the access window %s",
+			displayName(entry), local.Format("15:04"), rule.EdgeMinutes, edge))
+}
+
+// userRole reads the role from login details or looks it up with a short-lived cache
+func (d *Detector) userRole(ctx context.Context, event *audit.Event) string {
+	if role, ok := event.Details["role"].(string); ok && role != "" {
+		return role
+	}
+
+	userID := event.Entry.UserID
+	d.mu.Lock()
+	cached, ok := d.roles[userID]
+	d.mu.Unlock()
+	if ok && time.Since(cached.fetchedAt) < roleCacheTTL {
+		return cached.role
+	}
+
+	user, err := d.users.GetByID(ctx, userID)
+	if err != nil {
+		return ""
+	}
+
+	d.mu.Lock()
+	d.roles[userID] = roleEntry{role: user.Role, fetchedAt: time.Now()}
+	d.mu.Unlock()
+	return user.Role
+}
+
+// raise records an alert and optionally emails the company's Managers
+func (d *Detector) raise(ctx context.Context, rule Rule, event *audit.Event, hits []hit, title, description string) {
+	entry := event.Entry
+	now := time.Now()
+
+	alert := models.SecurityAlert{
+		ID:          primitive.NewObjectID(),
+		CompanyID:   entry.CompanyID,
+		Rule:        rule.Name,
+		Severity:    rule.Severity,
+		Title:       title,
+		Description: description,
+		UserID:      entry.UserID,
+		Username:    entry.Username,
+		IPAddress:   entry.IPAddress,
+		UserAgent:   entry.UserAgent,
+		Count:       len(hits),
+		Status:      StatusOpen,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	for _, h := range hits {
+		alert.EventIDs = append(alert.EventIDs, h.eventID)
+	}
+
+	if err := d.alerts.Create(ctx, &alert); err != nil {
+		log.Printf("Error recording security alert: %v", err)
+		return
+	}
+
+	if d.emailAlerts && d.emailService != nil {
+		go d.notify(alert)
+	}
+}
+
+// notify emails every Manager of the alert's company
+func (d *Detector) notify(alert models.SecurityAlert) {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	managers, err := d.users.List(ctx, repository.UserFilter{CompanyID: alert.CompanyID, Roles: []string{"Manager"}})
+	if err != nil {
+		log.Printf("Error loading alert recipients: %v", err)
+		return
+	}
+
+	for _, manager := range managers {
+		if err := d.emailService.SendSecurityAlertEmail(manager.Email, alert.Severity, alert.Title, alert.Description); err != nil {
+			log.Printf("Error emailing security alert: %v", err)
+		}
+	}
+}
+
+// ValidStatus reports whether status is a settable alert status
+func ValidStatus(status string) bool {
+	return status == StatusOpen || status == StatusAcknowledged || status == StatusResolved
+}
+
+func displayName(entry models.AuditLog) string {
+	if entry.Username != "" {
+		return entry.Username
+	}
+	return "User " + entry.UserID.Hex()
+}
@@ -0,0 +1,35 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSweepCachesExpiresKnownValues(t *testing.T) {
+	d, err := NewDetector(nil, nil, nil, nil, nil, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	userID := primitive.NewObjectID()
+	d.knownIPs["old"] = now.Add(-knownValueTTL)
+	d.knownIPs["new"] = now
+	d.knownUAs["old"] = now.Add(-2 * knownValueTTL)
+	d.roles[userID] = roleEntry{role: "Staff", fetchedAt: now.Add(-roleCacheTTL)}
+
+	d.sweepCaches(now)
+	if _, ok := d.knownIPs["old"]; ok {
+		t.Error("expired IP kept")
+	}
+	if _, ok := d.knownIPs["new"]; !ok {
+		t.Error("fresh IP dropped")
+	}
+	if len(d.knownUAs) != 0 {
+		t.Error("expired user agent kept")
+	}
+	if len(d.roles) != 0 {
+		t.Error("expired role kept")
+	}
+}
@@ -0,0 +1,93 @@
+package anomaly
+
+import (
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// hit is one event counted by a sliding window
+type hit struct {
+	at       time.Time
+	eventID  primitive.ObjectID
+	distinct string
+}
+
+// slidingWindow counts events per key over a trailing time window. When a hit
+// carries a distinct value, repeated values inside the window are counted once.
+type slidingWindow struct {
+	mu        sync.Mutex
+	window    time.Duration
+	hits      map[string][]hit
+	lastAlert map[string]time.Time
+}
+
+func newSlidingWindow(window time.Duration) *slidingWindow {
+	return &slidingWindow{
+		window:    window,
+		hits:      make(map[string][]hit),
+		lastAlert: make(map[string]time.Time),
+	}
+}
+
+// add records a hit and returns the hits still inside the window
+func (w *slidingWindow) add(key string, h hit) []hit {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	current := w.prune(key, h.at)
+	if h.distinct != "" {
+		for _, existing := range current {
+			if existing.distinct == h.distinct {
+				return append([]hit(nil), current...)
+			}
+		}
+	}
+	current = append(current, h)
+	w.hits[key] = current
+	return append([]hit(nil), current...)
+}
+
+// shouldAlert reports whether key is out of its cooldown, and starts a new one if so.
+// The cooldown equals the window so a sustained burst raises one alert per window.
+func (w *slidingWindow) shouldAlert(key string, now time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if last, ok := w.lastAlert[key]; ok && now.Sub(last) < w.window {
+		return false
+	}
+	w.lastAlert[key] = now
+	return true
+}
+
+// sweep drops keys with no hits or cooldowns left in the window
+func (w *slidingWindow) sweep(now time.Time) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for key := range w.hits {
+		if len(w.prune(key, now)) == 0 {
+			delete(w.hits, key)
+		}
+	}
+	for key, last := range w.lastAlert {
+		if now.Sub(last) >= w.window {
+			delete(w.lastAlert, key)
+		}
+	}
+}
+
+// prune removes hits older than the window; callers hold w.mu
+func (w *slidingWindow) prune(key string, now time.Time) []hit {
+	current := w.hits[key]
+	cutoff := now.Add(-w.window)
+	i := 0
+	for i < len(current) && !current[i].at.After(cutoff) {
+		i++
+	}
+	current = current[i:]
+	w.hits[key] = current
+	return current
+}
@@ -0,0 +1,102 @@
+package anomaly
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSlidingWindowPrunesOldHits(t *testing.T) {
+	w := newSlidingWindow(time.Minute)
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	w.add("k", hit{at: start, eventID: primitive.NewObjectID()})
+	w.add("k", hit{at: start.Add(30 * time.Second), eventID: primitive.NewObjectID()})
+	if hits := w.add("k", hit{at: start.Add(50 * time.Second), eventID: primitive.NewObjectID()}); len(hits) != 3 {
+		t.Fatalf("got %d hits inside the window, want 3", len(hits))
+	}
+
+	// A hit exactly one window after the first pushes the first out
+	if hits := w.add("k", hit{at: start.Add(time.Minute), eventID: primitive.NewObjectID()}); len(hits) != 3 {
+		t.Fatalf("got %d hits after the first expired, want 3", len(hits))
+	}
+	if hits := w.add("k", hit{at: start.Add(5 * time.Minute), eventID: primitive.NewObjectID()}); len(hits) != 1 {
+		t.Fatalf("got %d hits after a quiet period, want 1", len(hits))
+	}
+	if hits := w.add("other", hit{at: start.Add(5 * time.Minute), eventID: primitive.NewObjectID()}); len(hits) != 1 {
+		t.Fatalf("keys share hits: got %d, want 1", len(hits))
+	}
+}
+
+func TestSlidingWindowCountsDistinctValuesOnce(t *testing.T) {
+	w := newSlidingWindow(time.Minute)
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		offset   time.Duration
+		distinct string
+		want     int
+	}{
+		{0, "item-1", 1},
+		{time.Second, "item-1", 1},
+		{2 * time.Second, "item-2", 2},
+		{3 * time.Second, "item-1", 2},
+		{4 * time.Second, "item-3", 3},
+		// item-1 left the window, so it counts again
+		{70 * time.Second, "item-1", 1},
+	}
+	for _, tc := range cases {
+		hits := w.add("k", hit{at: start.Add(tc.offset), eventID: primitive.NewObjectID(), distinct: tc.distinct})
+		if len(hits) != tc.want {
+			t.Errorf("after %s at %s got %d hits, want %d", tc.distinct, tc.offset, len(hits), tc.want)
+		}
+	}
+}
+
+func TestSlidingWindowCooldown(t *testing.T) {
+	w := newSlidingWindow(time.Minute)
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	cases := []struct {
+		key    string
+		offset time.Duration
+		want   bool
+	}{
+		{"k", 0, true},
+		{"k", 10 * time.Second, false},
+		{"other", 10 * time.Second, true},
+		{"k", 59 * time.Second, false},
+		{"k", time.Minute, true},
+		{"k", 90 * time.Second, false},
+	}
+	for _, tc := range cases {
+		if got := w.shouldAlert(tc.key, start.Add(tc.offset)); got != tc.want {
+			t.Errorf("shouldAlert(%s) at %s = %v, want %v", tc.key, tc.offset, got, tc.want)
+		}
+	}
+}
+
+func TestSlidingWindowSweep(t *testing.T) {
+	w := newSlidingWindow(time.Minute)
+	start := time.Date(2026, 1, 1, 9, 0, 0, 0, time.UTC)
+
+	w.add("idle", hit{at: start, eventID: primitive.NewObjectID()})
+	w.shouldAlert("idle", start)
+	w.add("busy", hit{at: start.Add(90 * time.Second), eventID: primitive.NewObjectID()})
+	w.shouldAlert("busy", start.Add(90*time.Second))
+
+	w.sweep(start.Add(2 * time.Minute))
+	if _, ok := w.hits["idle"]; ok {
+		t.Error("sweep kept the hits of an idle key")
+	}
+	if _, ok := w.lastAlert["idle"]; ok {
+		t.Error("sweep kept the cooldown of an idle key")
+	}
+	if len(w.hits["busy"]) != 1 {
+		t.Error("sweep dropped a hit still inside the window")
+	}
+	if _, ok := w.lastAlert["busy"]; !ok {
+		t.Error("sweep dropped a running cooldown")
+	}
+}
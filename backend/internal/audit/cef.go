@@ -0,0 +1,85 @@
+package audit
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	cefVendor  = "SafeWare"
+	cefProduct = "SafeWare"
+	cefVersion = "1.0"
+)
+
+var (
+	cefHeaderEscaper    = strings.NewReplacer(`\`, `\\`, `|`, `\|`, "\r", " ", "\n", " ")
+	cefExtensionEscaper = strings.NewReplacer(`\`, `\\`, `=`, `\=`, "\r", `\r`, "\n", `\n`)
+)
+
+// FormatCEFEntry renders a decrypted log entry as an ArcSight CEF line
+func FormatCEFEntry(entry map[string]interface{}) string {
+	action := stringValue(entry["action"])
+	resourceType := stringValue(entry["resource_type"])
+	status := stringValue(entry["status"])
+
+	name := strings.TrimSpace(action + " " + resourceType)
+	header := fmt.Sprintf("CEF:0|%s|%s|%s|%s|%s|%d|",
+		cefHeaderEscaper.Replace(cefVendor),
+		cefHeaderEscaper.Replace(cefProduct),
+		cefHeaderEscaper.Replace(cefVersion),
+		cefHeaderEscaper.Replace(action),
+		cefHeaderEscaper.Replace(name),
+		cefSeverity(action, status),
+	)
+
+	ext := []string{}
+	add := func(key, value string) {
+		if value != "" {
+			ext = append(ext, key+"="+cefExtensionEscaper.Replace(value))
+		}
+	}
+
+	if ts, ok := entry["timestamp"].(time.Time); ok {
+		add("rt", fmt.Sprint(ts.UnixMilli()))
+	}
+	add("externalId", stringValue(entry["id"]))
+	add("suid", stringValue(entry["user_id"]))
+	add("suser", stringValue(entry["username"]))
+	add("src", stringValue(entry["ip_address"]))
+	add("requestClientApplication", stringValue(entry["user_agent"]))
+	add("act", action)
+	add("outcome", status)
+	if resourceType != "" {
+		add("cs1Label", "resourceType")
+		add("cs1", resourceType)
+	}
+	if resourceID := stringValue(entry["resource_id"]); resourceID != "" {
+		add("cs2Label", "resourceId")
+		add("cs2", resourceID)
+	}
+	if details, ok := entry["details"]; ok {
+		if b, err := json.Marshal(details); err == nil {
+			add("cs3Label", "details")
+			add("cs3", string(b))
+		}
+	}
+
+	return header + strings.Join(ext, " ")
+}
+
+// cefSeverity maps an action outcome to the CEF 0-10 severity scale
+func cefSeverity(action, status string) int {
+	failed := status == "FAILURE" || status == "FAILED"
+	switch {
+	case failed && action == "LOGIN":
+		return 7
+	case failed:
+		return 5
+	case action == "DELETE":
+		return 4
+	default:
+		return 2
+	}
+}
@@ -0,0 +1,279 @@
+package audit
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Export formats
+const (
+	FormatCSV   = "csv"
+	FormatJSONL = "jsonl"
+	FormatCEF   = "cef"
+)
+
+var ErrUnsupportedFormat = errors.New("unsupported export format")
+
+var formatExtensions = map[string]string{
+	FormatCSV:   "csv",
+	FormatJSONL: "jsonl",
+	FormatCEF:   "cef",
+}
+
+var csvHeader = []string{
+	"id", "timestamp", "user_id", "username", "action", "resource_type",
+	"resource_id", "status", "ip_address", "user_agent", "details",
+}
+
+// ExportManifest describes an export archive. It is signed as a whole, so the
+// data file hash and record count cannot be altered without detection.
+type ExportManifest struct {
+	CompanyID     string            `json:"company_id"`
+	Format        string            `json:"format"`
+	DataFile      string            `json:"data_file"`
+	RecordCount   int64             `json:"record_count"`
+	SHA256        string            `json:"sha256"`
+	Filter        map[string]string `json:"filter"`
+	GeneratedAt   time.Time         `json:"generated_at"`
+	GeneratedBy   string            `json:"generated_by"`
+	SignAlgorithm string            `json:"sign_algorithm"`
+}
+
+// Exporter streams audit logs into signed evidence archives
+type Exporter struct {
+	service    *AuditService
+	privateKey ed25519.PrivateKey
+}
+
+// NewExporter creates an exporter signing with an Ed25519 key.
+// signingKey is a 32-byte seed in hex or base64; any other value is hashed into a seed.
+// An empty value derives the seed from the audit encryption key, so anyone holding
+// that key can also sign exports; a warning is logged when that happens.
+func NewExporter(service *AuditService, signingKey string) *Exporter {
+	var seed []byte
+	switch {
+	case signingKey == "":
+		log.Printf("Warning: AUDIT_SIGNING_KEY is not set; audit exports are signed with a key derived from the audit encryption key. Set a dedicated signing key before relying on export signatures.")
+		sum := sha256.Sum256(append([]byte("safeware-audit-export:"), service.encryptionKey...))
+		seed = sum[:]
+	default:
+		if decoded, err := hex.DecodeString(signingKey); err == nil && len(decoded) == ed25519.SeedSize {
+			seed = decoded
+		} else if decoded, err := base64.StdEncoding.DecodeString(signingKey); err == nil && len(decoded) == ed25519.SeedSize {
+			seed = decoded
+		} else {
+			sum := sha256.Sum256([]byte(signingKey))
+			seed = sum[:]
+		}
+	}
+
+	return &Exporter{
+		service:    service,
+		privateKey: ed25519.NewKeyFromSeed(seed),
+	}
+}
+
+// PublicKey returns the base64 Ed25519 key used to verify export signatures.
+// It is published through the API and never written into an archive: a key
+// shipped alongside the signature would verify a forged archive just as well.
+func (e *Exporter) PublicKey() string {
+	return base64.StdEncoding.EncodeToString(e.privateKey.Public().(ed25519.PublicKey))
+}
+
+// ValidFormat reports whether format is a supported export format
+func ValidFormat(format string) bool {
+	_, ok := formatExtensions[format]
+	return ok
+}
+
+// Export writes a zip archive to w containing the data file, manifest.json and
+// manifest.sig (detached base64 Ed25519 signature over manifest.json).
+// Records are streamed in chronological order.
+func (e *Exporter) Export(ctx context.Context, w io.Writer, companyID primitive.ObjectID, filter map[string]interface{}, format, generatedBy string) (*ExportManifest, error) {
+	ext, ok := formatExtensions[format]
+	if !ok {
+		return nil, ErrUnsupportedFormat
+	}
+
+	archive := zip.NewWriter(w)
+	dataFile := "audit-logs." + ext
+	dataWriter, err := archive.Create(dataFile)
+	if err != nil {
+		return nil, err
+	}
+
+	hasher := sha256.New()
+	out := io.MultiWriter(dataWriter, hasher)
+	recordWriter := newRecordWriter(format, out)
+
+	var count int64
+	err = e.service.repo.Each(ctx, logQuery(companyID, filter), func(logEntry models.AuditLog) error {
+		count++
+		return recordWriter.write(e.service.entryMap(logEntry))
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := recordWriter.flush(); err != nil {
+		return nil, err
+	}
+
+	manifest := &ExportManifest{
+		CompanyID:     companyID.Hex(),
+		Format:        format,
+		DataFile:      dataFile,
+		RecordCount:   count,
+		SHA256:        hex.EncodeToString(hasher.Sum(nil)),
+		Filter:        stringFilter(filter),
+		GeneratedAt:   time.Now().UTC(),
+		GeneratedBy:   generatedBy,
+		SignAlgorithm: "Ed25519",
+	}
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(archive, "manifest.json", manifestBytes); err != nil {
+		return nil, err
+	}
+
+	signature := ed25519.Sign(e.privateKey, manifestBytes)
+	if err := writeZipFile(archive, "manifest.sig", []byte(base64.StdEncoding.EncodeToString(signature))); err != nil {
+		return nil, err
+	}
+
+	return manifest, archive.Close()
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
+
+func stringFilter(filter map[string]interface{}) map[string]string {
+	result := make(map[string]string)
+	for key, value := range filter {
+		if s, ok := value.(string); ok && s != "" {
+			result[key] = s
+		}
+	}
+	return result
+}
+
+// recordWriter encodes decrypted log entries in one export format
+type recordWriter struct {
+	format        string
+	out           io.Writer
+	csv           *csv.Writer
+	headerWritten bool
+}
+
+func newRecordWriter(format string, out io.Writer) *recordWriter {
+	rw := &recordWriter{format: format, out: out}
+	if format == FormatCSV {
+		rw.csv = csv.NewWriter(out)
+	}
+	return rw
+}
+
+func (rw *recordWriter) write(entry map[string]interface{}) error {
+	switch rw.format {
+	case FormatCSV:
+		if err := rw.writeCSVHeader(); err != nil {
+			return err
+		}
+		return rw.csv.Write(csvRecord(entry))
+	case FormatJSONL:
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		_, err = rw.out.Write(append(line, '\n'))
+		return err
+	case FormatCEF:
+		_, err := io.WriteString(rw.out, FormatCEFEntry(entry)+"\n")
+		return err
+	}
+	return ErrUnsupportedFormat
+}
+
+// writeCSVHeader emits the header once, before the first record
+func (rw *recordWriter) writeCSVHeader() error {
+	if rw.headerWritten {
+		return nil
+	}
+	rw.headerWritten = true
+	return rw.csv.Write(csvHeader)
+}
+
+func (rw *recordWriter) flush() error {
+	if rw.csv == nil {
+		return nil
+	}
+	// An empty export still carries the header row
+	if err := rw.writeCSVHeader(); err != nil {
+		return err
+	}
+	rw.csv.Flush()
+	return rw.csv.Error()
+}
+
+func csvRecord(entry map[string]interface{}) []string {
+	details := ""
+	if d, ok := entry["details"]; ok {
+		if b, err := json.Marshal(d); err == nil {
+			details = string(b)
+		}
+	}
+
+	return []string{
+		stringValue(entry["id"]),
+		stringValue(entry["timestamp"]),
+		stringValue(entry["user_id"]),
+		stringValue(entry["username"]),
+		stringValue(entry["action"]),
+		stringValue(entry["resource_type"]),
+		stringValue(entry["resource_id"]),
+		stringValue(entry["status"]),
+		stringValue(entry["ip_address"]),
+		stringValue(entry["user_agent"]),
+		details,
+	}
+}
+
+func stringValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case primitive.ObjectID:
+		if v.IsZero() {
+			return ""
+		}
+		return v.Hex()
+	case time.Time:
+		return v.UTC().Format(time.RFC3339Nano)
+	default:
+		return fmt.Sprint(v)
+	}
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"os"
+
+	"github.com/a2sv/safeware/internal/cryptoutil"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RotationResult counts what a key rotation rewrote
+type RotationResult struct {
+	Rewritten int64 `json:"rewritten"`
+	// Current were already encrypted with the new key, e.g. by an earlier interrupted run
+	Current int64 `json:"current"`
+	// Unreadable opened with neither key and were left untouched
+	Unreadable []primitive.ObjectID `json:"unreadable,omitempty"`
+}
+
+// RotateKey re-encrypts every entry's details from oldKey to the service's current key
+func (s *AuditService) RotateKey(ctx context.Context, oldKey string) (*RotationResult, error) {
+	previous := normalizeKey(oldKey)
+	result := &RotationResult{}
+	err := s.repo.Each(ctx, repository.AuditQuery{}, func(entry models.AuditLog) error {
+		if entry.DetailsEncrypted == "" {
+			return nil
+		}
+		sealed, err := base64.StdEncoding.DecodeString(entry.DetailsEncrypted)
+		if err != nil {
+			result.Unreadable = append(result.Unreadable, entry.ID)
+			return nil
+		}
+
+		plaintext, err := cryptoutil.Open(previous, sealed)
+		if err != nil {
+			if _, err := cryptoutil.Open(s.encryptionKey, sealed); err == nil {
+				result.Current++
+			} else {
+				result.Unreadable = append(result.Unreadable, entry.ID)
+			}
+			return nil
+		}
+
+		encrypted, err := s.encrypt(plaintext)
+		if err != nil {
+			return err
+		}
+		if err := s.repo.Update(ctx, entry.ID, repository.AuditUpdate{DetailsEncrypted: &encrypted}); err != nil {
+			return err
+		}
+		result.Rewritten++
+		return nil
+	})
+	return result, err
+}
+
+// RotateKey re-encrypts every cold-storage archive from the key derived from
+// oldArchiveKey (or oldAuditKey when that is empty) to the current archive key
+func (r *RetentionService) RotateKey(ctx context.Context, oldArchiveKey, oldAuditKey string) (*RotationResult, error) {
+	previous := deriveArchiveKey(oldArchiveKey, normalizeKey(oldAuditKey))
+	archives, err := r.repo.ListArchives(ctx, repository.ArchiveFilter{})
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RotationResult{}
+	for i := range archives {
+		archive := &archives[i]
+		sealed, err := os.ReadFile(archive.FilePath)
+		if err != nil {
+			result.Unreadable = append(result.Unreadable, archive.ID)
+			continue
+		}
+
+		compressed, err := cryptoutil.Open(previous, sealed)
+		if err != nil {
+			if _, err := cryptoutil.Open(r.archiveKey, sealed); err == nil {
+				result.Current++
+			} else {
+				result.Unreadable = append(result.Unreadable, archive.ID)
+			}
+			continue
+		}
+
+		resealed, err := cryptoutil.Seal(r.archiveKey, compressed)
+		if err != nil {
+			return result, err
+		}
+		if err := writeFileAtomic(archive.FilePath, resealed); err != nil {
+			return result, err
+		}
+		sum := sha256.Sum256(resealed)
+		archive.SHA256 = hex.EncodeToString(sum[:])
+		archive.FileSize = int64(len(resealed))
+		if err := r.repo.SaveArchive(ctx, archive); err != nil {
+			return result, err
+		}
+		result.Rewritten++
+	}
+	return result, nil
+}
+
+// CheckReport summarizes an integrity check of stored audit data
+type CheckReport struct {
+	Entries int64 `json:"entries"`
+	// Undecryptable entries have details that fail AES-GCM authentication:
+	// they were altered or written with a different key
+	Undecryptable    []primitive.ObjectID `json:"undecryptable,omitempty"`
+	Archives         int                  `json:"archives"`
+	MissingArchives  []primitive.ObjectID `json:"missing_archives,omitempty"`
+	TamperedArchives []primitive.ObjectID `json:"tampered_archives,omitempty"`
+}
+
+// OK reports whether no problem was found
+func (v *CheckReport) OK() bool {
+	return len(v.Undecryptable) == 0 && len(v.MissingArchives) == 0 && len(v.TamperedArchives) == 0
+}
+
+// Check authenticates the encrypted details of every live entry and checks
+// each archive against its recorded checksum and key. A zero companyID checks
+// all companies. It detects altered entries and archives, not removed ones:
+// entries are not hash-chained, since erasure and key rotation rewrite them
+// and retention deletes them.
+func (r *RetentionService) Check(ctx context.Context, companyID primitive.ObjectID) (*CheckReport, error) {
+	report := &CheckReport{}
+	err := r.auditService.repo.Each(ctx, repository.AuditQuery{CompanyID: companyID}, func(entry models.AuditLog) error {
+		report.Entries++
+		if entry.DetailsEncrypted == "" {
+			return nil
+		}
+		if _, err := r.auditService.Decrypt(entry.DetailsEncrypted); err != nil {
+			report.Undecryptable = append(report.Undecryptable, entry.ID)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	archives, err := r.repo.ListArchives(ctx, repository.ArchiveFilter{CompanyID: companyID})
+	if err != nil {
+		return nil, err
+	}
+	for _, archive := range archives {
+		report.Archives++
+		_, _, err := r.readArchive(ctx, archive.CompanyID, archive.ID)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+			report.MissingArchives = append(report.MissingArchives, archive.ID)
+		case err != nil:
+			report.TamperedArchives = append(report.TamperedArchives, archive.ID)
+		}
+	}
+	return report, nil
+}
@@ -0,0 +1,53 @@
+package audit
+
+import (
+	"context"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestRotateKeyReencryptsDetails(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	ctx := context.Background()
+	company := primitive.NewObjectID()
+
+	old := NewAuditService("old-key", repos.Audit)
+	old.LogAction(ctx, primitive.NewObjectID(), company, "ana", "CREATE", "ITEM", nil, map[string]interface{}{"sku": "SKU-1"}, "", "", "SUCCESS")
+	old.LogAction(ctx, primitive.NewObjectID(), company, "ana", "LOGIN", "USER", nil, nil, "", "", "SUCCESS")
+	old.Close()
+
+	current := NewAuditService("new-key", repos.Audit)
+	defer current.Close()
+	result, err := current.RotateKey(ctx, "old-key")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Rewritten != 1 || result.Current != 0 || len(result.Unreadable) != 0 {
+		t.Fatalf("unexpected first rotation: %+v", result)
+	}
+
+	// An interrupted run can be repeated
+	if result, err = current.RotateKey(ctx, "old-key"); err != nil {
+		t.Fatal(err)
+	}
+	if result.Rewritten != 0 || result.Current != 1 {
+		t.Errorf("unexpected second rotation: %+v", result)
+	}
+
+	err = repos.Audit.Each(ctx, repository.AuditQuery{Action: "^CREATE$"}, func(entry models.AuditLog) error {
+		details, err := current.Decrypt(entry.DetailsEncrypted)
+		if err != nil {
+			return err
+		}
+		if details["sku"] != "SKU-1" {
+			t.Errorf("unexpected details: %v", details)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
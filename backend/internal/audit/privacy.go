@@ -0,0 +1,118 @@
+package audit
+
+import (
+	"context"
+	"crypto/ed25519"
+	"encoding/json"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// EachLog streams a company's decrypted log entries in chronological order
+func (s *AuditService) EachLog(ctx context.Context, companyID primitive.ObjectID, filter map[string]interface{}, fn func(entry map[string]interface{}) error) error {
+	return s.repo.Each(ctx, logQuery(companyID, filter), func(logEntry models.AuditLog) error {
+		return fn(s.entryMap(logEntry))
+	})
+}
+
+// Usernames returns the usernames a user's entries in the company were logged under
+func (s *AuditService) Usernames(ctx context.Context, companyID, userID primitive.ObjectID) ([]string, error) {
+	return s.repo.Usernames(ctx, companyID, userID)
+}
+
+// Pseudonymize replaces a user's identifiers (name, email, ...) with aliases in
+// every audit entry that mentions them, including inside encrypted details.
+// Entries keep their IDs, actions, resources and timestamps, so the trail stays intact.
+// It returns how many entries were rewritten.
+func (s *AuditService) Pseudonymize(ctx context.Context, companyID, userID primitive.ObjectID, aliases map[string]string, usernameAlias string) (int64, error) {
+	var updated int64
+	err := s.repo.Each(ctx, repository.AuditQuery{CompanyID: companyID}, func(logEntry models.AuditLog) error {
+		if logEntry.UserID != userID && logEntry.ResourceID != userID && aliases[logEntry.Username] == "" {
+			return nil
+		}
+
+		var update repository.AuditUpdate
+		if logEntry.UserID == userID || aliases[logEntry.Username] != "" {
+			if logEntry.Username != usernameAlias {
+				update.Username = &usernameAlias
+			}
+		}
+		if logEntry.DetailsEncrypted != "" {
+			details, err := s.Decrypt(logEntry.DetailsEncrypted)
+			if err == nil {
+				if changed := replaceIdentifiers(details, aliases); changed {
+					plaintext, err := json.Marshal(details)
+					if err != nil {
+						return err
+					}
+					encrypted, err := s.encrypt(plaintext)
+					if err != nil {
+						return err
+					}
+					update.DetailsEncrypted = &encrypted
+				}
+			}
+		}
+		if update.Username == nil && update.DetailsEncrypted == nil {
+			return nil
+		}
+
+		if err := s.repo.Update(ctx, logEntry.ID, update); err != nil {
+			return err
+		}
+		updated++
+		return nil
+	})
+	return updated, err
+}
+
+// replaceIdentifiers rewrites string values in details that contain an identifier
+func replaceIdentifiers(value interface{}, aliases map[string]string) bool {
+	changed := false
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, item := range v {
+			if s, ok := item.(string); ok {
+				if replaced := replaceAll(s, aliases); replaced != s {
+					v[key] = replaced
+					changed = true
+				}
+				continue
+			}
+			if replaceIdentifiers(item, aliases) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if s, ok := item.(string); ok {
+				if replaced := replaceAll(s, aliases); replaced != s {
+					v[i] = replaced
+					changed = true
+				}
+				continue
+			}
+			if replaceIdentifiers(item, aliases) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+func replaceAll(s string, aliases map[string]string) string {
+	for identifier, alias := range aliases {
+		if identifier != "" {
+			s = strings.ReplaceAll(s, identifier, alias)
+		}
+	}
+	return s
+}
+
+// Sign returns a detached Ed25519 signature over data with the export key
+func (e *Exporter) Sign(data []byte) []byte {
+	return ed25519.Sign(e.privateKey, data)
+}
@@ -0,0 +1,428 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/a2sv/safeware/internal/cryptoutil"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// archiveBatchSize bounds how many entries go into one archive file
+const archiveBatchSize = 5000
+
+var (
+	ErrArchiveNotFound  = errors.New("audit archive not found")
+	ErrHoldNotFound     = errors.New("legal hold not found")
+	ErrArchiveTampered  = errors.New("audit archive checksum mismatch")
+	ErrInvalidRetention = errors.New("retention days must not be negative")
+)
+
+// RetentionService moves expired audit logs into encrypted cold storage
+type RetentionService struct {
+	auditService *AuditService
+	repo         repository.AuditRetentionRepository
+	archivePath  string
+	archiveKey   []byte
+}
+
+// NewRetentionService creates a retention service keeping policies and the
+// archive index in repo and writing archives under archivePath. An empty
+// archiveKey derives the archive key from the audit encryption key.
+func NewRetentionService(auditService *AuditService, repo repository.AuditRetentionRepository, archivePath, archiveKey string) *RetentionService {
+	if archivePath == "" {
+		archivePath = "audit-archives"
+	}
+
+	return &RetentionService{
+		auditService: auditService,
+		repo:         repo,
+		archivePath:  archivePath,
+		archiveKey:   deriveArchiveKey(archiveKey, auditService.encryptionKey),
+	}
+}
+
+func deriveArchiveKey(archiveKey string, auditKey []byte) []byte {
+	if archiveKey == "" {
+		return cryptoutil.DeriveKey(string(auditKey), "audit-archive")
+	}
+	return cryptoutil.DeriveKey(archiveKey, "audit-archive")
+}
+
+// GetPolicy returns the company's retention policy, or a keep-forever default
+func (r *RetentionService) GetPolicy(ctx context.Context, companyID primitive.ObjectID) (*models.AuditRetentionPolicy, error) {
+	policy, err := r.repo.Policy(ctx, companyID)
+	if err == repository.ErrNotFound {
+		return &models.AuditRetentionPolicy{CompanyID: companyID}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return policy, nil
+}
+
+// SetPolicy updates the retention period and company-wide legal hold
+func (r *RetentionService) SetPolicy(ctx context.Context, companyID primitive.ObjectID, retentionDays int, legalHold bool, reason string, updatedBy primitive.ObjectID) (*models.AuditRetentionPolicy, error) {
+	if retentionDays < 0 {
+		return nil, ErrInvalidRetention
+	}
+
+	err := r.repo.SetPolicy(ctx, &models.AuditRetentionPolicy{
+		CompanyID:       companyID,
+		RetentionDays:   retentionDays,
+		LegalHold:       legalHold,
+		LegalHoldReason: reason,
+		UpdatedBy:       updatedBy,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r.GetPolicy(ctx, companyID)
+}
+
+// AddHold places a scoped legal hold on the company's audit logs
+func (r *RetentionService) AddHold(ctx context.Context, companyID primitive.ObjectID, hold models.LegalHold) (*models.LegalHold, error) {
+	hold.ID = primitive.NewObjectID()
+	hold.CreatedAt = time.Now()
+	if err := r.repo.AddHold(ctx, companyID, hold); err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// RemoveHold lifts a scoped legal hold
+func (r *RetentionService) RemoveHold(ctx context.Context, companyID, holdID primitive.ObjectID) error {
+	err := r.repo.RemoveHold(ctx, companyID, holdID)
+	if err == repository.ErrNotFound {
+		return ErrHoldNotFound
+	}
+	return err
+}
+
+// Start runs the retention job on a fixed interval until ctx is cancelled
+func (r *RetentionService) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = 24 * time.Hour
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := r.RunAll(ctx); err != nil {
+			log.Printf("Audit retention run failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunAll applies retention for every company with a finite retention period
+func (r *RetentionService) RunAll(ctx context.Context) error {
+	policies, err := r.repo.Expiring(ctx)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if _, err := r.Run(ctx, policy.CompanyID); err != nil {
+			log.Printf("Audit retention failed for company %s: %v", policy.CompanyID.Hex(), err)
+		}
+	}
+	return nil
+}
+
+// Run archives and purges the company's expired audit logs, returning how many moved
+func (r *RetentionService) Run(ctx context.Context, companyID primitive.ObjectID) (int, error) {
+	policy, err := r.GetPolicy(ctx, companyID)
+	if err != nil {
+		return 0, err
+	}
+	if policy.RetentionDays <= 0 || policy.LegalHold {
+		return 0, nil
+	}
+
+	for _, hold := range policy.Holds {
+		if hold.UserID.IsZero() && hold.ResourceID.IsZero() && hold.FromDate == nil && hold.ToDate == nil {
+			// An unscoped hold covers everything
+			return 0, nil
+		}
+	}
+
+	cutoff := time.Now().AddDate(0, 0, -policy.RetentionDays)
+	total := 0
+	for {
+		entries, err := r.auditService.repo.Expired(ctx, companyID, cutoff, policy.Holds, archiveBatchSize)
+		if err != nil {
+			return total, err
+		}
+		if len(entries) == 0 {
+			break
+		}
+
+		archive, err := r.writeArchive(ctx, companyID, entries)
+		if err != nil {
+			return total, err
+		}
+
+		// Only purge once the archive is durable and indexed
+		ids := make([]primitive.ObjectID, len(entries))
+		for i, entry := range entries {
+			ids[i] = entry.ID
+		}
+		if err := r.auditService.repo.Delete(ctx, ids); err != nil {
+			return total, err
+		}
+
+		total += len(entries)
+		r.auditService.LogAction(ctx, primitive.NilObjectID, companyID, "system", "ARCHIVE", "AUDIT_LOG", &archive.ID,
+			map[string]interface{}{
+				"record_count": archive.RecordCount,
+				"from_date":    archive.FromDate,
+				"to_date":      archive.ToDate,
+				"sha256":       archive.SHA256,
+			}, "", "", "SUCCESS")
+
+		if len(entries) < archiveBatchSize {
+			break
+		}
+	}
+
+	if err := r.repo.SetLastRun(ctx, companyID, time.Now()); err != nil {
+		return total, err
+	}
+	return total, nil
+}
+
+// writeArchive stores entries as gzip-compressed, AES-GCM encrypted extended JSON lines
+func (r *RetentionService) writeArchive(ctx context.Context, companyID primitive.ObjectID, entries []models.AuditLog) (*models.AuditArchive, error) {
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+
+	actions := map[string]bool{}
+	users := map[primitive.ObjectID]bool{}
+	for _, entry := range entries {
+		line, err := bson.MarshalExtJSON(entry, true, false)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := gz.Write(append(line, '\n')); err != nil {
+			return nil, err
+		}
+		actions[entry.Action] = true
+		if !entry.UserID.IsZero() {
+			users[entry.UserID] = true
+		}
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+
+	sealed, err := cryptoutil.Seal(r.archiveKey, compressed.Bytes())
+	if err != nil {
+		return nil, err
+	}
+
+	archive := models.AuditArchive{
+		ID:          primitive.NewObjectID(),
+		CompanyID:   companyID,
+		FileSize:    int64(len(sealed)),
+		RecordCount: len(entries),
+		FromDate:    entries[0].CreatedAt,
+		ToDate:      entries[len(entries)-1].CreatedAt,
+		CreatedAt:   time.Now(),
+	}
+	sum := sha256.Sum256(sealed)
+	archive.SHA256 = hex.EncodeToString(sum[:])
+	for action := range actions {
+		archive.Actions = append(archive.Actions, action)
+	}
+	sort.Strings(archive.Actions)
+	for userID := range users {
+		archive.UserIDs = append(archive.UserIDs, userID)
+	}
+
+	dir := filepath.Join(r.archivePath, companyID.Hex())
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	archive.FilePath = filepath.Join(dir, fmt.Sprintf("audit-%s-%s.jsonl.gz.enc",
+		archive.FromDate.UTC().Format("20060102T150405Z"), archive.ID.Hex()))
+
+	if err := writeFileAtomic(archive.FilePath, sealed); err != nil {
+		return nil, err
+	}
+
+	if err := r.repo.AddArchive(ctx, &archive); err != nil {
+		os.Remove(archive.FilePath)
+		return nil, err
+	}
+
+	return &archive, nil
+}
+
+// writeFileAtomic writes to a temp file, syncs it and renames it into place
+func writeFileAtomic(path string, data []byte) error {
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// ListArchives returns the archive index for a company, optionally overlapping a date range
+func (r *RetentionService) ListArchives(ctx context.Context, companyID primitive.ObjectID, filter map[string]interface{}) ([]models.AuditArchive, error) {
+	query := repository.ArchiveFilter{CompanyID: companyID}
+	if fromStr, ok := filter["from_date"].(string); ok && fromStr != "" {
+		if from, err := time.Parse(time.RFC3339, fromStr); err == nil {
+			query.From = &from
+		}
+	}
+	if toStr, ok := filter["to_date"].(string); ok && toStr != "" {
+		if to, err := time.Parse(time.RFC3339, toStr); err == nil {
+			query.To = &to
+		}
+	}
+	if action, ok := filter["action"].(string); ok {
+		query.Action = action
+	}
+	if userID, ok := filter["user_id"].(string); ok && userID != "" {
+		if oid, err := primitive.ObjectIDFromHex(userID); err == nil {
+			query.UserID = oid
+		}
+	}
+	return r.repo.ListArchives(ctx, query)
+}
+
+// SearchArchive decrypts an archive and returns the entries matching filter
+func (r *RetentionService) SearchArchive(ctx context.Context, companyID, archiveID primitive.ObjectID, filter map[string]interface{}) ([]map[string]interface{}, error) {
+	_, entries, err := r.readArchive(ctx, companyID, archiveID)
+	if err != nil {
+		return nil, err
+	}
+
+	matches, err := logQuery(companyID, filter).Matcher()
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]map[string]interface{}, 0)
+	for _, entry := range entries {
+		if matches(entry) {
+			result = append(result, r.auditService.entryMap(entry))
+		}
+	}
+	return result, nil
+}
+
+// RestoreArchive reinserts an archive's entries into audit_logs. A legal hold over the
+// archive's date range is placed so the next retention run does not archive them again.
+func (r *RetentionService) RestoreArchive(ctx context.Context, companyID, archiveID, restoredBy primitive.ObjectID) (int, error) {
+	archive, entries, err := r.readArchive(ctx, companyID, archiveID)
+	if err != nil {
+		return 0, err
+	}
+
+	from, to := archive.FromDate, archive.ToDate
+	if _, err := r.AddHold(ctx, companyID, models.LegalHold{
+		Reason:    "Restored from archive " + archive.ID.Hex(),
+		FromDate:  &from,
+		ToDate:    &to,
+		CreatedBy: restoredBy,
+	}); err != nil {
+		return 0, err
+	}
+
+	// Entries already present (e.g. a repeated restore) are skipped
+	restored, err := r.auditService.repo.Restore(ctx, entries)
+	if err != nil {
+		return 0, err
+	}
+
+	now := time.Now()
+	archive.RestoredAt = &now
+	if err := r.repo.SaveArchive(ctx, archive); err != nil {
+		return restored, err
+	}
+	return restored, nil
+}
+
+// readArchive loads, verifies and decodes an archive file
+func (r *RetentionService) readArchive(ctx context.Context, companyID, archiveID primitive.ObjectID) (*models.AuditArchive, []models.AuditLog, error) {
+	archive, err := r.repo.GetArchive(ctx, companyID, archiveID)
+	if err == repository.ErrNotFound {
+		return nil, nil, ErrArchiveNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	sealed, err := os.ReadFile(archive.FilePath)
+	if err != nil {
+		return nil, nil, err
+	}
+	sum := sha256.Sum256(sealed)
+	if hex.EncodeToString(sum[:]) != archive.SHA256 {
+		return nil, nil, ErrArchiveTampered
+	}
+
+	compressed, err := cryptoutil.Open(r.archiveKey, sealed)
+	if err != nil {
+		return nil, nil, err
+	}
+	gz, err := gzip.NewReader(bytes.NewReader(compressed))
+	if err != nil {
+		return nil, nil, err
+	}
+	defer gz.Close()
+
+	entries := make([]models.AuditLog, 0, archive.RecordCount)
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var entry models.AuditLog
+		if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &entry); err != nil {
+			return nil, nil, err
+		}
+		entries = append(entries, entry)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	return archive, entries, nil
+}
@@ -2,49 +2,41 @@ package audit
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
-	"crypto/rand"
 	"encoding/base64"
 	"encoding/json"
-	"errors"
-	"io"
 	"log"
+	"sync"
 	"time"
 
-	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/cryptoutil"
 	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo/options"
 )
 
 type AuditService struct {
 	encryptionKey []byte
+	repo          repository.AuditRepository
+	sinks         sinkSet
+	pending       sync.WaitGroup
 }
 
-// NewAuditService creates a new audit service
+// NewAuditService creates a new audit service storing entries in repo
 // key must be 32 bytes for AES-256
-func NewAuditService(key string) *AuditService {
-	// Ensure key is 32 bytes, pad or trim if necessary (for MVP simplicity)
-	// In production, this should be validated strictly
-	keyBytes := []byte(key)
-	if len(keyBytes) < 32 {
-		padded := make([]byte, 32)
-		copy(padded, keyBytes)
-		keyBytes = padded
-	} else if len(keyBytes) > 32 {
-		keyBytes = keyBytes[:32]
-	}
-
+func NewAuditService(key string, repo repository.AuditRepository) *AuditService {
 	return &AuditService{
-		encryptionKey: keyBytes,
+		encryptionKey: normalizeKey(key),
+		repo:          repo,
 	}
 }
 
 // LogAction records an action asynchronously
 func (s *AuditService) LogAction(ctx context.Context, actorID, companyID primitive.ObjectID, username, action, resourceType string, resourceID *primitive.ObjectID, details map[string]interface{}, ip, userAgent string, status string) {
 	// Run in goroutine to not block the main request
+	s.pending.Add(1)
 	go func() {
+		defer s.pending.Done()
+
 		// Create a detached context with timeout for the background operation
 		bgCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -80,32 +72,46 @@ func (s *AuditService) LogAction(ctx context.Context, actorID, companyID primiti
 			logEntry.ResourceID = *resourceID
 		}
 
-		collection := database.GetCollection("audit_logs")
-		_, err := collection.InsertOne(bgCtx, logEntry)
-		if err != nil {
+		if err := s.repo.Insert(bgCtx, &logEntry); err != nil {
 			log.Printf("Error writing audit log: %v", err)
 		}
+
+		// Forward to external sinks even if the database write failed
+		s.sinks.publish(&Event{Entry: logEntry, Details: details})
 	}()
 }
 
-// encrypt encrypts data using AES-GCM
-func (s *AuditService) encrypt(data []byte) (string, error) {
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return "", err
-	}
+// AddSink forwards every logged event that passes filter to sink
+func (s *AuditService) AddSink(sink Sink, filter SinkFilter) {
+	s.sinks.add(sink, filter)
+}
 
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return "", err
+// Close waits for in-flight entries, then flushes and closes all registered sinks
+func (s *AuditService) Close() error {
+	s.pending.Wait()
+	return s.sinks.close()
+}
+
+// normalizeKey pads or trims key to 32 bytes (for MVP simplicity)
+// In production, this should be validated strictly
+func normalizeKey(key string) []byte {
+	keyBytes := []byte(key)
+	if len(keyBytes) < 32 {
+		padded := make([]byte, 32)
+		copy(padded, keyBytes)
+		keyBytes = padded
+	} else if len(keyBytes) > 32 {
+		keyBytes = keyBytes[:32]
 	}
+	return keyBytes
+}
 
-	nonce := make([]byte, gcm.NonceSize())
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+// encrypt encrypts data using AES-GCM
+func (s *AuditService) encrypt(data []byte) (string, error) {
+	ciphertext, err := cryptoutil.Seal(s.encryptionKey, data)
+	if err != nil {
 		return "", err
 	}
-
-	ciphertext := gcm.Seal(nonce, nonce, data, nil)
 	return base64.StdEncoding.EncodeToString(ciphertext), nil
 }
 
@@ -116,23 +122,7 @@ func (s *AuditService) Decrypt(encryptedString string) (map[string]interface{},
 		return nil, err
 	}
 
-	block, err := aes.NewCipher(s.encryptionKey)
-	if err != nil {
-		return nil, err
-	}
-
-	gcm, err := cipher.NewGCM(block)
-	if err != nil {
-		return nil, err
-	}
-
-	nonceSize := gcm.NonceSize()
-	if len(data) < nonceSize {
-		return nil, errors.New("ciphertext too short")
-	}
-
-	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
-	plaintext, err := gcm.Open(nil, nonce, ciphertext, nil)
+	plaintext, err := cryptoutil.Open(s.encryptionKey, data)
 	if err != nil {
 		return nil, err
 	}
@@ -145,32 +135,69 @@ func (s *AuditService) Decrypt(encryptedString string) (map[string]interface{},
 	return details, nil
 }
 
-// GetLogs retrieves audit logs with optional filtering
+// GetLogs retrieves audit logs with optional filtering, most recent first
 func (s *AuditService) GetLogs(ctx context.Context, companyID primitive.ObjectID, filter map[string]interface{}) ([]map[string]interface{}, error) {
-	collection := database.GetCollection("audit_logs")
+	query := logQuery(companyID, filter)
+	query.NewestFirst = true
 
-	// Base filter: Company ID
-	query := map[string]interface{}{
-		"company_id": companyID,
+	// Decrypt details for each log
+	result := make([]map[string]interface{}, 0)
+	err := s.repo.Each(ctx, query, func(logEntry models.AuditLog) error {
+		result = append(result, s.entryMap(logEntry))
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
 
-	// Apply additional filters with case-insensitive regex
-	if action, ok := filter["action"].(string); ok && action != "" {
-		query["action"] = map[string]interface{}{
-			"$regex":   action,
-			"$options": "i", // case-insensitive
+	return result, nil
+}
+
+// entryMap flattens a log entry for API responses, decrypting its details
+func (s *AuditService) entryMap(logEntry models.AuditLog) map[string]interface{} {
+	entry := entryFields(logEntry)
+
+	if logEntry.DetailsEncrypted != "" {
+		details, err := s.Decrypt(logEntry.DetailsEncrypted)
+		if err == nil {
+			entry["details"] = details
+		} else {
+			entry["details_error"] = "Failed to decrypt details"
 		}
 	}
-	if resourceType, ok := filter["resource_type"].(string); ok && resourceType != "" {
-		query["resource_type"] = map[string]interface{}{
-			"$regex":   resourceType,
-			"$options": "i", // case-insensitive
-		}
+
+	return entry
+}
+
+// entryFields returns the plaintext fields of a log entry
+func entryFields(logEntry models.AuditLog) map[string]interface{} {
+	return map[string]interface{}{
+		"id":            logEntry.ID,
+		"user_id":       logEntry.UserID,
+		"username":      logEntry.Username,
+		"action":        logEntry.Action,
+		"resource_type": logEntry.ResourceType,
+		"resource_id":   logEntry.ResourceID,
+		"status":        logEntry.Status,
+		"ip_address":    logEntry.IPAddress,
+		"user_agent":    logEntry.UserAgent,
+		"timestamp":     logEntry.CreatedAt, // Changed to "timestamp" to match frontend
 	}
+}
+
+// logQuery translates API filters into a company-scoped repository query
+func logQuery(companyID primitive.ObjectID, filter map[string]interface{}) repository.AuditQuery {
+	query := repository.AuditQuery{CompanyID: companyID}
+
+	// Action, resource type and status match case-insensitively
+	query.Action, _ = filter["action"].(string)
+	query.ResourceType, _ = filter["resource_type"].(string)
+	query.Status, _ = filter["status"].(string)
+
 	if userID, ok := filter["user_id"].(string); ok && userID != "" {
 		oid, err := primitive.ObjectIDFromHex(userID)
 		if err == nil {
-			query["user_id"] = oid
+			query.UserID = oid
 		}
 	}
 
@@ -178,64 +205,15 @@ func (s *AuditService) GetLogs(ctx context.Context, companyID primitive.ObjectID
 	if fromStr, ok := filter["from_date"].(string); ok && fromStr != "" {
 		from, err := time.Parse(time.RFC3339, fromStr)
 		if err == nil {
-			if _, exists := query["created_at"]; !exists {
-				query["created_at"] = map[string]interface{}{}
-			}
-			query["created_at"].(map[string]interface{})["$gte"] = from
+			query.From = &from
 		}
 	}
 	if toStr, ok := filter["to_date"].(string); ok && toStr != "" {
 		to, err := time.Parse(time.RFC3339, toStr)
 		if err == nil {
-			if _, exists := query["created_at"]; !exists {
-				query["created_at"] = map[string]interface{}{}
-			}
-			query["created_at"].(map[string]interface{})["$lte"] = to
+			query.To = &to
 		}
 	}
 
-	// Create find options with sorting (most recent first)
-	findOptions := options.Find()
-	findOptions.SetSort(map[string]interface{}{"created_at": -1}) // Sort descending
-
-	cursor, err := collection.Find(ctx, query, findOptions)
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-
-	var logs []models.AuditLog
-	if err := cursor.All(ctx, &logs); err != nil {
-		return nil, err
-	}
-
-	// Decrypt details for each log
-	result := make([]map[string]interface{}, 0, len(logs))
-	for _, logEntry := range logs {
-		entry := map[string]interface{}{
-			"id":            logEntry.ID,
-			"user_id":       logEntry.UserID,
-			"username":      logEntry.Username,
-			"action":        logEntry.Action,
-			"resource_type": logEntry.ResourceType,
-			"resource_id":   logEntry.ResourceID,
-			"status":        logEntry.Status,
-			"ip_address":    logEntry.IPAddress,
-			"user_agent":    logEntry.UserAgent,
-			"timestamp":     logEntry.CreatedAt, // Changed to "timestamp" to match frontend
-		}
-
-		if logEntry.DetailsEncrypted != "" {
-			details, err := s.Decrypt(logEntry.DetailsEncrypted)
-			if err == nil {
-				entry["details"] = details
-			} else {
-				entry["details_error"] = "Failed to decrypt details"
-			}
-		}
-
-		result = append(result, entry)
-	}
-
-	return result, nil
+	return query
 }
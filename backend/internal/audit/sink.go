@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// sinkQueueSize bounds buffered events per sink before new events are dropped
+const sinkQueueSize = 1024
+
+// Event is an audit entry with its details in plaintext, as delivered to sinks
+type Event struct {
+	Entry   models.AuditLog
+	Details map[string]interface{}
+}
+
+// Map flattens the event into the same shape the audit log API returns
+func (e *Event) Map() map[string]interface{} {
+	entry := entryFields(e.Entry)
+	entry["company_id"] = e.Entry.CompanyID
+	if e.Details != nil {
+		entry["details"] = e.Details
+	}
+	return entry
+}
+
+// Sink receives audit events in addition to the MongoDB audit_logs collection.
+// Implementations are called from a single goroutine per sink.
+type Sink interface {
+	Name() string
+	Write(ctx context.Context, event *Event) error
+	Close() error
+}
+
+// SinkFilter routes events to a sink. Empty lists match everything.
+type SinkFilter struct {
+	CompanyIDs []primitive.ObjectID
+	Actions    []string
+	Statuses   []string
+}
+
+// Matches reports whether the event passes the filter
+func (f SinkFilter) Matches(event *Event) bool {
+	if len(f.CompanyIDs) > 0 {
+		found := false
+		for _, id := range f.CompanyIDs {
+			if id == event.Entry.CompanyID {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return matchesAny(f.Actions, event.Entry.Action) && matchesAny(f.Statuses, event.Entry.Status)
+}
+
+func matchesAny(values []string, value string) bool {
+	if len(values) == 0 {
+		return true
+	}
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// routedSink delivers filtered events to a sink from a buffered queue so a slow
+// or unreachable SIEM never blocks audit logging
+type routedSink struct {
+	sink   Sink
+	filter SinkFilter
+	queue  chan *Event
+	done   chan struct{}
+}
+
+func newRoutedSink(sink Sink, filter SinkFilter) *routedSink {
+	r := &routedSink{
+		sink:   sink,
+		filter: filter,
+		queue:  make(chan *Event, sinkQueueSize),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+func (r *routedSink) run() {
+	defer close(r.done)
+	for event := range r.queue {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		if err := r.sink.Write(ctx, event); err != nil {
+			log.Printf("Error forwarding audit event to %s: %v", r.sink.Name(), err)
+		}
+		cancel()
+	}
+}
+
+func (r *routedSink) enqueue(event *Event) {
+	if !r.filter.Matches(event) {
+		return
+	}
+	select {
+	case r.queue <- event:
+	default:
+		log.Printf("Audit sink %s queue full, dropping event %s", r.sink.Name(), event.Entry.ID.Hex())
+	}
+}
+
+func (r *routedSink) close() error {
+	close(r.queue)
+	<-r.done
+	return r.sink.Close()
+}
+
+// sinkSet holds the sinks registered on an AuditService
+type sinkSet struct {
+	mu    sync.RWMutex
+	sinks []*routedSink
+}
+
+func (s *sinkSet) add(sink Sink, filter SinkFilter) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sinks = append(s.sinks, newRoutedSink(sink, filter))
+}
+
+func (s *sinkSet) publish(event *Event) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, sink := range s.sinks {
+		sink.enqueue(event)
+	}
+}
+
+func (s *sinkSet) close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var firstErr error
+	for _, sink := range s.sinks {
+		if err := sink.close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	s.sinks = nil
+	return firstErr
+}
+
+// SinkConfig describes one forwarding destination, as read from AUDIT_SINKS
+type SinkConfig struct {
+	Type       string   `json:"type"` // syslog or webhook
+	CompanyIDs []string `json:"company_ids"`
+	Actions    []string `json:"actions"`
+	Statuses   []string `json:"statuses"`
+
+	// Syslog
+	Network       string `json:"network"` // udp, tcp or tls
+	Address       string `json:"address"`
+	AppName       string `json:"app_name"`
+	Facility      int    `json:"facility"`
+	Format        string `json:"format"` // cef (default) or json
+	TLSSkipVerify bool   `json:"tls_skip_verify"`
+	TLSCAFile     string `json:"tls_ca_file"`
+
+	// Webhook
+	URL           string            `json:"url"`
+	Secret        string            `json:"secret"`
+	Headers       map[string]string `json:"headers"`
+	BatchSize     int               `json:"batch_size"`
+	FlushInterval string            `json:"flush_interval"`
+}
+
+// ParseSinkConfigs decodes the AUDIT_SINKS JSON array
+func ParseSinkConfigs(raw string) ([]SinkConfig, error) {
+	if strings.TrimSpace(raw) == "" {
+		return nil, nil
+	}
+	var configs []SinkConfig
+	if err := json.Unmarshal([]byte(raw), &configs); err != nil {
+		return nil, fmt.Errorf("invalid audit sink config: %w", err)
+	}
+	return configs, nil
+}
+
+// NewSinkFromConfig builds the sink and routing filter described by cfg
+func NewSinkFromConfig(cfg SinkConfig) (Sink, SinkFilter, error) {
+	filter := SinkFilter{Actions: cfg.Actions, Statuses: cfg.Statuses}
+	for _, id := range cfg.CompanyIDs {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			return nil, filter, fmt.Errorf("invalid company id %q in audit sink config", id)
+		}
+		filter.CompanyIDs = append(filter.CompanyIDs, oid)
+	}
+
+	switch cfg.Type {
+	case "syslog":
+		sink, err := NewSyslogSink(SyslogOptions{
+			Network:       cfg.Network,
+			Address:       cfg.Address,
+			AppName:       cfg.AppName,
+			Facility:      cfg.Facility,
+			Format:        cfg.Format,
+			TLSSkipVerify: cfg.TLSSkipVerify,
+			TLSCAFile:     cfg.TLSCAFile,
+		})
+		return sink, filter, err
+	case "webhook":
+		interval, _ := time.ParseDuration(cfg.FlushInterval)
+		sink, err := NewWebhookSink(WebhookOptions{
+			URL:           cfg.URL,
+			Secret:        cfg.Secret,
+			Headers:       cfg.Headers,
+			BatchSize:     cfg.BatchSize,
+			FlushInterval: interval,
+		})
+		return sink, filter, err
+	default:
+		return nil, filter, fmt.Errorf("unknown audit sink type %q", cfg.Type)
+	}
+}
@@ -0,0 +1,336 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func testEvent(action, status string) *Event {
+	return &Event{
+		Entry: models.AuditLog{
+			ID:           primitive.NewObjectID(),
+			CompanyID:    primitive.NewObjectID(),
+			UserID:       primitive.NewObjectID(),
+			Username:     `ana "the auditor"`,
+			Action:       action,
+			ResourceType: "ITEM",
+			ResourceID:   primitive.NewObjectID(),
+			Status:       status,
+			IPAddress:    "10.0.0.7",
+			CreatedAt:    time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC),
+		},
+		Details: map[string]interface{}{"sku": "SKU-1"},
+	}
+}
+
+// readOctetCounted reads one RFC 6587 octet-counted frame
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	prefix, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	length, err := strconv.Atoi(strings.TrimSuffix(prefix, " "))
+	if err != nil {
+		return "", err
+	}
+	message := make([]byte, length)
+	if _, err := io.ReadFull(r, message); err != nil {
+		return "", err
+	}
+	return string(message), nil
+}
+
+func TestSyslogSinkUDP(t *testing.T) {
+	listener, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	sink, err := NewSyslogSink(SyslogOptions{Network: "udp", Address: listener.LocalAddr().String(), AppName: "safeware-test"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	event := testEvent("LOGIN", "FAILURE")
+	if err := sink.Write(context.Background(), event); err != nil {
+		t.Fatal(err)
+	}
+
+	listener.SetReadDeadline(time.Now().Add(5 * time.Second))
+	buf := make([]byte, 64*1024)
+	n, _, err := listener.ReadFrom(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	message := string(buf[:n])
+
+	// authpriv (10) * 8 + warning (4)
+	if !strings.HasPrefix(message, "<84>1 2026-03-04T05:06:07.000000Z ") {
+		t.Errorf("unexpected header: %q", message)
+	}
+	for _, want := range []string{
+		" safeware-test ",
+		" LOGIN [" + syslogEnterpriseID + " ",
+		`username="ana \"the auditor\""`,
+		`event_id="` + event.Entry.ID.Hex() + `"`,
+		"] CEF:0|SafeWare|SafeWare|1.0|LOGIN|LOGIN ITEM|7|",
+	} {
+		if !strings.Contains(message, want) {
+			t.Errorf("message %q does not contain %q", message, want)
+		}
+	}
+}
+
+func TestSyslogSinkTCPFramingAndRedial(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	messages := make(chan string, 4)
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			// Read one message per connection, then drop it so the sink has to redial
+			message, err := readOctetCounted(bufio.NewReader(conn))
+			conn.Close()
+			if err == nil {
+				messages <- message
+			}
+		}
+	}()
+
+	sink, err := NewSyslogSink(SyslogOptions{Network: "tcp", Address: listener.Addr().String(), Format: "json"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	first := testEvent("CREATE", "SUCCESS")
+	if err := sink.Write(context.Background(), first); err != nil {
+		t.Fatal(err)
+	}
+	message := receive(t, messages)
+	if !strings.HasPrefix(message, "<86>1 ") {
+		t.Errorf("unexpected header: %q", message)
+	}
+	body := message[strings.Index(message, "] ")+2:]
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &decoded); err != nil {
+		t.Fatalf("json body %q: %v", body, err)
+	}
+	if decoded["action"] != "CREATE" || decoded["company_id"] != first.Entry.CompanyID.Hex() {
+		t.Errorf("unexpected json body: %v", decoded)
+	}
+
+	// The listener closed the first connection; writes must survive that
+	second := testEvent("UPDATE", "SUCCESS")
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if err := sink.Write(context.Background(), second); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case message := <-messages:
+			if !strings.Contains(message, `event_id="`+second.Entry.ID.Hex()+`"`) {
+				t.Errorf("expected the second event, got %q", message)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+			// A write into a connection the peer already closed can succeed
+			// locally; the next one fails and redials
+			if time.Now().After(deadline) {
+				t.Fatal("second event never arrived")
+			}
+		}
+	}
+}
+
+func receive(t *testing.T, messages <-chan string) string {
+	t.Helper()
+	select {
+	case message := <-messages:
+		return message
+	case <-time.After(5 * time.Second):
+		t.Fatal("no message received")
+		return ""
+	}
+}
+
+func TestWebhookSinkBatchesSignsAndRetries(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		attempts int
+		bodies   [][]byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		mac := hmac.New(sha256.New, []byte("s3cret"))
+		mac.Write(body)
+		if got, want := r.Header.Get(WebhookSignatureHeader), "sha256="+hex.EncodeToString(mac.Sum(nil)); got != want {
+			t.Errorf("signature %q, want %q", got, want)
+		}
+		if r.Header.Get("X-Tenant") != "acme" {
+			t.Errorf("custom header missing")
+		}
+		bodies = append(bodies, body)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{
+		URL:           server.URL,
+		Secret:        "s3cret",
+		Headers:       map[string]string{"X-Tenant": "acme"},
+		BatchSize:     2,
+		FlushInterval: time.Hour,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	ctx := context.Background()
+	if err := sink.Write(ctx, testEvent("CREATE", "SUCCESS")); err != nil {
+		t.Fatal(err)
+	}
+	if err := sink.Write(ctx, testEvent("DELETE", "SUCCESS")); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 2 {
+		t.Fatalf("expected one retry after the 503, got %d attempts", attempts)
+	}
+	var payload struct {
+		Events []map[string]interface{} `json:"events"`
+	}
+	if err := json.Unmarshal(bodies[0], &payload); err != nil {
+		t.Fatal(err)
+	}
+	if len(payload.Events) != 2 || payload.Events[0]["action"] != "CREATE" || payload.Events[1]["action"] != "DELETE" {
+		t.Errorf("unexpected batch: %s", bodies[0])
+	}
+	if payload.Events[0]["details"].(map[string]interface{})["sku"] != "SKU-1" {
+		t.Errorf("details missing from %s", bodies[0])
+	}
+}
+
+func TestWebhookSinkDoesNotRetryClientErrors(t *testing.T) {
+	var mu sync.Mutex
+	attempts := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		attempts++
+		mu.Unlock()
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer server.Close()
+
+	sink, err := NewWebhookSink(WebhookOptions{URL: server.URL, BatchSize: 1, FlushInterval: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+
+	err = sink.Write(context.Background(), testEvent("CREATE", "SUCCESS"))
+	if err == nil || !strings.Contains(err.Error(), "400") {
+		t.Fatalf("expected the 400 to be reported, got %v", err)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if attempts != 1 {
+		t.Errorf("client errors must not be retried, got %d attempts", attempts)
+	}
+}
+
+// recordingSink collects the events routed to it
+type recordingSink struct {
+	mu     sync.Mutex
+	events []*Event
+}
+
+func (r *recordingSink) Name() string { return "recording" }
+
+func (r *recordingSink) Write(ctx context.Context, event *Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.events = append(r.events, event)
+	return nil
+}
+
+func (r *recordingSink) Close() error { return nil }
+
+func TestAuditServiceRoutesEventsToSinks(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	service := NewAuditService("test-key", repos.Audit)
+
+	company, other := primitive.NewObjectID(), primitive.NewObjectID()
+	sink := &recordingSink{}
+	service.AddSink(sink, SinkFilter{
+		CompanyIDs: []primitive.ObjectID{company},
+		Actions:    []string{"login"},
+		Statuses:   []string{"failure"},
+	})
+
+	ctx := context.Background()
+	user := primitive.NewObjectID()
+	service.LogAction(ctx, user, company, "ana", "LOGIN", "USER", nil, map[string]interface{}{"reason": "bad password"}, "10.0.0.7", "", "FAILURE")
+	service.LogAction(ctx, user, company, "ana", "LOGIN", "USER", nil, nil, "10.0.0.7", "", "SUCCESS")
+	service.LogAction(ctx, user, other, "bo", "LOGIN", "USER", nil, nil, "10.0.0.8", "", "FAILURE")
+	service.LogAction(ctx, user, company, "ana", "DELETE", "ITEM", nil, nil, "10.0.0.7", "", "FAILURE")
+	if err := service.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sink.events) != 1 {
+		t.Fatalf("expected 1 routed event, got %d", len(sink.events))
+	}
+	event := sink.events[0]
+	if event.Entry.CompanyID != company || event.Details["reason"] != "bad password" {
+		t.Errorf("unexpected event: %+v", event)
+	}
+
+	stored := 0
+	err := repos.Audit.Each(ctx, repository.AuditQuery{}, func(models.AuditLog) error {
+		stored++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored != 4 {
+		t.Errorf("every entry is stored regardless of routing, got %d", stored)
+	}
+}
@@ -0,0 +1,232 @@
+package audit
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// syslogEnterpriseID is the SD-ID suffix for SafeWare structured data (RFC 5612 example PEN)
+	syslogEnterpriseID = "safeware@32473"
+	// facilityAuthPriv is the default syslog facility for security events
+	facilityAuthPriv = 10
+
+	severityWarning       = 4
+	severityNotice        = 5
+	severityInformational = 6
+)
+
+var sdValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+
+// SyslogOptions configures an RFC 5424 syslog sink
+type SyslogOptions struct {
+	Network       string // udp, tcp or tls
+	Address       string // host:port
+	AppName       string
+	Facility      int
+	Format        string // cef (default) or json message body
+	TLSSkipVerify bool
+	TLSCAFile     string
+}
+
+// SyslogSink forwards audit events as RFC 5424 messages. TCP and TLS use
+// octet-counting framing (RFC 6587 / RFC 5425); UDP sends one message per datagram.
+type SyslogSink struct {
+	opts      SyslogOptions
+	hostname  string
+	tlsConfig *tls.Config
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewSyslogSink validates options; the connection is dialed on first write
+func NewSyslogSink(opts SyslogOptions) (*SyslogSink, error) {
+	if opts.Address == "" {
+		return nil, errors.New("syslog sink requires an address")
+	}
+	if opts.Network == "" {
+		opts.Network = "udp"
+	}
+	if opts.Network != "udp" && opts.Network != "tcp" && opts.Network != "tls" {
+		return nil, fmt.Errorf("unsupported syslog network %q", opts.Network)
+	}
+	if opts.AppName == "" {
+		opts.AppName = "safeware"
+	}
+	if opts.Facility <= 0 || opts.Facility > 23 {
+		opts.Facility = facilityAuthPriv
+	}
+	if opts.Format == "" {
+		opts.Format = FormatCEF
+	}
+
+	sink := &SyslogSink{opts: opts, hostname: "-"}
+	if host, err := os.Hostname(); err == nil && host != "" {
+		sink.hostname = host
+	}
+
+	if opts.Network == "tls" {
+		sink.tlsConfig = &tls.Config{InsecureSkipVerify: opts.TLSSkipVerify}
+		if opts.TLSCAFile != "" {
+			pem, err := os.ReadFile(opts.TLSCAFile)
+			if err != nil {
+				return nil, err
+			}
+			pool := x509.NewCertPool()
+			if !pool.AppendCertsFromPEM(pem) {
+				return nil, errors.New("no certificates found in syslog CA file")
+			}
+			sink.tlsConfig.RootCAs = pool
+		}
+	}
+
+	return sink, nil
+}
+
+// Name identifies the sink in logs
+func (s *SyslogSink) Name() string {
+	return "syslog(" + s.opts.Network + "://" + s.opts.Address + ")"
+}
+
+// Write sends one event, redialing once if the connection was dropped
+func (s *SyslogSink) Write(ctx context.Context, event *Event) error {
+	message := s.Format(event)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if s.conn == nil {
+			if s.conn, err = s.dial(ctx); err != nil {
+				return err
+			}
+		}
+		if deadline, ok := ctx.Deadline(); ok {
+			s.conn.SetWriteDeadline(deadline)
+		}
+		if _, err = s.conn.Write(s.frame(message)); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	return err
+}
+
+// Close closes the underlying connection
+func (s *SyslogSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.conn == nil {
+		return nil
+	}
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *SyslogSink) dial(ctx context.Context) (net.Conn, error) {
+	dialer := &net.Dialer{Timeout: 5 * time.Second}
+	if s.opts.Network == "tls" {
+		tlsDialer := &tls.Dialer{NetDialer: dialer, Config: s.tlsConfig}
+		return tlsDialer.DialContext(ctx, "tcp", s.opts.Address)
+	}
+	return dialer.DialContext(ctx, s.opts.Network, s.opts.Address)
+}
+
+// frame applies octet-counting for stream transports
+func (s *SyslogSink) frame(message string) []byte {
+	if s.opts.Network == "udp" {
+		return []byte(message)
+	}
+	return []byte(fmt.Sprintf("%d %s", len(message), message))
+}
+
+// Format renders an event as an RFC 5424 message
+func (s *SyslogSink) Format(event *Event) string {
+	entry := event.Entry
+	pri := s.opts.Facility*8 + syslogSeverity(entry.Status)
+
+	msgID := sanitizeHeaderField(entry.Action, 32)
+
+	params := []string{}
+	add := func(name, value string) {
+		if value != "" {
+			params = append(params, fmt.Sprintf(`%s="%s"`, name, sdValueEscaper.Replace(value)))
+		}
+	}
+	add("company_id", stringValue(entry.CompanyID))
+	add("user_id", stringValue(entry.UserID))
+	add("username", entry.Username)
+	add("action", entry.Action)
+	add("resource_type", entry.ResourceType)
+	add("resource_id", stringValue(entry.ResourceID))
+	add("status", entry.Status)
+	add("src", entry.IPAddress)
+	add("event_id", stringValue(entry.ID))
+
+	structured := "[" + syslogEnterpriseID
+	if len(params) > 0 {
+		structured += " " + strings.Join(params, " ")
+	}
+	structured += "]"
+
+	var body string
+	if s.opts.Format == "json" {
+		b, _ := json.Marshal(event.Map())
+		body = string(b)
+	} else {
+		body = FormatCEFEntry(event.Map())
+	}
+
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s %s %s",
+		pri,
+		entry.CreatedAt.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		sanitizeHeaderField(s.hostname, 255),
+		sanitizeHeaderField(s.opts.AppName, 48),
+		os.Getpid(),
+		msgID,
+		structured,
+		body,
+	)
+}
+
+// syslogSeverity maps an audit status to a syslog severity
+func syslogSeverity(status string) int {
+	switch status {
+	case "FAILURE", "FAILED":
+		return severityWarning
+	case "SUCCESS":
+		return severityInformational
+	default:
+		return severityNotice
+	}
+}
+
+// sanitizeHeaderField restricts a header field to printable ASCII without spaces
+func sanitizeHeaderField(value string, maxLen int) string {
+	var b strings.Builder
+	for _, r := range value {
+		if r > 32 && r < 127 {
+			b.WriteRune(r)
+		}
+		if b.Len() >= maxLen {
+			break
+		}
+	}
+	if b.Len() == 0 {
+		return "-"
+	}
+	return b.String()
+}
@@ -0,0 +1,179 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookBatchSize     = 100
+	defaultWebhookFlushInterval = 5 * time.Second
+	webhookMaxAttempts          = 3
+	// WebhookSignatureHeader carries the HMAC-SHA256 of the request body
+	WebhookSignatureHeader = "X-SafeWare-Signature"
+)
+
+// WebhookOptions configures a batching HTTP JSON sink
+type WebhookOptions struct {
+	URL           string
+	Secret        string // optional HMAC key for WebhookSignatureHeader
+	Headers       map[string]string
+	BatchSize     int
+	FlushInterval time.Duration
+	Client        *http.Client
+}
+
+// WebhookSink posts batches of events as {"events": [...]} to an HTTP endpoint
+type WebhookSink struct {
+	opts WebhookOptions
+
+	mu      sync.Mutex
+	pending []map[string]interface{}
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewWebhookSink starts a sink that flushes when a batch fills or the interval elapses
+func NewWebhookSink(opts WebhookOptions) (*WebhookSink, error) {
+	if opts.URL == "" {
+		return nil, errors.New("webhook sink requires a url")
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultWebhookBatchSize
+	}
+	if opts.FlushInterval <= 0 {
+		opts.FlushInterval = defaultWebhookFlushInterval
+	}
+	if opts.Client == nil {
+		opts.Client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	sink := &WebhookSink{
+		opts: opts,
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go sink.flushLoop()
+	return sink, nil
+}
+
+// Name identifies the sink in logs
+func (w *WebhookSink) Name() string {
+	return "webhook(" + w.opts.URL + ")"
+}
+
+// Write queues an event, sending the batch once it is full
+func (w *WebhookSink) Write(ctx context.Context, event *Event) error {
+	w.mu.Lock()
+	w.pending = append(w.pending, event.Map())
+	full := len(w.pending) >= w.opts.BatchSize
+	w.mu.Unlock()
+
+	if full {
+		return w.Flush(ctx)
+	}
+	return nil
+}
+
+// Flush sends all pending events
+func (w *WebhookSink) Flush(ctx context.Context) error {
+	w.mu.Lock()
+	batch := w.pending
+	w.pending = nil
+	w.mu.Unlock()
+
+	if len(batch) == 0 {
+		return nil
+	}
+	return w.send(ctx, batch)
+}
+
+// Close stops the flush loop and sends what is left
+func (w *WebhookSink) Close() error {
+	close(w.stop)
+	<-w.done
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	return w.Flush(ctx)
+}
+
+func (w *WebhookSink) flushLoop() {
+	defer close(w.done)
+	ticker := time.NewTicker(w.opts.FlushInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+			if err := w.Flush(ctx); err != nil {
+				log.Printf("Error flushing audit events to %s: %v", w.Name(), err)
+			}
+			cancel()
+		}
+	}
+}
+
+// send posts one batch, retrying server errors with backoff
+func (w *WebhookSink) send(ctx context.Context, batch []map[string]interface{}) error {
+	body, err := json.Marshal(map[string]interface{}{"events": batch})
+	if err != nil {
+		return err
+	}
+
+	var lastErr error
+	for attempt := 0; attempt < webhookMaxAttempts; attempt++ {
+		if attempt > 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			case <-time.After(time.Duration(attempt) * time.Second):
+			}
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.opts.URL, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for key, value := range w.opts.Headers {
+			req.Header.Set(key, value)
+		}
+		if w.opts.Secret != "" {
+			mac := hmac.New(sha256.New, []byte(w.opts.Secret))
+			mac.Write(body)
+			req.Header.Set(WebhookSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+		}
+
+		resp, err := w.opts.Client.Do(req)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode < 300 {
+			return nil
+		}
+		lastErr = fmt.Errorf("webhook returned status %d", resp.StatusCode)
+		// Client errors will not succeed on retry
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			return lastErr
+		}
+	}
+	return lastErr
+}
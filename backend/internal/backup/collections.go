@@ -0,0 +1,117 @@
+package backup
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// scope describes how a collection's documents belong to a company
+type scope int
+
+const (
+	// scopeCompanyField documents carry a company_id field
+	scopeCompanyField scope = iota
+	// scopeCompanyDocument is the companies collection itself, keyed by _id
+	scopeCompanyDocument
+	// scopeViaItems documents reference a company's items through item_id
+	scopeViaItems
+	// scopeViaUsers documents reference a company's users through user_id
+	scopeViaUsers
+)
+
+// collectionSpec registers a tenant collection for backup, restore and export
+type collectionSpec struct {
+	Name  string
+	Scope scope
+	// AppendOnly collections are never deleted on restore; missing documents are re-inserted
+	AppendOnly bool
+}
+
+// tenantCollections lists every collection holding company data. Collections are
+// restored in this order, so parents come before the documents that reference them.
+var tenantCollections = []collectionSpec{
+	{Name: "companies", Scope: scopeCompanyDocument},
+	{Name: "roles", Scope: scopeCompanyField},
+	{Name: "users", Scope: scopeCompanyField},
+	{Name: "sessions", Scope: scopeViaUsers},
+	{Name: "warehouses", Scope: scopeCompanyField},
+	{Name: "storage_locations", Scope: scopeCompanyField},
+	{Name: "categories", Scope: scopeCompanyField},
+	{Name: "items", Scope: scopeCompanyField},
+	{Name: "item_locations", Scope: scopeViaItems},
+	{Name: "cost_layers", Scope: scopeCompanyField},
+	{Name: "cost_movements", Scope: scopeCompanyField},
+	{Name: "item_prices", Scope: scopeCompanyField},
+	{Name: "boms", Scope: scopeCompanyField},
+	{Name: "kit_builds", Scope: scopeCompanyField},
+	{Name: "sequences", Scope: scopeCompanyField},
+	{Name: "quality_holds", Scope: scopeCompanyField},
+	{Name: "import_jobs", Scope: scopeCompanyField},
+	{Name: "transfers", Scope: scopeCompanyField},
+	{Name: "dac_grants", Scope: scopeCompanyField},
+	{Name: "rules", Scope: scopeCompanyField},
+	{Name: "audit_logs", Scope: scopeCompanyField, AppendOnly: true},
+	{Name: "audit_retention_policies", Scope: scopeCompanyField},
+	{Name: "audit_archives", Scope: scopeCompanyField},
+	{Name: "security_alerts", Scope: scopeCompanyField},
+}
+
+// globalCollections hold data shared by all companies; only full backups include them
+var globalCollections = []string{"permissions"}
+
+// TenantCollectionNames returns the collections that hold company data
+func TenantCollectionNames() []string {
+	names := make([]string, len(tenantCollections))
+	for i, spec := range tenantCollections {
+		names[i] = spec.Name
+	}
+	return names
+}
+
+// tenantFilter builds the query selecting a company's documents in a collection
+func (s *Service) tenantFilter(ctx context.Context, spec collectionSpec, companyID primitive.ObjectID) (bson.M, error) {
+	switch spec.Scope {
+	case scopeCompanyDocument:
+		return bson.M{"_id": companyID}, nil
+	case scopeViaItems:
+		ids, err := companyIDs(ctx, s.db.Collection("items"), companyID)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"item_id": bson.M{"$in": ids}}, nil
+	case scopeViaUsers:
+		ids, err := companyIDs(ctx, s.db.Collection("users"), companyID)
+		if err != nil {
+			return nil, err
+		}
+		return bson.M{"user_id": bson.M{"$in": ids}}, nil
+	default:
+		return bson.M{"company_id": companyID}, nil
+	}
+}
+
+// companyIDs returns the _id of every document a company owns in collection
+func companyIDs(ctx context.Context, collection *mongo.Collection, companyID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := collection.Find(ctx,
+		bson.M{"company_id": companyID}, options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
@@ -0,0 +1,124 @@
+package backup
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"os"
+
+	"github.com/a2sv/safeware/internal/cryptoutil"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// RotationResult counts the backups a key rotation rewrote
+type RotationResult struct {
+	Rewritten int `json:"rewritten"`
+	// Current were already encrypted with the new key
+	Current int `json:"current"`
+	// Unreadable are missing, fail their checksum or open with neither key
+	Unreadable []primitive.ObjectID `json:"unreadable,omitempty"`
+}
+
+// RotateKey re-encrypts every backup archive from oldEncryptionKey to the
+// current key. Each archive is rewritten to a temporary file and renamed into
+// place, and its recorded checksum and size are updated.
+func (s *Service) RotateKey(ctx context.Context, oldEncryptionKey string) (*RotationResult, error) {
+	previous := cryptoutil.DeriveKey(oldEncryptionKey, "backup")
+	backups, err := s.backups.All(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &RotationResult{}
+	for i := range backups {
+		backup := &backups[i]
+		if err := s.verify(backup); err != nil {
+			result.Unreadable = append(result.Unreadable, backup.ID)
+			continue
+		}
+
+		size, sum, err := s.reencrypt(backup.FilePath, previous)
+		if err != nil {
+			if s.readable(backup.FilePath, s.key) {
+				result.Current++
+			} else {
+				result.Unreadable = append(result.Unreadable, backup.ID)
+			}
+			continue
+		}
+
+		backup.SHA256 = sum
+		backup.FileSize = size
+		if err := s.backups.Save(ctx, backup); err != nil {
+			return result, err
+		}
+		result.Rewritten++
+	}
+	return result, nil
+}
+
+// reencrypt decrypts path with key and rewrites it with the current key,
+// returning the new size and checksum. The original is kept on failure.
+func (s *Service) reencrypt(path string, key []byte) (int64, string, error) {
+	in, err := os.Open(path)
+	if err != nil {
+		return 0, "", err
+	}
+	defer in.Close()
+
+	dec, err := cryptoutil.NewStreamReader(in, key)
+	if err != nil {
+		return 0, "", err
+	}
+
+	tmp := path + ".rotate"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return 0, "", err
+	}
+	fail := func(err error) (int64, string, error) {
+		out.Close()
+		os.Remove(tmp)
+		return 0, "", err
+	}
+
+	aw, err := s.newArchiveWriter(out)
+	if err != nil {
+		return fail(err)
+	}
+	// The compressed stream is copied as is; only the encryption layer changes
+	if _, err := io.Copy(aw.enc, dec); err != nil {
+		return fail(err)
+	}
+	if err := aw.enc.Close(); err != nil {
+		return fail(err)
+	}
+	if err := out.Sync(); err != nil {
+		return fail(err)
+	}
+	if err := out.Close(); err != nil {
+		os.Remove(tmp)
+		return 0, "", err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return 0, "", err
+	}
+	return aw.size, hex.EncodeToString(aw.hash.Sum(nil)), nil
+}
+
+// readable reports whether the whole archive decrypts with key
+func (s *Service) readable(path string, key []byte) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+
+	dec, err := cryptoutil.NewStreamReader(file, key)
+	if err != nil {
+		return false
+	}
+	_, err = io.Copy(io.Discard, dec)
+	return err == nil
+}
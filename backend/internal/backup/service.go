@@ -0,0 +1,636 @@
+package backup
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/cryptoutil"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	TypeCompany    = "company"
+	TypeFull       = "full"
+	TypePreRestore = "pre_restore"
+
+	// formatVersion is written to every archive header
+	formatVersion = 1
+	// restoreBatchSize bounds how many documents are inserted at once on restore
+	restoreBatchSize = 500
+	// maxLineSize bounds a single extended JSON line (one document)
+	maxLineSize = 32 * 1024 * 1024
+)
+
+var (
+	ErrBackupNotFound  = errors.New("backup not found")
+	ErrBackupTampered  = errors.New("backup checksum mismatch")
+	ErrBackupMissing   = errors.New("backup file is missing")
+	ErrInvalidArchive  = errors.New("backup archive is not readable")
+	ErrWrongCompany    = errors.New("backup does not contain this company")
+	ErrCompanyNotFound = errors.New("company not found")
+)
+
+// Service writes and restores compressed, AES-GCM encrypted database backups.
+//
+// An archive is a stream of extended JSON lines: a header line, then one line per
+// document of the form {"collection": ..., "company_id": ..., "doc": {...}}.
+// Lines are gzip-compressed and then encrypted with cryptoutil.StreamWriter.
+//
+// Archives carry the raw documents of every tenant collection, whatever their
+// shape, so dumping and restoring them reads and writes db directly instead of
+// going through repositories. Backup metadata is kept in a repository.
+type Service struct {
+	auditService  *audit.AuditService
+	tx            repository.Transactor
+	backups       repository.BackupRepository
+	companies     repository.CompanyRepository
+	db            *mongo.Database
+	path          string
+	retentionDays int
+	key           []byte
+}
+
+// NewService creates a backup service dumping db into archives under path. An
+// empty encryption key falls back to a key derived from fallbackSecret.
+func NewService(auditService *audit.AuditService, tx repository.Transactor, backups repository.BackupRepository, companies repository.CompanyRepository, db *mongo.Database, path string, retentionDays int, encryptionKey, fallbackSecret string) *Service {
+	if path == "" {
+		path = "backups"
+	}
+	if retentionDays <= 0 {
+		retentionDays = 30
+	}
+	if encryptionKey == "" {
+		encryptionKey = fallbackSecret
+	}
+
+	return &Service{
+		auditService:  auditService,
+		tx:            tx,
+		backups:       backups,
+		companies:     companies,
+		db:            db,
+		path:          path,
+		retentionDays: retentionDays,
+		key:           cryptoutil.DeriveKey(encryptionKey, "backup"),
+	}
+}
+
+// archiveHeader is the first line of every archive
+type archiveHeader struct {
+	Format    string             `bson:"format"`
+	Version   int                `bson:"version"`
+	BackupID  primitive.ObjectID `bson:"backup_id"`
+	Type      string             `bson:"backup_type"`
+	CompanyID primitive.ObjectID `bson:"company_id,omitempty"`
+	CreatedAt time.Time          `bson:"created_at"`
+}
+
+// archiveRecord is one document line in an archive
+type archiveRecord struct {
+	Collection string             `bson:"collection"`
+	CompanyID  primitive.ObjectID `bson:"company_id,omitempty"`
+	Doc        bson.Raw           `bson:"doc"`
+}
+
+// archiveWriter layers extended JSON lines over gzip, encryption and a checksum
+type archiveWriter struct {
+	file    *os.File
+	hash    hash.Hash
+	size    int64
+	enc     *cryptoutil.StreamWriter
+	gz      *gzip.Writer
+	buf     *bufio.Writer
+	records int64
+}
+
+func (s *Service) newArchiveWriter(file *os.File) (*archiveWriter, error) {
+	aw := &archiveWriter{file: file, hash: sha256.New()}
+
+	enc, err := cryptoutil.NewStreamWriter(aw, s.key)
+	if err != nil {
+		return nil, err
+	}
+	aw.enc = enc
+	aw.gz = gzip.NewWriter(enc)
+	aw.buf = bufio.NewWriter(aw.gz)
+	return aw, nil
+}
+
+// Write tees encrypted output to the file and checksum
+func (aw *archiveWriter) Write(p []byte) (int, error) {
+	n, err := aw.file.Write(p)
+	aw.hash.Write(p[:n])
+	aw.size += int64(n)
+	return n, err
+}
+
+func (aw *archiveWriter) writeLine(v interface{}) error {
+	line, err := bson.MarshalExtJSON(v, true, false)
+	if err != nil {
+		return err
+	}
+	if _, err := aw.buf.Write(line); err != nil {
+		return err
+	}
+	return aw.buf.WriteByte('\n')
+}
+
+func (aw *archiveWriter) close() error {
+	if err := aw.buf.Flush(); err != nil {
+		return err
+	}
+	if err := aw.gz.Close(); err != nil {
+		return err
+	}
+	if err := aw.enc.Close(); err != nil {
+		return err
+	}
+	return aw.file.Sync()
+}
+
+// BackupCompany dumps every tenant collection for one company. A zero createdBy
+// marks a scheduled backup, which is audited here as the system actor.
+func (s *Service) BackupCompany(ctx context.Context, companyID, createdBy primitive.ObjectID, backupType, notes string) (*models.Backup, error) {
+	if _, err := s.companies.Get(ctx, companyID); err != nil {
+		if err == repository.ErrNotFound {
+			return nil, ErrCompanyNotFound
+		}
+		return nil, err
+	}
+
+	backup, err := s.write(ctx, companyID, createdBy, backupType, notes, func(aw *archiveWriter) error {
+		return s.dumpCompany(ctx, aw, companyID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if createdBy.IsZero() {
+		s.auditService.LogAction(ctx, primitive.NilObjectID, companyID, "system", "BACKUP", "BACKUP", &backup.ID,
+			map[string]interface{}{
+				"backup_type":  backup.BackupType,
+				"record_count": backup.RecordCount,
+				"sha256":       backup.SHA256,
+			}, "", "", "SUCCESS")
+	}
+	return backup, nil
+}
+
+// BackupAll dumps every company plus the shared global collections into one archive
+func (s *Service) BackupAll(ctx context.Context, notes string) (*models.Backup, error) {
+	companies, err := s.companies.IDs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.write(ctx, primitive.NilObjectID, primitive.NilObjectID, TypeFull, notes, func(aw *archiveWriter) error {
+		for _, companyID := range companies {
+			if err := s.dumpCompany(ctx, aw, companyID); err != nil {
+				return err
+			}
+		}
+		for _, name := range globalCollections {
+			if err := s.dumpCollection(ctx, aw, name, primitive.NilObjectID, bson.M{}); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// write creates the archive file, records its metadata and removes partial files on failure
+func (s *Service) write(ctx context.Context, companyID, createdBy primitive.ObjectID, backupType, notes string, dump func(*archiveWriter) error) (*models.Backup, error) {
+	now := time.Now()
+	backup := &models.Backup{
+		ID:             primitive.NewObjectID(),
+		CompanyID:      companyID,
+		BackupType:     backupType,
+		Encrypted:      true,
+		CreatedBy:      createdBy,
+		CreatedAt:      now,
+		RetentionUntil: now.AddDate(0, 0, s.retentionDays),
+		Notes:          notes,
+	}
+
+	dir := filepath.Join(s.path, "all")
+	if !companyID.IsZero() {
+		dir = filepath.Join(s.path, companyID.Hex())
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, err
+	}
+	backup.FilePath = filepath.Join(dir, fmt.Sprintf("backup-%s-%s.jsonl.gz.enc", now.UTC().Format("20060102T150405Z"), backup.ID.Hex()))
+
+	tmp := backup.FilePath + ".tmp"
+	file, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	fail := func(err error) (*models.Backup, error) {
+		file.Close()
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	aw, err := s.newArchiveWriter(file)
+	if err != nil {
+		return fail(err)
+	}
+	header := archiveHeader{
+		Format:    "safeware-backup",
+		Version:   formatVersion,
+		BackupID:  backup.ID,
+		Type:      backupType,
+		CompanyID: companyID,
+		CreatedAt: now,
+	}
+	if err := aw.writeLine(header); err != nil {
+		return fail(err)
+	}
+	if err := dump(aw); err != nil {
+		return fail(err)
+	}
+	if err := aw.close(); err != nil {
+		return fail(err)
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+	if err := os.Rename(tmp, backup.FilePath); err != nil {
+		os.Remove(tmp)
+		return nil, err
+	}
+
+	backup.FileSize = aw.size
+	backup.SHA256 = hex.EncodeToString(aw.hash.Sum(nil))
+	backup.RecordCount = aw.records
+
+	if err := s.backups.Create(ctx, backup); err != nil {
+		os.Remove(backup.FilePath)
+		return nil, err
+	}
+	return backup, nil
+}
+
+func (s *Service) dumpCompany(ctx context.Context, aw *archiveWriter, companyID primitive.ObjectID) error {
+	for _, spec := range tenantCollections {
+		filter, err := s.tenantFilter(ctx, spec, companyID)
+		if err != nil {
+			return err
+		}
+		if err := s.dumpCollection(ctx, aw, spec.Name, companyID, filter); err != nil {
+			return fmt.Errorf("backing up %s: %w", spec.Name, err)
+		}
+	}
+	return nil
+}
+
+func (s *Service) dumpCollection(ctx context.Context, aw *archiveWriter, name string, companyID primitive.ObjectID, filter bson.M) error {
+	cursor, err := s.db.Collection(name).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		record := archiveRecord{Collection: name, CompanyID: companyID, Doc: cursor.Current}
+		if err := aw.writeLine(record); err != nil {
+			return err
+		}
+		aw.records++
+	}
+	return cursor.Err()
+}
+
+// List returns a company's backups, newest first. Full backups are not tenant-visible.
+func (s *Service) List(ctx context.Context, companyID primitive.ObjectID) ([]models.Backup, error) {
+	return s.backups.List(ctx, companyID)
+}
+
+// Get returns one backup. A zero companyID allows any backup, including full ones.
+func (s *Service) Get(ctx context.Context, backupID, companyID primitive.ObjectID) (*models.Backup, error) {
+	backup, err := s.backups.Get(ctx, companyID, backupID)
+	if err == repository.ErrNotFound {
+		return nil, ErrBackupNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return backup, nil
+}
+
+// RestoreResult summarizes a tenant restore
+type RestoreResult struct {
+	BackupID          primitive.ObjectID `json:"backup_id"`
+	CompanyID         primitive.ObjectID `json:"company_id"`
+	SafetyBackupID    primitive.ObjectID `json:"safety_backup_id"`
+	RestoredDocuments map[string]int64   `json:"restored_documents"`
+}
+
+// Restore replaces one company's data with its contents in the backup. Other
+// companies and global collections are never touched. A pre_restore backup of the
+// current state is taken first so the restore itself can be undone. The
+// replacement runs in one transaction: it is applied in full or not at all.
+func (s *Service) Restore(ctx context.Context, backup *models.Backup, companyID, restoredBy primitive.ObjectID) (*RestoreResult, error) {
+	if !backup.CompanyID.IsZero() && backup.CompanyID != companyID {
+		return nil, ErrWrongCompany
+	}
+	if err := s.verify(backup); err != nil {
+		return nil, err
+	}
+
+	safety, err := s.BackupCompany(ctx, companyID, restoredBy, TypePreRestore,
+		"Automatic backup before restoring "+backup.ID.Hex())
+	if err != nil {
+		return nil, fmt.Errorf("pre-restore backup failed: %w", err)
+	}
+
+	// Resolve every delete filter before anything changes, since some collections
+	// are scoped through item and user ids that the restore replaces
+	filters := make(map[string]bson.M, len(tenantCollections))
+	for _, spec := range tenantCollections {
+		if filters[spec.Name], err = s.tenantFilter(ctx, spec, companyID); err != nil {
+			return nil, err
+		}
+	}
+
+	// The deletes and inserts run in one transaction, so a failure part way
+	// through the archive leaves the company as it was
+	result := &RestoreResult{
+		BackupID:       backup.ID,
+		CompanyID:      companyID,
+		SafetyBackupID: safety.ID,
+	}
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		result.RestoredDocuments = map[string]int64{}
+		return s.replace(ctx, backup, filters, result)
+	})
+	if err != nil {
+		// Nothing was restored; the counts belonged to the aborted transaction
+		result.RestoredDocuments = map[string]int64{}
+		return result, err
+	}
+
+	now := time.Now()
+	backup.RestoredAt = &now
+	if err := s.backups.Save(ctx, backup); err != nil {
+		return result, err
+	}
+	return result, nil
+}
+
+// replace deletes the company's documents and inserts those in the backup,
+// counting them in result
+func (s *Service) replace(ctx context.Context, backup *models.Backup, filters map[string]bson.M, result *RestoreResult) error {
+	file, err := os.Open(backup.FilePath)
+	if err != nil {
+		return ErrBackupMissing
+	}
+	defer file.Close()
+
+	lines, err := s.openArchive(file)
+	if err != nil {
+		return err
+	}
+
+	cleared := map[string]bool{}
+	batches := map[string][]bson.Raw{}
+	flush := func(name string) error {
+		docs := batches[name]
+		if len(docs) == 0 {
+			return nil
+		}
+		batches[name] = nil
+		inserted, err := insertDocuments(ctx, s.db.Collection(name), docs, isAppendOnly(name))
+		result.RestoredDocuments[name] += inserted
+		return err
+	}
+	clearCollection := func(name string) error {
+		if cleared[name] {
+			return nil
+		}
+		cleared[name] = true
+		if isAppendOnly(name) {
+			return nil
+		}
+		_, err := s.db.Collection(name).DeleteMany(ctx, filters[name])
+		return err
+	}
+
+	for lines.Scan() {
+		var record archiveRecord
+		if err := bson.UnmarshalExtJSON(lines.Bytes(), true, &record); err != nil {
+			return ErrInvalidArchive
+		}
+		if record.Collection == "" || record.CompanyID != result.CompanyID {
+			continue
+		}
+		if _, ok := filters[record.Collection]; !ok {
+			continue
+		}
+		if err := clearCollection(record.Collection); err != nil {
+			return err
+		}
+		batches[record.Collection] = append(batches[record.Collection], record.Doc)
+		if len(batches[record.Collection]) >= restoreBatchSize {
+			if err := flush(record.Collection); err != nil {
+				return err
+			}
+		}
+	}
+	if err := lines.Err(); err != nil {
+		return ErrInvalidArchive
+	}
+
+	for _, spec := range tenantCollections {
+		if err := flush(spec.Name); err != nil {
+			return err
+		}
+		// Collections that were empty at backup time are emptied now
+		if err := clearCollection(spec.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// verify checks the archive still matches the checksum recorded at backup time
+func (s *Service) verify(backup *models.Backup) error {
+	file, err := os.Open(backup.FilePath)
+	if err != nil {
+		return ErrBackupMissing
+	}
+	defer file.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, file); err != nil {
+		return err
+	}
+	if backup.SHA256 != "" && hex.EncodeToString(hasher.Sum(nil)) != backup.SHA256 {
+		return ErrBackupTampered
+	}
+	return nil
+}
+
+// openArchive decrypts and decompresses an archive and validates its header line
+func (s *Service) openArchive(r io.Reader) (*bufio.Scanner, error) {
+	dec, err := cryptoutil.NewStreamReader(r, s.key)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+	gz, err := gzip.NewReader(dec)
+	if err != nil {
+		return nil, ErrInvalidArchive
+	}
+
+	scanner := bufio.NewScanner(gz)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	if !scanner.Scan() {
+		return nil, ErrInvalidArchive
+	}
+	var header archiveHeader
+	if err := bson.UnmarshalExtJSON(scanner.Bytes(), true, &header); err != nil || header.Format != "safeware-backup" {
+		return nil, ErrInvalidArchive
+	}
+	if header.Version > formatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d", header.Version)
+	}
+	return scanner, nil
+}
+
+func isAppendOnly(name string) bool {
+	for _, spec := range tenantCollections {
+		if spec.Name == name {
+			return spec.AppendOnly
+		}
+	}
+	return false
+}
+
+// insertDocuments writes a batch. Documents of append-only collections are
+// only inserted when missing: a duplicate key error would abort the restore
+// transaction, and existing entries, pseudonymized or not, are kept as they are.
+func insertDocuments(ctx context.Context, collection *mongo.Collection, docs []bson.Raw, appendOnly bool) (int64, error) {
+	if !appendOnly {
+		batch := make([]interface{}, len(docs))
+		for i, doc := range docs {
+			batch[i] = doc
+		}
+		res, err := collection.InsertMany(ctx, batch)
+		if err != nil {
+			return 0, err
+		}
+		return int64(len(res.InsertedIDs)), nil
+	}
+
+	writes := make([]mongo.WriteModel, 0, len(docs))
+	for _, doc := range docs {
+		elements, err := doc.Elements()
+		if err != nil {
+			return 0, ErrInvalidArchive
+		}
+		fields := make(bson.D, 0, len(elements))
+		for _, element := range elements {
+			if element.Key() != "_id" {
+				fields = append(fields, bson.E{Key: element.Key(), Value: element.Value()})
+			}
+		}
+		writes = append(writes, mongo.NewUpdateOneModel().
+			SetFilter(bson.M{"_id": doc.Lookup("_id")}).
+			SetUpdate(bson.M{"$setOnInsert": fields}).
+			SetUpsert(true))
+	}
+	res, err := collection.BulkWrite(ctx, writes)
+	if err != nil {
+		return 0, err
+	}
+	return res.UpsertedCount, nil
+}
+
+// EnforceRetention deletes archives and metadata whose RetentionUntil has passed
+func (s *Service) EnforceRetention(ctx context.Context) (int, error) {
+	expired, err := s.backups.Expired(ctx, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, backup := range expired {
+		if err := os.Remove(backup.FilePath); err != nil && !os.IsNotExist(err) {
+			log.Printf("Error removing expired backup %s: %v", backup.FilePath, err)
+			continue
+		}
+		if err := s.backups.Delete(ctx, backup.ID); err != nil && err != repository.ErrNotFound {
+			return removed, err
+		}
+		removed++
+
+		if !backup.CompanyID.IsZero() {
+			s.auditService.LogAction(ctx, primitive.NilObjectID, backup.CompanyID, "system", "DELETE", "BACKUP", &backup.ID,
+				map[string]interface{}{"reason": "retention_expired", "created_at": backup.CreatedAt}, "", "", "SUCCESS")
+		}
+	}
+	return removed, nil
+}
+
+// RunNightly backs up every company separately, then enforces retention
+func (s *Service) RunNightly(ctx context.Context) error {
+	companies, err := s.companies.IDs(ctx)
+	if err != nil {
+		return err
+	}
+	for _, companyID := range companies {
+		if _, err := s.BackupCompany(ctx, companyID, primitive.NilObjectID, TypeCompany, "Scheduled nightly backup"); err != nil {
+			log.Printf("Nightly backup failed for company %s: %v", companyID.Hex(), err)
+		}
+	}
+	if _, err := s.EnforceRetention(ctx); err != nil {
+		return err
+	}
+	return nil
+}
+
+// StartScheduler runs RunNightly every day at the given local hour until ctx is done
+func (s *Service) StartScheduler(ctx context.Context, hour int) {
+	if hour < 0 || hour > 23 {
+		hour = 2
+	}
+
+	for {
+		now := time.Now()
+		next := time.Date(now.Year(), now.Month(), now.Day(), hour, 0, 0, 0, now.Location())
+		if !next.After(now) {
+			next = next.AddDate(0, 0, 1)
+		}
+
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		if err := s.RunNightly(ctx); err != nil {
+			log.Printf("Nightly backup run failed: %v", err)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package category
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const dateLayout = "2006-01-02"
+
+// AttributeError is one problem with an item's attributes
+type AttributeError struct {
+	Key     string `json:"key"`
+	Message string `json:"message"`
+}
+
+// ValidationError lists every problem with an item's attributes
+type ValidationError struct {
+	Errors []AttributeError
+}
+
+func (e *ValidationError) Error() string {
+	problems := make([]string, len(e.Errors))
+	for i, problem := range e.Errors {
+		problems[i] = problem.Key + " " + problem.Message
+	}
+	return "invalid attributes: " + strings.Join(problems, "; ")
+}
+
+// Validate checks an item's attributes against the schema of its category
+// and returns them normalized: numbers as float64 and dates as YYYY-MM-DD.
+// Attributes outside the schema are rejected, and a missing category is
+// ErrUnknownCategory.
+func (s *Service) Validate(ctx context.Context, companyID, categoryID primitive.ObjectID, attributes map[string]interface{}) (map[string]interface{}, error) {
+	schema, err := s.Schema(ctx, companyID, categoryID)
+	if err == repository.ErrNotFound {
+		return nil, ErrUnknownCategory
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	problems := []AttributeError{}
+	normalized := map[string]interface{}{}
+	for _, def := range schema {
+		raw, ok := attributes[def.Key]
+		if ok && raw != nil {
+			if text, isText := raw.(string); !isText || strings.TrimSpace(text) != "" {
+				value, problem := coerce(def, raw)
+				if problem != "" {
+					problems = append(problems, AttributeError{def.Key, problem})
+				} else {
+					normalized[def.Key] = value
+				}
+				continue
+			}
+		}
+		if def.Required {
+			problems = append(problems, AttributeError{def.Key, "is required"})
+		}
+	}
+
+	keys := make([]string, 0, len(attributes))
+	for key := range attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if !slices.ContainsFunc(schema, func(def models.AttributeDef) bool { return def.Key == key }) {
+			problems = append(problems, AttributeError{key, "is not an attribute of this category"})
+		}
+	}
+
+	if len(problems) > 0 {
+		return nil, &ValidationError{Errors: problems}
+	}
+	return normalized, nil
+}
+
+// Filters turns attribute query values into item filters. A value matches
+// exactly; for numbers and dates a ".min" or ".max" suffix on the key gives
+// an inclusive bound. Values are typed by the schema of categoryID when it is
+// set, otherwise by the attribute's definition in any of the company's
+// categories.
+func (s *Service) Filters(ctx context.Context, companyID primitive.ObjectID, categoryID *primitive.ObjectID, query map[string]string) ([]repository.AttributeFilter, error) {
+	if len(query) == 0 {
+		return nil, nil
+	}
+
+	var schema []models.AttributeDef
+	if categoryID != nil {
+		var err error
+		if schema, err = s.Schema(ctx, companyID, *categoryID); err != nil {
+			return nil, err
+		}
+	} else {
+		categories, err := s.categories.List(ctx, companyID)
+		if err != nil {
+			return nil, err
+		}
+		for _, category := range categories {
+			schema = append(schema, category.Attributes...)
+		}
+	}
+
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := map[string]*repository.AttributeFilter{}
+	order := []string{}
+	for _, param := range keys {
+		key, bound := param, ""
+		if i := strings.LastIndex(param, "."); i > 0 {
+			key, bound = param[:i], param[i+1:]
+			if bound != "min" && bound != "max" {
+				return nil, fmt.Errorf("unknown attribute filter %q", param)
+			}
+		}
+
+		def, err := filterDef(schema, key)
+		if err != nil {
+			return nil, err
+		}
+		if bound != "" && def.Type != models.AttributeNumber && def.Type != models.AttributeDate {
+			return nil, fmt.Errorf("only number and date attributes take ranges, not %q", key)
+		}
+		value, problem := coerce(def, query[param])
+		if problem != "" {
+			return nil, fmt.Errorf("attribute filter %s %s", param, problem)
+		}
+
+		filter, ok := filters[key]
+		if !ok {
+			filter = &repository.AttributeFilter{Key: key}
+			filters[key] = filter
+			order = append(order, key)
+		}
+		switch bound {
+		case "min":
+			filter.Min = value
+		case "max":
+			filter.Max = value
+		default:
+			filter.Value = value
+		}
+	}
+
+	result := make([]repository.AttributeFilter, 0, len(order))
+	for _, key := range order {
+		result = append(result, *filters[key])
+	}
+	return result, nil
+}
+
+// filterDef finds the definition a filter key refers to. Categories that
+// define the key differently make it ambiguous.
+func filterDef(schema []models.AttributeDef, key string) (models.AttributeDef, error) {
+	var found *models.AttributeDef
+	for i := range schema {
+		if schema[i].Key != key {
+			continue
+		}
+		if found != nil && found.Type != schema[i].Type {
+			return models.AttributeDef{}, fmt.Errorf("attribute %q has different types in different categories; filter by category_id", key)
+		}
+		found = &schema[i]
+	}
+	if found == nil {
+		return models.AttributeDef{}, fmt.Errorf("unknown attribute %q", key)
+	}
+	def := *found
+	// Filters may name an option of any category defining the enum
+	def.Options = nil
+	for _, d := range schema {
+		if d.Key == key {
+			def.Options = append(def.Options, d.Options...)
+		}
+	}
+	return def, nil
+}
+
+// coerce converts a value to its attribute's type, or describes why it cannot
+func coerce(def models.AttributeDef, raw interface{}) (interface{}, string) {
+	switch def.Type {
+	case models.AttributeNumber:
+		switch v := raw.(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				return nil, "must be a finite number"
+			}
+			return v, ""
+		case int:
+			return float64(v), ""
+		case int64:
+			return float64(v), ""
+		case string:
+			n, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || math.IsNaN(n) || math.IsInf(n, 0) {
+				return nil, "must be a number"
+			}
+			return n, ""
+		}
+		return nil, "must be a number"
+	case models.AttributeDate:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, "must be a date as YYYY-MM-DD"
+		}
+		v = strings.TrimSpace(v)
+		if t, err := time.Parse(dateLayout, v); err == nil {
+			return t.Format(dateLayout), ""
+		}
+		if t, err := time.Parse(time.RFC3339, v); err == nil {
+			return t.UTC().Format(dateLayout), ""
+		}
+		return nil, "must be a date as YYYY-MM-DD"
+	case models.AttributeEnum:
+		v, ok := raw.(string)
+		if !ok || !slices.Contains(def.Options, strings.TrimSpace(v)) {
+			return nil, "must be one of " + strings.Join(def.Options, ", ")
+		}
+		return strings.TrimSpace(v), ""
+	default:
+		v, ok := raw.(string)
+		if !ok {
+			return nil, "must be text"
+		}
+		return strings.TrimSpace(v), ""
+	}
+}
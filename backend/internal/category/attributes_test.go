@@ -0,0 +1,220 @@
+package category
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// categoryEnv is a company with Tools, its subcategory Drills, and Paint,
+// which defines color as a string where Tools has it as an enum
+type categoryEnv struct {
+	service *Service
+	company primitive.ObjectID
+	tools   *models.Category
+	drills  *models.Category
+	paint   *models.Category
+}
+
+func newCategoryEnv(t *testing.T) *categoryEnv {
+	t.Helper()
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	env := &categoryEnv{service: NewService(repos.Categories, repos.Items), company: primitive.NewObjectID()}
+
+	env.tools = &models.Category{CompanyID: env.company, Name: "Tools", Attributes: []models.AttributeDef{
+		{Key: "weight", Type: models.AttributeNumber, Required: true, Unit: "kg"},
+		{Key: "color", Type: models.AttributeEnum, Options: []string{"red", "blue"}},
+		{Key: "bought", Type: models.AttributeDate},
+		{Key: "note", Type: models.AttributeString},
+	}}
+	env.drills = &models.Category{CompanyID: env.company, Name: "Drills", Attributes: []models.AttributeDef{
+		{Key: "voltage", Type: models.AttributeNumber},
+	}}
+	env.paint = &models.Category{CompanyID: env.company, Name: "Paint", Attributes: []models.AttributeDef{
+		{Key: "color", Type: models.AttributeString},
+	}}
+	if err := env.service.Create(ctx, env.tools); err != nil {
+		t.Fatal(err)
+	}
+	env.drills.ParentID = &env.tools.ID
+	for _, category := range []*models.Category{env.drills, env.paint} {
+		if err := env.service.Create(ctx, category); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return env
+}
+
+func TestValidate(t *testing.T) {
+	env := newCategoryEnv(t)
+
+	tests := []struct {
+		name       string
+		category   *models.Category
+		attributes map[string]interface{}
+		want       map[string]interface{}
+		problems   []AttributeError
+	}{
+		{
+			name:       "normalizes numbers, enums and dates",
+			category:   env.tools,
+			attributes: map[string]interface{}{"weight": "2.5", "color": " red ", "bought": "2026-03-01T23:30:00-02:00", "note": " spare "},
+			want:       map[string]interface{}{"weight": 2.5, "color": "red", "bought": "2026-03-02", "note": "spare"},
+		},
+		{
+			name:       "keeps plain dates",
+			category:   env.tools,
+			attributes: map[string]interface{}{"weight": 1, "bought": "2026-03-01"},
+			want:       map[string]interface{}{"weight": 1.0, "bought": "2026-03-01"},
+		},
+		{
+			name:       "inherits the parent's attributes",
+			category:   env.drills,
+			attributes: map[string]interface{}{"weight": 3.0, "voltage": "18"},
+			want:       map[string]interface{}{"weight": 3.0, "voltage": 18.0},
+		},
+		{
+			name:       "requires required attributes",
+			category:   env.tools,
+			attributes: map[string]interface{}{"weight": "  ", "color": "blue"},
+			problems:   []AttributeError{{"weight", "is required"}},
+		},
+		{
+			name:       "rejects unknown keys",
+			category:   env.tools,
+			attributes: map[string]interface{}{"weight": 1, "voltage": 18, "size": "L"},
+			problems: []AttributeError{
+				{"size", "is not an attribute of this category"},
+				{"voltage", "is not an attribute of this category"},
+			},
+		},
+		{
+			name:       "rejects values outside the enum and bad types",
+			category:   env.tools,
+			attributes: map[string]interface{}{"weight": "heavy", "color": "green", "bought": "March"},
+			problems: []AttributeError{
+				{"weight", "must be a number"},
+				{"color", "must be one of red, blue"},
+				{"bought", "must be a date as YYYY-MM-DD"},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := env.service.Validate(context.Background(), env.company, tt.category.ID, tt.attributes)
+			if tt.problems != nil {
+				var validationErr *ValidationError
+				if !errors.As(err, &validationErr) {
+					t.Fatalf("error = %v, want a validation error", err)
+				}
+				if !reflect.DeepEqual(validationErr.Errors, tt.problems) {
+					t.Fatalf("problems = %v, want %v", validationErr.Errors, tt.problems)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("attributes = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := env.service.Validate(context.Background(), env.company, primitive.NewObjectID(), nil); err != ErrUnknownCategory {
+		t.Fatalf("unknown category: error = %v, want %v", err, ErrUnknownCategory)
+	}
+}
+
+func TestFilters(t *testing.T) {
+	env := newCategoryEnv(t)
+
+	tests := []struct {
+		name     string
+		category *models.Category
+		query    map[string]string
+		want     []repository.AttributeFilter
+		err      string
+	}{
+		{
+			name:  "types exact values by any category defining them",
+			query: map[string]string{"weight": "2", "voltage": "18"},
+			want:  []repository.AttributeFilter{{Key: "voltage", Value: 18.0}, {Key: "weight", Value: 2.0}},
+		},
+		{
+			name:  "merges min and max into one range",
+			query: map[string]string{"weight.min": "1", "weight.max": "5.5", "bought.min": "2026-01-01T10:00:00Z"},
+			want: []repository.AttributeFilter{
+				{Key: "bought", Min: "2026-01-01"},
+				{Key: "weight", Min: 1.0, Max: 5.5},
+			},
+		},
+		{
+			name:  "rejects ranges of strings",
+			query: map[string]string{"note.min": "a"},
+			err:   `only number and date attributes take ranges, not "note"`,
+		},
+		{
+			name:  "rejects unknown bounds",
+			query: map[string]string{"weight.avg": "1"},
+			err:   `unknown attribute filter "weight.avg"`,
+		},
+		{
+			name:  "rejects unknown attributes",
+			query: map[string]string{"size": "L"},
+			err:   `unknown attribute "size"`,
+		},
+		{
+			name:  "rejects values of the wrong type",
+			query: map[string]string{"weight.max": "heavy"},
+			err:   "attribute filter weight.max must be a number",
+		},
+		{
+			name:  "rejects keys typed differently in different categories",
+			query: map[string]string{"color": "red"},
+			err:   `attribute "color" has different types in different categories; filter by category_id`,
+		},
+		{
+			name:     "types ambiguous keys by the category filtered on",
+			category: env.tools,
+			query:    map[string]string{"color": "red"},
+			want:     []repository.AttributeFilter{{Key: "color", Value: "red"}},
+		},
+		{
+			name:     "checks enum options of the category filtered on",
+			category: env.tools,
+			query:    map[string]string{"color": "green"},
+			err:      "attribute filter color must be one of red, blue",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var categoryID *primitive.ObjectID
+			if tt.category != nil {
+				categoryID = &tt.category.ID
+			}
+			got, err := env.service.Filters(context.Background(), env.company, categoryID, tt.query)
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Fatalf("error = %v, want %q", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("filters = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
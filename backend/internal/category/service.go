@@ -0,0 +1,310 @@
+// Package category keeps each company's tree of item categories and the
+// typed attribute schemas that items in a category must follow.
+package category
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxAttributes caps the attributes a category defines
+const maxAttributes = 100
+
+var (
+	ErrInvalidName   = errors.New("name is required")
+	ErrInvalidParent = errors.New("parent must be another category of the company")
+	ErrInvalidSchema = errors.New("invalid attribute schema")
+	ErrNotEmpty      = errors.New("category still has subcategories or items")
+	// ErrUnknownCategory is returned when an item names a category that does not exist
+	ErrUnknownCategory = errors.New("category not found")
+)
+
+// keyPattern keeps attribute keys usable as report columns and query fields
+var keyPattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Node is a category with its subcategories
+type Node struct {
+	models.Category
+	Children []*Node `json:"children"`
+}
+
+// Service manages categories and checks item attributes against them
+type Service struct {
+	categories repository.CategoryRepository
+	items      repository.ItemRepository
+}
+
+func NewService(categories repository.CategoryRepository, items repository.ItemRepository) *Service {
+	return &Service{categories: categories, items: items}
+}
+
+// Create adds a category under its parent, or at the top level. Its
+// attributes may not redefine those it inherits.
+func (s *Service) Create(ctx context.Context, category *models.Category) error {
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		return ErrInvalidName
+	}
+	attributes, err := normalizeSchema(category.Attributes)
+	if err != nil {
+		return err
+	}
+	category.Attributes = attributes
+
+	if category.ParentID != nil {
+		inherited, err := s.Schema(ctx, category.CompanyID, *category.ParentID)
+		if err == repository.ErrNotFound {
+			return ErrInvalidParent
+		}
+		if err != nil {
+			return err
+		}
+		if err := checkOverlap(attributes, inherited, "a parent category"); err != nil {
+			return err
+		}
+	}
+
+	now := time.Now()
+	category.CreatedAt = now
+	category.UpdatedAt = now
+	return s.categories.Create(ctx, category)
+}
+
+// Update renames a category or replaces its own attributes. Items already in
+// the category are checked against the new schema when they are next saved.
+func (s *Service) Update(ctx context.Context, companyID, id primitive.ObjectID, update repository.CategoryUpdate) (*models.Category, error) {
+	if update.Name != nil {
+		name := strings.TrimSpace(*update.Name)
+		if name == "" {
+			return nil, ErrInvalidName
+		}
+		update.Name = &name
+	}
+	if update.Attributes != nil {
+		attributes, err := normalizeSchema(update.Attributes)
+		if err != nil {
+			return nil, err
+		}
+		update.Attributes = attributes
+
+		categories, err := s.categories.List(ctx, companyID)
+		if err != nil {
+			return nil, err
+		}
+		byID := index(categories)
+		category, ok := byID[id]
+		if !ok {
+			return nil, repository.ErrNotFound
+		}
+		if err := checkOverlap(attributes, inheritedSchema(byID, category.ParentID), "a parent category"); err != nil {
+			return nil, err
+		}
+		for _, c := range categories {
+			if c.ID != id && slices.Contains(ancestors(byID, c.ParentID), id) {
+				if err := checkOverlap(attributes, c.Attributes, "subcategory "+c.Name); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+	return s.categories.Update(ctx, companyID, id, update)
+}
+
+// Delete removes a category that has no subcategories and no items, archived
+// ones included, and returns it
+func (s *Service) Delete(ctx context.Context, companyID, id primitive.ObjectID) (*models.Category, error) {
+	category, err := s.categories.Get(ctx, companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	hasChildren, err := s.categories.HasChildren(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	hasItems, err := s.items.InCategory(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if hasChildren || hasItems {
+		return nil, ErrNotEmpty
+	}
+	if err := s.categories.Delete(ctx, companyID, id); err != nil {
+		return nil, err
+	}
+	return category, nil
+}
+
+// Get returns a category with its full schema, inherited attributes first
+func (s *Service) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Category, []models.AttributeDef, error) {
+	category, err := s.categories.Get(ctx, companyID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	schema, err := s.Schema(ctx, companyID, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return category, schema, nil
+}
+
+// Tree returns the company's categories nested under their parents, each
+// level ordered by name
+func (s *Service) Tree(ctx context.Context, companyID primitive.ObjectID) ([]*Node, error) {
+	categories, err := s.categories.List(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make(map[primitive.ObjectID]*Node, len(categories))
+	for _, category := range categories {
+		nodes[category.ID] = &Node{Category: category, Children: []*Node{}}
+	}
+	roots := []*Node{}
+	for _, category := range categories {
+		node := nodes[category.ID]
+		if parent, ok := nodes[derefID(category.ParentID)]; ok {
+			parent.Children = append(parent.Children, node)
+		} else {
+			roots = append(roots, node)
+		}
+	}
+	return roots, nil
+}
+
+// Schema returns the attributes of a category, those of its ancestors first
+func (s *Service) Schema(ctx context.Context, companyID, id primitive.ObjectID) ([]models.AttributeDef, error) {
+	categories, err := s.categories.List(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	byID := index(categories)
+	if _, ok := byID[id]; !ok {
+		return nil, repository.ErrNotFound
+	}
+	return inheritedSchema(byID, &id), nil
+}
+
+// Descendants returns a category and every category below it
+func (s *Service) Descendants(ctx context.Context, companyID, id primitive.ObjectID) ([]primitive.ObjectID, error) {
+	categories, err := s.categories.List(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	byID := index(categories)
+	if _, ok := byID[id]; !ok {
+		return nil, repository.ErrNotFound
+	}
+	ids := []primitive.ObjectID{id}
+	for _, category := range categories {
+		if category.ID != id && slices.Contains(ancestors(byID, category.ParentID), id) {
+			ids = append(ids, category.ID)
+		}
+	}
+	return ids, nil
+}
+
+// index maps categories by ID
+func index(categories []models.Category) map[primitive.ObjectID]models.Category {
+	byID := make(map[primitive.ObjectID]models.Category, len(categories))
+	for _, category := range categories {
+		byID[category.ID] = category
+	}
+	return byID
+}
+
+// ancestors returns the IDs from id up to the top of the tree
+func ancestors(byID map[primitive.ObjectID]models.Category, id *primitive.ObjectID) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	for id != nil && len(ids) <= len(byID) {
+		category, ok := byID[*id]
+		if !ok {
+			break
+		}
+		ids = append(ids, category.ID)
+		id = category.ParentID
+	}
+	return ids
+}
+
+// inheritedSchema returns the attributes of id and its ancestors, outermost first
+func inheritedSchema(byID map[primitive.ObjectID]models.Category, id *primitive.ObjectID) []models.AttributeDef {
+	chain := ancestors(byID, id)
+	schema := []models.AttributeDef{}
+	for i := len(chain) - 1; i >= 0; i-- {
+		schema = append(schema, byID[chain[i]].Attributes...)
+	}
+	return schema
+}
+
+func derefID(id *primitive.ObjectID) primitive.ObjectID {
+	if id == nil {
+		return primitive.NilObjectID
+	}
+	return *id
+}
+
+// normalizeSchema trims and checks attribute definitions
+func normalizeSchema(attributes []models.AttributeDef) ([]models.AttributeDef, error) {
+	if len(attributes) > maxAttributes {
+		return nil, fmt.Errorf("%w: a category defines at most %d attributes", ErrInvalidSchema, maxAttributes)
+	}
+	normalized := make([]models.AttributeDef, 0, len(attributes))
+	seen := map[string]bool{}
+	for _, def := range attributes {
+		def.Key = strings.TrimSpace(def.Key)
+		def.Label = strings.TrimSpace(def.Label)
+		def.Type = strings.ToLower(strings.TrimSpace(def.Type))
+		def.Unit = strings.TrimSpace(def.Unit)
+
+		switch {
+		case !keyPattern.MatchString(def.Key):
+			return nil, fmt.Errorf("%w: key %q must be lower case letters, digits and underscores, starting with a letter", ErrInvalidSchema, def.Key)
+		case seen[def.Key]:
+			return nil, fmt.Errorf("%w: attribute %q is defined twice", ErrInvalidSchema, def.Key)
+		case !slices.Contains(models.AttributeTypes, def.Type):
+			return nil, fmt.Errorf("%w: type of %q must be one of %s", ErrInvalidSchema, def.Key, strings.Join(models.AttributeTypes, ", "))
+		case def.Unit != "" && def.Type != models.AttributeNumber:
+			return nil, fmt.Errorf("%w: only numbers have units, not %q", ErrInvalidSchema, def.Key)
+		case def.Type == models.AttributeEnum && len(def.Options) == 0:
+			return nil, fmt.Errorf("%w: enum %q needs options", ErrInvalidSchema, def.Key)
+		case def.Type != models.AttributeEnum && len(def.Options) > 0:
+			return nil, fmt.Errorf("%w: only enums have options, not %q", ErrInvalidSchema, def.Key)
+		}
+		seen[def.Key] = true
+
+		if def.Type == models.AttributeEnum {
+			options := make([]string, 0, len(def.Options))
+			for _, option := range def.Options {
+				option = strings.TrimSpace(option)
+				if option == "" || slices.Contains(options, option) {
+					return nil, fmt.Errorf("%w: options of %q must be distinct and not empty", ErrInvalidSchema, def.Key)
+				}
+				options = append(options, option)
+			}
+			def.Options = options
+		}
+		normalized = append(normalized, def)
+	}
+	return normalized, nil
+}
+
+// checkOverlap rejects attributes that other, an ancestor's or descendant's
+// schema, already defines
+func checkOverlap(attributes, other []models.AttributeDef, owner string) error {
+	for _, def := range attributes {
+		for _, existing := range other {
+			if def.Key == existing.Key {
+				return fmt.Errorf("%w: attribute %q is already defined by %s", ErrInvalidSchema, def.Key, owner)
+			}
+		}
+	}
+	return nil
+}
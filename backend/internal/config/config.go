@@ -2,6 +2,7 @@ package config
 
 import (
 	"log"
+	"strings"
 	"time"
 
 	"github.com/spf13/viper"
@@ -16,11 +17,16 @@ type Config struct {
 	Audit    AuditConfig
 	Backup   BackupConfig
 	Captcha  CaptchaConfig
+	Anomaly  AnomalyConfig
+	Pricing  PricingConfig
+	Label    LabelConfig
+	Items    ItemConfig
 }
 
 type DatabaseConfig struct {
-	URI      string
-	Database string
+	URI            string
+	Database       string
+	MigrateOnStart bool
 }
 
 type RedisConfig struct {
@@ -47,16 +53,43 @@ type ServerConfig struct {
 	Port           string
 	GinMode        string
 	TrustedProxies []string
+	IdempotencyTTL time.Duration // How long responses to Idempotency-Key requests are replayed
 }
 
 type AuditConfig struct {
-	EncryptionKey string
+	EncryptionKey     string
+	RedactFields      []string
+	SigningKey        string
+	ArchivePath       string
+	ArchiveKey        string
+	RetentionInterval time.Duration
+	Sinks             string // JSON array of syslog/webhook forwarding targets
 }
 
 type BackupConfig struct {
-	Path          string
-	RetentionDays int
-	EncryptionKey string
+	Path            string
+	RetentionDays   int
+	EncryptionKey   string
+	ScheduleEnabled bool
+	ScheduleHour    int // Local hour of the nightly backup run
+}
+
+type AnomalyConfig struct {
+	Enabled     bool
+	Rules       string // JSON array of rule overrides
+	EmailAlerts bool
+}
+
+type PricingConfig struct {
+	ScheduleInterval time.Duration // How often future-dated price changes are checked and applied
+}
+
+type LabelConfig struct {
+	Templates string // JSON array of custom label templates
+}
+
+type ItemConfig struct {
+	PurgeAfter time.Duration // How long items stay archived before they can be purged
 }
 
 type CaptchaConfig struct {
@@ -81,10 +114,31 @@ func Load() *Config {
 		refreshExpiry = 168 * time.Hour // 7 days
 	}
 
+	retentionInterval, _ := time.ParseDuration(viper.GetString("AUDIT_RETENTION_INTERVAL"))
+	if retentionInterval == 0 {
+		retentionInterval = 24 * time.Hour
+	}
+
+	idempotencyTTL, _ := time.ParseDuration(viper.GetString("IDEMPOTENCY_TTL"))
+	if idempotencyTTL == 0 {
+		idempotencyTTL = 24 * time.Hour
+	}
+
+	priceInterval, _ := time.ParseDuration(viper.GetString("PRICE_SCHEDULE_INTERVAL"))
+	if priceInterval == 0 {
+		priceInterval = time.Minute
+	}
+
+	backupHour := 2
+	if viper.IsSet("BACKUP_SCHEDULE_HOUR") {
+		backupHour = viper.GetInt("BACKUP_SCHEDULE_HOUR")
+	}
+
 	return &Config{
 		Database: DatabaseConfig{
-			URI:      viper.GetString("MONGODB_URI"),
-			Database: viper.GetString("MONGODB_DATABASE"),
+			URI:            viper.GetString("MONGODB_URI"),
+			Database:       viper.GetString("MONGODB_DATABASE"),
+			MigrateOnStart: viper.GetBool("MIGRATE_ON_START"),
 		},
 		Redis: RedisConfig{
 			URL: viper.GetString("REDIS_URL"),
@@ -107,17 +161,51 @@ func Load() *Config {
 			Port:           viper.GetString("PORT"),
 			GinMode:        viper.GetString("GIN_MODE"),
 			TrustedProxies: viper.GetStringSlice("TRUSTED_PROXIES"),
+			IdempotencyTTL: idempotencyTTL,
 		},
 		Audit: AuditConfig{
-			EncryptionKey: viper.GetString("AUDIT_ENCRYPTION_KEY"),
+			EncryptionKey:     viper.GetString("AUDIT_ENCRYPTION_KEY"),
+			RedactFields:      splitList(viper.GetString("AUDIT_REDACT_FIELDS")),
+			SigningKey:        viper.GetString("AUDIT_SIGNING_KEY"),
+			ArchivePath:       viper.GetString("AUDIT_ARCHIVE_PATH"),
+			ArchiveKey:        viper.GetString("AUDIT_ARCHIVE_KEY"),
+			RetentionInterval: retentionInterval,
+			Sinks:             viper.GetString("AUDIT_SINKS"),
 		},
 		Backup: BackupConfig{
-			Path:          viper.GetString("BACKUP_PATH"),
-			RetentionDays: viper.GetInt("BACKUP_RETENTION_DAYS"),
-			EncryptionKey: viper.GetString("BACKUP_ENCRYPTION_KEY"),
+			Path:            viper.GetString("BACKUP_PATH"),
+			RetentionDays:   viper.GetInt("BACKUP_RETENTION_DAYS"),
+			EncryptionKey:   viper.GetString("BACKUP_ENCRYPTION_KEY"),
+			ScheduleEnabled: !viper.IsSet("BACKUP_SCHEDULE_ENABLED") || viper.GetBool("BACKUP_SCHEDULE_ENABLED"),
+			ScheduleHour:    backupHour,
 		},
 		Captcha: CaptchaConfig{
 			Secret: viper.GetString("CAPTCHA_SECRET"),
 		},
+		Anomaly: AnomalyConfig{
+			Enabled:     !viper.IsSet("ANOMALY_DETECTION_ENABLED") || viper.GetBool("ANOMALY_DETECTION_ENABLED"),
+			Rules:       viper.GetString("ANOMALY_RULES"),
+			EmailAlerts: viper.GetBool("ANOMALY_EMAIL_ALERTS"),
+		},
+		Pricing: PricingConfig{
+			ScheduleInterval: priceInterval,
+		},
+		Label: LabelConfig{
+			Templates: viper.GetString("LABEL_TEMPLATES"),
+		},
+		Items: ItemConfig{
+			PurgeAfter: time.Duration(viper.GetInt("ITEM_PURGE_AFTER_DAYS")) * 24 * time.Hour,
+		},
+	}
+}
+
+// splitList parses a comma-separated environment value, dropping empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
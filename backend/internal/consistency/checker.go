@@ -0,0 +1,273 @@
+// Package consistency finds references between collections that were left
+// dangling by partial writes, and repairs the ones that have a safe fix.
+package consistency
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Issue kinds
+const (
+	// KindOrphanLocation is a stock location whose item no longer exists; repaired by deleting it
+	KindOrphanLocation = "orphan_location"
+	// KindItemWithoutLocation is an active item with no stock location; repaired by archiving it
+	KindItemWithoutLocation = "item_without_location"
+	// KindStaleSupervisor is a warehouse whose supervisor was deleted, demoted or moved; repaired by unassigning
+	KindStaleSupervisor = "stale_supervisor"
+	// KindLocationWithoutWarehouse is stock held in a missing warehouse; reported only
+	KindLocationWithoutWarehouse = "location_without_warehouse"
+	// KindUserWithoutWarehouse is a Staff or Supervisor assigned to a missing warehouse; reported only
+	KindUserWithoutWarehouse = "user_without_warehouse"
+)
+
+// Issue is one inconsistency found by the checker
+type Issue struct {
+	Kind       string             `json:"kind"`
+	Collection string             `json:"collection"`
+	ID         primitive.ObjectID `json:"id"`
+	CompanyID  primitive.ObjectID `json:"company_id,omitempty"`
+	Detail     string             `json:"detail"`
+	Repairable bool               `json:"repairable"`
+	Repaired   bool               `json:"repaired"`
+}
+
+// Report lists every issue found in one run
+type Report struct {
+	Issues    []Issue   `json:"issues"`
+	Repaired  int       `json:"repaired"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+// Unresolved counts issues still present after the run
+func (r *Report) Unresolved() int {
+	return len(r.Issues) - r.Repaired
+}
+
+// Checker scans the inventory collections for dangling references. The checks
+// join raw collections, including documents no repository would return, so it
+// works on db directly.
+type Checker struct {
+	auditService *audit.AuditService
+	db           *mongo.Database
+}
+
+func NewChecker(auditService *audit.AuditService, db *mongo.Database) *Checker {
+	return &Checker{auditService: auditService, db: db}
+}
+
+type check struct {
+	find   func(ctx context.Context) ([]Issue, error)
+	repair func(ctx context.Context, issue Issue) error
+}
+
+// Run performs every check. With repair set, repairable issues are fixed and
+// each fix is audited as the system actor.
+func (c *Checker) Run(ctx context.Context, repair bool) (*Report, error) {
+	checks := []check{
+		{find: c.orphanLocations, repair: c.deleteLocation},
+		{find: c.itemsWithoutLocation, repair: c.archiveItem},
+		{find: c.staleSupervisors, repair: c.unassignSupervisor},
+		{find: c.locationsWithoutWarehouse},
+		{find: c.usersWithoutWarehouse},
+	}
+
+	report := &Report{Issues: []Issue{}, CheckedAt: time.Now()}
+	for _, chk := range checks {
+		issues, err := chk.find(ctx)
+		if err != nil {
+			return nil, err
+		}
+		for _, issue := range issues {
+			issue.Repairable = chk.repair != nil
+			if repair && issue.Repairable {
+				if err := chk.repair(ctx, issue); err != nil {
+					return nil, err
+				}
+				issue.Repaired = true
+				report.Repaired++
+				c.auditService.LogAction(ctx, primitive.NilObjectID, issue.CompanyID, "system", "REPAIR", "CONSISTENCY", &issue.ID,
+					map[string]interface{}{
+						"kind":       issue.Kind,
+						"collection": issue.Collection,
+						"detail":     issue.Detail,
+					}, "", "", "SUCCESS")
+			}
+			report.Issues = append(report.Issues, issue)
+		}
+	}
+	return report, nil
+}
+
+// orphanLocations finds locations whose item is gone. The company is taken
+// from the location's warehouse, since the item cannot tell it any more.
+func (c *Checker) orphanLocations(ctx context.Context) ([]Issue, error) {
+	pipeline := mongo.Pipeline{
+		lookup("items", "item_id", "item"),
+		{{Key: "$match", Value: bson.M{"item": bson.M{"$size": 0}}}},
+		lookup("warehouses", "warehouse_id", "warehouse"),
+		{{Key: "$project", Value: bson.M{
+			"item_id":    1,
+			"company_id": bson.M{"$arrayElemAt": bson.A{"$warehouse.company_id", 0}},
+		}}},
+	}
+	return c.aggregate(ctx, "item_locations", pipeline, func(doc reference) Issue {
+		return Issue{
+			Kind:       KindOrphanLocation,
+			Collection: "item_locations",
+			ID:         doc.ID,
+			CompanyID:  doc.CompanyID,
+			Detail:     "item " + doc.ItemID.Hex() + " does not exist",
+		}
+	})
+}
+
+func (c *Checker) itemsWithoutLocation(ctx context.Context) ([]Issue, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"is_archived": false}}},
+		{{Key: "$lookup", Value: bson.M{
+			"from":         "item_locations",
+			"localField":   "_id",
+			"foreignField": "item_id",
+			"as":           "locations",
+		}}},
+		{{Key: "$match", Value: bson.M{"locations": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"company_id": 1, "sku": 1}}},
+	}
+	return c.aggregate(ctx, "items", pipeline, func(doc reference) Issue {
+		return Issue{
+			Kind:       KindItemWithoutLocation,
+			Collection: "items",
+			ID:         doc.ID,
+			CompanyID:  doc.CompanyID,
+			Detail:     "item " + doc.SKU + " has no stock location",
+		}
+	})
+}
+
+// staleSupervisors finds warehouses pointing at a user who no longer exists,
+// is no longer a Supervisor, or now belongs to another warehouse
+func (c *Checker) staleSupervisors(ctx context.Context) ([]Issue, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"supervisor_id": bson.M{"$exists": true, "$ne": nil}}}},
+		lookup("users", "supervisor_id", "supervisor"),
+		{{Key: "$match", Value: bson.M{"$or": bson.A{
+			bson.M{"supervisor": bson.M{"$size": 0}},
+			bson.M{"supervisor.role": bson.M{"$ne": "Supervisor"}},
+			bson.M{"$expr": bson.M{"$ne": bson.A{
+				bson.M{"$arrayElemAt": bson.A{"$supervisor.warehouse_id", 0}}, "$_id",
+			}}},
+		}}}},
+		{{Key: "$project", Value: bson.M{"company_id": 1, "supervisor_id": 1}}},
+	}
+	return c.aggregate(ctx, "warehouses", pipeline, func(doc reference) Issue {
+		return Issue{
+			Kind:       KindStaleSupervisor,
+			Collection: "warehouses",
+			ID:         doc.ID,
+			CompanyID:  doc.CompanyID,
+			Detail:     "supervisor " + doc.SupervisorID.Hex() + " is missing or no longer supervises this warehouse",
+		}
+	})
+}
+
+func (c *Checker) locationsWithoutWarehouse(ctx context.Context) ([]Issue, error) {
+	pipeline := mongo.Pipeline{
+		lookup("warehouses", "warehouse_id", "warehouse"),
+		{{Key: "$match", Value: bson.M{"warehouse": bson.M{"$size": 0}}}},
+		lookup("items", "item_id", "item"),
+		{{Key: "$project", Value: bson.M{
+			"warehouse_id": 1,
+			"company_id":   bson.M{"$arrayElemAt": bson.A{"$item.company_id", 0}},
+		}}},
+	}
+	return c.aggregate(ctx, "item_locations", pipeline, func(doc reference) Issue {
+		return Issue{
+			Kind:       KindLocationWithoutWarehouse,
+			Collection: "item_locations",
+			ID:         doc.ID,
+			CompanyID:  doc.CompanyID,
+			Detail:     "warehouse " + doc.WarehouseID.Hex() + " does not exist",
+		}
+	})
+}
+
+func (c *Checker) usersWithoutWarehouse(ctx context.Context) ([]Issue, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"role":         bson.M{"$in": bson.A{"Supervisor", "Staff"}},
+			"warehouse_id": bson.M{"$exists": true, "$ne": nil},
+		}}},
+		lookup("warehouses", "warehouse_id", "warehouse"),
+		{{Key: "$match", Value: bson.M{"warehouse": bson.M{"$size": 0}}}},
+		{{Key: "$project", Value: bson.M{"company_id": 1, "warehouse_id": 1}}},
+	}
+	return c.aggregate(ctx, "users", pipeline, func(doc reference) Issue {
+		return Issue{
+			Kind:       KindUserWithoutWarehouse,
+			Collection: "users",
+			ID:         doc.ID,
+			CompanyID:  doc.CompanyID,
+			Detail:     "warehouse " + doc.WarehouseID.Hex() + " does not exist",
+		}
+	})
+}
+
+func (c *Checker) deleteLocation(ctx context.Context, issue Issue) error {
+	_, err := c.db.Collection("item_locations").DeleteOne(ctx, bson.M{"_id": issue.ID})
+	return err
+}
+
+func (c *Checker) archiveItem(ctx context.Context, issue Issue) error {
+	_, err := c.db.Collection("items").UpdateOne(ctx, bson.M{"_id": issue.ID},
+		bson.M{"$set": bson.M{"is_archived": true, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	return err
+}
+
+func (c *Checker) unassignSupervisor(ctx context.Context, issue Issue) error {
+	_, err := c.db.Collection("warehouses").UpdateOne(ctx, bson.M{"_id": issue.ID},
+		bson.M{"$unset": bson.M{"supervisor_id": ""}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	return err
+}
+
+// reference holds the fields the check pipelines project
+type reference struct {
+	ID           primitive.ObjectID `bson:"_id"`
+	CompanyID    primitive.ObjectID `bson:"company_id"`
+	ItemID       primitive.ObjectID `bson:"item_id"`
+	WarehouseID  primitive.ObjectID `bson:"warehouse_id"`
+	SupervisorID primitive.ObjectID `bson:"supervisor_id"`
+	SKU          string             `bson:"sku"`
+}
+
+func lookup(from, localField, as string) bson.D {
+	return bson.D{{Key: "$lookup", Value: bson.M{
+		"from":         from,
+		"localField":   localField,
+		"foreignField": "_id",
+		"as":           as,
+	}}}
+}
+
+func (c *Checker) aggregate(ctx context.Context, collection string, pipeline mongo.Pipeline, toIssue func(doc reference) Issue) ([]Issue, error) {
+	cursor, err := c.db.Collection(collection).Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var issues []Issue
+	for cursor.Next(ctx) {
+		var doc reference
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		issues = append(issues, toIssue(doc))
+	}
+	return issues, cursor.Err()
+}
@@ -0,0 +1,58 @@
+package cryptoutil
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"io"
+)
+
+var ErrCiphertextTooShort = errors.New("ciphertext too short")
+
+// DeriveKey turns an arbitrary secret into a 32-byte AES-256 key.
+// An optional purpose label keeps keys derived from the same secret distinct.
+func DeriveKey(secret, purpose string) []byte {
+	sum := sha256.Sum256([]byte(purpose + ":" + secret))
+	return sum[:]
+}
+
+// Seal encrypts data with AES-GCM, prefixing the random nonce to the ciphertext
+func Seal(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return gcm.Seal(nonce, nonce, data, nil), nil
+}
+
+// Open decrypts data produced by Seal
+func Open(key, data []byte) ([]byte, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	nonceSize := gcm.NonceSize()
+	if len(data) < nonceSize {
+		return nil, ErrCiphertextTooShort
+	}
+
+	nonce, ciphertext := data[:nonceSize], data[nonceSize:]
+	return gcm.Open(nil, nonce, ciphertext, nil)
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
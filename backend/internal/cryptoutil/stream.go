@@ -0,0 +1,178 @@
+package cryptoutil
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// streamMagic prefixes every encrypted stream
+var streamMagic = []byte("SWENC1")
+
+// streamChunkSize is the plaintext size of each sealed frame
+const streamChunkSize = 64 * 1024
+
+var (
+	ErrInvalidStream   = errors.New("not an encrypted stream")
+	ErrTruncatedStream = errors.New("encrypted stream is truncated")
+)
+
+// StreamWriter encrypts a stream as a sequence of AES-GCM frames. Each frame is
+// authenticated with its index and a final flag, so reordering, dropping or
+// truncating frames is detected on read. Close must be called to write the final frame.
+type StreamWriter struct {
+	w      io.Writer
+	gcm    cipher.AEAD
+	buf    []byte
+	index  uint64
+	closed bool
+}
+
+// NewStreamWriter starts an encrypted stream on w
+func NewStreamWriter(w io.Writer, key []byte) (*StreamWriter, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(streamMagic); err != nil {
+		return nil, err
+	}
+	return &StreamWriter{w: w, gcm: gcm, buf: make([]byte, 0, streamChunkSize)}, nil
+}
+
+// Write buffers plaintext, sealing full chunks as they fill
+func (s *StreamWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(s.buf[len(s.buf):cap(s.buf)], p)
+		s.buf = s.buf[:len(s.buf)+n]
+		p = p[n:]
+		written += n
+
+		if len(s.buf) == cap(s.buf) && len(p) > 0 {
+			if err := s.writeFrame(false); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// Close seals the remaining buffer as the final frame
+func (s *StreamWriter) Close() error {
+	if s.closed {
+		return nil
+	}
+	s.closed = true
+	return s.writeFrame(true)
+}
+
+func (s *StreamWriter) writeFrame(final bool) error {
+	nonce := make([]byte, s.gcm.NonceSize())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return err
+	}
+
+	sealed := s.gcm.Seal(nonce, nonce, s.buf, frameAAD(s.index, final))
+	header := make([]byte, 4)
+	binary.BigEndian.PutUint32(header, uint32(len(sealed)))
+	if _, err := s.w.Write(header); err != nil {
+		return err
+	}
+	if _, err := s.w.Write(sealed); err != nil {
+		return err
+	}
+
+	s.index++
+	s.buf = s.buf[:0]
+	return nil
+}
+
+// StreamReader decrypts a stream produced by StreamWriter
+type StreamReader struct {
+	r     io.Reader
+	gcm   cipher.AEAD
+	buf   []byte
+	index uint64
+	done  bool
+}
+
+// NewStreamReader validates the stream header and prepares to decrypt
+func NewStreamReader(r io.Reader, key []byte) (*StreamReader, error) {
+	gcm, err := newGCM(key)
+	if err != nil {
+		return nil, err
+	}
+
+	magic := make([]byte, len(streamMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || !bytes.Equal(magic, streamMagic) {
+		return nil, ErrInvalidStream
+	}
+	return &StreamReader{r: r, gcm: gcm}, nil
+}
+
+// Read returns decrypted plaintext
+func (s *StreamReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		if err := s.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+func (s *StreamReader) readFrame() error {
+	header := make([]byte, 4)
+	if _, err := io.ReadFull(s.r, header); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return ErrTruncatedStream
+		}
+		return err
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > streamChunkSize+uint32(s.gcm.NonceSize()+s.gcm.Overhead()) {
+		return ErrInvalidStream
+	}
+	frame := make([]byte, size)
+	if _, err := io.ReadFull(s.r, frame); err != nil {
+		return ErrTruncatedStream
+	}
+
+	nonceSize := s.gcm.NonceSize()
+	if len(frame) < nonceSize {
+		return ErrCiphertextTooShort
+	}
+	nonce, ciphertext := frame[:nonceSize], frame[nonceSize:]
+
+	// Try as a regular frame first, then as the final frame
+	plaintext, err := s.gcm.Open(nil, nonce, ciphertext, frameAAD(s.index, false))
+	if err != nil {
+		plaintext, err = s.gcm.Open(nil, nonce, ciphertext, frameAAD(s.index, true))
+		if err != nil {
+			return err
+		}
+		s.done = true
+	}
+
+	s.index++
+	s.buf = plaintext
+	return nil
+}
+
+func frameAAD(index uint64, final bool) []byte {
+	aad := make([]byte, 9)
+	binary.BigEndian.PutUint64(aad, index)
+	if final {
+		aad[8] = 1
+	}
+	return aad
+}
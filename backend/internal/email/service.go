@@ -102,3 +102,36 @@ func (e *EmailService) SendPasswordResetEmail(to, token string) error {
 
 	return e.SendEmail(to, "Reset your SafeWare password", body.String())
 }
+
+func (e *EmailService) SendSecurityAlertEmail(to, severity, title, description string) error {
+	alertsURL := fmt.Sprintf("%s/manager/security-alerts", e.frontendURL)
+
+	tmpl := `
+	<html>
+	<body style="font-family: Arial, sans-serif; line-height: 1.6; color: #333;">
+		<div style="max-width: 600px; margin: 0 auto; padding: 20px;">
+			<h2 style="color: #dc2626;">Security Alert: {{.Title}}</h2>
+			<p><strong>Severity:</strong> {{.Severity}}</p>
+			<p>{{.Description}}</p>
+			<div style="margin: 30px 0;">
+				<a href="{{.AlertsURL}}" style="background-color: #0ea5e9; color: white; padding: 12px 30px; text-decoration: none; border-radius: 5px; display: inline-block;">Review Alerts</a>
+			</div>
+			<p style="color: #999; font-size: 12px; margin-top: 30px;">This alert was raised automatically by SafeWare anomaly detection.</p>
+		</div>
+	</body>
+	</html>
+	`
+
+	t := template.Must(template.New("alert").Parse(tmpl))
+	var body bytes.Buffer
+	if err := t.Execute(&body, map[string]string{
+		"Title":       title,
+		"Severity":    severity,
+		"Description": description,
+		"AlertsURL":   alertsURL,
+	}); err != nil {
+		return err
+	}
+
+	return e.SendEmail(to, "[SafeWare] Security alert: "+title, body.String())
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/anomaly"
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// alertListLimit caps how many alerts one listing returns
+const alertListLimit = 500
+
+type AlertHandler struct {
+	alerts       repository.AlertRepository
+	auditService *audit.AuditService
+}
+
+func NewAlertHandler(alerts repository.AlertRepository, auditService *audit.AuditService) *AlertHandler {
+	return &AlertHandler{
+		alerts:       alerts,
+		auditService: auditService,
+	}
+}
+
+type UpdateAlertRequest struct {
+	Status string `json:"status" binding:"required"` // open, acknowledged, resolved
+	Note   string `json:"note"`
+}
+
+// List returns security alerts raised by anomaly detection
+func (h *AlertHandler) List(c *gin.Context) {
+	companyObjectID, err := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	filter := repository.AlertFilter{
+		Status:   c.Query("status"),
+		Rule:     c.Query("rule"),
+		Severity: c.Query("severity"),
+	}
+	if userID, err := primitive.ObjectIDFromHex(c.Query("user_id")); err == nil {
+		filter.UserID = userID
+	}
+
+	alerts, err := h.alerts.List(c.Request.Context(), companyObjectID, filter, alertListLimit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security alerts"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"alerts": alerts})
+}
+
+// Update acknowledges or resolves a security alert
+func (h *AlertHandler) Update(c *gin.Context) {
+	var req UpdateAlertRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if !anomaly.ValidStatus(req.Status) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Status must be one of open, acknowledged, resolved"})
+		return
+	}
+
+	alertID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alert ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	err = h.alerts.SetStatus(c.Request.Context(), companyObjectID, alertID, req.Status, req.Note, userObjectID)
+	if err == repository.ErrNotFound {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Security alert not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update security alert"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"SECURITY_ALERT",
+		&alertID,
+		map[string]interface{}{
+			"status": req.Status,
+			"note":   req.Note,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Security alert updated successfully"})
+}
@@ -1,7 +1,11 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"log"
 	"net/http"
+	"time"
 
 	"github.com/a2sv/safeware/internal/audit"
 	"github.com/gin-gonic/gin"
@@ -10,11 +14,13 @@ import (
 
 type AuditHandler struct {
 	auditService *audit.AuditService
+	exporter     *audit.Exporter
 }
 
-func NewAuditHandler(auditService *audit.AuditService) *AuditHandler {
+func NewAuditHandler(auditService *audit.AuditService, exporter *audit.Exporter) *AuditHandler {
 	return &AuditHandler{
 		auditService: auditService,
+		exporter:     exporter,
 	}
 }
 
@@ -28,16 +34,7 @@ func (h *AuditHandler) List(c *gin.Context) {
 		return
 	}
 
-	// Build filter from query params
-	filter := map[string]interface{}{
-		"action":        c.Query("action"),
-		"resource_type": c.Query("resource_type"),
-		"user_id":       c.Query("user_id"),
-		"from_date":     c.Query("from_date"),
-		"to_date":       c.Query("to_date"),
-	}
-
-	logs, err := h.auditService.GetLogs(c.Request.Context(), companyID, filter)
+	logs, err := h.auditService.GetLogs(c.Request.Context(), companyID, auditFilter(c))
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to retrieve audit logs"})
 		return
@@ -45,3 +42,75 @@ func (h *AuditHandler) List(c *gin.Context) {
 
 	c.JSON(http.StatusOK, logs)
 }
+
+// Export streams a signed archive of audit logs in CSV, JSON Lines or CEF format
+func (h *AuditHandler) Export(c *gin.Context) {
+	companyIDStr := c.GetString("company_id")
+	companyID, err := primitive.ObjectIDFromHex(companyIDStr)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+
+	format := c.DefaultQuery("format", audit.FormatCSV)
+	if !audit.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be one of csv, jsonl, cef"})
+		return
+	}
+
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	email := c.GetString("email")
+	filter := auditFilter(c)
+
+	filename := fmt.Sprintf("audit-export-%s-%s.zip", format, time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Status(http.StatusOK)
+
+	manifest, err := h.exporter.Export(c.Request.Context(), c.Writer, companyID, filter, format, email)
+	if err != nil {
+		// Headers are already sent, so the truncated archive is the only signal to the client
+		log.Printf("Error exporting audit logs: %v", err)
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyID,
+		email,
+		"EXPORT",
+		"AUDIT_LOG",
+		nil,
+		map[string]interface{}{
+			"format":       manifest.Format,
+			"record_count": manifest.RecordCount,
+			"sha256":       manifest.SHA256,
+			"filter":       manifest.Filter,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+}
+
+// ExportPublicKey returns the key regulators use to verify export signatures
+func (h *AuditHandler) ExportPublicKey(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"algorithm":  "Ed25519",
+		"public_key": h.exporter.PublicKey(),
+	})
+}
+
+// auditFilter builds the audit log filter from query params
+func auditFilter(c *gin.Context) map[string]interface{} {
+	return map[string]interface{}{
+		"action":        c.Query("action"),
+		"resource_type": c.Query("resource_type"),
+		"status":        c.Query("status"),
+		"user_id":       c.Query("user_id"),
+		"from_date":     c.Query("from_date"),
+		"to_date":       c.Query("to_date"),
+	}
+}
@@ -7,23 +7,25 @@ import (
 
 	"github.com/a2sv/safeware/internal/audit"
 	"github.com/a2sv/safeware/internal/auth"
-	"github.com/a2sv/safeware/internal/database"
 	"github.com/a2sv/safeware/internal/email"
 	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type AuthHandler struct {
+	users        repository.UserRepository
+	companies    repository.CompanyRepository
 	jwtService   *auth.JWTService
 	emailService *email.EmailService
 	auditService *audit.AuditService
 }
 
-func NewAuthHandler(jwtService *auth.JWTService, emailService *email.EmailService, auditService *audit.AuditService) *AuthHandler {
+func NewAuthHandler(users repository.UserRepository, companies repository.CompanyRepository, jwtService *auth.JWTService, emailService *email.EmailService, auditService *audit.AuditService) *AuthHandler {
 	return &AuthHandler{
+		users:        users,
+		companies:    companies,
 		jwtService:   jwtService,
 		emailService: emailService,
 		auditService: auditService,
@@ -77,13 +79,10 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
+	ctx := c.Request.Context()
 
 	// Check if user already exists
-	var existingUser models.User
-	err := usersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&existingUser)
-	if err == nil {
+	if exists, _ := h.users.EmailExists(ctx, req.Email); exists {
 		c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 		return
 	}
@@ -98,15 +97,13 @@ func (h *AuthHandler) Register(c *gin.Context) {
 	var companyID primitive.ObjectID
 	if req.CompanyName != "" {
 		// Create new company
-		companiesCollection := database.GetCollection("companies")
 		company := models.Company{
 			ID:        primitive.NewObjectID(),
 			Name:      req.CompanyName,
 			CreatedAt: time.Now(),
 			UpdatedAt: time.Now(),
 		}
-		_, err := companiesCollection.InsertOne(ctx, company)
-		if err != nil {
+		if err := h.companies.Create(ctx, &company); err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create company"})
 			return
 		}
@@ -141,8 +138,11 @@ func (h *AuthHandler) Register(c *gin.Context) {
 		UpdatedAt:                time.Now(),
 	}
 
-	_, err = usersCollection.InsertOne(ctx, user)
-	if err != nil {
+	if err := h.users.Create(ctx, &user); err != nil {
+		if err == repository.ErrDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create user"})
 		return
 	}
@@ -164,14 +164,12 @@ func (h *AuthHandler) Login(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
+	ctx := c.Request.Context()
 
 	// Find user
-	var user models.User
-	err := usersCollection.FindOne(ctx, bson.M{"email": req.Email}).Decode(&user)
+	user, err := h.users.GetByEmail(ctx, req.Email)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid email or password"})
 			return
 		}
@@ -222,10 +220,7 @@ func (h *AuthHandler) Login(c *gin.Context) {
 	}
 
 	// Update last login
-	now := time.Now()
-	usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
-		"$set": bson.M{"last_login": now},
-	})
+	h.users.SetLastLogin(ctx, user.ID, time.Now())
 
 	// Log successful login audit
 	go h.auditService.LogAction(
@@ -285,17 +280,13 @@ func (h *AuthHandler) RefreshToken(c *gin.Context) {
 	}
 
 	// Get user
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
-
 	userID, err := primitive.ObjectIDFromHex(claims.UserID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	var user models.User
-	err = usersCollection.FindOne(ctx, bson.M{"_id": userID}).Decode(&user)
+	user, err := h.users.GetByID(c.Request.Context(), userID)
 	if err != nil {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "User not found"})
 		return
@@ -334,17 +325,13 @@ func (h *AuthHandler) GetProfile(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
-
 	objectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
 		return
 	}
 
-	var user models.User
-	err = usersCollection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&user)
+	user, err := h.users.GetByID(c.Request.Context(), objectID)
 	if err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 		return
@@ -0,0 +1,178 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/backup"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// restoreConfirmation must be sent in the restore body, since a restore replaces all company data
+const restoreConfirmation = "RESTORE"
+
+type BackupHandler struct {
+	backupService *backup.Service
+	auditService  *audit.AuditService
+}
+
+func NewBackupHandler(backupService *backup.Service, auditService *audit.AuditService) *BackupHandler {
+	return &BackupHandler{
+		backupService: backupService,
+		auditService:  auditService,
+	}
+}
+
+type CreateBackupRequest struct {
+	Notes string `json:"notes"`
+}
+
+type RestoreBackupRequest struct {
+	Confirm string `json:"confirm" binding:"required"`
+}
+
+// Create takes an on-demand encrypted backup of the company
+func (h *BackupHandler) Create(c *gin.Context) {
+	var req CreateBackupRequest
+	// Body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	result, err := h.backupService.BackupCompany(c.Request.Context(), companyObjectID, userObjectID, backup.TypeCompany, req.Notes)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create backup"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"BACKUP",
+		"BACKUP",
+		&result.ID,
+		map[string]interface{}{
+			"backup_type":  result.BackupType,
+			"record_count": result.RecordCount,
+			"sha256":       result.SHA256,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, result)
+}
+
+// List returns the company's backups, newest first
+func (h *BackupHandler) List(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	backups, err := h.backupService.List(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch backups"})
+		return
+	}
+
+	c.JSON(http.StatusOK, backups)
+}
+
+// Get returns one backup's metadata
+func (h *BackupHandler) Get(c *gin.Context) {
+	backupObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	result, err := h.backupService.Get(c.Request.Context(), backupObjectID, companyObjectID)
+	if err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// Restore replaces the company's data with the contents of a backup
+func (h *BackupHandler) Restore(c *gin.Context) {
+	backupObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid backup ID"})
+		return
+	}
+
+	var req RestoreBackupRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Confirm != restoreConfirmation {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Restore must be confirmed with {\"confirm\": \"" + restoreConfirmation + "\"}"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	source, err := h.backupService.Get(c.Request.Context(), backupObjectID, companyObjectID)
+	if err != nil {
+		backupError(c, err)
+		return
+	}
+
+	result, err := h.backupService.Restore(c.Request.Context(), source, companyObjectID, userObjectID)
+
+	status := "SUCCESS"
+	details := map[string]interface{}{"backup_created_at": source.CreatedAt}
+	if result != nil {
+		details["safety_backup_id"] = result.SafetyBackupID.Hex()
+		details["restored_documents"] = result.RestoredDocuments
+	}
+	if err != nil {
+		status = "FAILURE"
+		details["error"] = err.Error()
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"RESTORE",
+		"BACKUP",
+		&backupObjectID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		status,
+	)
+
+	if err != nil {
+		backupError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, result)
+}
+
+// backupError maps backup service errors to HTTP responses
+func backupError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, backup.ErrBackupNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Backup not found"})
+	case errors.Is(err, backup.ErrBackupMissing):
+		c.JSON(http.StatusGone, gin.H{"error": "Backup file is no longer available"})
+	case errors.Is(err, backup.ErrBackupTampered), errors.Is(err, backup.ErrInvalidArchive):
+		c.JSON(http.StatusConflict, gin.H{"error": "Backup failed integrity verification"})
+	case errors.Is(err, backup.ErrWrongCompany):
+		c.JSON(http.StatusForbidden, gin.H{"error": "Backup belongs to another company"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Backup operation failed"})
+	}
+}
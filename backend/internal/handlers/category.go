@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/category"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type CategoryHandler struct {
+	categoryService *category.Service
+	auditService    *audit.AuditService
+}
+
+func NewCategoryHandler(categoryService *category.Service, auditService *audit.AuditService) *CategoryHandler {
+	return &CategoryHandler{
+		categoryService: categoryService,
+		auditService:    auditService,
+	}
+}
+
+type CreateCategoryRequest struct {
+	ParentID   string                `json:"parent_id"`
+	Name       string                `json:"name" binding:"required"`
+	Attributes []models.AttributeDef `json:"attributes"`
+}
+
+type UpdateCategoryRequest struct {
+	Name       *string               `json:"name"`
+	Attributes []models.AttributeDef `json:"attributes"` // Replaces the category's own attributes
+}
+
+// Tree returns the company's categories nested under their parents
+func (h *CategoryHandler) Tree(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	tree, err := h.categoryService.Tree(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load categories"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"categories": tree})
+}
+
+// Get returns a category with its full schema, inherited attributes included
+func (h *CategoryHandler) Get(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	cat, schema, err := h.categoryService.Get(c.Request.Context(), companyObjectID, objectID)
+	if err != nil {
+		categoryError(c, err, "Failed to load category")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"category": cat, "schema": schema})
+}
+
+// Create adds a category, optionally under a parent
+func (h *CategoryHandler) Create(c *gin.Context) {
+	var req CreateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	cat := &models.Category{
+		CompanyID:  companyObjectID,
+		Name:       req.Name,
+		Attributes: req.Attributes,
+		CreatedBy:  userObjectID,
+	}
+	if cat.Attributes == nil {
+		cat.Attributes = []models.AttributeDef{}
+	}
+	if req.ParentID != "" {
+		parentObjectID, err := primitive.ObjectIDFromHex(req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent ID"})
+			return
+		}
+		cat.ParentID = &parentObjectID
+	}
+
+	if err := h.categoryService.Create(c.Request.Context(), cat); err != nil {
+		categoryError(c, err, "Failed to create category")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"CREATE",
+		"CATEGORY",
+		&cat.ID,
+		map[string]interface{}{
+			"name":       cat.Name,
+			"parent_id":  req.ParentID,
+			"attributes": len(cat.Attributes),
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, cat)
+}
+
+// Update renames a category or replaces its attributes
+func (h *CategoryHandler) Update(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+	var req UpdateCategoryRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == nil && req.Attributes == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide name or attributes"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	cat, err := h.categoryService.Update(c.Request.Context(), companyObjectID, objectID,
+		repository.CategoryUpdate{Name: req.Name, Attributes: req.Attributes})
+	if err != nil {
+		categoryError(c, err, "Failed to update category")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"CATEGORY",
+		&objectID,
+		map[string]interface{}{"updates": req},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, cat)
+}
+
+// Delete removes a category without subcategories or items
+func (h *CategoryHandler) Delete(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	cat, err := h.categoryService.Delete(c.Request.Context(), companyObjectID, objectID)
+	if err != nil {
+		categoryError(c, err, "Failed to delete category")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"DELETE",
+		"CATEGORY",
+		&objectID,
+		map[string]interface{}{"name": cat.Name},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Category deleted successfully"})
+}
+
+// categoryError writes the response for a failed category call
+func categoryError(c *gin.Context, err error, message string) {
+	switch {
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+	case err == repository.ErrDuplicate:
+		c.JSON(http.StatusConflict, gin.H{"error": "A category with this name already exists there"})
+	case err == category.ErrNotEmpty:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case err == category.ErrInvalidName, err == category.ErrInvalidParent, errors.Is(err, category.ErrInvalidSchema):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,38 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// setETag exposes a document version as a strong ETag
+func setETag(c *gin.Context, version int64) {
+	c.Header("ETag", `"`+strconv.FormatInt(version, 10)+`"`)
+}
+
+// ifMatch reads the version a client expects from the If-Match header. The
+// version is nil when the header is absent or "*", so the write is
+// unconditional. ok is false for a tag this API never issues, including weak
+// tags, which never match under If-Match.
+func ifMatch(c *gin.Context) (version *int64, ok bool) {
+	header := strings.TrimSpace(c.GetHeader("If-Match"))
+	if header == "" || header == "*" {
+		return nil, true
+	}
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return nil, false
+	}
+	parsed, err := strconv.ParseInt(header[1:len(header)-1], 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	return &parsed, true
+}
+
+// preconditionFailed rejects a write whose If-Match no longer matches
+func preconditionFailed(c *gin.Context, resource string) {
+	c.JSON(http.StatusPreconditionFailed, gin.H{"error": resource + " was modified by another request; reload it and retry"})
+}
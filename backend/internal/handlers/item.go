@@ -2,55 +2,106 @@ package handlers
 
 import (
 	"context"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
 	"github.com/a2sv/safeware/internal/audit"
-	"github.com/a2sv/safeware/internal/database"
+	"github.com/a2sv/safeware/internal/category"
 	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/sku"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/a2sv/safeware/internal/valuation"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type ItemHandler struct {
+	tx           repository.Transactor
+	items        repository.ItemRepository
+	valuation    *valuation.Service
+	pricing      *pricing.Service
+	categories   *category.Service
+	skus         *sku.Service
 	auditService *audit.AuditService
 }
 
-func NewItemHandler(auditService *audit.AuditService) *ItemHandler {
+func NewItemHandler(tx repository.Transactor, items repository.ItemRepository, valuationService *valuation.Service, pricingService *pricing.Service, categoryService *category.Service, skuService *sku.Service, auditService *audit.AuditService) *ItemHandler {
 	return &ItemHandler{
+		tx:           tx,
+		items:        items,
+		valuation:    valuationService,
+		pricing:      pricingService,
+		categories:   categoryService,
+		skus:         skuService,
 		auditService: auditService,
 	}
 }
 
 type CreateItemRequest struct {
-	SKU         string                 `json:"sku" binding:"required"`
-	Name        string                 `json:"name" binding:"required"`
-	Quality     string                 `json:"quality" binding:"required"` // New, Used, Damaged
-	Price       float64                `json:"price"`
-	Department  string                 `json:"department"`
-	Attributes  map[string]interface{} `json:"attributes"`
-	WarehouseID string                 `json:"warehouse_id"` // Optional binding, validated manually
-	Quantity    int                    `json:"quantity" binding:"required,min=0"`
-	Batch       string                 `json:"batch"`
+	SKU          string                 `json:"sku"` // Unique in the company regardless of case; generated from the SKU pattern when empty
+	Name         string                 `json:"name" binding:"required"`
+	Quality      string                 `json:"quality" binding:"required"`          // New, Used, Damaged
+	Price        int64                  `json:"price" binding:"min=0"`               // Minor units per base unit, e.g. cents
+	Currency     string                 `json:"currency"`                            // Must be the company currency if given
+	UnitCost     *int64                 `json:"unit_cost" binding:"omitempty,min=0"` // Cost of one Unit of the initial quantity; defaults to the standard cost or price
+	StandardCost int64                  `json:"standard_cost" binding:"min=0"`
+	Department   string                 `json:"department"`
+	CategoryID   string                 `json:"category_id"`
+	Attributes   map[string]interface{} `json:"attributes"`   // Must match the category's schema
+	BaseUnit     string                 `json:"base_unit"`    // each when empty; g, ml or smaller for weight or volume items
+	Units        []models.UnitOfMeasure `json:"units"`        // e.g. inner_pack, case, pallet
+	WarehouseID  string                 `json:"warehouse_id"` // Optional binding, validated manually
+	Quantity     float64                `json:"quantity" binding:"required,min=0"`
+	Unit         string                 `json:"unit"` // Unit of quantity and unit_cost; defaults to the base unit
+	Batch        string                 `json:"batch"`
 }
 
-type ItemResponse struct {
-	models.Item `bson:",inline"`
-	Quantity    int    `bson:"quantity" json:"quantity"`
-	Batch       string `bson:"batch" json:"batch"`
+type UpdateItemRequest struct {
+	Name         string                 `json:"name"`
+	Quality      string                 `json:"quality"`
+	Price        *int64                 `json:"price" binding:"omitempty,min=0"`
+	Currency     string                 `json:"currency"`
+	StandardCost *int64                 `json:"standard_cost" binding:"omitempty,min=0"`
+	Reason       string                 `json:"reason"` // Kept in the price history when the price or standard cost changes
+	Department   string                 `json:"department"`
+	CategoryID   *string                `json:"category_id"` // "" takes the item out of its category
+	Attributes   map[string]interface{} `json:"attributes"`  // Replaces all attributes
+	Units        []models.UnitOfMeasure `json:"units"`       // Replaces the units besides the base unit, which cannot change
 }
 
-type UpdateItemRequest struct {
-	Name       string                 `json:"name"`
-	Quality    string                 `json:"quality"`
-	Price      *float64               `json:"price"`
-	Department string                 `json:"department"`
-	Attributes map[string]interface{} `json:"attributes"`
+// AdjustQuantityRequest changes one location's stock by Delta, or sets it to
+// Quantity, which requires If-Match with the location's ETag. Both are in
+// Unit, the item's base unit by default. UnitCost values stock added by the
+// adjustment, per Unit.
+type AdjustQuantityRequest struct {
+	LocationID string   `json:"location_id" binding:"required"`
+	Delta      *float64 `json:"delta"`
+	Quantity   *float64 `json:"quantity" binding:"omitempty,min=0"`
+	Unit       string   `json:"unit"`
+	UnitCost   *int64   `json:"unit_cost" binding:"omitempty,min=0"`
+	Reason     string   `json:"reason"`
+}
+
+// itemStockView is an item's stock, also shown in the unit asked for
+type itemStockView struct {
+	repository.ItemStock
+	InUnit *uom.Amount `json:"in_unit,omitempty"`
 }
 
-// List returns all items for the user's company, optionally filtered by warehouse
+// locationView is an item location, also shown in the unit asked for
+type locationView struct {
+	models.ItemLocation
+	InUnit *uom.Amount `json:"in_unit,omitempty"`
+}
+
+// List returns all items for the user's company, optionally filtered by
+// warehouse, by ?category_id (subcategories included) and by attribute
+// values given as ?attr.<key>=, ?attr.<key>.min= and ?attr.<key>.max=.
+// ?unit also shows quantities in that unit for the items that have it.
 func (h *ItemHandler) List(c *gin.Context) {
 	companyID := c.GetString("company_id")
 	warehouseID := c.Param("id")
@@ -66,106 +117,49 @@ func (h *ItemHandler) List(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("items")
 	companyObjID, _ := primitive.ObjectIDFromHex(companyID)
 
-	pipeline := mongo.Pipeline{
-		{{Key: "$match", Value: bson.D{{Key: "company_id", Value: companyObjID}, {Key: "is_archived", Value: false}}}},
-	}
-
-	// Lookup locations
-	pipeline = append(pipeline, bson.D{
-		{Key: "$lookup", Value: bson.D{
-			{Key: "from", Value: "item_locations"},
-			{Key: "localField", Value: "_id"},
-			{Key: "foreignField", Value: "item_id"},
-			{Key: "as", Value: "locations"},
-		}},
-	})
-
+	var filter repository.ItemFilter
 	if warehouseID != "" {
 		whObjID, err := primitive.ObjectIDFromHex(warehouseID)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
 			return
 		}
-
-		// Filter locations to specific warehouse and sum quantity
-		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
-			{Key: "quantity", Value: bson.D{
-				{Key: "$sum", Value: bson.D{
-					{Key: "$map", Value: bson.D{
-						{Key: "input", Value: bson.D{
-							{Key: "$filter", Value: bson.D{
-								{Key: "input", Value: "$locations"},
-								{Key: "as", Value: "loc"},
-								{Key: "cond", Value: bson.D{{Key: "$eq", Value: bson.A{"$$loc.warehouse_id", whObjID}}}},
-							}},
-						}},
-						{Key: "as", Value: "loc"},
-						{Key: "in", Value: "$$loc.quantity"},
-					}},
-				}},
-			}},
-			{Key: "batch", Value: bson.D{
-				{Key: "$let", Value: bson.D{
-					{Key: "vars", Value: bson.D{
-						{Key: "loc", Value: bson.D{
-							{Key: "$arrayElemAt", Value: bson.A{
-								bson.D{
-									{Key: "$filter", Value: bson.D{
-										{Key: "input", Value: "$locations"},
-										{Key: "as", Value: "loc"},
-										{Key: "cond", Value: bson.D{{Key: "$eq", Value: bson.A{"$$loc.warehouse_id", whObjID}}}},
-									}},
-								},
-								0,
-							}},
-						}},
-					}},
-					{Key: "in", Value: "$$loc.batch"},
-				}},
-			}},
-		}}})
-
-		// Only show items present in this warehouse
-		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "quantity", Value: bson.D{{Key: "$gt", Value: 0}}}}}})
-	} else {
-		// Sum all locations
-		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
-			{Key: "quantity", Value: bson.D{
-				{Key: "$sum", Value: "$locations.quantity"},
-			}},
-		}}})
+		filter.WarehouseID = &whObjID
 	}
 
-	// Remove locations array
-	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: "locations", Value: 0}}}})
+	ctx := c.Request.Context()
+	if !categoryFilter(c, h.categories, companyObjID, &filter) {
+		return
+	}
 
-	cursor, err := collection.Aggregate(ctx, pipeline)
+	items, err := h.items.ListStock(ctx, companyObjID, filter)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
 		return
 	}
-	defer cursor.Close(ctx)
 
-	var items []ItemResponse
-	if err = cursor.All(ctx, &items); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode items"})
-		return
+	unit := c.Query("unit")
+	views := make([]itemStockView, len(items))
+	for i := range items {
+		views[i] = itemStockView{ItemStock: items[i]}
+		if unit != "" {
+			amount := uom.Present(&items[i].Item, items[i].Quantity, unit)
+			views[i].InUnit = &amount
+		}
 	}
 
-	c.JSON(http.StatusOK, gin.H{"items": items})
+	c.JSON(http.StatusOK, gin.H{"items": views})
 }
 
-// Get returns a single item by ID
+// Get returns a single item by ID, with its location quantities also in
+// ?unit when given
 func (h *ItemHandler) Get(c *gin.Context) {
 	companyID := c.GetString("company_id")
 	itemID := c.Param("id")
 
-	ctx := context.Background()
-	collection := database.GetCollection("items")
+	ctx := c.Request.Context()
 
 	objectID, err := primitive.ObjectIDFromHex(itemID)
 	if err != nil {
@@ -174,10 +168,9 @@ func (h *ItemHandler) Get(c *gin.Context) {
 	}
 
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
-	var item models.Item
-	err = collection.FindOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}).Decode(&item)
+	item, err := h.items.Get(ctx, companyObjectID, objectID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
 			return
 		}
@@ -186,14 +179,31 @@ func (h *ItemHandler) Get(c *gin.Context) {
 	}
 
 	// Get item locations
-	locationsCollection := database.GetCollection("item_locations")
-	cursor, _ := locationsCollection.Find(ctx, bson.M{"item_id": objectID})
-	var locations []models.ItemLocation
-	cursor.All(ctx, &locations)
+	locations, err := h.items.Locations(ctx, objectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
 
+	unit := c.Query("unit")
+	views := make([]locationView, len(locations))
+	for i, location := range locations {
+		views[i] = locationView{ItemLocation: location}
+		if unit != "" {
+			amount, err := uom.FromBase(item, location.Quantity, unit)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+			views[i].InUnit = &amount
+		}
+	}
+
+	setETag(c, item.Version)
 	c.JSON(http.StatusOK, gin.H{
 		"item":      item,
-		"locations": locations,
+		"units":     uom.Units(item),
+		"locations": views,
 	})
 }
 
@@ -212,6 +222,11 @@ func (h *ItemHandler) Create(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	quality := models.NormalizeQuality(req.Quality)
+	if quality == "" {
+		invalidQuality(c)
+		return
+	}
 
 	// If Supervisor or Staff, force warehouse ID
 	role := c.GetString("role")
@@ -232,47 +247,119 @@ func (h *ItemHandler) Create(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
+	currency, ok := h.companyCurrency(c, companyObjectID, req.Currency)
+	if !ok {
+		return
+	}
+
+	attributes := req.Attributes
+	var categoryObjectID *primitive.ObjectID
+	if req.CategoryID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.CategoryID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return
+		}
+		if attributes, err = h.categories.Validate(c.Request.Context(), companyObjectID, oid, req.Attributes); err != nil {
+			if !attributeError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
+			}
+			return
+		}
+		categoryObjectID = &oid
+	}
+
+	baseUnit, units, err := uom.Normalize(req.BaseUnit, req.Units)
+	if err == nil {
+		err = uom.CheckBase(baseUnit)
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	itemSKU, err := sku.Normalize(req.SKU)
+	if err == sku.ErrEmpty {
+		if itemSKU, err = h.skus.Reserve(c.Request.Context(), companyObjectID, req.Department); err != nil {
+			skuError(c, err)
+			return
+		}
+	}
 
 	item := models.Item{
-		ID:          primitive.NewObjectID(),
-		CompanyID:   companyObjectID,
-		SKU:         req.SKU,
-		Name:        req.Name,
-		Quality:     req.Quality,
-		Price:       req.Price,
-		OwnerUserID: ownerObjectID,
-		Department:  req.Department,
-		Attributes:  req.Attributes,
-		IsArchived:  false,
-		CreatedAt:   time.Now(),
-		UpdatedAt:   time.Now(),
+		ID:           primitive.NewObjectID(),
+		CompanyID:    companyObjectID,
+		SKU:          itemSKU,
+		Name:         req.Name,
+		Quality:      quality,
+		Price:        req.Price,
+		Currency:     currency,
+		StandardCost: req.StandardCost,
+		OwnerUserID:  ownerObjectID,
+		Department:   req.Department,
+		CategoryID:   categoryObjectID,
+		Attributes:   attributes,
+		BaseUnit:     baseUnit,
+		Units:        units,
+		IsArchived:   false,
+		CreatedAt:    time.Now(),
+		UpdatedAt:    time.Now(),
 	}
 
-	// Insert item
-	itemsCollection := database.GetCollection("items")
-	_, err = itemsCollection.InsertOne(ctx, item)
+	// The initial quantity and its cost are kept per base unit
+	quantity, err := uom.ToBase(&item, req.Quantity, req.Unit)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
+	unitCost := req.UnitCost
+	if unitCost != nil {
+		cost, err := uom.UnitCost(&item, *unitCost, req.Unit)
+		if err != nil {
+			if !unitError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
+			}
+			return
+		}
+		unitCost = &cost
+	}
 
-	// Create initial location
+	// Create item with its initial location
 	location := models.ItemLocation{
 		ID:          primitive.NewObjectID(),
 		ItemID:      item.ID,
 		WarehouseID: warehouseObjectID,
-		Quantity:    req.Quantity,
+		Quantity:    quantity,
 		Batch:       req.Batch,
 		UpdatedBy:   ownerObjectID,
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
 
-	locationsCollection := database.GetCollection("item_locations")
-	_, err = locationsCollection.InsertOne(ctx, location)
+	// The initial quantity is the item's first receipt
+	err = h.tx.WithTransaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.items.Create(ctx, &item, &location); err != nil {
+			return err
+		}
+		if err := h.pricing.Record(ctx, &item, "Initial price", ownerObjectID); err != nil {
+			return err
+		}
+		_, err := h.valuation.Record(ctx, valuation.Change{
+			Item:        &item,
+			WarehouseID: warehouseObjectID,
+			Delta:       quantity,
+			UnitCost:    unitCost,
+			Source:      valuation.SourceCreate,
+			CreatedBy:   ownerObjectID,
+		})
+		return err
+	})
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item location"})
+		if err == repository.ErrDuplicate {
+			h.duplicateSKU(c, companyObjectID, item.SKU)
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create item"})
 		return
 	}
 
@@ -289,13 +376,15 @@ func (h *ItemHandler) Create(c *gin.Context) {
 			"sku":          item.SKU,
 			"name":         item.Name,
 			"warehouse_id": req.WarehouseID,
-			"quantity":     req.Quantity,
+			"quantity":     quantity,
+			"base_unit":    item.BaseUnit,
 		},
 		c.ClientIP(),
 		c.Request.UserAgent(),
 		"SUCCESS",
 	)
 
+	setETag(c, item.Version)
 	c.JSON(http.StatusCreated, item)
 }
 
@@ -318,40 +407,79 @@ func (h *ItemHandler) Update(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Item")
+		return
+	}
+
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	// Build update document
-	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	// Build update
+	update := repository.ItemUpdate{Price: req.Price, StandardCost: req.StandardCost, Attributes: req.Attributes, Units: req.Units, IfVersion: version}
+	if req.Price != nil || req.StandardCost != nil || req.Currency != "" {
+		currency, ok := h.companyCurrency(c, companyObjectID, req.Currency)
+		if !ok {
+			return
+		}
+		update.Currency = &currency
+	}
 	if req.Name != "" {
-		update["$set"].(bson.M)["name"] = req.Name
+		update.Name = &req.Name
 	}
 	if req.Quality != "" {
-		update["$set"].(bson.M)["quality"] = req.Quality
-	}
-	if req.Price != nil {
-		update["$set"].(bson.M)["price"] = *req.Price
+		quality := models.NormalizeQuality(req.Quality)
+		if quality == "" {
+			invalidQuality(c)
+			return
+		}
+		update.Quality = &quality
 	}
 	if req.Department != "" {
-		update["$set"].(bson.M)["department"] = req.Department
+		update.Department = &req.Department
 	}
-	if req.Attributes != nil {
-		update["$set"].(bson.M)["attributes"] = req.Attributes
+	if req.CategoryID != nil {
+		categoryObjectID := primitive.NilObjectID
+		if *req.CategoryID != "" {
+			if categoryObjectID, err = primitive.ObjectIDFromHex(*req.CategoryID); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+				return
+			}
+		}
+		update.CategoryID = &categoryObjectID
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("items")
+	var item *models.Item
+	err = h.tx.WithTransaction(c.Request.Context(), func(ctx context.Context) error {
+		if update.CategoryID != nil || update.Attributes != nil || update.Units != nil {
+			if err := h.checkItemUpdate(ctx, companyObjectID, objectID, &update); err != nil {
+				return err
+			}
+		}
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}, update)
-	if err != nil || result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		var err error
+		if item, err = h.items.Update(ctx, companyObjectID, objectID, update); err != nil {
+			return err
+		}
+		if req.Price == nil && req.StandardCost == nil {
+			return nil
+		}
+		if err := h.pricing.Record(ctx, item, req.Reason, userObjectID); err != nil {
+			return err
+		}
+		return h.valuation.Revalue(ctx, item, valuation.SourcePrice, userObjectID)
+	})
+	if err != nil {
+		if unitError(c, err) {
+			return
+		}
+		if !attributeError(c, err) {
+			itemWriteError(c, err)
+		}
 		return
 	}
 
-	// Fetch updated item
-	var item models.Item
-	collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&item)
-
 	// Log audit
 	go h.auditService.LogAction(
 		context.Background(),
@@ -363,12 +491,14 @@ func (h *ItemHandler) Update(c *gin.Context) {
 		&objectID,
 		map[string]interface{}{
 			"updates": req,
+			"version": item.Version,
 		},
 		c.ClientIP(),
 		c.Request.UserAgent(),
 		"SUCCESS",
 	)
 
+	setETag(c, item.Version)
 	c.JSON(http.StatusOK, item)
 }
 
@@ -385,16 +515,17 @@ func (h *ItemHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Item")
+		return
+	}
+
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	ctx := context.Background()
-	collection := database.GetCollection("items")
-
-	update := bson.M{"$set": bson.M{"is_archived": true, "updated_at": time.Now()}}
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}, update)
-	if err != nil || result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	if err := h.items.Archive(c.Request.Context(), companyObjectID, objectID, version, userObjectID); err != nil {
+		itemWriteError(c, err)
 		return
 	}
 
@@ -415,3 +546,311 @@ func (h *ItemHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Item archived successfully"})
 }
+
+// AdjustQuantity changes the stock of one of an item's locations. Deltas are
+// applied atomically, so concurrent adjustments are never lost.
+func (h *ItemHandler) AdjustQuantity(c *gin.Context) {
+	companyID := c.GetString("company_id")
+	userID := c.GetString("user_id")
+	username := c.GetString("username")
+
+	var req AdjustQuantityRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if (req.Delta == nil) == (req.Quantity == nil) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide either delta or quantity"})
+		return
+	}
+
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	locationObjectID, err := primitive.ObjectIDFromHex(req.LocationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Item location")
+		return
+	}
+	// Setting an absolute quantity would overwrite concurrent adjustments
+	if req.Quantity != nil && version == nil {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Setting a quantity requires If-Match with the location's ETag"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
+	userObjectID, _ := primitive.ObjectIDFromHex(userID)
+
+	ctx := c.Request.Context()
+	item, err := h.items.Get(ctx, companyObjectID, objectID)
+	if err != nil {
+		itemWriteError(c, err)
+		return
+	}
+
+	// Quantities and costs are kept per base unit
+	change := repository.QuantityChange{IfVersion: version, UpdatedBy: userObjectID}
+	if req.Delta != nil {
+		change.Delta, err = uom.ToBase(item, *req.Delta, req.Unit)
+	} else {
+		var quantity int
+		quantity, err = uom.ToBase(item, *req.Quantity, req.Unit)
+		change.Set = &quantity
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	unitCost := req.UnitCost
+	if unitCost != nil {
+		cost, err := uom.UnitCost(item, *unitCost, req.Unit)
+		if err != nil {
+			if !unitError(c, err) {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust quantity"})
+			}
+			return
+		}
+		unitCost = &cost
+	}
+
+	// If Supervisor or Staff, only locations in their warehouse
+	role := c.GetString("role")
+	if role == "Supervisor" || role == "Staff" {
+		warehouseObjectID, _ := primitive.ObjectIDFromHex(c.GetString("warehouse_id"))
+		change.WarehouseID = &warehouseObjectID
+	}
+
+	// Value the change in the same transaction as the stock write
+	var location *models.ItemLocation
+	err = h.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		previous := 0
+		if change.Set != nil {
+			locations, err := h.items.Locations(ctx, objectID)
+			if err != nil {
+				return err
+			}
+			for _, existing := range locations {
+				if existing.ID == locationObjectID {
+					previous = existing.Quantity
+				}
+			}
+		}
+
+		var err error
+		if location, err = h.items.AdjustQuantity(ctx, objectID, locationObjectID, change); err != nil {
+			return err
+		}
+		delta := change.Delta
+		if change.Set != nil {
+			delta = location.Quantity - previous
+		}
+		_, err = h.valuation.Record(ctx, valuation.Change{
+			Item:        item,
+			WarehouseID: location.WarehouseID,
+			Delta:       delta,
+			UnitCost:    unitCost,
+			Source:      valuation.SourceAdjust,
+			CreatedBy:   userObjectID,
+		})
+		return err
+	})
+	if err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item location not found"})
+		case repository.ErrVersionMismatch:
+			preconditionFailed(c, "Item location")
+		case repository.ErrInsufficientStock:
+			c.JSON(http.StatusConflict, gin.H{"error": "Insufficient stock"})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to adjust quantity"})
+		}
+		return
+	}
+
+	details := map[string]interface{}{
+		"location_id":  location.ID.Hex(),
+		"warehouse_id": location.WarehouseID.Hex(),
+		"quantity":     location.Quantity,
+		"version":      location.Version,
+	}
+	if req.Delta != nil {
+		details["delta"] = change.Delta
+	}
+	if req.Unit != "" {
+		details["unit"] = req.Unit
+	}
+	if req.Reason != "" {
+		details["reason"] = req.Reason
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		username,
+		"ADJUST",
+		"ITEM",
+		&objectID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	setETag(c, location.Version)
+	c.JSON(http.StatusOK, location)
+}
+
+// companyCurrency returns the company currency, rejecting a request made in
+// any other currency
+func (h *ItemHandler) companyCurrency(c *gin.Context, companyID primitive.ObjectID, requested string) (string, bool) {
+	settings, err := h.valuation.Settings(c.Request.Context(), companyID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load company settings"})
+		return "", false
+	}
+	if requested != "" && requested != settings.Currency {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Prices must be in the company currency " + settings.Currency})
+		return "", false
+	}
+	return settings.Currency, true
+}
+
+// checkItemUpdate validates the units, category and attributes an update
+// gives an item against its current state, normalizing them in place
+func (h *ItemHandler) checkItemUpdate(ctx context.Context, companyID, id primitive.ObjectID, update *repository.ItemUpdate) error {
+	current, err := h.items.Get(ctx, companyID, id)
+	if err != nil {
+		return err
+	}
+	if update.Units != nil {
+		if _, update.Units, err = uom.Normalize(uom.Base(current), update.Units); err != nil {
+			return err
+		}
+	}
+
+	// Check the attributes the item will have against the category it will be in
+	if update.CategoryID == nil && update.Attributes == nil {
+		return nil
+	}
+	categoryID := current.CategoryID
+	if update.CategoryID != nil {
+		categoryID = update.CategoryID
+	}
+	if categoryID == nil || categoryID.IsZero() {
+		return nil
+	}
+	attributes := update.Attributes
+	if attributes == nil {
+		attributes = current.Attributes
+	}
+	update.Attributes, err = h.categories.Validate(ctx, companyID, *categoryID, attributes)
+	return err
+}
+
+// attributeError writes the response for attributes that do not fit the
+// item's category, reporting false for any other error
+func attributeError(c *gin.Context, err error) bool {
+	var invalid *category.ValidationError
+	switch {
+	case errors.As(err, &invalid):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid attributes", "attributes": invalid.Errors})
+	case err == category.ErrUnknownCategory:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Category not found"})
+	default:
+		return false
+	}
+	return true
+}
+
+// unitError writes a 400 for quantities given in a unit the item does not
+// have or that do not convert to its base unit, reporting false for any
+// other error
+func unitError(c *gin.Context, err error) bool {
+	if errors.Is(err, uom.ErrUnknownUnit) || err == uom.ErrFractional || err == uom.ErrTooLarge || errors.Is(err, uom.ErrInvalidUnits) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return true
+	}
+	return false
+}
+
+// invalidQuality rejects a quality that is not one of models.ItemQualities
+func invalidQuality(c *gin.Context) {
+	c.JSON(http.StatusBadRequest, gin.H{"error": "Quality must be one of " + strings.Join(models.ItemQualities, ", ")})
+}
+
+// duplicateSKU rejects an item whose SKU the company already uses, naming
+// the item that has it
+func (h *ItemHandler) duplicateSKU(c *gin.Context, companyID primitive.ObjectID, itemSKU string) {
+	response := gin.H{"error": "SKU " + itemSKU + " is already used by another item in this company"}
+	if existing, err := h.items.GetBySKU(c.Request.Context(), companyID, itemSKU); err == nil {
+		response["item_id"] = existing.ID
+		response["sku"] = existing.SKU
+		if existing.IsArchived {
+			response["error"] = "SKU " + itemSKU + " is used by an archived item; restore it or choose another SKU"
+			response["archived"] = true
+		}
+	}
+	c.JSON(http.StatusConflict, response)
+}
+
+// categoryFilter narrows filter by ?category_id, subcategories included,
+// and by the attribute values given as ?attr.<key>=, ?attr.<key>.min= and
+// ?attr.<key>.max=. It writes the error response and returns false when
+// they are invalid.
+func categoryFilter(c *gin.Context, categories *category.Service, companyID primitive.ObjectID, filter *repository.ItemFilter) bool {
+	ctx := c.Request.Context()
+	var categoryObjID *primitive.ObjectID
+	if categoryID := c.Query("category_id"); categoryID != "" {
+		oid, err := primitive.ObjectIDFromHex(categoryID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid category ID"})
+			return false
+		}
+		if filter.CategoryIDs, err = categories.Descendants(ctx, companyID, oid); err != nil {
+			if err == repository.ErrNotFound {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Category not found"})
+				return false
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch items"})
+			return false
+		}
+		categoryObjID = &oid
+	}
+
+	query := map[string]string{}
+	for param, values := range c.Request.URL.Query() {
+		if key, ok := strings.CutPrefix(param, "attr."); ok && len(values) > 0 {
+			query[key] = values[0]
+		}
+	}
+	attributes, err := categories.Filters(ctx, companyID, categoryObjID, query)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return false
+	}
+	filter.Attributes = attributes
+	return true
+}
+
+// itemWriteError maps repository errors from item writes to responses
+func itemWriteError(c *gin.Context, err error) {
+	switch err {
+	case repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+	case repository.ErrVersionMismatch:
+		preconditionFailed(c, "Item")
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
@@ -0,0 +1,237 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/category"
+	"github.com/a2sv/safeware/internal/itemarchive"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ItemArchiveHandler struct {
+	archiveService *itemarchive.Service
+	categories     *category.Service
+	auditService   *audit.AuditService
+}
+
+func NewItemArchiveHandler(archiveService *itemarchive.Service, categoryService *category.Service, auditService *audit.AuditService) *ItemArchiveHandler {
+	return &ItemArchiveHandler{
+		archiveService: archiveService,
+		categories:     categoryService,
+		auditService:   auditService,
+	}
+}
+
+// PurgeItemRequest confirms a purge with the item's SKU, since a purge
+// cannot be undone. The item's ETag is also required as If-Match.
+type PurgeItemRequest struct {
+	Confirm string `json:"confirm" binding:"required"`
+	Reason  string `json:"reason"`
+}
+
+// archivedView is an archived item, its stock also shown in the unit asked for
+type archivedView struct {
+	itemarchive.Archived
+	InUnit *uom.Amount `json:"in_unit,omitempty"`
+}
+
+// List browses archived items, most recently archived first. It takes the
+// item list's ?warehouse_id, ?category_id and ?attr. filters, plus
+// ?archived_from and ?archived_to (RFC 3339 or YYYY-MM-DD, to exclusive) and
+// ?purgeable=true for items past the retention period. Supervisors only see
+// items stocked in their warehouse.
+func (h *ItemArchiveHandler) List(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	var filter itemarchive.Filter
+	if own := ownWarehouse(c); own != nil {
+		filter.Items.WarehouseID = own
+	} else if warehouseID := c.Query("warehouse_id"); warehouseID != "" {
+		warehouseObjectID, err := primitive.ObjectIDFromHex(warehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		filter.Items.WarehouseID = &warehouseObjectID
+	}
+	if !categoryFilter(c, h.categories, companyObjectID, &filter.Items) {
+		return
+	}
+
+	for _, bound := range []struct {
+		name   string
+		target **time.Time
+	}{{"archived_from", &filter.ArchivedFrom}, {"archived_to", &filter.ArchivedTo}} {
+		raw := c.Query(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := parseTimeParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.name + " date, use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		*bound.target = &parsed
+	}
+	filter.Purgeable = c.Query("purgeable") == "true"
+
+	archived, err := h.archiveService.List(c.Request.Context(), companyObjectID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch archived items"})
+		return
+	}
+
+	unit := c.Query("unit")
+	views := make([]archivedView, len(archived))
+	for i := range archived {
+		views[i] = archivedView{Archived: archived[i]}
+		if unit != "" {
+			amount := uom.Present(&archived[i].Item, archived[i].Quantity, unit)
+			views[i].InUnit = &amount
+		}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"items":            views,
+		"purge_after_days": int(h.archiveService.PurgeAfter().Hours() / 24),
+	})
+}
+
+// Restore unarchives an item with its locations. Supervisors can only
+// restore items stocked in their warehouse. If-Match with the item's ETag
+// makes it conditional.
+func (h *ItemArchiveHandler) Restore(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Item")
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	item, locations, err := h.archiveService.Restore(c.Request.Context(), companyObjectID, objectID, ownWarehouse(c), version)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Archived item not found"})
+			return
+		}
+		itemWriteError(c, err)
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"RESTORE",
+		"ITEM",
+		&objectID,
+		map[string]interface{}{
+			"sku":       item.SKU,
+			"locations": len(locations),
+			"version":   item.Version,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	setETag(c, item.Version)
+	c.JSON(http.StatusOK, gin.H{"item": item, "locations": locations})
+}
+
+// Purge permanently deletes an archived item once its retention period is
+// over. Any stock it still held is written off.
+func (h *ItemArchiveHandler) Purge(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	var req PurgeItemRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Purge must be confirmed with {\"confirm\": \"<the item's SKU>\"}"})
+		return
+	}
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Item")
+		return
+	}
+	if version == nil {
+		c.JSON(http.StatusPreconditionRequired, gin.H{"error": "Purging requires If-Match with the item's ETag"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	purged, err := h.archiveService.Purge(c.Request.Context(), companyObjectID, objectID, req.Confirm, *version, userObjectID)
+	if err != nil {
+		var retention *itemarchive.RetentionError
+		switch {
+		case err == repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		case err == repository.ErrVersionMismatch:
+			preconditionFailed(c, "Item")
+		case err == itemarchive.ErrConfirmation:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.As(err, &retention):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "purgeable_at": retention.PurgeableAt})
+		case err == itemarchive.ErrNotArchived, err == itemarchive.ErrInKit, err == itemarchive.ErrOnHold:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to purge item"})
+		}
+		return
+	}
+
+	details := map[string]interface{}{
+		"sku":            purged.Item.SKU,
+		"name":           purged.Item.Name,
+		"locations":      purged.Locations,
+		"written_off":    purged.WrittenOff,
+		"write_off_cost": purged.WriteOffCost,
+		"prices":         purged.Prices,
+		"kit_removed":    purged.KitRemoved,
+	}
+	if purged.Item.ArchivedAt != nil {
+		details["archived_at"] = purged.Item.ArchivedAt
+	}
+	if req.Reason != "" {
+		details["reason"] = req.Reason
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"PURGE",
+		"ITEM",
+		&objectID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, purged)
+}
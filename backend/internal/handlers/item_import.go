@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/a2sv/safeware/internal/itemimport"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportFileSize bounds uploaded import files
+const maxImportFileSize = 20 << 20
+
+type ItemImportHandler struct {
+	importService *itemimport.Service
+}
+
+func NewItemImportHandler(importService *itemimport.Service) *ItemImportHandler {
+	return &ItemImportHandler{importService: importService}
+}
+
+// Import validates an uploaded CSV or XLSX file of items. A dry run, or a file
+// with invalid rows, only returns the validation report; otherwise the rows
+// are upserted by SKU in a background job that can be polled.
+func (h *ItemImportHandler) Import(c *gin.Context) {
+	c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, maxImportFileSize)
+	file, header, err := c.Request.FormFile("file")
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": "Import file must be at most 20MB"})
+			return
+		}
+		c.JSON(http.StatusBadRequest, gin.H{"error": "A file field is required"})
+		return
+	}
+	defer file.Close()
+
+	format, err := itemimport.DetectFormat(c.PostForm("format"), header.Filename)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var mapping itemimport.Mapping
+	if raw := c.PostForm("mapping"); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &mapping); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "mapping must be a JSON object of field to column name"})
+			return
+		}
+	}
+
+	dryRun := false
+	if raw := c.DefaultPostForm("dry_run", c.Query("dry_run")); raw != "" {
+		if dryRun, err = strconv.ParseBool(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dry_run must be true or false"})
+			return
+		}
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	req := itemimport.Request{
+		CompanyID: companyObjectID,
+		UserID:    userObjectID,
+		Username:  c.GetString("email"),
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+		FileName:  header.Filename,
+		Format:    format,
+		Mapping:   mapping,
+	}
+
+	// Supervisors can only import into their own warehouse
+	warehouseID := c.PostForm("warehouse_id")
+	if c.GetString("role") == "Supervisor" {
+		warehouseID = c.GetString("warehouse_id")
+		req.Restricted = true
+	}
+	if warehouseID != "" {
+		warehouseObjectID, err := primitive.ObjectIDFromHex(warehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		req.WarehouseID = &warehouseObjectID
+	}
+
+	rows, report, err := h.importService.Validate(c.Request.Context(), file, req)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	report.DryRun = dryRun
+
+	if dryRun {
+		c.JSON(http.StatusOK, gin.H{"report": report})
+		return
+	}
+	if !report.Valid() {
+		c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Import file has invalid rows; nothing was imported", "report": report})
+		return
+	}
+
+	job, err := h.importService.Start(c.Request.Context(), req, rows)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to start import"})
+		return
+	}
+
+	c.Header("Location", "imports/"+job.ID.Hex())
+	c.JSON(http.StatusAccepted, gin.H{"job": job, "report": report})
+}
+
+// Status returns the progress of an import job
+func (h *ItemImportHandler) Status(c *gin.Context) {
+	jobID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid import job ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	job, err := h.importService.Get(c.Request.Context(), companyObjectID, jobID)
+	if err != nil {
+		if err == itemimport.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch import job"})
+		return
+	}
+	if c.GetString("role") == "Supervisor" && job.WarehouseID.Hex() != c.GetString("warehouse_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Import job not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"job": job})
+}
@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ItemPriceHandler struct {
+	pricingService *pricing.Service
+	auditService   *audit.AuditService
+}
+
+func NewItemPriceHandler(pricingService *pricing.Service, auditService *audit.AuditService) *ItemPriceHandler {
+	return &ItemPriceHandler{
+		pricingService: pricingService,
+		auditService:   auditService,
+	}
+}
+
+type SchedulePriceRequest struct {
+	Price         int64  `json:"price" binding:"min=0"` // Minor units of the company currency
+	StandardCost  *int64 `json:"standard_cost" binding:"omitempty,min=0"`
+	EffectiveFrom string `json:"effective_from" binding:"required"` // RFC 3339 time or YYYY-MM-DD
+	Reason        string `json:"reason" binding:"required"`
+}
+
+// History lists an item's prices, including scheduled ones
+func (h *ItemPriceHandler) History(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	itemObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	prices, err := h.pricingService.History(c.Request.Context(), companyObjectID, itemObjectID)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"prices": prices})
+}
+
+// PriceAt returns the price in effect at ?at, an RFC 3339 time or a
+// YYYY-MM-DD date, defaulting to now
+func (h *ItemPriceHandler) PriceAt(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	itemObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	at := time.Now()
+	if raw := c.Query("at"); raw != "" {
+		if at, err = parseTimeParam(raw); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid at date, use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+	}
+
+	price, err := h.pricingService.PriceAt(c.Request.Context(), companyObjectID, itemObjectID, at)
+	if err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		case pricing.ErrNoPrice:
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+		}
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"at": at, "price": price})
+}
+
+// Schedule adds a future-dated price change
+func (h *ItemPriceHandler) Schedule(c *gin.Context) {
+	var req SchedulePriceRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	effectiveFrom, err := parseTimeParam(req.EffectiveFrom)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid effective_from, use RFC 3339 or YYYY-MM-DD"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	itemObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	price, err := h.pricingService.Schedule(c.Request.Context(), companyObjectID, itemObjectID, pricing.Change{
+		Price:         req.Price,
+		StandardCost:  req.StandardCost,
+		EffectiveFrom: effectiveFrom,
+		Reason:        req.Reason,
+		ChangedBy:     userObjectID,
+	})
+	if err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Item not found"})
+		case pricing.ErrNotFuture:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case pricing.ErrConflict:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule price"})
+		}
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"SCHEDULE",
+		"ITEM_PRICE",
+		&itemObjectID,
+		map[string]interface{}{
+			"price_id":       price.ID,
+			"price":          price.Price,
+			"standard_cost":  price.StandardCost,
+			"effective_from": price.EffectiveFrom,
+			"reason":         price.Reason,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, price)
+}
+
+// Cancel removes a scheduled price that has not taken effect
+func (h *ItemPriceHandler) Cancel(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	itemObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	priceObjectID, err := primitive.ObjectIDFromHex(c.Param("price_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid price ID"})
+		return
+	}
+
+	price, err := h.pricingService.Cancel(c.Request.Context(), companyObjectID, itemObjectID, priceObjectID)
+	if err != nil {
+		switch err {
+		case repository.ErrNotFound:
+			c.JSON(http.StatusNotFound, gin.H{"error": "Price not found"})
+		case pricing.ErrApplied:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel price"})
+		}
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"CANCEL",
+		"ITEM_PRICE",
+		&itemObjectID,
+		map[string]interface{}{
+			"price_id":       price.ID,
+			"price":          price.Price,
+			"effective_from": price.EffectiveFrom,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Scheduled price cancelled"})
+}
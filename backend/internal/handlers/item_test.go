@@ -0,0 +1,315 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/category"
+	"github.com/a2sv/safeware/internal/layout"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/sku"
+	"github.com/a2sv/safeware/internal/valuation"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// itemTestEnv wires the item and layout handlers to the memory repositories
+type itemTestEnv struct {
+	repos         *repository.Repositories
+	layoutService *layout.Service
+	company       primitive.ObjectID
+	warehouse     primitive.ObjectID
+	other         primitive.ObjectID // A second warehouse of the same company
+	user          primitive.ObjectID
+	role          string
+	router        *gin.Engine
+}
+
+func newItemTestEnv(t *testing.T) *itemTestEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	env := &itemTestEnv{
+		repos:   repos,
+		company: primitive.NewObjectID(),
+		user:    primitive.NewObjectID(),
+		role:    "Manager",
+	}
+	if err := repos.Companies.Create(ctx, &models.Company{ID: env.company, Name: "Acme", Currency: "USD"}); err != nil {
+		t.Fatal(err)
+	}
+	for _, id := range []*primitive.ObjectID{&env.warehouse, &env.other} {
+		*id = primitive.NewObjectID()
+		if err := repos.Warehouses.Create(ctx, &models.Warehouse{ID: *id, CompanyID: env.company, Name: "Main", IsActive: true}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	auditService := audit.NewAuditService("test-key", repos.Audit)
+	t.Cleanup(func() { auditService.Close() })
+	valuationService := valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	itemHandler := NewItemHandler(
+		repos.Tx,
+		repos.Items,
+		valuationService,
+		pricing.NewService(repos.Tx, repos.Items, repos.Prices, valuationService, auditService),
+		category.NewService(repos.Categories, repos.Items),
+		sku.NewService(repos.Companies, repos.Items, repos.Sequences),
+		auditService,
+	)
+	env.layoutService = layout.NewService(repos.Tx, repos.Layout, repos.Items, repos.Warehouses)
+	layoutHandler := NewLayoutHandler(env.layoutService, auditService)
+
+	// Stands in for the auth middleware
+	env.router = gin.New()
+	env.router.Use(func(c *gin.Context) {
+		c.Set("company_id", env.company.Hex())
+		c.Set("user_id", env.user.Hex())
+		c.Set("username", "tester")
+		c.Set("role", env.role)
+		if env.role != "Manager" {
+			c.Set("warehouse_id", env.warehouse.Hex())
+		}
+		c.Next()
+	})
+	env.router.POST("/item/create", itemHandler.Create)
+	env.router.PATCH("/item/adjust/:id", itemHandler.AdjustQuantity)
+	env.router.POST("/stock/putaway", layoutHandler.Putaway)
+	env.router.POST("/stock/move", layoutHandler.Move)
+	return env
+}
+
+// do sends body as JSON and decodes the response into out when it is not nil
+func (env *itemTestEnv) do(t *testing.T, method, path string, body interface{}, headers map[string]string, out interface{}) *httptest.ResponseRecorder {
+	t.Helper()
+	payload, err := json.Marshal(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req := httptest.NewRequest(method, path, bytes.NewReader(payload))
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	w := httptest.NewRecorder()
+	env.router.ServeHTTP(w, req)
+	if out != nil && w.Code < 300 {
+		if err := json.Unmarshal(w.Body.Bytes(), out); err != nil {
+			t.Fatalf("decoding %s: %v", w.Body.String(), err)
+		}
+	}
+	return w
+}
+
+// createItem creates an item through the handler and returns it with its
+// only location
+func (env *itemTestEnv) createItem(t *testing.T, request gin.H) (models.Item, models.ItemLocation) {
+	t.Helper()
+	var item models.Item
+	if w := env.do(t, http.MethodPost, "/item/create", request, nil, &item); w.Code != http.StatusCreated {
+		t.Fatalf("create: %d %s", w.Code, w.Body.String())
+	}
+	locations, err := env.repos.Items.Locations(context.Background(), item.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 {
+		t.Fatalf("expected 1 location, got %d", len(locations))
+	}
+	return item, locations[0]
+}
+
+// createBin creates a zone, aisle, rack and bin in the warehouse
+func (env *itemTestEnv) createBin(t *testing.T, warehouseID primitive.ObjectID, code string) primitive.ObjectID {
+	t.Helper()
+	var parent *primitive.ObjectID
+	for _, kind := range models.LocationKinds {
+		location := &models.StorageLocation{
+			CompanyID:   env.company,
+			WarehouseID: warehouseID,
+			ParentID:    parent,
+			Kind:        kind,
+			Code:        code,
+		}
+		if err := env.layoutService.Create(context.Background(), location); err != nil {
+			t.Fatalf("create %s: %v", kind, err)
+		}
+		parent = &location.ID
+	}
+	return *parent
+}
+
+func TestCreateItem(t *testing.T) {
+	env := newItemTestEnv(t)
+
+	item, location := env.createItem(t, gin.H{
+		"sku":          "BOX-1",
+		"name":         "Box",
+		"quality":      "new",
+		"price":        250,
+		"warehouse_id": env.warehouse.Hex(),
+		"units":        []gin.H{{"name": "case", "factor": 12}},
+		"quantity":     2,
+		"unit":         "case",
+	})
+	if item.SKU != "BOX-1" || item.Currency != "USD" || item.BaseUnit != "each" {
+		t.Errorf("unexpected item: %+v", item)
+	}
+	if location.WarehouseID != env.warehouse || location.Quantity != 24 {
+		t.Errorf("expected 24 each in the warehouse, got %+v", location)
+	}
+
+	// SKUs are unique regardless of case
+	w := env.do(t, http.MethodPost, "/item/create", gin.H{
+		"sku":          "box-1",
+		"name":         "Other box",
+		"quality":      "New",
+		"warehouse_id": env.warehouse.Hex(),
+		"quantity":     1,
+	}, nil, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("duplicate SKU: expected 409, got %d %s", w.Code, w.Body.String())
+	}
+
+	w = env.do(t, http.MethodPost, "/item/create", gin.H{
+		"sku":          "BOX-2",
+		"name":         "Box",
+		"quality":      "Shiny",
+		"warehouse_id": env.warehouse.Hex(),
+		"quantity":     1,
+	}, nil, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("invalid quality: expected 400, got %d", w.Code)
+	}
+}
+
+func TestCreateItemUsesOwnWarehouseForSupervisors(t *testing.T) {
+	env := newItemTestEnv(t)
+	env.role = "Supervisor"
+
+	_, location := env.createItem(t, gin.H{
+		"sku":          "BOX-1",
+		"name":         "Box",
+		"quality":      "New",
+		"warehouse_id": env.other.Hex(),
+		"quantity":     5,
+	})
+	if location.WarehouseID != env.warehouse {
+		t.Errorf("expected the supervisor's warehouse %s, got %s", env.warehouse.Hex(), location.WarehouseID.Hex())
+	}
+}
+
+func TestAdjustQuantity(t *testing.T) {
+	env := newItemTestEnv(t)
+	item, location := env.createItem(t, gin.H{
+		"sku":          "BOX-1",
+		"name":         "Box",
+		"quality":      "New",
+		"warehouse_id": env.warehouse.Hex(),
+		"quantity":     10,
+	})
+	path := "/item/adjust/" + item.ID.Hex()
+
+	var adjusted models.ItemLocation
+	w := env.do(t, http.MethodPatch, path, gin.H{"location_id": location.ID.Hex(), "delta": -4}, nil, &adjusted)
+	if w.Code != http.StatusOK || adjusted.Quantity != 6 {
+		t.Fatalf("delta: %d %s", w.Code, w.Body.String())
+	}
+	etag := w.Header().Get("ETag")
+
+	w = env.do(t, http.MethodPatch, path, gin.H{"location_id": location.ID.Hex(), "delta": -7}, nil, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("overdraw: expected 409, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Setting a quantity needs the location's current ETag
+	w = env.do(t, http.MethodPatch, path, gin.H{"location_id": location.ID.Hex(), "quantity": 3}, nil, nil)
+	if w.Code != http.StatusPreconditionRequired {
+		t.Errorf("set without If-Match: expected 428, got %d", w.Code)
+	}
+	w = env.do(t, http.MethodPatch, path, gin.H{"location_id": location.ID.Hex(), "quantity": 3}, map[string]string{"If-Match": `"999"`}, nil)
+	if w.Code != http.StatusPreconditionFailed {
+		t.Errorf("stale If-Match: expected 412, got %d", w.Code)
+	}
+	w = env.do(t, http.MethodPatch, path, gin.H{"location_id": location.ID.Hex(), "quantity": 3}, map[string]string{"If-Match": etag}, &adjusted)
+	if w.Code != http.StatusOK || adjusted.Quantity != 3 {
+		t.Errorf("set: %d %s", w.Code, w.Body.String())
+	}
+
+	stored, err := env.repos.Items.Location(context.Background(), location.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Quantity != 3 {
+		t.Errorf("expected 3 in store, got %d", stored.Quantity)
+	}
+}
+
+func TestAdjustQuantityOutsideOwnWarehouse(t *testing.T) {
+	env := newItemTestEnv(t)
+	item, location := env.createItem(t, gin.H{
+		"sku":          "BOX-1",
+		"name":         "Box",
+		"quality":      "New",
+		"warehouse_id": env.other.Hex(),
+		"quantity":     10,
+	})
+
+	env.role = "Staff"
+	w := env.do(t, http.MethodPatch, "/item/adjust/"+item.ID.Hex(), gin.H{"location_id": location.ID.Hex(), "delta": 1}, nil, nil)
+	if w.Code != http.StatusNotFound {
+		t.Errorf("expected 404 for another warehouse's location, got %d %s", w.Code, w.Body.String())
+	}
+}
+
+func TestPutawayAndMoveStock(t *testing.T) {
+	env := newItemTestEnv(t)
+	_, location := env.createItem(t, gin.H{
+		"sku":          "BOX-1",
+		"name":         "Box",
+		"quality":      "New",
+		"warehouse_id": env.warehouse.Hex(),
+		"quantity":     10,
+	})
+	first := env.createBin(t, env.warehouse, "A")
+	second := env.createBin(t, env.warehouse, "B")
+
+	var result layout.MoveResult
+	w := env.do(t, http.MethodPost, "/stock/putaway", gin.H{"location_id": location.ID.Hex(), "bin_id": first.Hex(), "quantity": 10}, nil, &result)
+	if w.Code != http.StatusOK {
+		t.Fatalf("putaway: %d %s", w.Code, w.Body.String())
+	}
+	if result.To.BinID == nil || *result.To.BinID != first || result.To.Quantity != 10 {
+		t.Fatalf("unexpected putaway result: %+v", result.To)
+	}
+	binned := result.To.ID
+
+	w = env.do(t, http.MethodPost, "/stock/move", gin.H{"location_id": binned.Hex(), "bin_id": second.Hex(), "quantity": 4}, nil, &result)
+	if w.Code != http.StatusOK {
+		t.Fatalf("move: %d %s", w.Code, w.Body.String())
+	}
+	if result.From.Quantity != 6 || result.To.Quantity != 4 || *result.To.BinID != second {
+		t.Errorf("unexpected move result: from %+v to %+v", result.From, result.To)
+	}
+
+	w = env.do(t, http.MethodPost, "/stock/move", gin.H{"location_id": binned.Hex(), "bin_id": second.Hex(), "quantity": 7}, nil, nil)
+	if w.Code != http.StatusConflict {
+		t.Errorf("overdraw: expected 409, got %d %s", w.Code, w.Body.String())
+	}
+
+	// Bins are per warehouse
+	elsewhere := env.createBin(t, env.other, "C")
+	w = env.do(t, http.MethodPost, "/stock/move", gin.H{"location_id": binned.Hex(), "bin_id": elsewhere.Hex(), "quantity": 1}, nil, nil)
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("move to another warehouse: expected 400, got %d %s", w.Code, w.Body.String())
+	}
+}
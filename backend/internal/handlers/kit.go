@@ -0,0 +1,288 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/kit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type KitHandler struct {
+	kitService   *kit.Service
+	auditService *audit.AuditService
+}
+
+func NewKitHandler(kitService *kit.Service, auditService *audit.AuditService) *KitHandler {
+	return &KitHandler{
+		kitService:   kitService,
+		auditService: auditService,
+	}
+}
+
+type KitComponentRequest struct {
+	ItemID   string  `json:"item_id" binding:"required"`
+	Quantity float64 `json:"quantity" binding:"required"`
+	Unit     string  `json:"unit"` // Defaults to the component's base unit
+}
+
+type DefineKitRequest struct {
+	Components []KitComponentRequest `json:"components" binding:"required"`
+}
+
+type BuildKitRequest struct {
+	WarehouseID string `json:"warehouse_id"` // Managers only; others build at their own warehouse
+	Quantity    int    `json:"quantity" binding:"required"`
+	Batch       string `json:"batch"`
+}
+
+// List returns the company's bills of materials
+func (h *KitHandler) List(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	boms, err := h.kitService.List(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list kits"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"kits": boms})
+}
+
+// Get returns the bill of materials of a kit item
+func (h *KitHandler) Get(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	bom, err := h.kitService.Get(c.Request.Context(), companyObjectID, objectID)
+	if err != nil {
+		kitError(c, err, "Failed to load kit")
+		return
+	}
+	c.JSON(http.StatusOK, bom)
+}
+
+// Define sets the components of a kit item, replacing any it had
+func (h *KitHandler) Define(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	var req DefineKitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	components := make([]kit.Component, 0, len(req.Components))
+	for _, component := range req.Components {
+		itemObjectID, err := primitive.ObjectIDFromHex(component.ItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid component item ID"})
+			return
+		}
+		components = append(components, kit.Component{ItemID: itemObjectID, Quantity: component.Quantity, Unit: component.Unit})
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	bom, err := h.kitService.Define(c.Request.Context(), companyObjectID, objectID, components, userObjectID)
+	if err != nil {
+		kitError(c, err, "Failed to save kit")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"KIT",
+		&objectID,
+		map[string]interface{}{"components": bom.Components},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, bom)
+}
+
+// Delete removes the bill of materials of a kit item
+func (h *KitHandler) Delete(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	if err := h.kitService.Delete(c.Request.Context(), companyObjectID, objectID); err != nil {
+		kitError(c, err, "Failed to delete kit")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"DELETE",
+		"KIT",
+		&objectID,
+		map[string]interface{}{},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Kit deleted successfully"})
+}
+
+// Availability shows how many kits a warehouse's stock can build. Managers
+// and Auditors pick the warehouse with ?warehouse_id; Supervisors and Staff
+// always get their own.
+func (h *KitHandler) Availability(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	warehouseObjectID, ok := layoutWarehouse(c, c.Query("warehouse_id"))
+	if !ok {
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	availability, err := h.kitService.Availability(c.Request.Context(), companyObjectID, objectID, warehouseObjectID)
+	if err != nil {
+		kitError(c, err, "Failed to work out kit availability")
+		return
+	}
+	c.JSON(http.StatusOK, availability)
+}
+
+// Builds lists a kit's assemblies and disassemblies, newest first.
+// Supervisors and Staff only see their own warehouse's.
+func (h *KitHandler) Builds(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	builds, err := h.kitService.Builds(c.Request.Context(), companyObjectID, objectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list kit builds"})
+		return
+	}
+	if own := ownWarehouse(c); own != nil {
+		visible := []models.KitBuild{}
+		for _, build := range builds {
+			if build.WarehouseID == *own {
+				visible = append(visible, build)
+			}
+		}
+		builds = visible
+	}
+	c.JSON(http.StatusOK, gin.H{"builds": builds})
+}
+
+// Assemble builds kits from their components' stock
+func (h *KitHandler) Assemble(c *gin.Context) {
+	h.build(c, "ASSEMBLE", h.kitService.Assemble)
+}
+
+// Disassemble breaks kits back into their components
+func (h *KitHandler) Disassemble(c *gin.Context) {
+	h.build(c, "DISASSEMBLE", h.kitService.Disassemble)
+}
+
+func (h *KitHandler) build(c *gin.Context, action string, build func(context.Context, kit.Build) (*models.KitBuild, error)) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	var req BuildKitRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	warehouseObjectID, ok := layoutWarehouse(c, req.WarehouseID)
+	if !ok {
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	record, err := build(c.Request.Context(), kit.Build{
+		CompanyID:   companyObjectID,
+		KitItemID:   objectID,
+		WarehouseID: warehouseObjectID,
+		Quantity:    req.Quantity,
+		Batch:       req.Batch,
+		CreatedBy:   userObjectID,
+	})
+	if err != nil {
+		kitError(c, err, "Failed to build kits")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		action,
+		"KIT",
+		&objectID,
+		map[string]interface{}{
+			"build_id":     record.ID.Hex(),
+			"warehouse_id": record.WarehouseID.Hex(),
+			"quantity":     record.Quantity,
+			"lines":        record.Lines,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, record)
+}
+
+// kitError writes the response for a failed kit call
+func kitError(c *gin.Context, err error, message string) {
+	var shortage *kit.ShortageError
+	switch {
+	case errors.As(err, &shortage):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error(), "shortage": shortage})
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Kit, item or warehouse not found"})
+	case errors.Is(err, kit.ErrNoComponents), errors.Is(err, kit.ErrInvalidComponent),
+		errors.Is(err, kit.ErrCycle), errors.Is(err, kit.ErrInvalidQuantity):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, kit.ErrArchived), err == repository.ErrInsufficientStock:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -0,0 +1,322 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"strconv"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/label"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	defaultLabelDPI = 203 // common thermal printers
+	minLabelDPI     = 72
+	maxLabelDPI     = 600
+	maxLabelCopies  = 100
+)
+
+type LabelHandler struct {
+	labelService *label.Service
+	auditService *audit.AuditService
+}
+
+func NewLabelHandler(labelService *label.Service, auditService *audit.AuditService) *LabelHandler {
+	return &LabelHandler{
+		labelService: labelService,
+		auditService: auditService,
+	}
+}
+
+type ScanResolveRequest struct {
+	Payload     string `json:"payload" binding:"required"`
+	WarehouseID string `json:"warehouse_id"`
+}
+
+// printRequest is how a label request asks to be printed
+type printRequest struct {
+	format  string
+	options label.Options
+	copies  int
+	dpi     float64
+}
+
+// Templates lists the label templates that can be printed on
+func (h *LabelHandler) Templates(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"default": label.DefaultTemplate, "templates": h.labelService.Templates().List()})
+}
+
+// Item prints the label of an item, or with ?batch of one of its batches
+func (h *LabelHandler) Item(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+		return
+	}
+	req, ok := h.printRequest(c)
+	if !ok {
+		return
+	}
+
+	l, err := h.labelService.ItemLabel(c.Request.Context(), labelScope(c, nil), objectID, c.Query("batch"))
+	if err != nil {
+		labelError(c, err, "Item or batch not found")
+		return
+	}
+	h.print(c, req, []label.Label{l}, "label-"+l.Payload.SKU, objectID, "item")
+}
+
+// Location prints the label of a bin, or of a zone, aisle or rack
+func (h *LabelHandler) Location(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+	req, ok := h.printRequest(c)
+	if !ok {
+		return
+	}
+
+	l, err := h.labelService.LocationLabel(c.Request.Context(), labelScope(c, nil), objectID)
+	if err != nil {
+		labelError(c, err, "Storage location not found")
+		return
+	}
+	h.print(c, req, []label.Label{l}, "label-"+l.Payload.Path, objectID, "location")
+}
+
+// Warehouse prints labels for every item and batch in stock at a warehouse,
+// or with ?what=bins for every bin. Managers pick the warehouse with
+// ?warehouse_id; Supervisors and Staff always get their own.
+func (h *LabelHandler) Warehouse(c *gin.Context) {
+	what := c.DefaultQuery("what", "items")
+	if what != "items" && what != "bins" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "what must be items or bins"})
+		return
+	}
+	warehouseObjectID, ok := layoutWarehouse(c, c.Query("warehouse_id"))
+	if !ok {
+		return
+	}
+	req, ok := h.printRequest(c)
+	if !ok {
+		return
+	}
+
+	labels, err := h.labelService.WarehouseLabels(c.Request.Context(), labelScope(c, nil), warehouseObjectID, what == "bins")
+	if err != nil {
+		labelError(c, err, "Warehouse not found")
+		return
+	}
+	h.print(c, req, labels, "labels-"+what+"-"+warehouseObjectID.Hex(), warehouseObjectID, "warehouse_"+what)
+}
+
+// Batch prints labels for the items received in a batch at a warehouse, one
+// per item or with ?per_unit=true one per unit in stock
+func (h *LabelHandler) Batch(c *gin.Context) {
+	warehouseObjectID, ok := layoutWarehouse(c, c.Query("warehouse_id"))
+	if !ok {
+		return
+	}
+	req, ok := h.printRequest(c)
+	if !ok {
+		return
+	}
+
+	batch := c.Param("batch")
+	labels, err := h.labelService.BatchLabels(c.Request.Context(), labelScope(c, nil), warehouseObjectID, batch, c.Query("per_unit") == "true")
+	if err != nil {
+		labelError(c, err, "Batch not found in this warehouse")
+		return
+	}
+	h.print(c, req, labels, "labels-batch-"+batch, warehouseObjectID, "batch")
+}
+
+// Resolve looks up a scanned label, item or location ID, SKU or bin path.
+// Supervisors and Staff only find what is in their warehouse; Managers may
+// narrow the search with warehouse_id.
+func (h *LabelHandler) Resolve(c *gin.Context) {
+	var req ScanResolveRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	var requested *primitive.ObjectID
+	if req.WarehouseID != "" {
+		warehouseObjectID, err := primitive.ObjectIDFromHex(req.WarehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		requested = &warehouseObjectID
+	}
+
+	resolution, err := h.labelService.Resolve(c.Request.Context(), labelScope(c, requested), req.Payload)
+	if err != nil {
+		labelError(c, err, "Nothing matches this code")
+		return
+	}
+	c.JSON(http.StatusOK, resolution)
+}
+
+// printRequest reads the format, template, symbology, copies, skip and dpi
+// query parameters, writing a 400 when one is invalid
+func (h *LabelHandler) printRequest(c *gin.Context) (printRequest, bool) {
+	req := printRequest{format: c.DefaultQuery("format", label.FormatPDF), copies: 1, dpi: defaultLabelDPI}
+	if req.format != label.FormatPDF && req.format != label.FormatPNG {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be pdf or png"})
+		return req, false
+	}
+
+	template, ok := h.labelService.Templates().Get(c.DefaultQuery("template", label.DefaultTemplate))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown label template"})
+		return req, false
+	}
+	req.options = label.Options{Template: template, Symbology: c.DefaultQuery("symbology", template.Symbology)}
+	if !label.ValidSymbology(req.options.Symbology) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Symbology must be one of code128, qr, both"})
+		return req, false
+	}
+
+	if raw := c.Query("copies"); raw != "" {
+		copies, err := strconv.Atoi(raw)
+		if err != nil || copies < 1 || copies > maxLabelCopies {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "copies must be between 1 and " + strconv.Itoa(maxLabelCopies)})
+			return req, false
+		}
+		req.copies = copies
+	}
+	if raw := c.Query("skip"); raw != "" {
+		skip, err := strconv.Atoi(raw)
+		if err != nil || skip < 0 || skip >= template.PerPage() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "skip must be less than the labels on one sheet"})
+			return req, false
+		}
+		req.options.Skip = skip
+	}
+	if raw := c.Query("dpi"); raw != "" {
+		dpi, err := strconv.Atoi(raw)
+		if err != nil || dpi < minLabelDPI || dpi > maxLabelDPI {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "dpi must be between 72 and 600"})
+			return req, false
+		}
+		req.dpi = float64(dpi)
+	}
+	return req, true
+}
+
+// print renders labels, each repeated req.copies times, and audits the print run
+func (h *LabelHandler) print(c *gin.Context, req printRequest, labels []label.Label, filename string, resourceID primitive.ObjectID, kind string) {
+	if len(labels) == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Nothing to print"})
+		return
+	}
+	if len(labels)*req.copies > label.MaxLabels {
+		c.JSON(http.StatusBadRequest, gin.H{"error": label.ErrTooMany.Error()})
+		return
+	}
+	if req.copies > 1 {
+		repeated := make([]label.Label, 0, len(labels)*req.copies)
+		for _, l := range labels {
+			for i := 0; i < req.copies; i++ {
+				repeated = append(repeated, l)
+			}
+		}
+		labels = repeated
+	}
+
+	// Render before writing so a label too small for its barcode is still a 400
+	var buf bytes.Buffer
+	var err error
+	switch {
+	case req.format == label.FormatPDF:
+		err = label.RenderPDF(&buf, labels, req.options)
+	case len(labels) > 1:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "PNG holds a single label; use format=pdf"})
+		return
+	default:
+		err = label.RenderPNG(&buf, labels[0], req.options, req.dpi)
+	}
+	if err != nil {
+		if err == label.ErrTooDense {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to render labels"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"PRINT",
+		"LABEL",
+		&resourceID,
+		map[string]interface{}{
+			"kind":      kind,
+			"format":    req.format,
+			"template":  req.options.Template.Name,
+			"symbology": req.options.Symbology,
+			"count":     len(labels),
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	contentType := "application/pdf"
+	if req.format == label.FormatPNG {
+		contentType = "image/png"
+	}
+	c.Header("Content-Disposition", "attachment; filename="+safeFilename(filename)+"."+req.format)
+	c.Data(http.StatusOK, contentType, buf.Bytes())
+}
+
+// labelScope returns the scope of a label request: the caller's own warehouse
+// for Supervisors and Staff, otherwise requested, which may be nil
+func labelScope(c *gin.Context, requested *primitive.ObjectID) label.Scope {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	scope := label.Scope{CompanyID: companyObjectID, WarehouseID: requested}
+	if own := ownWarehouse(c); own != nil {
+		scope.WarehouseID = own
+	}
+	return scope
+}
+
+// labelError writes the response for a failed label or scan call
+func labelError(c *gin.Context, err error, notFound string) {
+	switch err {
+	case repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": notFound})
+	case label.ErrTooMany:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to look up labels"})
+	}
+}
+
+// safeFilename keeps the characters of s that are safe in a download name
+func safeFilename(s string) string {
+	out := make([]rune, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9', r == '-', r == '_', r == '.':
+			out = append(out, r)
+		default:
+			out = append(out, '_')
+		}
+	}
+	return string(out)
+}
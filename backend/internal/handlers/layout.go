@@ -0,0 +1,380 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/layout"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type LayoutHandler struct {
+	layoutService *layout.Service
+	auditService  *audit.AuditService
+}
+
+func NewLayoutHandler(layoutService *layout.Service, auditService *audit.AuditService) *LayoutHandler {
+	return &LayoutHandler{
+		layoutService: layoutService,
+		auditService:  auditService,
+	}
+}
+
+type CreateStorageLocationRequest struct {
+	WarehouseID string `json:"warehouse_id"`
+	ParentID    string `json:"parent_id"`
+	Kind        string `json:"kind" binding:"required"`
+	Code        string `json:"code" binding:"required"`
+	Name        string `json:"name"`
+	Capacity    int    `json:"capacity"`
+}
+
+type UpdateStorageLocationRequest struct {
+	Name     *string `json:"name"`
+	Capacity *int    `json:"capacity"`
+}
+
+type MoveStockRequest struct {
+	LocationID string  `json:"location_id" binding:"required"`
+	BinID      string  `json:"bin_id" binding:"required"`
+	Quantity   float64 `json:"quantity" binding:"required"`
+	Unit       string  `json:"unit"` // Defaults to the item's base unit
+	Reason     string  `json:"reason"`
+}
+
+// Tree returns a warehouse's zones, aisles, racks and bins with the stock
+// held in each. Managers and Auditors pick the warehouse with ?warehouse_id;
+// Supervisors and Staff always get their own.
+func (h *LayoutHandler) Tree(c *gin.Context) {
+	warehouseObjectID, ok := layoutWarehouse(c, c.Query("warehouse_id"))
+	if !ok {
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	tree, err := h.layoutService.Tree(c.Request.Context(), companyObjectID, warehouseObjectID)
+	if err != nil {
+		layoutError(c, err, "Failed to load warehouse layout")
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"warehouse_id": warehouseObjectID, "zones": tree})
+}
+
+// Create adds a zone, aisle, rack or bin to a warehouse
+func (h *LayoutHandler) Create(c *gin.Context) {
+	var req CreateStorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	warehouseObjectID, ok := layoutWarehouse(c, req.WarehouseID)
+	if !ok {
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	location := &models.StorageLocation{
+		CompanyID:   companyObjectID,
+		WarehouseID: warehouseObjectID,
+		Kind:        req.Kind,
+		Code:        req.Code,
+		Name:        req.Name,
+		Capacity:    req.Capacity,
+		CreatedBy:   userObjectID,
+	}
+	if req.ParentID != "" {
+		parentObjectID, err := primitive.ObjectIDFromHex(req.ParentID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid parent ID"})
+			return
+		}
+		location.ParentID = &parentObjectID
+	}
+
+	if err := h.layoutService.Create(c.Request.Context(), location); err != nil {
+		if err == repository.ErrDuplicate {
+			c.JSON(http.StatusConflict, gin.H{"error": "A location with this code already exists there"})
+			return
+		}
+		layoutError(c, err, "Failed to create storage location")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"CREATE",
+		"STORAGE_LOCATION",
+		&location.ID,
+		map[string]interface{}{
+			"warehouse_id": location.WarehouseID.Hex(),
+			"kind":         location.Kind,
+			"path":         location.Path,
+			"capacity":     location.Capacity,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, location)
+}
+
+// Update renames a storage location or changes a bin's capacity
+func (h *LayoutHandler) Update(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+	var req UpdateStorageLocationRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Name == nil && req.Capacity == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide name or capacity"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	location, err := h.layoutService.Update(c.Request.Context(), companyObjectID, objectID, ownWarehouse(c),
+		repository.LayoutUpdate{Name: req.Name, Capacity: req.Capacity})
+	if err != nil {
+		layoutError(c, err, "Failed to update storage location")
+		return
+	}
+
+	details := map[string]interface{}{"path": location.Path}
+	if req.Name != nil {
+		details["name"] = *req.Name
+	}
+	if req.Capacity != nil {
+		details["capacity"] = *req.Capacity
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"STORAGE_LOCATION",
+		&objectID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, location)
+}
+
+// Delete removes an empty storage location
+func (h *LayoutHandler) Delete(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	location, err := h.layoutService.Delete(c.Request.Context(), companyObjectID, objectID, ownWarehouse(c))
+	if err != nil {
+		layoutError(c, err, "Failed to delete storage location")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"DELETE",
+		"STORAGE_LOCATION",
+		&objectID,
+		map[string]interface{}{
+			"warehouse_id": location.WarehouseID.Hex(),
+			"kind":         location.Kind,
+			"path":         location.Path,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Storage location deleted successfully"})
+}
+
+// BinStock lists the stock in each bin of a warehouse, and the stock still
+// waiting to be put away. With an :id it covers that bin only.
+func (h *LayoutHandler) BinStock(c *gin.Context) {
+	warehouseObjectID, ok := layoutWarehouse(c, c.Query("warehouse_id"))
+	if !ok {
+		return
+	}
+	var binObjectID *primitive.ObjectID
+	if id := c.Param("id"); id != "" {
+		oid, err := primitive.ObjectIDFromHex(id)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bin ID"})
+			return
+		}
+		binObjectID = &oid
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	stock, err := h.layoutService.BinStock(c.Request.Context(), companyObjectID, warehouseObjectID, binObjectID)
+	if err != nil {
+		if err == repository.ErrNotFound && binObjectID != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Bin not found"})
+			return
+		}
+		layoutError(c, err, "Failed to load bin stock")
+		return
+	}
+	c.JSON(http.StatusOK, stock)
+}
+
+// Putaway moves stock that has not been put away into a bin
+func (h *LayoutHandler) Putaway(c *gin.Context) {
+	h.move(c, "PUTAWAY", h.layoutService.Putaway)
+}
+
+// Move moves stock from its bin into another bin of the same warehouse
+func (h *LayoutHandler) Move(c *gin.Context) {
+	h.move(c, "MOVE", h.layoutService.Move)
+}
+
+func (h *LayoutHandler) move(c *gin.Context, action string, move func(context.Context, layout.Movement) (*layout.MoveResult, error)) {
+	var req MoveStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	locationObjectID, err := primitive.ObjectIDFromHex(req.LocationID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+		return
+	}
+	binObjectID, err := primitive.ObjectIDFromHex(req.BinID)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid bin ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	result, err := move(c.Request.Context(), layout.Movement{
+		CompanyID:   companyObjectID,
+		LocationID:  locationObjectID,
+		BinID:       binObjectID,
+		Quantity:    req.Quantity,
+		Unit:        req.Unit,
+		WarehouseID: ownWarehouse(c),
+		UpdatedBy:   userObjectID,
+	})
+	if err != nil {
+		if err == repository.ErrInsufficientStock {
+			c.JSON(http.StatusConflict, gin.H{"error": "Insufficient stock"})
+			return
+		}
+		if unitError(c, err) {
+			return
+		}
+		layoutError(c, err, "Failed to move stock")
+		return
+	}
+
+	details := map[string]interface{}{
+		"warehouse_id":     result.To.WarehouseID.Hex(),
+		"from_location_id": result.From.ID.Hex(),
+		"to_location_id":   result.To.ID.Hex(),
+		"bin_id":           binObjectID.Hex(),
+		"quantity":         result.Quantity,
+	}
+	if result.From.BinID != nil {
+		details["from_bin_id"] = result.From.BinID.Hex()
+	}
+	if req.Unit != "" {
+		details["unit"] = req.Unit
+	}
+	if req.Reason != "" {
+		details["reason"] = req.Reason
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		action,
+		"ITEM",
+		&result.To.ItemID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, result)
+}
+
+// ownWarehouse returns the warehouse Supervisors and Staff are limited to,
+// or nil for other roles
+func ownWarehouse(c *gin.Context) *primitive.ObjectID {
+	if role := c.GetString("role"); role != "Supervisor" && role != "Staff" {
+		return nil
+	}
+	warehouseObjectID, _ := primitive.ObjectIDFromHex(c.GetString("warehouse_id"))
+	return &warehouseObjectID
+}
+
+// layoutWarehouse returns the warehouse a layout request is about: the
+// caller's own for Supervisors and Staff, otherwise the one given. It writes
+// a 400 when none is given.
+func layoutWarehouse(c *gin.Context, requested string) (primitive.ObjectID, bool) {
+	if own := ownWarehouse(c); own != nil {
+		return *own, true
+	}
+	warehouseObjectID, err := primitive.ObjectIDFromHex(requested)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide a valid warehouse_id"})
+		return primitive.NilObjectID, false
+	}
+	return warehouseObjectID, true
+}
+
+// layoutError writes the response for a failed layout or bin stock call
+func layoutError(c *gin.Context, err error, message string) {
+	switch err {
+	case repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse or storage location not found"})
+	case layout.ErrLocationNotFound, layout.ErrBinNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case layout.ErrInvalidKind, layout.ErrInvalidParent, layout.ErrInvalidCapacity, layout.ErrInvalidQuantity,
+		layout.ErrNotBin, layout.ErrOtherWarehouse, layout.ErrSameBin:
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case layout.ErrNotEmpty, layout.ErrAlreadyBinned, layout.ErrNotBinned, layout.ErrOverCapacity, layout.ErrOnHold:
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+	}
+}
@@ -7,19 +7,24 @@ import (
 
 	"github.com/a2sv/safeware/internal/audit"
 	"github.com/a2sv/safeware/internal/auth"
-	"github.com/a2sv/safeware/internal/database"
 	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 type ManagerHandler struct {
+	tx           repository.Transactor
+	users        repository.UserRepository
+	warehouses   repository.WarehouseRepository
 	auditService *audit.AuditService
 }
 
-func NewManagerHandler(auditService *audit.AuditService) *ManagerHandler {
+func NewManagerHandler(tx repository.Transactor, users repository.UserRepository, warehouses repository.WarehouseRepository, auditService *audit.AuditService) *ManagerHandler {
 	return &ManagerHandler{
+		tx:           tx,
+		users:        users,
+		warehouses:   warehouses,
 		auditService: auditService,
 	}
 }
@@ -64,11 +69,9 @@ func (h *ManagerHandler) CreateEmployee(role string) gin.HandlerFunc {
 			warehouseObjectID = &objID
 
 			// Verify warehouse exists and belongs to company
-			ctx := context.Background()
-			whCollection := database.GetCollection("warehouses")
 			companyObjID, _ := primitive.ObjectIDFromHex(companyID)
-			count, _ := whCollection.CountDocuments(ctx, bson.M{"_id": objID, "company_id": companyObjID})
-			if count == 0 {
+			exists, _ := h.warehouses.Exists(c.Request.Context(), companyObjID, objID)
+			if !exists {
 				c.JSON(http.StatusBadRequest, gin.H{"error": "Warehouse not found or does not belong to company"})
 				return
 			}
@@ -104,28 +107,33 @@ func (h *ManagerHandler) CreateEmployee(role string) gin.HandlerFunc {
 			UpdatedAt:      time.Now(),
 		}
 
-		ctx := context.Background()
-		usersCollection := database.GetCollection("users")
+		ctx := c.Request.Context()
 
 		// Check email uniqueness
-		count, _ := usersCollection.CountDocuments(ctx, bson.M{"email": req.Email})
-		if count > 0 {
+		if exists, _ := h.users.EmailExists(ctx, req.Email); exists {
 			c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
 			return
 		}
 
-		_, err = usersCollection.InsertOne(ctx, user)
+		// Create the user and, for a Supervisor, assign the warehouse in one transaction
+		err = h.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			if err := h.users.Create(ctx, &user); err != nil {
+				return err
+			}
+			if role == "Supervisor" && warehouseObjectID != nil {
+				return h.warehouses.SetSupervisor(ctx, *warehouseObjectID, user.ID)
+			}
+			return nil
+		})
 		if err != nil {
+			if err == repository.ErrDuplicate {
+				c.JSON(http.StatusConflict, gin.H{"error": "Email already registered"})
+				return
+			}
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create employee"})
 			return
 		}
 
-		// If Supervisor, update Warehouse
-		if role == "Supervisor" && warehouseObjectID != nil {
-			whCollection := database.GetCollection("warehouses")
-			whCollection.UpdateOne(ctx, bson.M{"_id": *warehouseObjectID}, bson.M{"$set": bson.M{"supervisor_id": user.ID}})
-		}
-
 		// Log audit
 		go h.auditService.LogAction(
 			context.Background(),
@@ -160,30 +168,19 @@ func (h *ManagerHandler) ListEmployees(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("users")
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 
 	// Find all users for this company, excluding the current user (Manager) if desired,
 	// but usually manager wants to see everyone including other managers?
 	// Let's filter by roles: Supervisor, Staff, Auditor
-	filter := bson.M{
-		"company_id": companyObjectID,
-		"role":       bson.M{"$in": []string{"Supervisor", "Staff", "Auditor"}},
-	}
-
-	cursor, err := collection.Find(ctx, filter)
+	employees, err := h.users.List(c.Request.Context(), repository.UserFilter{
+		CompanyID: companyObjectID,
+		Roles:     []string{"Supervisor", "Staff", "Auditor"},
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch employees"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var employees []models.User
-	if err = cursor.All(ctx, &employees); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode employees"})
-		return
-	}
 
 	// Transform to response format if needed, or just return users
 	// We might want to sanitize password hashes
@@ -222,35 +219,22 @@ func (h *ManagerHandler) UpdateEmployee(c *gin.Context) {
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	managerObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
-
-	// Build update document
-	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	// Build update
+	update := repository.UserUpdate{}
 	if req.FullName != "" {
-		update["$set"].(bson.M)["full_name"] = req.FullName
+		update.FullName = &req.FullName
 	}
 	if req.Email != "" {
-		update["$set"].(bson.M)["email"] = req.Email
+		update.Email = &req.Email
 	}
 	if req.WarehouseID != "" && c.GetString("role") != "Supervisor" {
 		warehouseObjID, err := primitive.ObjectIDFromHex(req.WarehouseID)
 		if err == nil {
-			update["$set"].(bson.M)["warehouse_id"] = warehouseObjID
+			update.WarehouseID = &warehouseObjID
 		}
 	}
 
-	filter := bson.M{"_id": employeeObjectID, "company_id": companyObjectID}
-	if c.GetString("role") == "Supervisor" {
-		whID := c.GetString("warehouse_id")
-		if whID != "" {
-			whObjID, _ := primitive.ObjectIDFromHex(whID)
-			filter["warehouse_id"] = whObjID
-		}
-	}
-
-	result, err := usersCollection.UpdateOne(ctx, filter, update)
-	if err != nil || result.MatchedCount == 0 {
+	if err := h.users.Update(c.Request.Context(), employeeFilter(c, companyObjectID), employeeObjectID, update); err != nil {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
 		return
 	}
@@ -291,22 +275,19 @@ func (h *ManagerHandler) DeleteEmployee(c *gin.Context) {
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	managerObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	ctx := context.Background()
-	usersCollection := database.GetCollection("users")
-
-	// Delete the employee
-	filter := bson.M{"_id": employeeObjectID, "company_id": companyObjectID}
-	if c.GetString("role") == "Supervisor" {
-		whID := c.GetString("warehouse_id")
-		if whID != "" {
-			whObjID, _ := primitive.ObjectIDFromHex(whID)
-			filter["warehouse_id"] = whObjID
+	// Delete the employee and unassign any warehouse they supervised
+	err = h.tx.WithTransaction(c.Request.Context(), func(ctx context.Context) error {
+		if err := h.users.Delete(ctx, employeeFilter(c, companyObjectID), employeeObjectID); err != nil {
+			return err
 		}
-	}
-
-	result, err := usersCollection.DeleteOne(ctx, filter)
-	if err != nil || result.DeletedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return h.warehouses.ClearSupervisor(ctx, employeeObjectID)
+	})
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete employee"})
 		return
 	}
 
@@ -327,3 +308,15 @@ func (h *ManagerHandler) DeleteEmployee(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Employee deleted successfully"})
 }
+
+// employeeFilter scopes employee changes to the company, and Supervisors to their own warehouse
+func employeeFilter(c *gin.Context, companyID primitive.ObjectID) repository.UserFilter {
+	filter := repository.UserFilter{CompanyID: companyID}
+	if c.GetString("role") == "Supervisor" {
+		if whID := c.GetString("warehouse_id"); whID != "" {
+			whObjID, _ := primitive.ObjectIDFromHex(whID)
+			filter.WarehouseID = &whObjID
+		}
+	}
+	return filter
+}
@@ -1,13 +1,10 @@
 package handlers
 
 import (
-	"context"
 	"net/http"
 
-	"github.com/a2sv/safeware/internal/database"
-	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
@@ -21,30 +18,19 @@ func (h *ManagerHandler) ListWarehouseEmployees(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("users")
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	warehouseObjectID, _ := primitive.ObjectIDFromHex(warehouseID)
 
 	// Find users in this warehouse with roles Staff or Supervisor
-	filter := bson.M{
-		"company_id":   companyObjectID,
-		"warehouse_id": warehouseObjectID,
-		"role":         bson.M{"$in": []string{"Supervisor", "Staff"}},
-	}
-
-	cursor, err := collection.Find(ctx, filter)
+	employees, err := h.users.List(c.Request.Context(), repository.UserFilter{
+		CompanyID:   companyObjectID,
+		WarehouseID: &warehouseObjectID,
+		Roles:       []string{"Supervisor", "Staff"},
+	})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch employees"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var employees []models.User
-	if err = cursor.All(ctx, &employees); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode employees"})
-		return
-	}
 
 	// Sanitize password hashes
 	for i := range employees {
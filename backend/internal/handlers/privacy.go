@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/privacy"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// erasureConfirmation must be sent in the erase body, since pseudonymization cannot be undone
+const erasureConfirmation = "ERASE"
+
+type PrivacyHandler struct {
+	privacyService *privacy.Service
+	auditService   *audit.AuditService
+}
+
+func NewPrivacyHandler(privacyService *privacy.Service, auditService *audit.AuditService) *PrivacyHandler {
+	return &PrivacyHandler{
+		privacyService: privacyService,
+		auditService:   auditService,
+	}
+}
+
+type EraseUserRequest struct {
+	Confirm string `json:"confirm" binding:"required"`
+}
+
+// ExportCompany streams a zip archive of all company data for offboarding
+func (h *PrivacyHandler) ExportCompany(c *gin.Context) {
+	companyObjectID, err := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid company ID"})
+		return
+	}
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	email := c.GetString("email")
+
+	filename := fmt.Sprintf("company-export-%s.zip", time.Now().UTC().Format("20060102T150405Z"))
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.Status(http.StatusOK)
+
+	manifest, err := h.privacyService.ExportCompany(c.Request.Context(), c.Writer, companyObjectID, email)
+	if err != nil {
+		// Headers are already sent, so the truncated archive is the only signal to the client
+		log.Printf("Error exporting company data: %v", err)
+		return
+	}
+
+	counts := map[string]int64{}
+	for _, file := range manifest.Files {
+		counts[file.Name] = file.RecordCount
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		email,
+		"EXPORT",
+		"COMPANY",
+		&companyObjectID,
+		map[string]interface{}{"record_counts": counts},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+}
+
+// PersonalData returns everything stored about a current or former employee
+func (h *PrivacyHandler) PersonalData(c *gin.Context) {
+	employeeObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	report, err := h.privacyService.PersonalData(c.Request.Context(), companyObjectID, employeeObjectID)
+	if errors.Is(err, privacy.ErrUserNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build personal data report"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"EXPORT",
+		"EMPLOYEE",
+		&employeeObjectID,
+		map[string]interface{}{"report": "personal_data", "audit_log_count": len(report.AuditLogs)},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	filename := fmt.Sprintf("personal-data-%s.json", employeeObjectID.Hex())
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+	c.JSON(http.StatusOK, report)
+}
+
+// EraseEmployee pseudonymizes a departed employee's name and email everywhere
+func (h *PrivacyHandler) EraseEmployee(c *gin.Context) {
+	employeeObjectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid employee ID"})
+		return
+	}
+
+	var req EraseUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil || req.Confirm != erasureConfirmation {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Erasure must be confirmed with {\"confirm\": \"" + erasureConfirmation + "\"}"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	if employeeObjectID == userObjectID {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "You cannot erase your own account"})
+		return
+	}
+
+	result, err := h.privacyService.EraseUser(c.Request.Context(), companyObjectID, employeeObjectID)
+	switch {
+	case errors.Is(err, privacy.ErrUserNotFound):
+		c.JSON(http.StatusNotFound, gin.H{"error": "Employee not found"})
+		return
+	case errors.Is(err, privacy.ErrAlreadyErased):
+		c.JSON(http.StatusConflict, gin.H{"error": "Employee has already been erased"})
+		return
+	case err != nil:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to erase employee data"})
+		return
+	}
+
+	// Log audit. Only the alias is recorded, never the erased identifiers.
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"ERASE",
+		"EMPLOYEE",
+		&employeeObjectID,
+		map[string]interface{}{
+			"alias":              result.Alias,
+			"profile_erased":     result.ProfileErased,
+			"sessions_revoked":   result.SessionsRevoked,
+			"audit_logs_updated": result.AuditLogsUpdated,
+			"alerts_updated":     result.AlertsUpdated,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, result)
+}
@@ -0,0 +1,342 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/quality"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type QualityHandler struct {
+	qualityService *quality.Service
+	auditService   *audit.AuditService
+}
+
+func NewQualityHandler(qualityService *quality.Service, auditService *audit.AuditService) *QualityHandler {
+	return &QualityHandler{
+		qualityService: qualityService,
+		auditService:   auditService,
+	}
+}
+
+// HoldStockRequest holds one location's stock, or with ItemID all available
+// stock of an item's batch
+type HoldStockRequest struct {
+	LocationID  string  `json:"location_id"`
+	ItemID      string  `json:"item_id"`
+	Batch       string  `json:"batch"`        // With item_id; any batch when empty
+	WarehouseID string  `json:"warehouse_id"` // Managers only, with item_id; every warehouse when empty
+	Quantity    float64 `json:"quantity"`     // With location_id; all available stock when empty
+	Unit        string  `json:"unit"`
+	Reason      string  `json:"reason" binding:"required"`
+	Notes       string  `json:"notes"`
+}
+
+type InspectHoldRequest struct {
+	Notes string `json:"notes" binding:"required"`
+}
+
+type DecideHoldRequest struct {
+	Quantity  float64 `json:"quantity"` // All the hold still holds when empty
+	Unit      string  `json:"unit"`
+	Notes     string  `json:"notes"`
+	Supplier  string  `json:"supplier"`  // Returns only, required
+	Reference string  `json:"reference"` // Returns only, e.g. an RMA number
+}
+
+// List returns quality holds, newest first, filtered by ?status=held|resolved,
+// ?item_id and ?warehouse_id. Supervisors and Staff only see their warehouse.
+func (h *QualityHandler) List(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	filter := repository.QualityHoldFilter{Status: c.Query("status"), WarehouseID: ownWarehouse(c)}
+	if filter.Status != "" && filter.Status != models.HoldOpen && filter.Status != models.HoldResolved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "status must be held or resolved"})
+		return
+	}
+	if warehouseID := c.Query("warehouse_id"); warehouseID != "" && filter.WarehouseID == nil {
+		warehouseObjectID, err := primitive.ObjectIDFromHex(warehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		filter.WarehouseID = &warehouseObjectID
+	}
+	if itemID := c.Query("item_id"); itemID != "" {
+		itemObjectID, err := primitive.ObjectIDFromHex(itemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+			return
+		}
+		filter.ItemID = &itemObjectID
+	}
+
+	holds, err := h.qualityService.List(c.Request.Context(), companyObjectID, filter)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to list quality holds"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"holds": holds})
+}
+
+// Get returns one quality hold with its inspections and decisions
+func (h *QualityHandler) Get(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	hold, err := h.qualityService.Get(c.Request.Context(), companyObjectID, objectID, ownWarehouse(c))
+	if err != nil {
+		qualityError(c, err, "Failed to load quality hold")
+		return
+	}
+	c.JSON(http.StatusOK, hold)
+}
+
+// Hold puts stock on quality hold. Held stock stays in its location but is
+// not available to move, assemble or issue until a decision settles it.
+func (h *QualityHandler) Hold(c *gin.Context) {
+	var req HoldStockRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	hold := quality.Hold{
+		CompanyID:   companyObjectID,
+		Batch:       req.Batch,
+		Quantity:    req.Quantity,
+		Unit:        req.Unit,
+		Reason:      req.Reason,
+		Notes:       req.Notes,
+		WarehouseID: ownWarehouse(c),
+		HeldBy:      userObjectID,
+	}
+	switch {
+	case req.LocationID != "":
+		locationObjectID, err := primitive.ObjectIDFromHex(req.LocationID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid location ID"})
+			return
+		}
+		hold.LocationID = &locationObjectID
+	case req.ItemID != "":
+		itemObjectID, err := primitive.ObjectIDFromHex(req.ItemID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid item ID"})
+			return
+		}
+		hold.ItemID = &itemObjectID
+		if req.WarehouseID != "" && hold.WarehouseID == nil {
+			warehouseObjectID, err := primitive.ObjectIDFromHex(req.WarehouseID)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+				return
+			}
+			hold.WarehouseID = &warehouseObjectID
+		}
+	default:
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide location_id, or item_id with an optional batch"})
+		return
+	}
+
+	holds, err := h.qualityService.Hold(c.Request.Context(), hold)
+	if err != nil {
+		qualityError(c, err, "Failed to hold stock")
+		return
+	}
+
+	for _, held := range holds {
+		holdID := held.ID
+		// Log audit
+		go h.auditService.LogAction(
+			context.Background(),
+			userObjectID,
+			companyObjectID,
+			c.GetString("email"),
+			"HOLD",
+			"QUALITY_HOLD",
+			&holdID,
+			map[string]interface{}{
+				"item_id":      held.ItemID.Hex(),
+				"location_id":  held.LocationID.Hex(),
+				"warehouse_id": held.WarehouseID.Hex(),
+				"batch":        held.Batch,
+				"quantity":     held.Quantity,
+				"reason":       held.Reason,
+				"notes":        held.Notes,
+			},
+			c.ClientIP(),
+			c.Request.UserAgent(),
+			"SUCCESS",
+		)
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"holds": holds})
+}
+
+// Inspect records an inspection of held stock
+func (h *QualityHandler) Inspect(c *gin.Context) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+	var req InspectHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	hold, err := h.qualityService.Inspect(c.Request.Context(), companyObjectID, objectID, ownWarehouse(c), req.Notes, userObjectID)
+	if err != nil {
+		qualityError(c, err, "Failed to record inspection")
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"INSPECT",
+		"QUALITY_HOLD",
+		&objectID,
+		map[string]interface{}{
+			"item_id": hold.ItemID.Hex(),
+			"notes":   req.Notes,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, hold)
+}
+
+// Release makes held stock available again
+func (h *QualityHandler) Release(c *gin.Context) {
+	h.decide(c, models.DecisionRelease)
+}
+
+// Scrap writes held stock off
+func (h *QualityHandler) Scrap(c *gin.Context) {
+	h.decide(c, models.DecisionScrap)
+}
+
+// Return sends held stock back to its supplier
+func (h *QualityHandler) Return(c *gin.Context) {
+	h.decide(c, models.DecisionReturn)
+}
+
+func (h *QualityHandler) decide(c *gin.Context, action string) {
+	objectID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+	var req DecideHoldRequest
+	// Body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	hold, decision, err := h.qualityService.Decide(c.Request.Context(), quality.Decision{
+		CompanyID:   companyObjectID,
+		HoldID:      objectID,
+		Action:      action,
+		Quantity:    req.Quantity,
+		Unit:        req.Unit,
+		Notes:       req.Notes,
+		Supplier:    req.Supplier,
+		Reference:   req.Reference,
+		WarehouseID: ownWarehouse(c),
+		DecidedBy:   userObjectID,
+	})
+	if err != nil {
+		qualityError(c, err, "Failed to record decision")
+		return
+	}
+
+	details := map[string]interface{}{
+		"item_id":     hold.ItemID.Hex(),
+		"location_id": hold.LocationID.Hex(),
+		"quantity":    decision.Quantity,
+		"remaining":   hold.Remaining,
+		"status":      hold.Status,
+	}
+	if decision.Notes != "" {
+		details["notes"] = decision.Notes
+	}
+	if action != models.DecisionRelease {
+		details["total_cost"] = decision.TotalCost
+	}
+	if action == models.DecisionReturn {
+		details["supplier"] = decision.Supplier
+		details["reference"] = decision.Reference
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		auditDecisions[action],
+		"QUALITY_HOLD",
+		&objectID,
+		details,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"hold": hold, "decision": decision})
+}
+
+// auditDecisions names the audit action of each quality decision
+var auditDecisions = map[string]string{
+	models.DecisionRelease: "RELEASE",
+	models.DecisionScrap:   "SCRAP",
+	models.DecisionReturn:  "RETURN",
+}
+
+// qualityError writes the response for a failed quality hold call
+func qualityError(c *gin.Context, err error, message string) {
+	switch {
+	case err == repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Quality hold or item not found"})
+	case err == quality.ErrLocationNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+	case err == repository.ErrInsufficientStock:
+		c.JSON(http.StatusConflict, gin.H{"error": "Not enough available stock at the location"})
+	case err == repository.ErrVersionMismatch:
+		c.JSON(http.StatusConflict, gin.H{"error": "Quality hold was changed by another request; retry"})
+	case errors.Is(err, quality.ErrResolved), errors.Is(err, quality.ErrNothingToHold), errors.Is(err, quality.ErrExceedsHold):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	case errors.Is(err, quality.ErrInvalidQuantity), errors.Is(err, quality.ErrReasonRequired), errors.Is(err, quality.ErrNotesRequired),
+		errors.Is(err, quality.ErrSupplierRequired), errors.Is(err, quality.ErrInvalidDecision):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	default:
+		if !unitError(c, err) {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": message})
+		}
+	}
+}
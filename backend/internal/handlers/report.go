@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"context"
+	"log"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/report"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ReportHandler struct {
+	reportService *report.Service
+	auditService  *audit.AuditService
+}
+
+func NewReportHandler(reportService *report.Service, auditService *audit.AuditService) *ReportHandler {
+	return &ReportHandler{
+		reportService: reportService,
+		auditService:  auditService,
+	}
+}
+
+// Generate downloads an inventory report as CSV, XLSX or PDF. Managers and
+// Auditors may scope it with ?warehouse_id; Supervisors always get their own
+// warehouse. ?as_of values stock at the prices in effect at that time, and
+// ?unit shows item quantities in that unit where the item has it.
+func (h *ReportHandler) Generate(c *gin.Context) {
+	kind := c.Param("report")
+	if !report.ValidKind(kind) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Report must be one of stock-on-hand, valuation, quality, archived"})
+		return
+	}
+	format := c.DefaultQuery("format", report.FormatCSV)
+	if !report.ValidFormat(format) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Format must be one of csv, xlsx, pdf"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+	scope := report.Scope{CompanyID: companyObjectID, Unit: c.Query("unit")}
+
+	warehouseID := c.Query("warehouse_id")
+	if role := c.GetString("role"); role == "Supervisor" || role == "Staff" {
+		warehouseID = c.GetString("warehouse_id")
+	}
+	if warehouseID != "" {
+		warehouseObjectID, err := primitive.ObjectIDFromHex(warehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		scope.WarehouseID = &warehouseObjectID
+	}
+	if raw := c.Query("as_of"); raw != "" {
+		asOf, err := parseTimeParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid as_of date, use RFC 3339 or YYYY-MM-DD"})
+			return
+		}
+		scope.AsOf = &asOf
+	}
+
+	table, err := h.reportService.Build(c.Request.Context(), kind, scope)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to build report"})
+		return
+	}
+
+	c.Header("Content-Type", report.ContentType(format))
+	c.Header("Content-Disposition", "attachment; filename="+report.FileName(table, format))
+	c.Status(http.StatusOK)
+	if err := report.Render(c.Writer, table, format); err != nil {
+		// Headers are already sent, so the truncated file is the only signal to the client
+		log.Printf("Error rendering %s report: %v", kind, err)
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"EXPORT",
+		"REPORT",
+		scope.WarehouseID,
+		map[string]interface{}{
+			"report":    kind,
+			"format":    format,
+			"scope":     table.Scope,
+			"row_count": len(table.Rows),
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+}
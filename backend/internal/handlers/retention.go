@@ -0,0 +1,296 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type RetentionHandler struct {
+	retentionService *audit.RetentionService
+	auditService     *audit.AuditService
+}
+
+func NewRetentionHandler(retentionService *audit.RetentionService, auditService *audit.AuditService) *RetentionHandler {
+	return &RetentionHandler{
+		retentionService: retentionService,
+		auditService:     auditService,
+	}
+}
+
+type UpdateRetentionRequest struct {
+	RetentionDays   int    `json:"retention_days" binding:"min=0"`
+	LegalHold       bool   `json:"legal_hold"`
+	LegalHoldReason string `json:"legal_hold_reason"`
+}
+
+type CreateLegalHoldRequest struct {
+	Reason     string `json:"reason" binding:"required"`
+	UserID     string `json:"user_id"`
+	ResourceID string `json:"resource_id"`
+	FromDate   string `json:"from_date"` // RFC3339
+	ToDate     string `json:"to_date"`   // RFC3339
+}
+
+// GetPolicy returns the company's audit retention policy
+func (h *RetentionHandler) GetPolicy(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	policy, err := h.retentionService.GetPolicy(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch retention policy"})
+		return
+	}
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// UpdatePolicy sets the retention period and company-wide legal hold
+func (h *RetentionHandler) UpdatePolicy(c *gin.Context) {
+	var req UpdateRetentionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	policy, err := h.retentionService.SetPolicy(c.Request.Context(), companyObjectID, req.RetentionDays, req.LegalHold, req.LegalHoldReason, userObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update retention policy"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"RETENTION_POLICY",
+		&policy.ID,
+		map[string]interface{}{
+			"retention_days": req.RetentionDays,
+			"legal_hold":     req.LegalHold,
+			"reason":         req.LegalHoldReason,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, policy)
+}
+
+// CreateHold places a scoped legal hold on audit logs
+func (h *RetentionHandler) CreateHold(c *gin.Context) {
+	var req CreateLegalHoldRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	hold := models.LegalHold{Reason: req.Reason, CreatedBy: userObjectID}
+	if req.UserID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.UserID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
+		hold.UserID = oid
+	}
+	if req.ResourceID != "" {
+		oid, err := primitive.ObjectIDFromHex(req.ResourceID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid resource ID"})
+			return
+		}
+		hold.ResourceID = oid
+	}
+	if req.FromDate != "" {
+		from, err := time.Parse(time.RFC3339, req.FromDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "from_date must be RFC3339"})
+			return
+		}
+		hold.FromDate = &from
+	}
+	if req.ToDate != "" {
+		to, err := time.Parse(time.RFC3339, req.ToDate)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "to_date must be RFC3339"})
+			return
+		}
+		hold.ToDate = &to
+	}
+
+	created, err := h.retentionService.AddHold(c.Request.Context(), companyObjectID, hold)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create legal hold"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"CREATE",
+		"LEGAL_HOLD",
+		&created.ID,
+		map[string]interface{}{
+			"reason":      req.Reason,
+			"user_id":     req.UserID,
+			"resource_id": req.ResourceID,
+			"from_date":   req.FromDate,
+			"to_date":     req.ToDate,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// DeleteHold lifts a scoped legal hold
+func (h *RetentionHandler) DeleteHold(c *gin.Context) {
+	holdID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid hold ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	if err := h.retentionService.RemoveHold(c.Request.Context(), companyObjectID, holdID); err != nil {
+		if err == audit.ErrHoldNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Legal hold not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove legal hold"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"DELETE",
+		"LEGAL_HOLD",
+		&holdID,
+		nil,
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Legal hold removed successfully"})
+}
+
+// Run archives the company's expired audit logs immediately
+func (h *RetentionHandler) Run(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	archived, err := h.retentionService.Run(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Retention run failed", "archived": archived})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"archived": archived})
+}
+
+// ListArchives returns the archive index, filterable by date range, action and user
+func (h *RetentionHandler) ListArchives(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	archives, err := h.retentionService.ListArchives(c.Request.Context(), companyObjectID, auditFilter(c))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit archives"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"archives": archives})
+}
+
+// SearchArchive returns entries from one archive matching the audit log filters
+func (h *RetentionHandler) SearchArchive(c *gin.Context) {
+	archiveID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	logs, err := h.retentionService.SearchArchive(c.Request.Context(), companyObjectID, archiveID, auditFilter(c))
+	if err != nil {
+		h.archiveError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, logs)
+}
+
+// RestoreArchive puts an archive's entries back into the live audit log
+func (h *RetentionHandler) RestoreArchive(c *gin.Context) {
+	archiveID, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid archive ID"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	restored, err := h.retentionService.RestoreArchive(c.Request.Context(), companyObjectID, archiveID, userObjectID)
+	if err != nil {
+		h.archiveError(c, err)
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"RESTORE",
+		"AUDIT_ARCHIVE",
+		&archiveID,
+		map[string]interface{}{
+			"restored": restored,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"restored": restored})
+}
+
+func (h *RetentionHandler) archiveError(c *gin.Context, err error) {
+	switch err {
+	case audit.ErrArchiveNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Audit archive not found"})
+	case audit.ErrArchiveTampered:
+		c.JSON(http.StatusConflict, gin.H{"error": "Audit archive failed integrity check"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to read audit archive"})
+	}
+}
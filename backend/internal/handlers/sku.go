@@ -0,0 +1,126 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/sku"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type SKUHandler struct {
+	skuService   *sku.Service
+	auditService *audit.AuditService
+}
+
+func NewSKUHandler(skuService *sku.Service, auditService *audit.AuditService) *SKUHandler {
+	return &SKUHandler{
+		skuService:   skuService,
+		auditService: auditService,
+	}
+}
+
+type ReserveSKURequest struct {
+	Department string `json:"department"` // Needed when the pattern uses department codes
+}
+
+// GetPattern returns the company's SKU pattern
+func (h *SKUHandler) GetPattern(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	pattern, err := h.skuService.Pattern(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load SKU pattern"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"pattern": pattern})
+}
+
+// UpdatePattern replaces the company's SKU pattern
+func (h *SKUHandler) UpdatePattern(c *gin.Context) {
+	var req models.SKUPattern
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	pattern, err := h.skuService.SetPattern(c.Request.Context(), companyObjectID, req)
+	if err != nil {
+		if errors.Is(err, sku.ErrInvalidPattern) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update SKU pattern"})
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"SKU_PATTERN",
+		&companyObjectID,
+		map[string]interface{}{"pattern": pattern},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, gin.H{"pattern": pattern})
+}
+
+// Reserve takes the next SKU of the company's pattern, for an item that is
+// yet to be created
+func (h *SKUHandler) Reserve(c *gin.Context) {
+	var req ReserveSKURequest
+	// Body is optional
+	_ = c.ShouldBindJSON(&req)
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	reserved, err := h.skuService.Reserve(c.Request.Context(), companyObjectID, req.Department)
+	if err != nil {
+		skuError(c, err)
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"RESERVE",
+		"SKU",
+		nil,
+		map[string]interface{}{"sku": reserved, "department": req.Department},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusCreated, gin.H{"sku": reserved})
+}
+
+// skuError writes the response for a SKU that could not be generated
+func skuError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, sku.ErrNoPattern), errors.Is(err, sku.ErrDepartmentRequired), errors.Is(err, sku.ErrInvalidPattern):
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+	case errors.Is(err, sku.ErrExhausted):
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate SKU"})
+	}
+}
@@ -1,21 +1,19 @@
 package handlers
 
 import (
-	"context"
 	"net/http"
 
-	"github.com/a2sv/safeware/internal/database"
-	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
-type UserHandler struct{}
+type UserHandler struct {
+	users repository.UserRepository
+}
 
-func NewUserHandler() *UserHandler {
-	return &UserHandler{}
+func NewUserHandler(users repository.UserRepository) *UserHandler {
+	return &UserHandler{users: users}
 }
 
 // ListUsers returns all users for the company
@@ -26,22 +24,12 @@ func (h *UserHandler) List(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("users")
-
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
-	cursor, err := collection.Find(ctx, bson.M{"company_id": companyObjectID})
+	users, err := h.users.List(c.Request.Context(), repository.UserFilter{CompanyID: companyObjectID})
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var users []models.User
-	if err = cursor.All(ctx, &users); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode users"})
-		return
-	}
 
 	// Remove sensitive fields
 	for i := range users {
@@ -59,9 +47,6 @@ func (h *UserHandler) Get(c *gin.Context) {
 	companyID := c.GetString("company_id")
 	userID := c.Param("id")
 
-	ctx := context.Background()
-	collection := database.GetCollection("users")
-
 	objectID, err := primitive.ObjectIDFromHex(userID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
@@ -69,10 +54,9 @@ func (h *UserHandler) Get(c *gin.Context) {
 	}
 
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
-	var user models.User
-	err = collection.FindOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}).Decode(&user)
+	user, err := h.users.Get(c.Request.Context(), companyObjectID, objectID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
@@ -0,0 +1,180 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type ValuationHandler struct {
+	valuationService *valuation.Service
+	auditService     *audit.AuditService
+}
+
+func NewValuationHandler(valuationService *valuation.Service, auditService *audit.AuditService) *ValuationHandler {
+	return &ValuationHandler{
+		valuationService: valuationService,
+		auditService:     auditService,
+	}
+}
+
+type UpdateValuationSettingsRequest struct {
+	Currency *string `json:"currency"`
+	Method   *string `json:"method"`
+}
+
+// GetSettings returns the company's currency and valuation method
+func (h *ValuationHandler) GetSettings(c *gin.Context) {
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+
+	settings, err := h.valuationService.Settings(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load valuation settings"})
+		return
+	}
+	c.JSON(http.StatusOK, settings)
+}
+
+// UpdateSettings changes the company's currency or valuation method
+func (h *ValuationHandler) UpdateSettings(c *gin.Context) {
+	var req UpdateValuationSettingsRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Currency == nil && req.Method == nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Provide currency or method"})
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	userObjectID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+	previous, err := h.valuationService.Settings(c.Request.Context(), companyObjectID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to load valuation settings"})
+		return
+	}
+	settings, err := h.valuationService.UpdateSettings(c.Request.Context(), companyObjectID, req.Currency, req.Method, userObjectID)
+	if err != nil {
+		switch err {
+		case valuation.ErrInvalidCurrency, valuation.ErrInvalidMethod:
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case valuation.ErrCurrencyLocked:
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update valuation settings"})
+		}
+		return
+	}
+
+	// Log audit
+	go h.auditService.LogAction(
+		context.Background(),
+		userObjectID,
+		companyObjectID,
+		c.GetString("email"),
+		"UPDATE",
+		"VALUATION_SETTINGS",
+		&companyObjectID,
+		map[string]interface{}{
+			"old_currency": previous.Currency,
+			"new_currency": settings.Currency,
+			"old_method":   previous.Method,
+			"new_method":   settings.Method,
+		},
+		c.ClientIP(),
+		c.Request.UserAgent(),
+		"SUCCESS",
+	)
+
+	c.JSON(http.StatusOK, settings)
+}
+
+// Summary values stock over a period: ?period=YYYY-MM, or ?from and ?to as
+// RFC 3339 times or YYYY-MM-DD dates (to is exclusive). It defaults to the
+// current month so far. Managers and Auditors may scope it with
+// ?warehouse_id; Supervisors always get their own warehouse.
+func (h *ValuationHandler) Summary(c *gin.Context) {
+	from, to, ok := valuationPeriod(c)
+	if !ok {
+		return
+	}
+
+	companyObjectID, _ := primitive.ObjectIDFromHex(c.GetString("company_id"))
+	var warehouseObjectID *primitive.ObjectID
+	warehouseID := c.Query("warehouse_id")
+	if role := c.GetString("role"); role == "Supervisor" || role == "Staff" {
+		warehouseID = c.GetString("warehouse_id")
+	}
+	if warehouseID != "" {
+		oid, err := primitive.ObjectIDFromHex(warehouseID)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
+			return
+		}
+		warehouseObjectID = &oid
+	}
+
+	summary, err := h.valuationService.Summarize(c.Request.Context(), companyObjectID, warehouseObjectID, from, to)
+	if err != nil {
+		if err == repository.ErrNotFound {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to value stock"})
+		return
+	}
+	c.JSON(http.StatusOK, summary)
+}
+
+// valuationPeriod reads the period of a summary, writing a 400 when it is invalid
+func valuationPeriod(c *gin.Context) (time.Time, time.Time, bool) {
+	now := time.Now().UTC()
+	if period := c.Query("period"); period != "" {
+		month, err := time.Parse("2006-01", period)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Period must be YYYY-MM"})
+			return time.Time{}, time.Time{}, false
+		}
+		return month, month.AddDate(0, 1, 0), true
+	}
+
+	from := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	to := now
+	for _, bound := range []struct {
+		name  string
+		value *time.Time
+	}{{"from", &from}, {"to", &to}} {
+		raw := c.Query(bound.name)
+		if raw == "" {
+			continue
+		}
+		parsed, err := parseTimeParam(raw)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + bound.name + " date, use RFC 3339 or YYYY-MM-DD"})
+			return time.Time{}, time.Time{}, false
+		}
+		*bound.value = parsed
+	}
+	if !from.Before(to) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "from must be before to"})
+		return time.Time{}, time.Time{}, false
+	}
+	return from, to, true
+}
+
+// parseTimeParam reads an RFC 3339 time or a YYYY-MM-DD date, taken as
+// midnight UTC
+func parseTimeParam(raw string) (time.Time, error) {
+	if parsed, err := time.Parse(time.RFC3339, raw); err == nil {
+		return parsed, nil
+	}
+	return time.Parse("2006-01-02", raw)
+}
@@ -6,20 +6,20 @@ import (
 	"time"
 
 	"github.com/a2sv/safeware/internal/audit"
-	"github.com/a2sv/safeware/internal/database"
 	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
 	"github.com/gin-gonic/gin"
-	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
-	"go.mongodb.org/mongo-driver/mongo"
 )
 
 type WarehouseHandler struct {
+	warehouses   repository.WarehouseRepository
 	auditService *audit.AuditService
 }
 
-func NewWarehouseHandler(auditService *audit.AuditService) *WarehouseHandler {
+func NewWarehouseHandler(warehouses repository.WarehouseRepository, auditService *audit.AuditService) *WarehouseHandler {
 	return &WarehouseHandler{
+		warehouses:   warehouses,
 		auditService: auditService,
 	}
 }
@@ -45,22 +45,12 @@ func (h *WarehouseHandler) List(c *gin.Context) {
 		return
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("warehouses")
-
 	objectID, _ := primitive.ObjectIDFromHex(companyID)
-	cursor, err := collection.Find(ctx, bson.M{"company_id": objectID, "is_active": true})
+	warehouses, err := h.warehouses.ListActive(c.Request.Context(), objectID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch warehouses"})
 		return
 	}
-	defer cursor.Close(ctx)
-
-	var warehouses []models.Warehouse
-	if err = cursor.All(ctx, &warehouses); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to decode warehouses"})
-		return
-	}
 
 	c.JSON(http.StatusOK, gin.H{"warehouses": warehouses})
 }
@@ -72,9 +62,6 @@ func (h *WarehouseHandler) Get(c *gin.Context) {
 	username := c.GetString("username")
 	warehouseID := c.Param("id")
 
-	ctx := context.Background()
-	collection := database.GetCollection("warehouses")
-
 	objectID, err := primitive.ObjectIDFromHex(warehouseID)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid warehouse ID"})
@@ -84,10 +71,9 @@ func (h *WarehouseHandler) Get(c *gin.Context) {
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	var warehouse models.Warehouse
-	err = collection.FindOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}).Decode(&warehouse)
+	warehouse, err := h.warehouses.Get(c.Request.Context(), companyObjectID, objectID)
 	if err != nil {
-		if err == mongo.ErrNoDocuments {
+		if err == repository.ErrNotFound {
 			c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
 			return
 		}
@@ -112,6 +98,7 @@ func (h *WarehouseHandler) Get(c *gin.Context) {
 		"SUCCESS",
 	)
 
+	setETag(c, warehouse.Version)
 	c.JSON(http.StatusOK, warehouse)
 }
 
@@ -146,11 +133,7 @@ func (h *WarehouseHandler) Create(c *gin.Context) {
 		UpdatedAt:   time.Now(),
 	}
 
-	ctx := context.Background()
-	collection := database.GetCollection("warehouses")
-
-	_, err := collection.InsertOne(ctx, warehouse)
-	if err != nil {
+	if err := h.warehouses.Create(c.Request.Context(), &warehouse); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create warehouse"})
 		return
 	}
@@ -173,6 +156,7 @@ func (h *WarehouseHandler) Create(c *gin.Context) {
 		"SUCCESS",
 	)
 
+	setETag(c, warehouse.Version)
 	c.JSON(http.StatusCreated, warehouse)
 }
 
@@ -195,37 +179,30 @@ func (h *WarehouseHandler) Update(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Warehouse")
+		return
+	}
+
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	// Build update document
-	update := bson.M{"$set": bson.M{"updated_at": time.Now()}}
+	// Build update
+	update := repository.WarehouseUpdate{IPWhitelist: req.IPWhitelist, IsActive: req.IsActive, IfVersion: version}
 	if req.Name != "" {
-		update["$set"].(bson.M)["name"] = req.Name
+		update.Name = &req.Name
 	}
 	if req.Location != "" {
-		update["$set"].(bson.M)["location"] = req.Location
+		update.Location = &req.Location
 	}
-	if req.IPWhitelist != nil {
-		update["$set"].(bson.M)["ip_whitelist"] = req.IPWhitelist
-	}
-	if req.IsActive != nil {
-		update["$set"].(bson.M)["is_active"] = *req.IsActive
-	}
-
-	ctx := context.Background()
-	collection := database.GetCollection("warehouses")
 
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}, update)
-	if err != nil || result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+	warehouse, err := h.warehouses.Update(c.Request.Context(), companyObjectID, objectID, update)
+	if err != nil {
+		warehouseWriteError(c, err)
 		return
 	}
 
-	// Fetch updated warehouse
-	var warehouse models.Warehouse
-	collection.FindOne(ctx, bson.M{"_id": objectID}).Decode(&warehouse)
-
 	// Log audit
 	go h.auditService.LogAction(
 		context.Background(),
@@ -237,12 +214,14 @@ func (h *WarehouseHandler) Update(c *gin.Context) {
 		&objectID,
 		map[string]interface{}{
 			"updates": req,
+			"version": warehouse.Version,
 		},
 		c.ClientIP(),
 		c.Request.UserAgent(),
 		"SUCCESS",
 	)
 
+	setETag(c, warehouse.Version)
 	c.JSON(http.StatusOK, warehouse)
 }
 
@@ -259,16 +238,17 @@ func (h *WarehouseHandler) Delete(c *gin.Context) {
 		return
 	}
 
+	version, ok := ifMatch(c)
+	if !ok {
+		preconditionFailed(c, "Warehouse")
+		return
+	}
+
 	companyObjectID, _ := primitive.ObjectIDFromHex(companyID)
 	userObjectID, _ := primitive.ObjectIDFromHex(userID)
 
-	ctx := context.Background()
-	collection := database.GetCollection("warehouses")
-
-	update := bson.M{"$set": bson.M{"is_active": false, "updated_at": time.Now()}}
-	result, err := collection.UpdateOne(ctx, bson.M{"_id": objectID, "company_id": companyObjectID}, update)
-	if err != nil || result.MatchedCount == 0 {
-		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+	if err := h.warehouses.Deactivate(c.Request.Context(), companyObjectID, objectID, version); err != nil {
+		warehouseWriteError(c, err)
 		return
 	}
 
@@ -289,3 +269,15 @@ func (h *WarehouseHandler) Delete(c *gin.Context) {
 
 	c.JSON(http.StatusOK, gin.H{"message": "Warehouse deleted successfully"})
 }
+
+// warehouseWriteError maps repository errors from warehouse writes to responses
+func warehouseWriteError(c *gin.Context, err error) {
+	switch err {
+	case repository.ErrNotFound:
+		c.JSON(http.StatusNotFound, gin.H{"error": "Warehouse not found"})
+	case repository.ErrVersionMismatch:
+		preconditionFailed(c, "Warehouse")
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Database error"})
+	}
+}
@@ -0,0 +1,106 @@
+// Package idempotency remembers the responses to requests sent with an
+// Idempotency-Key header, so clients can safely retry writes.
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultTTL is how long completed responses are kept when no TTL is configured
+const DefaultTTL = 24 * time.Hour
+
+// lockTimeout bounds how long an unfinished request holds its key, so a
+// request lost to a crash does not block retries until the TTL expires
+const lockTimeout = 5 * time.Minute
+
+var (
+	// ErrMismatch means the key was already used for a different request
+	ErrMismatch = errors.New("idempotency key reused with a different request")
+	// ErrInProgress means the first request with the key has not finished yet
+	ErrInProgress = errors.New("request with this idempotency key is in progress")
+)
+
+// Store claims keys and keeps completed responses in repo. Expired records
+// are ignored until the repository removes them.
+type Store struct {
+	repo repository.IdempotencyRepository
+	ttl  time.Duration
+}
+
+func NewStore(repo repository.IdempotencyRepository, ttl time.Duration) *Store {
+	if ttl <= 0 {
+		ttl = DefaultTTL
+	}
+	return &Store{repo: repo, ttl: ttl}
+}
+
+func recordID(userID primitive.ObjectID, key string) string {
+	return userID.Hex() + ":" + key
+}
+
+// Begin claims key for a request. It returns nil when the caller should
+// process the request, or the stored record of an identical completed
+// request to replay.
+func (s *Store) Begin(ctx context.Context, userID primitive.ObjectID, key, fingerprint string) (*models.IdempotencyRecord, error) {
+	now := time.Now()
+	record := models.IdempotencyRecord{
+		ID:          recordID(userID, key),
+		UserID:      userID,
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(lockTimeout),
+	}
+
+	// The record ID is unique, so only one of several concurrent requests can
+	// claim the key. A second attempt covers a record that expired meanwhile.
+	for attempt := 0; attempt < 2; attempt++ {
+		err := s.repo.Claim(ctx, &record)
+		if err == nil {
+			return nil, nil
+		}
+		if err != repository.ErrDuplicate {
+			return nil, err
+		}
+
+		existing, err := s.repo.Get(ctx, record.ID)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if existing.ExpiresAt.Before(now) {
+			// The TTL monitor only runs periodically
+			if err := s.repo.DeleteExpired(ctx, record.ID, existing.ExpiresAt); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		switch {
+		case existing.Fingerprint != fingerprint:
+			return nil, ErrMismatch
+		case !existing.Completed:
+			return nil, ErrInProgress
+		}
+		return existing, nil
+	}
+	return nil, ErrInProgress
+}
+
+// Complete stores the response to a claimed key for the configured TTL
+func (s *Store) Complete(ctx context.Context, userID primitive.ObjectID, key string, statusCode int, headers map[string]string, body []byte) error {
+	return s.repo.Complete(ctx, recordID(userID, key), statusCode, headers, body, time.Now().Add(s.ttl))
+}
+
+// Release frees a claimed key whose request failed, so it can be retried
+func (s *Store) Release(ctx context.Context, userID primitive.ObjectID, key string) error {
+	return s.repo.Release(ctx, recordID(userID, key))
+}
@@ -0,0 +1,269 @@
+// Package itemarchive browses archived items, restores them and purges them
+// for good once they have been archived for the retention period. Purging
+// writes off any stock the item still held, so the valuation ledger keeps
+// balancing after the item is gone.
+package itemarchive
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// DefaultPurgeAfter is how long an item stays archived before it can be purged
+const DefaultPurgeAfter = 90 * 24 * time.Hour
+
+var (
+	// ErrNotArchived is returned when purging an item that is not archived
+	ErrNotArchived = errors.New("item is not archived")
+	// ErrInKit is returned when purging an item that is a component of a kit
+	ErrInKit = errors.New("item is a component of a kit; remove it from the kit first")
+	// ErrOnHold is returned when purging an item with stock on quality hold
+	ErrOnHold = errors.New("item has open quality holds; release or scrap the held stock first")
+	// ErrConfirmation is returned when a purge does not name the item's SKU
+	ErrConfirmation = errors.New("purge must be confirmed with the item's SKU")
+)
+
+// RetentionError is returned when purging an item before its retention period ends
+type RetentionError struct {
+	PurgeableAt time.Time `json:"purgeable_at"`
+}
+
+func (e *RetentionError) Error() string {
+	return fmt.Sprintf("item cannot be purged before %s", e.PurgeableAt.UTC().Format(time.RFC3339))
+}
+
+// Filter narrows the archive browser. Archive dates are inclusive of From
+// and exclusive of To.
+type Filter struct {
+	Items        repository.ItemFilter
+	ArchivedFrom *time.Time
+	ArchivedTo   *time.Time
+	// Purgeable keeps only items past their retention period
+	Purgeable bool
+}
+
+// Archived is an archived item with its stock and when it can be purged
+type Archived struct {
+	repository.ItemStock
+	PurgeableAt time.Time `json:"purgeable_at"`
+}
+
+// Purged reports what purging an item removed
+type Purged struct {
+	Item         models.Item `json:"item"`
+	Locations    int         `json:"locations"`      // Item locations deleted
+	WrittenOff   int         `json:"written_off"`    // Base units of stock written off
+	WriteOffCost int64       `json:"write_off_cost"` // Cost of the stock written off, in minor units
+	Prices       int         `json:"prices"`         // Price history entries deleted
+	KitRemoved   bool        `json:"kit_removed"`    // Whether the item's own bill of materials was deleted
+}
+
+// Service restores and purges archived items
+type Service struct {
+	tx         repository.Transactor
+	items      repository.ItemRepository
+	prices     repository.PriceRepository
+	kits       repository.KitRepository
+	holds      repository.QualityHoldRepository
+	valuation  *valuation.Service
+	purgeAfter time.Duration
+}
+
+// NewService returns a Service; purgeAfter of zero uses DefaultPurgeAfter
+func NewService(tx repository.Transactor, items repository.ItemRepository, prices repository.PriceRepository, kits repository.KitRepository, holds repository.QualityHoldRepository, valuationService *valuation.Service, purgeAfter time.Duration) *Service {
+	if purgeAfter <= 0 {
+		purgeAfter = DefaultPurgeAfter
+	}
+	return &Service{tx: tx, items: items, prices: prices, kits: kits, holds: holds, valuation: valuationService, purgeAfter: purgeAfter}
+}
+
+// PurgeAfter returns the retention period of archived items
+func (s *Service) PurgeAfter() time.Duration {
+	return s.purgeAfter
+}
+
+// List returns the company's archived items matching filter, most recently
+// archived first
+func (s *Service) List(ctx context.Context, companyID primitive.ObjectID, filter Filter) ([]Archived, error) {
+	stock, err := s.items.ListArchived(ctx, companyID, filter.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	archived := []Archived{}
+	for _, entry := range stock {
+		at := archivedAt(&entry.Item)
+		if filter.ArchivedFrom != nil && at.Before(*filter.ArchivedFrom) {
+			continue
+		}
+		if filter.ArchivedTo != nil && !at.Before(*filter.ArchivedTo) {
+			continue
+		}
+		purgeableAt := at.Add(s.purgeAfter)
+		if filter.Purgeable && purgeableAt.After(now) {
+			continue
+		}
+		archived = append(archived, Archived{ItemStock: entry, PurgeableAt: purgeableAt})
+	}
+	sort.SliceStable(archived, func(i, j int) bool {
+		return archivedAt(&archived[i].Item).After(archivedAt(&archived[j].Item))
+	})
+	return archived, nil
+}
+
+// Restore unarchives an item together with its locations, which archiving
+// left untouched. A warehouse limits it to items stocked there.
+func (s *Service) Restore(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID, ifVersion *int64) (*models.Item, []models.ItemLocation, error) {
+	if warehouseID != nil {
+		stocked, err := s.stockedIn(ctx, id, *warehouseID)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !stocked {
+			return nil, nil, repository.ErrNotFound
+		}
+	}
+
+	item, err := s.items.Restore(ctx, companyID, id, ifVersion)
+	if err != nil {
+		return nil, nil, err
+	}
+	locations, err := s.items.Locations(ctx, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	return item, locations, nil
+}
+
+// Purge deletes an archived item, its locations, its price history and its
+// own bill of materials once its retention period is over. Stock it still
+// held is written off in the valuation ledger first; past cost movements are
+// kept. Since a purge cannot be undone, the caller confirms it with the
+// item's SKU and the version it was shown, so a mistyped ID or an item
+// changed since fails instead.
+func (s *Service) Purge(ctx context.Context, companyID, id primitive.ObjectID, confirmSKU string, version int64, purgedBy primitive.ObjectID) (*Purged, error) {
+	var purged *Purged
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		item, err := s.items.Get(ctx, companyID, id)
+		if err != nil {
+			return err
+		}
+		if !item.IsArchived {
+			return ErrNotArchived
+		}
+		if confirmSKU != item.SKU {
+			return ErrConfirmation
+		}
+		if item.Version != version {
+			return repository.ErrVersionMismatch
+		}
+		if purgeableAt := archivedAt(item).Add(s.purgeAfter); purgeableAt.After(time.Now()) {
+			return &RetentionError{PurgeableAt: purgeableAt}
+		}
+		// Held stock is decided on by quality control, not written off here
+		holds, err := s.holds.List(ctx, companyID, repository.QualityHoldFilter{ItemID: &id, Status: models.HoldOpen})
+		if err != nil {
+			return err
+		}
+		if len(holds) > 0 {
+			return ErrOnHold
+		}
+
+		boms, err := s.kits.List(ctx, companyID)
+		if err != nil {
+			return err
+		}
+		purged = &Purged{Item: *item}
+		for _, bom := range boms {
+			for _, component := range bom.Components {
+				if component.ItemID == id {
+					return ErrInKit
+				}
+			}
+			if bom.KitItemID == id {
+				purged.KitRemoved = true
+			}
+		}
+		if purged.KitRemoved {
+			if err := s.kits.Delete(ctx, companyID, id); err != nil {
+				return err
+			}
+		}
+
+		locations, err := s.items.Locations(ctx, id)
+		if err != nil {
+			return err
+		}
+		purged.Locations = len(locations)
+		held := map[primitive.ObjectID]int{}
+		for _, location := range locations {
+			held[location.WarehouseID] += location.Quantity
+		}
+		for warehouseID, quantity := range held {
+			if quantity <= 0 {
+				continue
+			}
+			movement, err := s.valuation.Record(ctx, valuation.Change{
+				Item:        item,
+				WarehouseID: warehouseID,
+				Delta:       -quantity,
+				Source:      valuation.SourcePurge,
+				CreatedBy:   purgedBy,
+			})
+			if err != nil {
+				return err
+			}
+			purged.WrittenOff += quantity
+			purged.WriteOffCost += movement.TotalCost
+		}
+
+		prices, err := s.prices.List(ctx, companyID, id)
+		if err != nil {
+			return err
+		}
+		for _, price := range prices {
+			if err := s.prices.Delete(ctx, price.ID); err != nil {
+				return err
+			}
+		}
+		purged.Prices = len(prices)
+
+		return s.items.Purge(ctx, companyID, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return purged, nil
+}
+
+// stockedIn reports whether an item has a location in a warehouse
+func (s *Service) stockedIn(ctx context.Context, itemID, warehouseID primitive.ObjectID) (bool, error) {
+	locations, err := s.items.Locations(ctx, itemID)
+	if err != nil {
+		return false, err
+	}
+	for _, location := range locations {
+		if location.WarehouseID == warehouseID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// archivedAt is when an item was archived. Items archived before archives
+// were dated count from their last update.
+func archivedAt(item *models.Item) time.Time {
+	if item.ArchivedAt != nil {
+		return *item.ArchivedAt
+	}
+	return item.UpdatedAt
+}
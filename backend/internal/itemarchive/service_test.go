@@ -0,0 +1,201 @@
+package itemarchive
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// archiveEnv is a company with one warehouse
+type archiveEnv struct {
+	repos     *repository.Repositories
+	service   *Service
+	valuation *valuation.Service
+	company   *models.Company
+	warehouse *models.Warehouse
+	start     time.Time
+}
+
+func newArchiveEnv(t *testing.T) *archiveEnv {
+	t.Helper()
+	ctx := context.Background()
+	env := &archiveEnv{repos: repository.NewMemoryRepositories(), start: time.Now()}
+	repos := env.repos
+	env.company = &models.Company{Name: "Acme", Currency: "USD"}
+	if err := repos.Companies.Create(ctx, env.company); err != nil {
+		t.Fatal(err)
+	}
+	env.warehouse = &models.Warehouse{CompanyID: env.company.ID, Name: "Main", IsActive: true}
+	if err := repos.Warehouses.Create(ctx, env.warehouse); err != nil {
+		t.Fatal(err)
+	}
+	env.valuation = valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	env.service = NewService(repos.Tx, repos.Items, repos.Prices, repos.Kits, repos.QualityHolds, env.valuation, 0)
+	return env
+}
+
+// archived creates an item archived archivedFor ago, holding 4 units
+// received at 25 each
+func (env *archiveEnv) archived(t *testing.T, sku string, archivedFor time.Duration) (*models.Item, *models.ItemLocation) {
+	t.Helper()
+	ctx := context.Background()
+	archivedAt := time.Now().Add(-archivedFor)
+	item := &models.Item{CompanyID: env.company.ID, SKU: sku, Name: sku, Quality: "New", Price: 30, Currency: "USD", Version: 3, IsArchived: true, ArchivedAt: &archivedAt}
+	location := &models.ItemLocation{WarehouseID: env.warehouse.ID, Quantity: 4}
+	if err := env.repos.Items.Create(ctx, item, location); err != nil {
+		t.Fatal(err)
+	}
+	unitCost := int64(25)
+	if _, err := env.valuation.Record(ctx, valuation.Change{Item: item, WarehouseID: env.warehouse.ID, Delta: 4, UnitCost: &unitCost, Source: valuation.SourceCreate}); err != nil {
+		t.Fatal(err)
+	}
+	return item, location
+}
+
+// closing sums the company's valuation since the test began
+func (env *archiveEnv) closing(t *testing.T) valuation.Valuation {
+	t.Helper()
+	summary, err := env.valuation.Summarize(context.Background(), env.company.ID, nil, env.start, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary.Totals
+}
+
+func TestPurgeGates(t *testing.T) {
+	tests := []struct {
+		name        string
+		archivedFor time.Duration // Past the retention period when zero
+		setup       func(t *testing.T, env *archiveEnv, item *models.Item, location *models.ItemLocation)
+		sku         string // The item's SKU when empty
+		version     int64
+		check       func(err error) bool
+	}{
+		{
+			name: "not archived",
+			setup: func(t *testing.T, env *archiveEnv, item *models.Item, location *models.ItemLocation) {
+				if _, err := env.repos.Items.Restore(context.Background(), env.company.ID, item.ID, nil); err != nil {
+					t.Fatal(err)
+				}
+			},
+			version: 4,
+			check:   func(err error) bool { return err == ErrNotArchived },
+		},
+		{
+			name:    "wrong SKU",
+			sku:     "BOX-2",
+			version: 3,
+			check:   func(err error) bool { return err == ErrConfirmation },
+		},
+		{
+			name:    "version mismatch",
+			version: 2,
+			check:   func(err error) bool { return err == repository.ErrVersionMismatch },
+		},
+		{
+			name:        "retention period not over",
+			archivedFor: 10 * 24 * time.Hour,
+			version:     3,
+			check: func(err error) bool {
+				var retentionErr *RetentionError
+				if !errors.As(err, &retentionErr) {
+					return false
+				}
+				want := time.Now().Add(DefaultPurgeAfter - 10*24*time.Hour)
+				return retentionErr.PurgeableAt.Sub(want).Abs() < time.Minute
+			},
+		},
+		{
+			name: "open quality hold",
+			setup: func(t *testing.T, env *archiveEnv, item *models.Item, location *models.ItemLocation) {
+				hold := &models.QualityHold{CompanyID: env.company.ID, ItemID: item.ID, WarehouseID: env.warehouse.ID, LocationID: location.ID, Quantity: 1, Remaining: 1, Status: models.HoldOpen, Reason: "Dented"}
+				if err := env.repos.QualityHolds.Create(context.Background(), hold); err != nil {
+					t.Fatal(err)
+				}
+			},
+			version: 3,
+			check:   func(err error) bool { return err == ErrOnHold },
+		},
+		{
+			name: "component of a kit",
+			setup: func(t *testing.T, env *archiveEnv, item *models.Item, location *models.ItemLocation) {
+				bom := &models.BOM{CompanyID: env.company.ID, KitItemID: primitive.NewObjectID(), Components: []models.BOMComponent{{ItemID: item.ID, Quantity: 2}}}
+				if err := env.repos.Kits.Save(context.Background(), bom); err != nil {
+					t.Fatal(err)
+				}
+			},
+			version: 3,
+			check:   func(err error) bool { return err == ErrInKit },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newArchiveEnv(t)
+			archivedFor := tt.archivedFor
+			if archivedFor == 0 {
+				archivedFor = DefaultPurgeAfter + 24*time.Hour
+			}
+			item, location := env.archived(t, "BOX-1", archivedFor)
+			if tt.setup != nil {
+				tt.setup(t, env, item, location)
+			}
+			sku := tt.sku
+			if sku == "" {
+				sku = item.SKU
+			}
+
+			if _, err := env.service.Purge(ctx, env.company.ID, item.ID, sku, tt.version, primitive.NilObjectID); !tt.check(err) {
+				t.Fatalf("unexpected error %v", err)
+			}
+			// A refused purge leaves the item and its stock in place
+			if _, err := env.repos.Items.Get(ctx, env.company.ID, item.ID); err != nil {
+				t.Fatalf("item after a refused purge: %v", err)
+			}
+			if totals := env.closing(t); totals.ClosingQuantity != 4 || totals.ClosingValue != 100 {
+				t.Fatalf("valuation after a refused purge: %d at %d", totals.ClosingQuantity, totals.ClosingValue)
+			}
+		})
+	}
+}
+
+func TestPurgeWritesOffStock(t *testing.T) {
+	ctx := context.Background()
+	env := newArchiveEnv(t)
+	item, _ := env.archived(t, "KIT-1", DefaultPurgeAfter+time.Hour)
+	// The item is a kit itself; its own bill of materials goes with it
+	bom := &models.BOM{CompanyID: env.company.ID, KitItemID: item.ID, Components: []models.BOMComponent{{ItemID: primitive.NewObjectID(), Quantity: 1}}}
+	if err := env.repos.Kits.Save(ctx, bom); err != nil {
+		t.Fatal(err)
+	}
+	if err := env.repos.Prices.Add(ctx, &models.ItemPrice{CompanyID: env.company.ID, ItemID: item.ID, Price: 30, Currency: "USD", EffectiveFrom: env.start, Applied: true}); err != nil {
+		t.Fatal(err)
+	}
+
+	purged, err := env.service.Purge(ctx, env.company.ID, item.ID, "KIT-1", 3, primitive.NilObjectID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if purged.Locations != 1 || purged.WrittenOff != 4 || purged.WriteOffCost != 100 || purged.Prices != 1 || !purged.KitRemoved {
+		t.Fatalf("purged = %+v", purged)
+	}
+
+	if _, err := env.repos.Items.Get(ctx, env.company.ID, item.ID); err != repository.ErrNotFound {
+		t.Fatalf("item after purge: %v", err)
+	}
+	if _, err := env.repos.Kits.Get(ctx, env.company.ID, item.ID); err != repository.ErrNotFound {
+		t.Fatalf("bill of materials after purge: %v", err)
+	}
+	// The write-off is an issue, so the ledger still balances
+	totals := env.closing(t)
+	if totals.CostOfGoodsIssued != 100 || totals.ClosingQuantity != 0 || totals.ClosingValue != 0 {
+		t.Fatalf("valuation after purge: issued %d, closing %d at %d", totals.CostOfGoodsIssued, totals.ClosingQuantity, totals.ClosingValue)
+	}
+}
@@ -0,0 +1,364 @@
+// Package itemimport creates and updates items in bulk from CSV or XLSX
+// files. Files are validated in full before anything is written; the writes
+// then run as a background job whose progress is kept in the jobs repository.
+package itemimport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Job statuses
+const (
+	StatusRunning   = models.ImportStatusRunning
+	StatusCompleted = models.ImportStatusCompleted
+	StatusFailed    = models.ImportStatusFailed
+)
+
+const (
+	// maxReportedErrors caps the row errors returned in a report or kept on a job
+	maxReportedErrors = 1000
+	// progressInterval is how many rows are written between progress updates
+	progressInterval = 100
+)
+
+// ErrNotFound is returned for a job that does not exist in the company
+var ErrNotFound = errors.New("import job not found")
+
+// fieldError is a row problem with one of its fields
+type fieldError struct {
+	field   string
+	message string
+}
+
+func (e *fieldError) Error() string {
+	return e.field + " " + e.message
+}
+
+// Request describes an uploaded file and who is importing it
+type Request struct {
+	CompanyID primitive.ObjectID
+	UserID    primitive.ObjectID
+	Username  string
+	IP        string
+	UserAgent string
+	FileName  string
+	Format    string
+	Mapping   Mapping
+	// WarehouseID is used for rows without a warehouse_id
+	WarehouseID *primitive.ObjectID
+	// Restricted limits every row to WarehouseID and to creating items or
+	// setting the stock of existing ones, as for Supervisors
+	Restricted bool
+}
+
+// Report is the outcome of validating a file
+type Report struct {
+	DryRun     bool                    `json:"dry_run"`
+	TotalRows  int                     `json:"total_rows"`
+	ValidRows  int                     `json:"valid_rows"`
+	ErrorCount int                     `json:"error_count"`
+	Errors     []models.ImportRowError `json:"errors"`
+}
+
+// Valid reports whether every row can be imported
+func (r *Report) Valid() bool {
+	return r.ErrorCount == 0
+}
+
+// Service validates import files and runs import jobs
+type Service struct {
+	tx           repository.Transactor
+	jobs         repository.ImportJobRepository
+	items        repository.ItemRepository
+	warehouses   repository.WarehouseRepository
+	valuation    *valuation.Service
+	pricing      *pricing.Service
+	auditService *audit.AuditService
+}
+
+func NewService(tx repository.Transactor, jobs repository.ImportJobRepository, items repository.ItemRepository, warehouses repository.WarehouseRepository, valuationService *valuation.Service, pricingService *pricing.Service, auditService *audit.AuditService) *Service {
+	return &Service{tx: tx, jobs: jobs, items: items, warehouses: warehouses, valuation: valuationService, pricing: pricingService, auditService: auditService}
+}
+
+// Validate reads and checks the whole file. It returns an error when the
+// file itself cannot be used, and otherwise a report listing problems by row
+// along with the rows to import.
+func (s *Service) Validate(ctx context.Context, file io.Reader, req Request) ([]Row, *Report, error) {
+	t, err := readTable(file, req.Format)
+	if err != nil {
+		return nil, nil, err
+	}
+	columns, err := req.Mapping.columns(t.header)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	settings, err := s.valuation.Settings(ctx, req.CompanyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load company settings: %w", err)
+	}
+	active, err := s.warehouses.ListActive(ctx, req.CompanyID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("list warehouses: %w", err)
+	}
+	sc := scope{defaultWarehouse: req.WarehouseID, restricted: req.Restricted, active: map[primitive.ObjectID]bool{}, currency: settings.Currency}
+	for _, warehouse := range active {
+		sc.active[warehouse.ID] = true
+	}
+	if req.WarehouseID != nil && !sc.active[*req.WarehouseID] {
+		return nil, nil, errors.New("warehouse is not an active warehouse of your company")
+	}
+
+	rows, problems := validate(t, columns, sc)
+	if req.Restricted {
+		if rows, problems, err = s.restrictRows(ctx, req.CompanyID, rows, problems); err != nil {
+			return nil, nil, err
+		}
+	}
+	report := &Report{
+		TotalRows:  len(t.rows),
+		ValidRows:  len(rows),
+		ErrorCount: len(problems),
+		Errors:     capErrors(problems),
+	}
+	return rows, report, nil
+}
+
+// Start records a job for the validated rows and writes them in the background
+func (s *Service) Start(ctx context.Context, req Request, rows []Row) (*models.ImportJob, error) {
+	now := time.Now()
+	job := &models.ImportJob{
+		ID:        primitive.NewObjectID(),
+		CompanyID: req.CompanyID,
+		FileName:  req.FileName,
+		Status:    StatusRunning,
+		TotalRows: len(rows),
+		CreatedBy: req.UserID,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if req.WarehouseID != nil {
+		job.WarehouseID = *req.WarehouseID
+	}
+	if err := s.jobs.Create(ctx, job); err != nil {
+		return nil, err
+	}
+
+	snapshot := *job
+	go s.run(context.Background(), req, job, rows)
+	return &snapshot, nil
+}
+
+// run upserts each row, recording progress on the job as it goes
+func (s *Service) run(ctx context.Context, req Request, job *models.ImportJob, rows []Row) {
+	settings, err := s.valuation.Settings(ctx, req.CompanyID)
+	if err != nil {
+		settings = &valuation.Settings{Currency: models.DefaultCurrency}
+	}
+
+	for i, row := range rows {
+		now := time.Now()
+		item := &models.Item{
+			ID:          primitive.NewObjectID(),
+			CompanyID:   req.CompanyID,
+			SKU:         row.SKU,
+			Name:        row.Name,
+			Quality:     row.Quality,
+			Currency:    settings.Currency,
+			OwnerUserID: req.UserID,
+			Department:  row.Department,
+			CreatedAt:   now,
+			UpdatedAt:   now,
+		}
+		if row.Price != nil {
+			item.Price = *row.Price
+		}
+		location := &models.ItemLocation{
+			WarehouseID: row.WarehouseID,
+			Batch:       row.Batch,
+			UpdatedBy:   req.UserID,
+		}
+
+		// Stock the row adds or removes is valued like any other adjustment,
+		// and a changed price is kept in the item's price history and
+		// revalues the stock already held
+		var result repository.UpsertResult
+		err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			existing, err := s.items.GetBySKU(ctx, item.CompanyID, item.SKU)
+			switch {
+			case err == repository.ErrNotFound:
+				existing = item
+			case err != nil:
+				return err
+			case req.Restricted:
+				if problem := restrictedChange(existing, row); problem != nil {
+					return problem
+				}
+				fallthrough
+			default:
+				// Blank optional cells leave the existing item's values
+				if row.Price == nil {
+					item.Price = existing.Price
+				}
+				if row.Department == "" {
+					item.Department = existing.Department
+				}
+			}
+			// The quantity is in the base unit of the item the row updates
+			if location.Quantity, err = uom.ToBase(existing, row.Quantity, row.Unit); err != nil {
+				return err
+			}
+			previousPrice := existing.Price
+			if result, err = s.items.UpsertBySKU(ctx, item, location); err != nil {
+				return err
+			}
+			if err := s.pricing.Record(ctx, item, "Imported from "+req.FileName, req.UserID); err != nil {
+				return err
+			}
+			if item.Price != previousPrice {
+				if err := s.valuation.Revalue(ctx, item, valuation.SourceImport, req.UserID); err != nil {
+					return err
+				}
+			}
+			_, err = s.valuation.Record(ctx, valuation.Change{
+				Item:        item,
+				WarehouseID: row.WarehouseID,
+				Delta:       result.Delta,
+				Source:      valuation.SourceImport,
+				CreatedBy:   req.UserID,
+			})
+			return err
+		})
+		switch {
+		case err != nil:
+			job.Failed++
+			problem := models.ImportRowError{Row: row.Line, Message: err.Error()}
+			var fieldErr *fieldError
+			switch {
+			case err == repository.ErrInsufficientStock:
+				problem.Message = "quantity is less than the stock on quality hold at this location"
+			case errors.As(err, &fieldErr):
+				problem.Field, problem.Message = fieldErr.field, fieldErr.message
+			}
+			if len(job.Errors) < maxReportedErrors {
+				job.Errors = append(job.Errors, problem)
+			}
+		case result.Created:
+			job.Created++
+		default:
+			job.Updated++
+		}
+		job.ProcessedRows = i + 1
+
+		if job.ProcessedRows%progressInterval == 0 && job.ProcessedRows < len(rows) {
+			job.UpdatedAt = time.Now()
+			if err := s.jobs.Save(ctx, job); err != nil {
+				log.Printf("Failed to record import progress: %v", err)
+			}
+		}
+	}
+
+	now := time.Now()
+	job.Status = StatusCompleted
+	job.CompletedAt = &now
+	job.UpdatedAt = now
+	if err := s.jobs.Save(ctx, job); err != nil {
+		log.Printf("Failed to complete import job: %v", err)
+	}
+
+	status := "SUCCESS"
+	if job.Failed > 0 {
+		status = "FAILURE"
+	}
+	s.auditService.LogAction(ctx, req.UserID, req.CompanyID, req.Username, "IMPORT", "ITEM", &job.ID, map[string]interface{}{
+		"file_name":  job.FileName,
+		"total_rows": job.TotalRows,
+		"created":    job.Created,
+		"updated":    job.Updated,
+		"failed":     job.Failed,
+	}, req.IP, req.UserAgent, status)
+}
+
+// restrictRows drops the rows that would change an existing item's
+// company-wide fields, adding a problem for each
+func (s *Service) restrictRows(ctx context.Context, companyID primitive.ObjectID, rows []Row, problems []models.ImportRowError) ([]Row, []models.ImportRowError, error) {
+	allowed := rows[:0]
+	for _, row := range rows {
+		existing, err := s.items.GetBySKU(ctx, companyID, row.SKU)
+		if err == repository.ErrNotFound {
+			allowed = append(allowed, row)
+			continue
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if problem := restrictedChange(existing, row); problem != nil {
+			problems = append(problems, models.ImportRowError{Row: row.Line, Field: problem.field, Message: problem.message})
+			continue
+		}
+		allowed = append(allowed, row)
+	}
+	sort.SliceStable(problems, func(i, j int) bool {
+		return problems[i].Row < problems[j].Row
+	})
+	return allowed, problems, nil
+}
+
+// restrictedChange returns the first company-wide field a row would change
+// on an existing item. Only Managers may change those; other importers may
+// only set the item's stock.
+func restrictedChange(existing *models.Item, row Row) *fieldError {
+	const managerOnly = "differs from the existing item and can only be changed by a Manager"
+	switch {
+	case existing.IsArchived:
+		return &fieldError{FieldSKU, "is an archived item, which only a Manager can restore"}
+	case row.Name != existing.Name:
+		return &fieldError{FieldName, managerOnly}
+	case row.Quality != existing.Quality:
+		return &fieldError{FieldQuality, managerOnly}
+	case row.Price != nil && *row.Price != existing.Price:
+		return &fieldError{FieldPrice, managerOnly}
+	case row.Department != "" && row.Department != existing.Department:
+		return &fieldError{FieldDepartment, managerOnly}
+	}
+	return nil
+}
+
+// Get returns one of the company's import jobs
+func (s *Service) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ImportJob, error) {
+	job, err := s.jobs.Get(ctx, companyID, id)
+	if err == repository.ErrNotFound {
+		return nil, ErrNotFound
+	}
+	return job, err
+}
+
+// FailInterrupted marks jobs left running by a previous process as failed.
+// Call it at startup, before any import can begin.
+func (s *Service) FailInterrupted(ctx context.Context) error {
+	return s.jobs.FailRunning(ctx, "interrupted by a server restart; rows already processed were kept", time.Now())
+}
+
+func capErrors(problems []models.ImportRowError) []models.ImportRowError {
+	if problems == nil {
+		return []models.ImportRowError{}
+	}
+	if len(problems) > maxReportedErrors {
+		return problems[:maxReportedErrors]
+	}
+	return problems
+}
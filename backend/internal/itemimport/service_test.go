@@ -0,0 +1,191 @@
+package itemimport
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// importEnv is a company with one warehouse and the items BOX-1 to BOX-3,
+// each priced 2.50 with one unit in stock
+type importEnv struct {
+	repos     *repository.Repositories
+	service   *Service
+	company   *models.Company
+	warehouse *models.Warehouse
+	items     []*models.Item
+}
+
+func newImportEnv(t *testing.T) *importEnv {
+	t.Helper()
+	ctx := context.Background()
+	env := &importEnv{repos: repository.NewMemoryRepositories()}
+	repos := env.repos
+	env.company = &models.Company{Name: "Acme", Currency: "USD"}
+	if err := repos.Companies.Create(ctx, env.company); err != nil {
+		t.Fatal(err)
+	}
+	env.warehouse = &models.Warehouse{CompanyID: env.company.ID, Name: "Main", IsActive: true}
+	if err := repos.Warehouses.Create(ctx, env.warehouse); err != nil {
+		t.Fatal(err)
+	}
+	for _, sku := range []string{"BOX-1", "BOX-2", "BOX-3"} {
+		item := &models.Item{CompanyID: env.company.ID, SKU: sku, Name: "Box", Quality: "New", Price: 250, Currency: "USD", Department: "Shipping"}
+		if err := repos.Items.Create(ctx, item, &models.ItemLocation{WarehouseID: env.warehouse.ID, Quantity: 1}); err != nil {
+			t.Fatal(err)
+		}
+		env.items = append(env.items, item)
+	}
+
+	auditService := audit.NewAuditService("test-key", repos.Audit)
+	t.Cleanup(func() { auditService.Close() })
+	valuationService := valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	env.service = NewService(repos.Tx, repos.ImportJobs, repos.Items, repos.Warehouses, valuationService,
+		pricing.NewService(repos.Tx, repos.Items, repos.Prices, valuationService, auditService), auditService)
+	return env
+}
+
+// wait polls a job until it is no longer running
+func (env *importEnv) wait(t *testing.T, job *models.ImportJob) *models.ImportJob {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status == StatusRunning {
+		if time.Now().After(deadline) {
+			t.Fatal("import did not finish")
+		}
+		time.Sleep(10 * time.Millisecond)
+		var err error
+		if job, err = env.service.Get(context.Background(), env.company.ID, job.ID); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return job
+}
+
+func TestRestrictedImportOnlySetsStockOfExistingItems(t *testing.T) {
+	ctx := context.Background()
+	env := newImportEnv(t)
+	repos, service, company, warehouse, existing := env.repos, env.service, env.company, env.warehouse, env.items[0]
+
+	file := strings.Join([]string{
+		"sku,name,quality,price,department,quantity",
+		"BOX-1,Box,New,2.50,,5",
+		"box-2,Crate,New,2.50,Shipping,5",
+		"BOX-3,Box,New,3.00,Shipping,5",
+		"BOX-4,Other box,New,1,,2",
+	}, "\n")
+	req := Request{CompanyID: company.ID, UserID: primitive.NewObjectID(), Format: FormatCSV, WarehouseID: &warehouse.ID, Restricted: true}
+	rows, report, err := service.Validate(ctx, strings.NewReader(file), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.ValidRows != 2 || report.ErrorCount != 2 {
+		t.Fatalf("unexpected report: %+v", report)
+	}
+	if report.Errors[0].Row != 3 || report.Errors[0].Field != FieldName || report.Errors[1].Row != 4 || report.Errors[1].Field != FieldPrice {
+		t.Errorf("unexpected errors: %+v", report.Errors)
+	}
+
+	// The rows are checked again when written, as the item may change meanwhile
+	changed := rows[0]
+	changed.Department = "Packaging"
+	job, err := service.Start(ctx, req, append(rows, changed))
+	if err != nil {
+		t.Fatal(err)
+	}
+	job = env.wait(t, job)
+	if job.Created != 1 || job.Updated != 1 || job.Failed != 1 || job.Errors[0].Field != FieldDepartment {
+		t.Errorf("unexpected job: %+v", job)
+	}
+
+	item, err := repos.Items.Get(ctx, company.ID, existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item.Name != "Box" || item.Price != 250 || item.Department != "Shipping" {
+		t.Errorf("company-wide fields changed: %+v", item)
+	}
+	locations, err := repos.Items.Locations(ctx, existing.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locations) != 1 || locations[0].Quantity != 5 {
+		t.Errorf("expected the stock to be set to 5, got %+v", locations)
+	}
+}
+
+func TestBlankOptionalCellsKeepExistingValues(t *testing.T) {
+	ctx := context.Background()
+	file := strings.Join([]string{
+		"sku,name,quality,price,department,quantity",
+		"BOX-1,Box,New,,,4",
+		"BOX-2,Box,New,,Receiving,4",
+		"BOX-9,New box,New,,,4",
+	}, "\n")
+
+	for _, restricted := range []bool{false, true} {
+		env := newImportEnv(t)
+		req := Request{CompanyID: env.company.ID, UserID: primitive.NewObjectID(), Format: FormatCSV, WarehouseID: &env.warehouse.ID, Restricted: restricted}
+		rows, report, err := env.service.Validate(ctx, strings.NewReader(file), req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Only a Manager may move BOX-2 to another department
+		wantValid := 3
+		if restricted {
+			wantValid = 2
+		}
+		if report.ValidRows != wantValid {
+			t.Fatalf("restricted=%v: unexpected report: %+v", restricted, report)
+		}
+		job, err := env.service.Start(ctx, req, rows)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job = env.wait(t, job); job.Failed != 0 {
+			t.Fatalf("restricted=%v: unexpected job: %+v", restricted, job)
+		}
+
+		item, err := env.repos.Items.Get(ctx, env.company.ID, env.items[0].ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if item.Price != 250 || item.Department != "Shipping" {
+			t.Errorf("restricted=%v: blank cells changed the item: %+v", restricted, item)
+		}
+		prices, err := env.repos.Prices.List(ctx, env.company.ID, item.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, price := range prices {
+			if price.Price != 250 {
+				t.Errorf("restricted=%v: price history recorded %d", restricted, price.Price)
+			}
+		}
+
+		if !restricted {
+			moved, err := env.repos.Items.Get(ctx, env.company.ID, env.items[1].ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if moved.Price != 250 || moved.Department != "Receiving" {
+				t.Errorf("unexpected update: %+v", moved)
+			}
+		}
+		created, err := env.repos.Items.GetBySKU(ctx, env.company.ID, "BOX-9")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.Price != 0 || created.Department != "" {
+			t.Errorf("restricted=%v: unexpected new item: %+v", restricted, created)
+		}
+	}
+}
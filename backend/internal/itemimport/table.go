@@ -0,0 +1,111 @@
+package itemimport
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Supported file formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+)
+
+// MaxRows bounds the data rows of one import file
+const MaxRows = 50000
+
+var errEmptyFile = errors.New("file has no header row")
+
+// DetectFormat returns the format named explicitly, or else the one implied
+// by the file extension
+func DetectFormat(format, fileName string) (string, error) {
+	if format == "" {
+		format = strings.TrimPrefix(strings.ToLower(filepath.Ext(fileName)), ".")
+	}
+	switch strings.ToLower(format) {
+	case FormatCSV:
+		return FormatCSV, nil
+	case FormatXLSX:
+		return FormatXLSX, nil
+	}
+	return "", fmt.Errorf("unsupported format %q, expected csv or xlsx", format)
+}
+
+// table is the header and data rows of an import file. Rows keep their line
+// in the file so errors can point at it.
+type table struct {
+	header []string
+	rows   []tableRow
+}
+
+type tableRow struct {
+	line   int
+	values []string
+}
+
+// readTable reads a CSV file or the first sheet of an XLSX workbook.
+// Blank rows are skipped.
+func readTable(r io.Reader, format string) (*table, error) {
+	var records [][]string
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		reader.TrimLeadingSpace = true
+		var err error
+		if records, err = reader.ReadAll(); err != nil {
+			return nil, fmt.Errorf("invalid CSV: %w", err)
+		}
+	case FormatXLSX:
+		workbook, err := excelize.OpenReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("invalid XLSX: %w", err)
+		}
+		defer workbook.Close()
+		sheets := workbook.GetSheetList()
+		if len(sheets) == 0 {
+			return nil, errEmptyFile
+		}
+		if records, err = workbook.GetRows(sheets[0]); err != nil {
+			return nil, fmt.Errorf("invalid XLSX: %w", err)
+		}
+	default:
+		return nil, fmt.Errorf("unsupported format %q", format)
+	}
+
+	t := &table{}
+	for i, record := range records {
+		if isBlank(record) {
+			continue
+		}
+		if t.header == nil {
+			// Spreadsheet tools often prefix CSV exports with a byte order mark
+			record[0] = strings.TrimPrefix(record[0], "\ufeff")
+			t.header = record
+			continue
+		}
+		if len(t.rows) == MaxRows {
+			return nil, fmt.Errorf("file has more than %d rows", MaxRows)
+		}
+		t.rows = append(t.rows, tableRow{line: i + 1, values: record})
+	}
+	if t.header == nil {
+		return nil, errEmptyFile
+	}
+	return t, nil
+}
+
+func isBlank(record []string) bool {
+	for _, value := range record {
+		if strings.TrimSpace(value) != "" {
+			return false
+		}
+	}
+	return true
+}
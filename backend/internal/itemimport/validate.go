@@ -0,0 +1,196 @@
+package itemimport
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Importable fields
+const (
+	FieldSKU         = "sku"
+	FieldName        = "name"
+	FieldQuality     = "quality"
+	FieldPrice       = "price"
+	FieldQuantity    = "quantity"
+	FieldUnit        = "unit"
+	FieldDepartment  = "department"
+	FieldBatch       = "batch"
+	FieldWarehouseID = "warehouse_id"
+)
+
+var fields = []string{FieldSKU, FieldName, FieldQuality, FieldPrice, FieldQuantity, FieldUnit, FieldDepartment, FieldBatch, FieldWarehouseID}
+
+var requiredFields = []string{FieldSKU, FieldName, FieldQuality, FieldQuantity}
+
+// Mapping names the file column to read each field from. Fields left out
+// are read from the column named like the field, if there is one.
+// Headers are matched case-insensitively.
+type Mapping map[string]string
+
+// columns resolves the mapping against the file header to column indexes
+func (m Mapping) columns(header []string) (map[string]int, error) {
+	index := map[string]int{}
+	for i, name := range header {
+		key := strings.ToLower(strings.TrimSpace(name))
+		if _, seen := index[key]; !seen {
+			index[key] = i
+		}
+	}
+
+	columns := map[string]int{}
+	for field, column := range m {
+		if !isField(field) {
+			return nil, fmt.Errorf("unknown field %q in mapping", field)
+		}
+		i, ok := index[strings.ToLower(strings.TrimSpace(column))]
+		if !ok {
+			return nil, fmt.Errorf("column %q mapped to %s is not in the file", column, field)
+		}
+		columns[field] = i
+	}
+	for _, field := range fields {
+		if _, mapped := columns[field]; mapped {
+			continue
+		}
+		if i, ok := index[field]; ok {
+			columns[field] = i
+		}
+	}
+	for _, field := range requiredFields {
+		if _, ok := columns[field]; !ok {
+			return nil, fmt.Errorf("no column for required field %s", field)
+		}
+	}
+	return columns, nil
+}
+
+func isField(name string) bool {
+	for _, field := range fields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// Row is a validated item row
+type Row struct {
+	Line        int
+	SKU         string
+	Name        string
+	Quality     string
+	Price       *int64 // Minor units of the company currency; nil keeps the existing item's
+	Quantity    float64
+	Unit        string // Unit of Quantity; the item's base unit when empty
+	Department  string // Empty keeps the existing item's
+	Batch       string
+	WarehouseID primitive.ObjectID
+}
+
+// scope lists the warehouses rows may target
+type scope struct {
+	// defaultWarehouse is used for rows without a warehouse_id
+	defaultWarehouse *primitive.ObjectID
+	// restricted callers may only import into the default warehouse
+	restricted bool
+	// active are the company's active warehouses
+	active map[primitive.ObjectID]bool
+	// currency of prices, given in major units in the file
+	currency string
+}
+
+// validate checks every row, returning the valid ones and an error per
+// invalid field
+func validate(t *table, columns map[string]int, s scope) ([]Row, []models.ImportRowError) {
+	var rows []Row
+	var problems []models.ImportRowError
+	firstLine := map[string]int{}
+
+	for _, record := range t.rows {
+		value := func(field string) string {
+			i, ok := columns[field]
+			if !ok || i >= len(record.values) {
+				return ""
+			}
+			return strings.TrimSpace(record.values[i])
+		}
+		fail := func(field, format string, args ...interface{}) {
+			problems = append(problems, models.ImportRowError{Row: record.line, Field: field, Message: fmt.Sprintf(format, args...)})
+		}
+		before := len(problems)
+
+		row := Row{
+			Line:       record.line,
+			SKU:        value(FieldSKU),
+			Name:       value(FieldName),
+			Unit:       value(FieldUnit),
+			Department: value(FieldDepartment),
+			Batch:      value(FieldBatch),
+		}
+		for _, field := range requiredFields {
+			if value(field) == "" {
+				fail(field, "is required")
+			}
+		}
+
+		if row.SKU != "" {
+			key := strings.ToLower(row.SKU)
+			if line, dup := firstLine[key]; dup {
+				fail(FieldSKU, "duplicates the SKU on row %d", line)
+			} else {
+				firstLine[key] = record.line
+			}
+		}
+
+		if quality := value(FieldQuality); quality != "" {
+			if row.Quality = models.NormalizeQuality(quality); row.Quality == "" {
+				fail(FieldQuality, "must be one of %s", strings.Join(models.ItemQualities, ", "))
+			}
+		}
+
+		if price := value(FieldPrice); price != "" {
+			parsed, err := models.ParseMinor(price, s.currency)
+			if err != nil {
+				fail(FieldPrice, "must be a non-negative amount in %s with at most %d decimals", s.currency, models.CurrencyExponent(s.currency))
+			}
+			row.Price = &parsed
+		}
+
+		if quantity := value(FieldQuantity); quantity != "" {
+			parsed, err := strconv.ParseFloat(quantity, 64)
+			if err != nil || parsed < 0 || math.IsInf(parsed, 0) {
+				fail(FieldQuantity, "must be a non-negative number")
+			}
+			row.Quantity = parsed
+		}
+
+		switch warehouse := value(FieldWarehouseID); {
+		case warehouse == "" && s.defaultWarehouse == nil:
+			fail(FieldWarehouseID, "is required when no default warehouse is given")
+		case warehouse == "":
+			row.WarehouseID = *s.defaultWarehouse
+		default:
+			id, err := primitive.ObjectIDFromHex(warehouse)
+			switch {
+			case err != nil:
+				fail(FieldWarehouseID, "is not a valid ID")
+			case s.restricted && id != *s.defaultWarehouse:
+				fail(FieldWarehouseID, "is outside your assigned warehouse")
+			case !s.active[id]:
+				fail(FieldWarehouseID, "is not an active warehouse of your company")
+			default:
+				row.WarehouseID = id
+			}
+		}
+
+		if len(problems) == before {
+			rows = append(rows, row)
+		}
+	}
+	return rows, problems
+}
@@ -0,0 +1,484 @@
+// Package kit keeps the bills of materials of kit items and builds kits from
+// their components at a warehouse. Assembly takes the components out of
+// stock and adds the kits at the cost of what was taken; disassembly does
+// the reverse. Each build is valued like any other stock change, recorded as
+// a kit build, and runs in one transaction.
+package kit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxComponents caps the components of one kit
+const maxComponents = 100
+
+var (
+	// ErrNoComponents is returned for a bill of materials without components
+	ErrNoComponents = errors.New("a kit needs at least one component")
+	// ErrInvalidComponent is returned for components that are missing, archived, repeated or of the wrong quantity
+	ErrInvalidComponent = errors.New("invalid component")
+	// ErrCycle is returned when a kit would contain itself through its components
+	ErrCycle = errors.New("a kit cannot contain itself")
+	// ErrInvalidQuantity is returned for a build quantity that is not positive
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrArchived is returned when building an archived kit
+	ErrArchived = errors.New("kit item is archived")
+)
+
+// ShortageError is returned when a warehouse lacks the stock a build takes
+type ShortageError struct {
+	ItemID    primitive.ObjectID `json:"item_id"`
+	SKU       string             `json:"sku"`
+	Required  int                `json:"required"`
+	Available int                `json:"available"`
+}
+
+func (e *ShortageError) Error() string {
+	return fmt.Sprintf("not enough %s in stock: %d needed, %d available", e.SKU, e.Required, e.Available)
+}
+
+// Component is a component as given by a caller, in any unit of its item
+type Component struct {
+	ItemID   primitive.ObjectID
+	Quantity float64
+	Unit     string
+}
+
+// ComponentStock is a component's stock at a warehouse against what one kit takes
+type ComponentStock struct {
+	ItemID    primitive.ObjectID `json:"item_id"`
+	SKU       string             `json:"sku"`
+	Name      string             `json:"name"`
+	Unit      string             `json:"unit"`
+	PerKit    int                `json:"per_kit"`
+	Available int                `json:"available"`
+	Buildable int                `json:"buildable"`
+}
+
+// Availability is how many kits a warehouse's stock can build. Buildable
+// is limited by the scarcest component.
+type Availability struct {
+	KitItemID   primitive.ObjectID `json:"kit_item_id"`
+	WarehouseID primitive.ObjectID `json:"warehouse_id"`
+	Buildable   int                `json:"buildable"`
+	InStock     int                `json:"in_stock"` // Kits already assembled
+	Components  []ComponentStock   `json:"components"`
+}
+
+// Build assembles or disassembles Quantity kits at a warehouse. Batch names
+// the batch the kits or components are added to.
+type Build struct {
+	CompanyID   primitive.ObjectID
+	KitItemID   primitive.ObjectID
+	WarehouseID primitive.ObjectID
+	Quantity    int
+	Batch       string
+	CreatedBy   primitive.ObjectID
+}
+
+// Service manages bills of materials and builds kits
+type Service struct {
+	tx         repository.Transactor
+	kits       repository.KitRepository
+	items      repository.ItemRepository
+	warehouses repository.WarehouseRepository
+	valuation  *valuation.Service
+}
+
+func NewService(tx repository.Transactor, kits repository.KitRepository, items repository.ItemRepository, warehouses repository.WarehouseRepository, valuationService *valuation.Service) *Service {
+	return &Service{tx: tx, kits: kits, items: items, warehouses: warehouses, valuation: valuationService}
+}
+
+// Define sets the bill of materials of a kit item, replacing any it had.
+// Component quantities are converted to the base unit of their item.
+func (s *Service) Define(ctx context.Context, companyID, kitItemID primitive.ObjectID, components []Component, updatedBy primitive.ObjectID) (*models.BOM, error) {
+	if len(components) == 0 {
+		return nil, ErrNoComponents
+	}
+	if len(components) > maxComponents {
+		return nil, fmt.Errorf("%w: a kit has at most %d components", ErrInvalidComponent, maxComponents)
+	}
+	if _, err := s.activeItem(ctx, companyID, kitItemID); err != nil {
+		return nil, err
+	}
+
+	bom := &models.BOM{CompanyID: companyID, KitItemID: kitItemID, UpdatedBy: updatedBy}
+	seen := map[primitive.ObjectID]bool{}
+	for _, component := range components {
+		if component.ItemID == kitItemID {
+			return nil, ErrCycle
+		}
+		if seen[component.ItemID] {
+			return nil, fmt.Errorf("%w: item %s is listed twice", ErrInvalidComponent, component.ItemID.Hex())
+		}
+		seen[component.ItemID] = true
+
+		item, err := s.items.Get(ctx, companyID, component.ItemID)
+		if err == repository.ErrNotFound || (err == nil && item.IsArchived) {
+			return nil, fmt.Errorf("%w: item %s is not an active item of the company", ErrInvalidComponent, component.ItemID.Hex())
+		}
+		if err != nil {
+			return nil, err
+		}
+		quantity, err := uom.ToBase(item, component.Quantity, component.Unit)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s: %v", ErrInvalidComponent, item.SKU, err)
+		}
+		if quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity of %s must be greater than zero", ErrInvalidComponent, item.SKU)
+		}
+		bom.Components = append(bom.Components, models.BOMComponent{ItemID: item.ID, Quantity: quantity})
+	}
+
+	existing, err := s.kits.List(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if containsKit(existing, bom) {
+		return nil, ErrCycle
+	}
+
+	if err := s.kits.Save(ctx, bom); err != nil {
+		return nil, err
+	}
+	return bom, nil
+}
+
+// Get returns the bill of materials of a kit item
+func (s *Service) Get(ctx context.Context, companyID, kitItemID primitive.ObjectID) (*models.BOM, error) {
+	return s.kits.Get(ctx, companyID, kitItemID)
+}
+
+// List returns the company's bills of materials
+func (s *Service) List(ctx context.Context, companyID primitive.ObjectID) ([]models.BOM, error) {
+	return s.kits.List(ctx, companyID)
+}
+
+// Delete removes the bill of materials of a kit item. Kits already
+// assembled stay in stock as ordinary items.
+func (s *Service) Delete(ctx context.Context, companyID, kitItemID primitive.ObjectID) error {
+	return s.kits.Delete(ctx, companyID, kitItemID)
+}
+
+// Builds returns a kit item's assemblies and disassemblies, newest first
+func (s *Service) Builds(ctx context.Context, companyID, kitItemID primitive.ObjectID) ([]models.KitBuild, error) {
+	return s.kits.Builds(ctx, companyID, kitItemID)
+}
+
+// Availability works out how many kits a warehouse's stock can build
+func (s *Service) Availability(ctx context.Context, companyID, kitItemID, warehouseID primitive.ObjectID) (*Availability, error) {
+	if _, err := s.warehouses.Get(ctx, companyID, warehouseID); err != nil {
+		return nil, err
+	}
+	bom, err := s.kits.Get(ctx, companyID, kitItemID)
+	if err != nil {
+		return nil, err
+	}
+
+	kitStock, err := s.stock(ctx, kitItemID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	availability := &Availability{
+		KitItemID:   kitItemID,
+		WarehouseID: warehouseID,
+		InStock:     total(kitStock),
+		Components:  make([]ComponentStock, 0, len(bom.Components)),
+	}
+	for i, component := range bom.Components {
+		item, err := s.items.Get(ctx, companyID, component.ItemID)
+		if err != nil {
+			return nil, err
+		}
+		locations, err := s.stock(ctx, component.ItemID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		line := ComponentStock{
+			ItemID:    item.ID,
+			SKU:       item.SKU,
+			Name:      item.Name,
+			Unit:      uom.Base(item),
+			PerKit:    component.Quantity,
+			Available: total(locations),
+		}
+		line.Buildable = line.Available / component.Quantity
+		if i == 0 || line.Buildable < availability.Buildable {
+			availability.Buildable = line.Buildable
+		}
+		availability.Components = append(availability.Components, line)
+	}
+	return availability, nil
+}
+
+// Assemble takes the components of build.Quantity kits out of the
+// warehouse's stock and adds the kits, valued at the cost of the components
+func (s *Service) Assemble(ctx context.Context, build Build) (*models.KitBuild, error) {
+	return s.build(ctx, build, models.BuildAssemble)
+}
+
+// Disassemble takes build.Quantity kits out of the warehouse's stock and
+// puts their components back. The kits' cost is shared among the components
+// by their standard cost, or else their price.
+func (s *Service) Disassemble(ctx context.Context, build Build) (*models.KitBuild, error) {
+	return s.build(ctx, build, models.BuildDisassemble)
+}
+
+func (s *Service) build(ctx context.Context, build Build, kind string) (*models.KitBuild, error) {
+	if build.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+	settings, err := s.valuation.Settings(ctx, build.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var record *models.KitBuild
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := s.warehouses.Get(ctx, build.CompanyID, build.WarehouseID); err != nil {
+			return err
+		}
+		kit, err := s.items.Get(ctx, build.CompanyID, build.KitItemID)
+		if err != nil {
+			return err
+		}
+		if kit.IsArchived {
+			return ErrArchived
+		}
+		bom, err := s.kits.Get(ctx, build.CompanyID, build.KitItemID)
+		if err != nil {
+			return err
+		}
+		components := make([]*models.Item, len(bom.Components))
+		for i, component := range bom.Components {
+			if components[i], err = s.items.Get(ctx, build.CompanyID, component.ItemID); err != nil {
+				return err
+			}
+		}
+
+		record = &models.KitBuild{
+			CompanyID:   build.CompanyID,
+			KitItemID:   kit.ID,
+			WarehouseID: build.WarehouseID,
+			Type:        kind,
+			Quantity:    build.Quantity,
+			Currency:    settings.Currency,
+			CreatedBy:   build.CreatedBy,
+			CreatedAt:   time.Now(),
+		}
+		if kind == models.BuildAssemble {
+			err = s.assemble(ctx, build, record, kit, bom, components)
+		} else {
+			err = s.disassemble(ctx, build, record, kit, bom, components)
+		}
+		if err != nil {
+			return err
+		}
+		return s.kits.AddBuild(ctx, record)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return record, nil
+}
+
+func (s *Service) assemble(ctx context.Context, build Build, record *models.KitBuild, kit *models.Item, bom *models.BOM, components []*models.Item) error {
+	var cost int64
+	for i, component := range bom.Components {
+		taken, err := s.take(ctx, build, record, components[i], component.Quantity*build.Quantity, valuation.SourceAssemble)
+		if err != nil {
+			return err
+		}
+		cost += taken
+	}
+	unitCost := valuation.DivideRounded(cost, int64(build.Quantity))
+	return s.add(ctx, build, record, kit, build.Quantity, unitCost, valuation.SourceAssemble)
+}
+
+func (s *Service) disassemble(ctx context.Context, build Build, record *models.KitBuild, kit *models.Item, bom *models.BOM, components []*models.Item) error {
+	cost, err := s.take(ctx, build, record, kit, build.Quantity, valuation.SourceDisassemble)
+	if err != nil {
+		return err
+	}
+
+	// Share the kits' cost by each component's standard value, or evenly by
+	// quantity when the components have no cost
+	weights := make([]int64, len(bom.Components))
+	var totalWeight int64
+	for i, component := range bom.Components {
+		weights[i] = int64(component.Quantity) * valuation.FallbackCost(components[i])
+		totalWeight += weights[i]
+	}
+	if totalWeight == 0 {
+		for i, component := range bom.Components {
+			weights[i] = int64(component.Quantity)
+			totalWeight += weights[i]
+		}
+	}
+
+	for i, component := range bom.Components {
+		quantity := component.Quantity * build.Quantity
+		share := valuation.DivideRounded(cost*weights[i], totalWeight)
+		if err := s.add(ctx, build, record, components[i], quantity, valuation.DivideRounded(share, int64(quantity)), valuation.SourceDisassemble); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// take removes quantity of an item from the warehouse, unbinned stock first
+// and then bins in order, and returns the cost of what was issued
+func (s *Service) take(ctx context.Context, build Build, record *models.KitBuild, item *models.Item, quantity int, source string) (int64, error) {
+	locations, err := s.stock(ctx, item.ID, build.WarehouseID)
+	if err != nil {
+		return 0, err
+	}
+	if available := total(locations); available < quantity {
+		return 0, &ShortageError{ItemID: item.ID, SKU: item.SKU, Required: quantity, Available: available}
+	}
+
+	movement, err := s.valuation.Record(ctx, valuation.Change{
+		Item:        item,
+		WarehouseID: build.WarehouseID,
+		Delta:       -quantity,
+		Source:      source,
+		CreatedBy:   build.CreatedBy,
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	remaining := quantity
+	for i := 0; remaining > 0; i++ {
+		location := locations[i]
+		taken := min(location.Available(), remaining)
+		if _, err := s.items.AdjustQuantity(ctx, item.ID, location.ID, repository.QuantityChange{
+			Delta:       -taken,
+			WarehouseID: &build.WarehouseID,
+			UpdatedBy:   build.CreatedBy,
+		}); err != nil {
+			return 0, err
+		}
+		record.Lines = append(record.Lines, models.KitBuildLine{
+			ItemID:     item.ID,
+			LocationID: location.ID,
+			Quantity:   -taken,
+			TotalCost:  valuation.DivideRounded(movement.TotalCost*int64(taken), int64(quantity)),
+		})
+		remaining -= taken
+	}
+	return movement.TotalCost, nil
+}
+
+// add puts quantity of an item into the warehouse's unbinned stock of the
+// build's batch, received at unitCost
+func (s *Service) add(ctx context.Context, build Build, record *models.KitBuild, item *models.Item, quantity int, unitCost int64, source string) error {
+	location := &models.ItemLocation{
+		ItemID:      item.ID,
+		WarehouseID: build.WarehouseID,
+		Quantity:    quantity,
+		Batch:       build.Batch,
+		UpdatedBy:   build.CreatedBy,
+	}
+	if err := s.items.AddToLocation(ctx, location); err != nil {
+		return err
+	}
+	movement, err := s.valuation.Record(ctx, valuation.Change{
+		Item:        item,
+		WarehouseID: build.WarehouseID,
+		Delta:       quantity,
+		UnitCost:    &unitCost,
+		Source:      source,
+		CreatedBy:   build.CreatedBy,
+	})
+	if err != nil {
+		return err
+	}
+	record.Lines = append(record.Lines, models.KitBuildLine{
+		ItemID:     item.ID,
+		LocationID: location.ID,
+		Quantity:   quantity,
+		TotalCost:  movement.TotalCost,
+	})
+	return nil
+}
+
+// activeItem returns an item of the company that is not archived
+func (s *Service) activeItem(ctx context.Context, companyID, id primitive.ObjectID) (*models.Item, error) {
+	item, err := s.items.Get(ctx, companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if item.IsArchived {
+		return nil, ErrArchived
+	}
+	return item, nil
+}
+
+// stock returns an item's locations holding available stock in a
+// warehouse, unbinned stock first and then oldest first. Stock on quality
+// hold is left out.
+func (s *Service) stock(ctx context.Context, itemID, warehouseID primitive.ObjectID) ([]models.ItemLocation, error) {
+	locations, err := s.items.Locations(ctx, itemID)
+	if err != nil {
+		return nil, err
+	}
+	stocked := []models.ItemLocation{}
+	for _, location := range locations {
+		if location.WarehouseID == warehouseID && location.Available() > 0 {
+			stocked = append(stocked, location)
+		}
+	}
+	sort.SliceStable(stocked, func(i, j int) bool {
+		if (stocked[i].BinID == nil) != (stocked[j].BinID == nil) {
+			return stocked[i].BinID == nil
+		}
+		return stocked[i].CreatedAt.Before(stocked[j].CreatedAt)
+	})
+	return stocked, nil
+}
+
+// total sums the available stock of locations
+func total(locations []models.ItemLocation) int {
+	sum := 0
+	for _, location := range locations {
+		sum += location.Available()
+	}
+	return sum
+}
+
+// containsKit reports whether any component of bom, directly or through the
+// bills of materials of its components, is bom's kit
+func containsKit(boms []models.BOM, bom *models.BOM) bool {
+	byKit := make(map[primitive.ObjectID]models.BOM, len(boms))
+	for _, existing := range boms {
+		byKit[existing.KitItemID] = existing
+	}
+	byKit[bom.KitItemID] = *bom
+
+	visited := map[primitive.ObjectID]bool{}
+	var visit func(id primitive.ObjectID) bool
+	visit = func(id primitive.ObjectID) bool {
+		if visited[id] {
+			return false
+		}
+		visited[id] = true
+		for _, component := range byKit[id].Components {
+			if component.ItemID == bom.KitItemID || visit(component.ItemID) {
+				return true
+			}
+		}
+		return false
+	}
+	return visit(bom.KitItemID)
+}
@@ -0,0 +1,199 @@
+package kit
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// kitEnv is a FIFO company with two warehouses
+type kitEnv struct {
+	repos     *repository.Repositories
+	service   *Service
+	valuation *valuation.Service
+	company   *models.Company
+	warehouse *models.Warehouse
+	elsewhere *models.Warehouse
+	createdBy primitive.ObjectID
+}
+
+func newKitEnv(t *testing.T) *kitEnv {
+	t.Helper()
+	ctx := context.Background()
+	env := &kitEnv{repos: repository.NewMemoryRepositories(), createdBy: primitive.NewObjectID()}
+	repos := env.repos
+	env.company = &models.Company{Name: "Acme", Currency: "USD", ValuationMethod: models.ValuationFIFO}
+	if err := repos.Companies.Create(ctx, env.company); err != nil {
+		t.Fatal(err)
+	}
+	env.warehouse = &models.Warehouse{CompanyID: env.company.ID, Name: "Main", IsActive: true}
+	env.elsewhere = &models.Warehouse{CompanyID: env.company.ID, Name: "Annex", IsActive: true}
+	for _, warehouse := range []*models.Warehouse{env.warehouse, env.elsewhere} {
+		if err := repos.Warehouses.Create(ctx, warehouse); err != nil {
+			t.Fatal(err)
+		}
+	}
+	env.valuation = valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	env.service = NewService(repos.Tx, repos.Kits, repos.Items, repos.Warehouses, env.valuation)
+	return env
+}
+
+// item creates an item priced price without stock
+func (env *kitEnv) item(t *testing.T, sku string, price int64) *models.Item {
+	t.Helper()
+	item := &models.Item{CompanyID: env.company.ID, SKU: sku, Name: sku, Quality: "New", Price: price, Currency: "USD"}
+	if err := env.repos.Items.Create(context.Background(), item, &models.ItemLocation{WarehouseID: env.warehouse.ID}); err != nil {
+		t.Fatal(err)
+	}
+	return item
+}
+
+// receive adds quantity of an item to a warehouse at unitCost
+func (env *kitEnv) receive(t *testing.T, item *models.Item, warehouse *models.Warehouse, batch string, quantity int, unitCost int64) {
+	t.Helper()
+	ctx := context.Background()
+	location := &models.ItemLocation{ItemID: item.ID, WarehouseID: warehouse.ID, Batch: batch, Quantity: quantity}
+	if err := env.repos.Items.AddToLocation(ctx, location); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.valuation.Record(ctx, valuation.Change{Item: item, WarehouseID: warehouse.ID, Delta: quantity, UnitCost: &unitCost, Source: valuation.SourceAdjust}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// onHand sums an item's stock in the main warehouse
+func (env *kitEnv) onHand(t *testing.T, item *models.Item) int {
+	t.Helper()
+	locations, err := env.service.stock(context.Background(), item.ID, env.warehouse.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return total(locations)
+}
+
+func (env *kitEnv) define(t *testing.T, kit *models.Item, components ...Component) error {
+	t.Helper()
+	_, err := env.service.Define(context.Background(), env.company.ID, kit.ID, components, env.createdBy)
+	return err
+}
+
+func TestDefineRejectsCycles(t *testing.T) {
+	env := newKitEnv(t)
+	kit, bag, tape, roll := env.item(t, "KIT", 0), env.item(t, "BAG", 10), env.item(t, "TAPE", 5), env.item(t, "ROLL", 1)
+
+	if err := env.define(t, kit, Component{ItemID: bag.ID, Quantity: 1}, Component{ItemID: tape.ID, Quantity: 2}); err != nil {
+		t.Fatal(err)
+	}
+	// Nesting without a cycle is fine
+	if err := env.define(t, tape, Component{ItemID: roll.ID, Quantity: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		kit        *models.Item
+		components []Component
+	}{
+		{"contains itself", bag, []Component{{ItemID: bag.ID, Quantity: 1}}},
+		{"contains its own kit", bag, []Component{{ItemID: kit.ID, Quantity: 1}}},
+		{"contains its kit through another kit", roll, []Component{{ItemID: kit.ID, Quantity: 1}}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := env.define(t, tt.kit, tt.components...); err != ErrCycle {
+				t.Fatalf("error = %v, want %v", err, ErrCycle)
+			}
+		})
+	}
+
+	if err := env.define(t, kit, Component{ItemID: bag.ID, Quantity: 1}, Component{ItemID: bag.ID, Quantity: 1}); !errors.Is(err, ErrInvalidComponent) {
+		t.Fatalf("repeated component: error = %v, want %v", err, ErrInvalidComponent)
+	}
+}
+
+func TestAvailabilityIsLimitedByTheScarcestComponent(t *testing.T) {
+	ctx := context.Background()
+	env := newKitEnv(t)
+	kit, bag, tape := env.item(t, "KIT", 0), env.item(t, "BAG", 10), env.item(t, "TAPE", 5)
+	if err := env.define(t, kit, Component{ItemID: bag.ID, Quantity: 2}, Component{ItemID: tape.ID, Quantity: 3}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 7 bags over two batches build 3 kits, 8 tapes only 2; stock in
+	// another warehouse does not count
+	env.receive(t, bag, env.warehouse, "A", 5, 10)
+	env.receive(t, bag, env.warehouse, "B", 2, 10)
+	env.receive(t, tape, env.warehouse, "", 8, 5)
+	env.receive(t, tape, env.elsewhere, "", 100, 5)
+	env.receive(t, kit, env.warehouse, "", 1, 40)
+
+	availability, err := env.service.Availability(ctx, env.company.ID, kit.ID, env.warehouse.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if availability.Buildable != 2 || availability.InStock != 1 {
+		t.Fatalf("buildable %d, in stock %d; want 2 and 1", availability.Buildable, availability.InStock)
+	}
+	want := []struct{ available, buildable int }{{7, 3}, {8, 2}}
+	for i, line := range availability.Components {
+		if line.Available != want[i].available || line.Buildable != want[i].buildable {
+			t.Errorf("%s: available %d, buildable %d; want %d and %d", line.SKU, line.Available, line.Buildable, want[i].available, want[i].buildable)
+		}
+	}
+}
+
+func TestAssembleAndDisassembleCarryCost(t *testing.T) {
+	ctx := context.Background()
+	env := newKitEnv(t)
+	kit, bag, tape := env.item(t, "KIT", 0), env.item(t, "BAG", 50), env.item(t, "TAPE", 10)
+	if err := env.define(t, kit, Component{ItemID: bag.ID, Quantity: 2}, Component{ItemID: tape.ID, Quantity: 3}); err != nil {
+		t.Fatal(err)
+	}
+	env.receive(t, bag, env.warehouse, "", 10, 30)
+	env.receive(t, tape, env.warehouse, "", 10, 20)
+
+	build := Build{CompanyID: env.company.ID, KitItemID: kit.ID, WarehouseID: env.warehouse.ID, Quantity: 2, CreatedBy: env.createdBy}
+	assembled, err := env.service.Assemble(ctx, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Two kits take 4 bags at 30 and 6 tapes at 20
+	if kitLine := assembled.Lines[len(assembled.Lines)-1]; kitLine.ItemID != kit.ID || kitLine.Quantity != 2 || kitLine.TotalCost != 4*30+6*20 {
+		t.Fatalf("kit line = %+v, want 2 kits costing 240", kitLine)
+	}
+	if bags, tapes, kits := env.onHand(t, bag), env.onHand(t, tape), env.onHand(t, kit); bags != 6 || tapes != 4 || kits != 2 {
+		t.Fatalf("after assembly: %d bags, %d tapes, %d kits", bags, tapes, kits)
+	}
+
+	// One kit costs 120, shared 100:30 by the components' prices: 92 for
+	// the 2 bags at 46 each and 28 for the 3 tapes at 9 each
+	build.Quantity = 1
+	disassembled, err := env.service.Disassemble(ctx, build)
+	if err != nil {
+		t.Fatal(err)
+	}
+	costs := map[primitive.ObjectID]int64{}
+	for _, line := range disassembled.Lines {
+		costs[line.ItemID] += line.TotalCost
+	}
+	if costs[kit.ID] != 120 {
+		t.Errorf("kit issued at %d, want 120", costs[kit.ID])
+	}
+	if costs[bag.ID] != 2*46 || costs[tape.ID] != 3*9 {
+		t.Errorf("components received at %d and %d, want 92 and 27", costs[bag.ID], costs[tape.ID])
+	}
+	if bags, tapes, kits := env.onHand(t, bag), env.onHand(t, tape), env.onHand(t, kit); bags != 8 || tapes != 7 || kits != 1 {
+		t.Fatalf("after disassembly: %d bags, %d tapes, %d kits", bags, tapes, kits)
+	}
+
+	build.Quantity = 5
+	var shortage *ShortageError
+	if _, err := env.service.Assemble(ctx, build); !errors.As(err, &shortage) || shortage.SKU != "BAG" || shortage.Required != 10 || shortage.Available != 8 {
+		t.Fatalf("assembling 5: error = %v, want a shortage of 10 bags with 8 available", err)
+	}
+}
@@ -0,0 +1,85 @@
+package label
+
+import (
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Payload kinds
+const (
+	KindItem     = "item"
+	KindBatch    = "batch"
+	KindLocation = "location"
+)
+
+// fieldEscaper percent-encodes the separator, and the escape itself, inside
+// payload fields. Other characters are kept, so payloads of ordinary SKUs and
+// paths read the same as before and stay short.
+var (
+	fieldEscaper   = strings.NewReplacer("%", "%25", "|", "%7C")
+	fieldUnescaper = strings.NewReplacer("%25", "%", "%7C", "|", "%7c", "|")
+)
+
+// payloadKinds maps payload kinds to the letter that opens an encoded payload
+var payloadKinds = map[string]string{
+	KindItem:     "I",
+	KindBatch:    "L",
+	KindLocation: "B",
+}
+
+// Payload is what a label's barcode encodes: the kind of thing labelled, its
+// ID, and the SKU and batch of items or the path of storage locations. It is
+// encoded as fields joined by "|", e.g. I|<item id>|<sku> or
+// L|<item id>|<sku>|<batch>, short enough for Code128 on common labels. A "|"
+// or "%" inside a field is written as %7C or %25.
+type Payload struct {
+	Kind  string
+	ID    primitive.ObjectID
+	SKU   string
+	Batch string
+	Path  string
+}
+
+// String encodes the payload
+func (p Payload) String() string {
+	fields := []string{payloadKinds[p.Kind], p.ID.Hex()}
+	switch p.Kind {
+	case KindItem:
+		fields = append(fields, fieldEscaper.Replace(p.SKU))
+	case KindBatch:
+		fields = append(fields, fieldEscaper.Replace(p.SKU), fieldEscaper.Replace(p.Batch))
+	case KindLocation:
+		fields = append(fields, fieldEscaper.Replace(p.Path))
+	}
+	return strings.Join(fields, "|")
+}
+
+// ParsePayload decodes a payload scanned from one of our labels. It reports
+// false for anything else, such as a bare SKU or a supplier's barcode.
+func ParsePayload(raw string) (Payload, bool) {
+	fields := strings.Split(strings.TrimSpace(raw), "|")
+	if len(fields) < 2 {
+		return Payload{}, false
+	}
+	for i := 2; i < len(fields); i++ {
+		fields[i] = fieldUnescaper.Replace(fields[i])
+	}
+	id, err := primitive.ObjectIDFromHex(fields[1])
+	if err != nil {
+		return Payload{}, false
+	}
+
+	payload := Payload{ID: id}
+	switch {
+	case fields[0] == payloadKinds[KindItem] && len(fields) == 3:
+		payload.Kind, payload.SKU = KindItem, fields[2]
+	case fields[0] == payloadKinds[KindBatch] && len(fields) == 4:
+		payload.Kind, payload.SKU, payload.Batch = KindBatch, fields[2], fields[3]
+	case fields[0] == payloadKinds[KindLocation] && len(fields) == 3:
+		payload.Kind, payload.Path = KindLocation, fields[2]
+	default:
+		return Payload{}, false
+	}
+	return payload, true
+}
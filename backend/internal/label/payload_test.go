@@ -0,0 +1,28 @@
+package label
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestPayloadRoundTrip(t *testing.T) {
+	id := primitive.NewObjectID()
+	for _, payload := range []Payload{
+		{Kind: KindItem, ID: id, SKU: "BOX-1"},
+		{Kind: KindItem, ID: id, SKU: "A|B%7C"},
+		{Kind: KindBatch, ID: id, SKU: "50%|OFF", Batch: "LOT|2"},
+		{Kind: KindLocation, ID: id, Path: "A-01|B"},
+	} {
+		encoded := payload.String()
+		decoded, ok := ParsePayload(encoded)
+		if !ok || decoded != payload {
+			t.Errorf("%+v encoded as %q decoded to %+v, %v", payload, encoded, decoded, ok)
+		}
+	}
+
+	// Payloads without separators inside fields are unchanged
+	if got, want := (Payload{Kind: KindBatch, ID: id, SKU: "BOX-1", Batch: "L7"}).String(), "L|"+id.Hex()+"|BOX-1|L7"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,356 @@
+package label
+
+import (
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+
+	"github.com/boombuler/barcode"
+	"github.com/boombuler/barcode/code128"
+	"github.com/boombuler/barcode/qr"
+	"github.com/go-pdf/fpdf"
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/gofont/gobold"
+	"golang.org/x/image/font/gofont/goregular"
+	"golang.org/x/image/font/opentype"
+	"golang.org/x/image/math/fixed"
+)
+
+// Formats
+const (
+	FormatPDF = "pdf"
+	FormatPNG = "png"
+)
+
+const (
+	// Narrowest modules that common imagers still read, in millimetres: about
+	// 5 mil for Code128, which is one dot on a 203 dpi thermal printer
+	minCode128Module = 0.125
+	minQRModule      = 0.25
+	// Quiet zones around the symbols, in modules
+	code128Quiet = 10
+	qrQuiet      = 4
+
+	maxLineHeight = 7.0
+	minLineHeight = 2.2
+	mmPerPoint    = 25.4 / 72
+)
+
+// ErrTooDense is returned when a barcode would be too small to scan on the label
+var ErrTooDense = errors.New("barcode is too dense for this label; use a larger template or the qr symbology")
+
+// Label is one label to print
+type Label struct {
+	Payload Payload
+	Title   string
+	Lines   []string
+}
+
+// Options choose how labels are laid out
+type Options struct {
+	Template  Template
+	Symbology string
+	// Skip leaves the first positions of the first sheet blank, to reuse a
+	// partly used sheet
+	Skip int
+}
+
+// box is a rectangle in millimetres
+type box struct{ x, y, w, h float64 }
+
+func (b box) inset(d float64) box {
+	return box{b.x + d, b.y + d, b.w - 2*d, b.h - 2*d}
+}
+
+// canvas is a surface labels are drawn on, measured in millimetres
+type canvas interface {
+	fill(b box)
+	// text writes one line with its top at y; measure reports its width
+	text(x, y, lineHeight, size float64, bold bool, s string)
+	measure(size float64, bold bool, s string) float64
+	// snap rounds a module width down to one the surface can draw evenly
+	snap(module float64) float64
+}
+
+// RenderPDF lays labels out on as many pages of the template as they need
+func RenderPDF(w io.Writer, labels []Label, opts Options) error {
+	t := opts.Template
+	pdf := fpdf.NewCustom(&fpdf.InitType{
+		OrientationStr: "P",
+		UnitStr:        "mm",
+		Size:           fpdf.SizeType{Wd: t.PageWidth, Ht: t.PageHeight},
+	})
+	pdf.SetMargins(0, 0, 0)
+	pdf.SetAutoPageBreak(false, 0)
+	pdf.SetFillColor(0, 0, 0)
+	c := &pdfCanvas{pdf: pdf, tr: pdf.UnicodeTranslatorFromDescriptor("")}
+
+	position := opts.Skip % t.PerPage()
+	pdf.AddPage()
+	for _, l := range labels {
+		if position == t.PerPage() {
+			pdf.AddPage()
+			position = 0
+		}
+		x, y := t.origin(position)
+		if err := drawLabel(c, l, box{x, y, t.LabelWidth, t.LabelHeight}, opts.Symbology); err != nil {
+			return err
+		}
+		position++
+	}
+	return pdf.Output(w)
+}
+
+// RenderPNG draws a single label at dpi dots per inch
+func RenderPNG(w io.Writer, l Label, opts Options, dpi float64) error {
+	t := opts.Template
+	scale := dpi / 25.4
+	img := image.NewRGBA(image.Rect(0, 0, int(math.Round(t.LabelWidth*scale)), int(math.Round(t.LabelHeight*scale))))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	c, err := newImageCanvas(img, dpi)
+	if err != nil {
+		return err
+	}
+	if err := drawLabel(c, l, box{0, 0, t.LabelWidth, t.LabelHeight}, opts.Symbology); err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// drawLabel places the symbols and text of a label inside area
+func drawLabel(c canvas, l Label, area box, symbology string) error {
+	padding := math.Min(math.Max(math.Min(area.w, area.h)*0.06, 1.5), 4)
+	inner := area.inset(padding)
+	content := l.Payload.String()
+
+	text := inner
+	if symbology == SymbologyCode128 || symbology == SymbologyBoth {
+		share := 0.45
+		if symbology == SymbologyBoth {
+			share = 0.3
+		}
+		bar := box{inner.x, inner.y + inner.h*(1-share), inner.w, inner.h * share}
+		switch err := drawCode128(c, content, bar); {
+		case err == ErrTooDense && symbology == SymbologyBoth:
+			// Small labels keep just the QR code
+		case err != nil:
+			return err
+		default:
+			text.h = inner.h*(1-share) - padding
+		}
+	}
+	if symbology == SymbologyQR || symbology == SymbologyBoth {
+		side := math.Min(text.h, text.w*0.5)
+		if err := drawQR(c, content, box{text.x, text.y + (text.h-side)/2, side, side}); err != nil {
+			return err
+		}
+		text.x += side + padding
+		text.w -= side + padding
+	}
+	drawText(c, l, text)
+	return nil
+}
+
+func drawCode128(c canvas, content string, area box) error {
+	code, err := code128.Encode(content)
+	if err != nil {
+		return err
+	}
+	modules := code.Bounds().Dx()
+	module := c.snap(area.w / float64(modules+2*code128Quiet))
+	if module < minCode128Module {
+		return ErrTooDense
+	}
+	x := area.x + (area.w-module*float64(modules))/2
+	fillRuns(c, code, 0, x, area.y, module, area.h)
+	return nil
+}
+
+func drawQR(c canvas, content string, area box) error {
+	code, err := qr.Encode(content, qr.M, qr.Auto)
+	if err != nil {
+		return err
+	}
+	modules := code.Bounds().Dx()
+	module := c.snap(area.w / float64(modules+2*qrQuiet))
+	if module < minQRModule {
+		return ErrTooDense
+	}
+	offset := module * qrQuiet
+	for row := 0; row < modules; row++ {
+		fillRuns(c, code, row, area.x+offset, area.y+offset+float64(row)*module, module, module)
+	}
+	return nil
+}
+
+// fillRuns draws each run of dark modules in one row of a symbol as a single bar
+func fillRuns(c canvas, code barcode.Barcode, row int, x, y, module, height float64) {
+	bounds := code.Bounds()
+	start := -1
+	for col := 0; col <= bounds.Dx(); col++ {
+		isDark := col < bounds.Dx() && dark(code.At(bounds.Min.X+col, bounds.Min.Y+row))
+		switch {
+		case isDark && start < 0:
+			start = col
+		case !isDark && start >= 0:
+			c.fill(box{x + float64(start)*module, y, float64(col-start) * module, height})
+			start = -1
+		}
+	}
+}
+
+func dark(c color.Color) bool {
+	r, _, _, _ := c.RGBA()
+	return r < 0x8000
+}
+
+// drawText writes the title in bold and the other lines below it, dropping
+// lines that do not fit
+func drawText(c canvas, l Label, area box) {
+	lines := append([]string{l.Title}, l.Lines...)
+	if room := int(area.h / minLineHeight); len(lines) > room {
+		lines = lines[:room]
+	}
+	if len(lines) == 0 || area.w <= 0 {
+		return
+	}
+	lineHeight := math.Min(area.h/float64(len(lines)), maxLineHeight)
+	size := lineHeight * 0.7 / mmPerPoint
+	y := area.y + (area.h-lineHeight*float64(len(lines)))/2
+	minSize := minLineHeight * 0.7 / mmPerPoint
+	for i, line := range lines {
+		bold := i == 0
+		// Shrink long lines towards the smallest size before cutting them short
+		lineSize := size
+		if width := c.measure(size, bold, line); width > area.w {
+			lineSize = math.Max(size*area.w/width, minSize)
+		}
+		c.text(area.x, y, lineHeight, lineSize, bold, fit(c, line, lineSize, bold, area.w))
+		y += lineHeight
+	}
+}
+
+// fit shortens text with an ellipsis until it fits width
+func fit(c canvas, text string, size float64, bold bool, width float64) string {
+	if c.measure(size, bold, text) <= width {
+		return text
+	}
+	runes := []rune(text)
+	for len(runes) > 0 && c.measure(size, bold, string(runes)+"...") > width {
+		runes = runes[:len(runes)-1]
+	}
+	return string(runes) + "..."
+}
+
+type pdfCanvas struct {
+	pdf *fpdf.Fpdf
+	tr  func(string) string
+}
+
+func (c *pdfCanvas) fill(b box) {
+	c.pdf.Rect(b.x, b.y, b.w, b.h, "F")
+}
+
+func (c *pdfCanvas) text(x, y, lineHeight, size float64, bold bool, s string) {
+	c.setFont(size, bold)
+	c.pdf.SetXY(x, y)
+	c.pdf.CellFormat(0, lineHeight, c.tr(s), "", 0, "L", false, 0, "")
+}
+
+func (c *pdfCanvas) measure(size float64, bold bool, s string) float64 {
+	c.setFont(size, bold)
+	return c.pdf.GetStringWidth(c.tr(s))
+}
+
+func (c *pdfCanvas) snap(module float64) float64 {
+	return module
+}
+
+func (c *pdfCanvas) setFont(size float64, bold bool) {
+	style := ""
+	if bold {
+		style = "B"
+	}
+	c.pdf.SetFont("Helvetica", style, size)
+}
+
+type imageCanvas struct {
+	img     *image.RGBA
+	scale   float64 // pixels per millimetre
+	dpi     float64
+	regular *opentype.Font
+	bold    *opentype.Font
+	faces   map[faceKey]font.Face
+}
+
+type faceKey struct {
+	size float64
+	bold bool
+}
+
+func newImageCanvas(img *image.RGBA, dpi float64) (*imageCanvas, error) {
+	regular, err := opentype.Parse(goregular.TTF)
+	if err != nil {
+		return nil, err
+	}
+	bold, err := opentype.Parse(gobold.TTF)
+	if err != nil {
+		return nil, err
+	}
+	return &imageCanvas{img: img, scale: dpi / 25.4, dpi: dpi, regular: regular, bold: bold, faces: map[faceKey]font.Face{}}, nil
+}
+
+func (c *imageCanvas) fill(b box) {
+	rect := image.Rect(
+		int(math.Round(b.x*c.scale)), int(math.Round(b.y*c.scale)),
+		int(math.Round((b.x+b.w)*c.scale)), int(math.Round((b.y+b.h)*c.scale)),
+	)
+	draw.Draw(c.img, rect, image.Black, image.Point{}, draw.Src)
+}
+
+func (c *imageCanvas) text(x, y, lineHeight, size float64, bold bool, s string) {
+	face := c.face(size, bold)
+	// Centre the line's ascent and descent within the line height
+	metrics := face.Metrics()
+	glyphHeight := float64(metrics.Ascent+metrics.Descent) / 64 / c.scale
+	baseline := y + (lineHeight-glyphHeight)/2 + float64(metrics.Ascent)/64/c.scale
+	d := font.Drawer{
+		Dst:  c.img,
+		Src:  image.Black,
+		Face: face,
+		Dot:  fixed.P(int(math.Round(x*c.scale)), int(math.Round(baseline*c.scale))),
+	}
+	d.DrawString(s)
+}
+
+func (c *imageCanvas) measure(size float64, bold bool, s string) float64 {
+	return float64(font.MeasureString(c.face(size, bold), s)) / 64 / c.scale
+}
+
+// snap keeps modules a whole number of pixels so every bar has the same width
+func (c *imageCanvas) snap(module float64) float64 {
+	return math.Floor(module*c.scale+1e-9) / c.scale
+}
+
+func (c *imageCanvas) face(size float64, bold bool) font.Face {
+	key := faceKey{size, bold}
+	if face, ok := c.faces[key]; ok {
+		return face
+	}
+	f := c.regular
+	if bold {
+		f = c.bold
+	}
+	face, err := opentype.NewFace(f, &opentype.FaceOptions{Size: size, DPI: c.dpi, Hinting: font.HintingFull})
+	if err != nil {
+		// The embedded Go fonts always parse, so only an absurd size gets here
+		face, _ = opentype.NewFace(f, &opentype.FaceOptions{Size: 8, DPI: c.dpi})
+	}
+	c.faces[key] = face
+	return face
+}
@@ -0,0 +1,335 @@
+// Package label renders printable Code128 and QR labels for items, batches
+// and storage locations, and resolves scanned labels back to what they name.
+package label
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/layout"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// MaxLabels caps the labels in one print run
+const MaxLabels = 2000
+
+// ErrTooMany is returned for a print run over MaxLabels
+var ErrTooMany = fmt.Errorf("a print run is limited to %d labels", MaxLabels)
+
+// Scope limits labels and scans to a company and, when WarehouseID is set,
+// to the stock and locations of one warehouse
+type Scope struct {
+	CompanyID   primitive.ObjectID
+	WarehouseID *primitive.ObjectID
+}
+
+// Resolution is what a scanned code names. Locations is the item's stock in
+// scope, only that of the batch for batches; Stock is the content of a bin.
+type Resolution struct {
+	Type      string                  `json:"type"` // item, batch, location
+	Payload   string                  `json:"payload"`
+	Item      *models.Item            `json:"item,omitempty"`
+	Batch     string                  `json:"batch,omitempty"`
+	Locations []models.ItemLocation   `json:"locations,omitempty"`
+	Location  *models.StorageLocation `json:"location,omitempty"`
+	Stock     *layout.BinStock        `json:"stock,omitempty"`
+}
+
+// Service builds labels and resolves scans
+type Service struct {
+	items         repository.ItemRepository
+	layout        repository.LayoutRepository
+	warehouses    repository.WarehouseRepository
+	layoutService *layout.Service
+	templates     *Templates
+}
+
+func NewService(items repository.ItemRepository, layoutRepo repository.LayoutRepository, warehouses repository.WarehouseRepository, layoutService *layout.Service, templates *Templates) *Service {
+	return &Service{items: items, layout: layoutRepo, warehouses: warehouses, layoutService: layoutService, templates: templates}
+}
+
+// Templates returns the label templates available for printing
+func (s *Service) Templates() *Templates {
+	return s.templates
+}
+
+// ItemLabel returns the label of an item, or of one of its batches
+func (s *Service) ItemLabel(ctx context.Context, scope Scope, itemID primitive.ObjectID, batch string) (Label, error) {
+	item, locations, err := s.item(ctx, scope, itemID, batch)
+	if err != nil {
+		return Label{}, err
+	}
+	if batch != "" && len(locations) == 0 {
+		return Label{}, repository.ErrNotFound
+	}
+	return itemLabel(item, batch), nil
+}
+
+// LocationLabel returns the label of a zone, aisle, rack or bin
+func (s *Service) LocationLabel(ctx context.Context, scope Scope, id primitive.ObjectID) (Label, error) {
+	location, err := s.location(ctx, scope, id)
+	if err != nil {
+		return Label{}, err
+	}
+	return locationLabel(location), nil
+}
+
+// WarehouseLabels returns a label for every bin of a warehouse, or for every
+// item and batch in stock there, in path or SKU order
+func (s *Service) WarehouseLabels(ctx context.Context, scope Scope, warehouseID primitive.ObjectID, bins bool) ([]Label, error) {
+	if scope.WarehouseID != nil && *scope.WarehouseID != warehouseID {
+		return nil, repository.ErrNotFound
+	}
+	if _, err := s.warehouses.Get(ctx, scope.CompanyID, warehouseID); err != nil {
+		return nil, err
+	}
+
+	if bins {
+		locations, err := s.layout.List(ctx, scope.CompanyID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		labels := []Label{}
+		for i := range locations {
+			if locations[i].Kind == models.LocationBin {
+				labels = append(labels, locationLabel(&locations[i]))
+			}
+		}
+		return labels, nil
+	}
+	return s.stockLabels(ctx, scope, warehouseID, func(models.ItemLocation) bool { return true }, false)
+}
+
+// BatchLabels returns a label for each item received in a batch at a
+// warehouse, or one per unit in stock when perUnit is set
+func (s *Service) BatchLabels(ctx context.Context, scope Scope, warehouseID primitive.ObjectID, batch string, perUnit bool) ([]Label, error) {
+	if scope.WarehouseID != nil && *scope.WarehouseID != warehouseID {
+		return nil, repository.ErrNotFound
+	}
+	if _, err := s.warehouses.Get(ctx, scope.CompanyID, warehouseID); err != nil {
+		return nil, err
+	}
+	labels, err := s.stockLabels(ctx, scope, warehouseID, func(location models.ItemLocation) bool {
+		return location.Batch == batch
+	}, perUnit)
+	if err != nil {
+		return nil, err
+	}
+	if len(labels) == 0 {
+		return nil, repository.ErrNotFound
+	}
+	return labels, nil
+}
+
+// stockLabels labels each item and batch with stock in a warehouse that
+// matches, once or once per unit
+func (s *Service) stockLabels(ctx context.Context, scope Scope, warehouseID primitive.ObjectID, match func(models.ItemLocation) bool, perUnit bool) ([]Label, error) {
+	locations, err := s.items.WarehouseLocations(ctx, warehouseID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	type key struct {
+		itemID primitive.ObjectID
+		batch  string
+	}
+	quantities := map[key]int{}
+	for _, location := range locations {
+		if location.Quantity > 0 && match(location) {
+			quantities[key{location.ItemID, location.Batch}] += location.Quantity
+		}
+	}
+
+	type entry struct {
+		item     *models.Item
+		batch    string
+		quantity int
+	}
+	entries := make([]entry, 0, len(quantities))
+	total := 0
+	for k, quantity := range quantities {
+		item, err := s.items.Get(ctx, scope.CompanyID, k.itemID)
+		if err == repository.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if item.IsArchived {
+			continue
+		}
+		entries = append(entries, entry{item, k.batch, quantity})
+		if total += 1; perUnit {
+			total += quantity - 1
+		}
+		if total > MaxLabels {
+			return nil, ErrTooMany
+		}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].item.SKU != entries[j].item.SKU {
+			return entries[i].item.SKU < entries[j].item.SKU
+		}
+		return entries[i].batch < entries[j].batch
+	})
+
+	labels := make([]Label, 0, total)
+	for _, e := range entries {
+		copies := 1
+		if perUnit {
+			copies = e.quantity
+		}
+		l := itemLabel(e.item, e.batch)
+		for i := 0; i < copies; i++ {
+			labels = append(labels, l)
+		}
+	}
+	return labels, nil
+}
+
+// Resolve finds what a scanned code names within scope. Besides our own
+// label payloads it accepts an item or location ID, a SKU, or, when scoped
+// to a warehouse, a location path.
+func (s *Service) Resolve(ctx context.Context, scope Scope, raw string) (*Resolution, error) {
+	raw = strings.TrimSpace(raw)
+	if payload, ok := ParsePayload(raw); ok {
+		if payload.Kind == KindLocation {
+			return s.resolveLocation(ctx, scope, payload.ID, raw)
+		}
+		return s.resolveItem(ctx, scope, payload.ID, payload.Batch, raw)
+	}
+
+	if id, err := primitive.ObjectIDFromHex(raw); err == nil {
+		resolution, err := s.resolveItem(ctx, scope, id, "", raw)
+		if err != repository.ErrNotFound {
+			return resolution, err
+		}
+		return s.resolveLocation(ctx, scope, id, raw)
+	}
+
+	item, err := s.items.GetBySKU(ctx, scope.CompanyID, raw)
+	if err == nil {
+		return s.resolveItem(ctx, scope, item.ID, "", raw)
+	}
+	if err != repository.ErrNotFound {
+		return nil, err
+	}
+
+	if scope.WarehouseID != nil {
+		locations, err := s.layout.List(ctx, scope.CompanyID, *scope.WarehouseID)
+		if err != nil {
+			return nil, err
+		}
+		for _, location := range locations {
+			if strings.EqualFold(location.Path, raw) {
+				return s.resolveLocation(ctx, scope, location.ID, raw)
+			}
+		}
+	}
+	return nil, repository.ErrNotFound
+}
+
+func (s *Service) resolveItem(ctx context.Context, scope Scope, itemID primitive.ObjectID, batch, raw string) (*Resolution, error) {
+	item, locations, err := s.item(ctx, scope, itemID, batch)
+	if err != nil {
+		return nil, err
+	}
+	resolution := &Resolution{Type: KindItem, Payload: raw, Item: item, Locations: locations}
+	if batch != "" {
+		if len(locations) == 0 {
+			return nil, repository.ErrNotFound
+		}
+		resolution.Type = KindBatch
+		resolution.Batch = batch
+	}
+	return resolution, nil
+}
+
+func (s *Service) resolveLocation(ctx context.Context, scope Scope, id primitive.ObjectID, raw string) (*Resolution, error) {
+	location, err := s.location(ctx, scope, id)
+	if err != nil {
+		return nil, err
+	}
+	resolution := &Resolution{Type: KindLocation, Payload: raw, Location: location}
+	if location.Kind == models.LocationBin {
+		stock, err := s.layoutService.BinStock(ctx, scope.CompanyID, location.WarehouseID, &location.ID)
+		if err != nil {
+			return nil, err
+		}
+		if len(stock.Bins) == 1 {
+			resolution.Stock = &stock.Bins[0]
+		}
+	}
+	return resolution, nil
+}
+
+// item returns an item with its locations in scope, only those of batch when
+// it is set. An item without stock in a scoped warehouse is not found.
+func (s *Service) item(ctx context.Context, scope Scope, itemID primitive.ObjectID, batch string) (*models.Item, []models.ItemLocation, error) {
+	item, err := s.items.Get(ctx, scope.CompanyID, itemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := s.items.Locations(ctx, itemID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	inWarehouse := false
+	locations := []models.ItemLocation{}
+	for _, location := range all {
+		if scope.WarehouseID != nil && location.WarehouseID != *scope.WarehouseID {
+			continue
+		}
+		inWarehouse = true
+		if batch == "" || location.Batch == batch {
+			locations = append(locations, location)
+		}
+	}
+	if scope.WarehouseID != nil && !inWarehouse {
+		return nil, nil, repository.ErrNotFound
+	}
+	return item, locations, nil
+}
+
+// location returns a storage location in scope
+func (s *Service) location(ctx context.Context, scope Scope, id primitive.ObjectID) (*models.StorageLocation, error) {
+	location, err := s.layout.Get(ctx, scope.CompanyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if scope.WarehouseID != nil && location.WarehouseID != *scope.WarehouseID {
+		return nil, repository.ErrNotFound
+	}
+	return location, nil
+}
+
+func itemLabel(item *models.Item, batch string) Label {
+	l := Label{
+		Payload: Payload{Kind: KindItem, ID: item.ID, SKU: item.SKU},
+		Title:   item.Name,
+		Lines:   []string{"SKU " + item.SKU},
+	}
+	if batch != "" {
+		l.Payload.Kind = KindBatch
+		l.Payload.Batch = batch
+		l.Lines = append(l.Lines, "Batch "+batch)
+	}
+	return l
+}
+
+func locationLabel(location *models.StorageLocation) Label {
+	kind := strings.ToUpper(location.Kind[:1]) + location.Kind[1:]
+	if location.Name != "" {
+		kind += " - " + location.Name
+	}
+	return Label{
+		Payload: Payload{Kind: KindLocation, ID: location.ID, Path: location.Path},
+		Title:   location.Path,
+		Lines:   []string{kind},
+	}
+}
@@ -0,0 +1,164 @@
+package label
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Symbologies
+const (
+	SymbologyCode128 = "code128"
+	SymbologyQR      = "qr"
+	// SymbologyBoth prints a QR code beside the text and Code128 below it
+	SymbologyBoth = "both"
+)
+
+// ValidSymbology reports whether a symbology can be rendered
+func ValidSymbology(symbology string) bool {
+	return symbology == SymbologyCode128 || symbology == SymbologyQR || symbology == SymbologyBoth
+}
+
+// Template is the geometry of a label stock, in millimetres. A sheet holds
+// Columns by Rows labels, the first one MarginLeft and MarginTop from the
+// page corner, with GapX and GapY between neighbours. Thermal rolls are a
+// one-label page.
+type Template struct {
+	Name        string  `json:"name"`
+	Description string  `json:"description,omitempty"`
+	PageWidth   float64 `json:"page_width"`
+	PageHeight  float64 `json:"page_height"`
+	LabelWidth  float64 `json:"label_width"`
+	LabelHeight float64 `json:"label_height"`
+	Columns     int     `json:"columns"`
+	Rows        int     `json:"rows"`
+	MarginLeft  float64 `json:"margin_left"`
+	MarginTop   float64 `json:"margin_top"`
+	GapX        float64 `json:"gap_x"`
+	GapY        float64 `json:"gap_y"`
+	// Symbology is used when a request does not choose one
+	Symbology string `json:"symbology"`
+}
+
+// PerPage is the number of labels on one page
+func (t Template) PerPage() int {
+	return t.Columns * t.Rows
+}
+
+// origin returns the top-left corner of the label at position i on its page
+func (t Template) origin(i int) (float64, float64) {
+	column, row := i%t.Columns, i/t.Columns
+	return t.MarginLeft + float64(column)*(t.LabelWidth+t.GapX),
+		t.MarginTop + float64(row)*(t.LabelHeight+t.GapY)
+}
+
+func (t Template) validate() error {
+	switch {
+	case strings.TrimSpace(t.Name) == "":
+		return errors.New("name is required")
+	case t.LabelWidth <= 0 || t.LabelHeight <= 0:
+		return errors.New("label_width and label_height must be positive")
+	case t.Columns <= 0 || t.Rows <= 0:
+		return errors.New("columns and rows must be positive")
+	case t.MarginLeft < 0 || t.MarginTop < 0 || t.GapX < 0 || t.GapY < 0:
+		return errors.New("margins and gaps must not be negative")
+	case !ValidSymbology(t.Symbology):
+		return errors.New("symbology must be one of code128, qr, both")
+	}
+	right, bottom := t.origin(t.PerPage() - 1)
+	if right+t.LabelWidth > t.PageWidth+0.01 || bottom+t.LabelHeight > t.PageHeight+0.01 {
+		return errors.New("labels do not fit on the page")
+	}
+	return nil
+}
+
+// builtinTemplates are common thermal and Avery label stocks
+var builtinTemplates = []Template{
+	{
+		Name: "4x6", Description: "4 x 6 in thermal shipping label",
+		PageWidth: 101.6, PageHeight: 152.4, LabelWidth: 101.6, LabelHeight: 152.4,
+		Columns: 1, Rows: 1, Symbology: SymbologyBoth,
+	},
+	{
+		Name: "4x2", Description: "4 x 2 in thermal label",
+		PageWidth: 101.6, PageHeight: 50.8, LabelWidth: 101.6, LabelHeight: 50.8,
+		Columns: 1, Rows: 1, Symbology: SymbologyBoth,
+	},
+	{
+		Name: "2x1", Description: "2 x 1 in thermal label",
+		PageWidth: 50.8, PageHeight: 25.4, LabelWidth: 50.8, LabelHeight: 25.4,
+		Columns: 1, Rows: 1, Symbology: SymbologyQR,
+	},
+	{
+		Name: "avery-5160", Description: "Avery 5160, 30 per US Letter sheet, 2.625 x 1 in",
+		PageWidth: 215.9, PageHeight: 279.4, LabelWidth: 66.675, LabelHeight: 25.4,
+		Columns: 3, Rows: 10, MarginLeft: 4.7625, MarginTop: 12.7, GapX: 3.175, Symbology: SymbologyQR,
+	},
+	{
+		Name: "avery-5163", Description: "Avery 5163, 10 per US Letter sheet, 4 x 2 in",
+		PageWidth: 215.9, PageHeight: 279.4, LabelWidth: 101.6, LabelHeight: 50.8,
+		Columns: 2, Rows: 5, MarginLeft: 3.96875, MarginTop: 12.7, GapX: 4.7625, Symbology: SymbologyBoth,
+	},
+	{
+		Name: "avery-l7160", Description: "Avery L7160, 21 per A4 sheet, 63.5 x 38.1 mm",
+		PageWidth: 210, PageHeight: 297, LabelWidth: 63.5, LabelHeight: 38.1,
+		Columns: 3, Rows: 7, MarginLeft: 7.2, MarginTop: 15.15, GapX: 2.5, Symbology: SymbologyQR,
+	},
+}
+
+// DefaultTemplate is used when a request names none
+const DefaultTemplate = "4x2"
+
+// Templates holds the built-in templates and any configured ones by name
+type Templates struct {
+	byName map[string]Template
+}
+
+// ParseTemplates reads a JSON array of custom templates, as set in
+// LABEL_TEMPLATES. A custom template replaces a built-in one of the same name.
+func ParseTemplates(raw string) (*Templates, error) {
+	templates := &Templates{byName: map[string]Template{}}
+	for _, t := range builtinTemplates {
+		templates.byName[t.Name] = t
+	}
+	if strings.TrimSpace(raw) == "" {
+		return templates, nil
+	}
+
+	var custom []Template
+	if err := json.Unmarshal([]byte(raw), &custom); err != nil {
+		return nil, fmt.Errorf("invalid label templates: %w", err)
+	}
+	for _, t := range custom {
+		if t.PageWidth == 0 && t.PageHeight == 0 && t.Columns <= 1 && t.Rows <= 1 {
+			// A single label on a roll
+			t.PageWidth, t.PageHeight, t.Columns, t.Rows = t.LabelWidth, t.LabelHeight, 1, 1
+		}
+		if t.Symbology == "" {
+			t.Symbology = SymbologyQR
+		}
+		if err := t.validate(); err != nil {
+			return nil, fmt.Errorf("invalid label template %q: %w", t.Name, err)
+		}
+		templates.byName[t.Name] = t
+	}
+	return templates, nil
+}
+
+// Get returns a template by name
+func (t *Templates) Get(name string) (Template, bool) {
+	template, ok := t.byName[name]
+	return template, ok
+}
+
+// List returns every template ordered by name
+func (t *Templates) List() []Template {
+	list := make([]Template, 0, len(t.byName))
+	for _, template := range t.byName {
+		list = append(list, template)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
@@ -0,0 +1,269 @@
+// Package layout maps each warehouse into zones, aisles, racks and bins, and
+// moves stock between bins. Stock enters a warehouse unbinned; putaway moves
+// it into a bin and moves shift it from one bin to another. Bin capacity is
+// checked on both, while adjustments record counted stock as it is.
+package layout
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidKind is returned for kinds other than zone, aisle, rack and bin
+	ErrInvalidKind = errors.New("kind must be one of zone, aisle, rack, bin")
+	// ErrInvalidParent is returned when a location is not placed inside the kind before it
+	ErrInvalidParent = errors.New("zones have no parent; aisles go in zones, racks in aisles and bins in racks")
+	// ErrInvalidCapacity is returned for a negative capacity or one set on anything but a bin
+	ErrInvalidCapacity = errors.New("capacity must not be negative and only applies to bins")
+	// ErrNotEmpty is returned when deleting a location that still holds locations or stock
+	ErrNotEmpty = errors.New("location still contains other locations or stock")
+	// ErrLocationNotFound is returned for stock that does not exist in scope
+	ErrLocationNotFound = errors.New("stock location not found")
+	// ErrBinNotFound is returned for a bin that does not exist in scope
+	ErrBinNotFound = errors.New("bin not found")
+	// ErrNotBin is returned when stock is sent to a zone, aisle or rack
+	ErrNotBin = errors.New("stock can only be stored in a bin")
+	// ErrOtherWarehouse is returned when a bin is in another warehouse than the stock
+	ErrOtherWarehouse = errors.New("bin is in another warehouse than the stock")
+	// ErrAlreadyBinned is returned when putting away stock that is already in a bin
+	ErrAlreadyBinned = errors.New("stock is already in a bin; move it instead")
+	// ErrNotBinned is returned when moving stock that has not been put away
+	ErrNotBinned = errors.New("stock is not in a bin yet; put it away first")
+	// ErrSameBin is returned when moving stock into the bin it is in
+	ErrSameBin = errors.New("stock is already in that bin")
+	// ErrInvalidQuantity is returned for a quantity that is not positive
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrOnHold is returned when moving more stock than is available because
+	// the rest is on quality hold
+	ErrOnHold = errors.New("stock on quality hold cannot be moved; it must be released first")
+	// ErrOverCapacity is returned when a bin would hold more than its capacity
+	ErrOverCapacity = errors.New("bin does not have room for that quantity")
+)
+
+// Service manages warehouse layouts and the stock in their bins
+type Service struct {
+	tx         repository.Transactor
+	layout     repository.LayoutRepository
+	items      repository.ItemRepository
+	warehouses repository.WarehouseRepository
+}
+
+func NewService(tx repository.Transactor, layout repository.LayoutRepository, items repository.ItemRepository, warehouses repository.WarehouseRepository) *Service {
+	return &Service{tx: tx, layout: layout, items: items, warehouses: warehouses}
+}
+
+// Node is a storage location with the locations inside it. Quantity is the
+// stock held in it and everything below it.
+type Node struct {
+	models.StorageLocation
+	Quantity int     `json:"quantity"`
+	Children []*Node `json:"children"`
+}
+
+// Create adds a location under its parent, which must be the kind before it
+// in the same warehouse
+func (s *Service) Create(ctx context.Context, location *models.StorageLocation) error {
+	location.Kind = strings.ToLower(strings.TrimSpace(location.Kind))
+	location.Code = strings.TrimSpace(location.Code)
+	depth := kindDepth(location.Kind)
+	if depth < 0 {
+		return ErrInvalidKind
+	}
+	if location.Capacity < 0 || (location.Capacity > 0 && location.Kind != models.LocationBin) {
+		return ErrInvalidCapacity
+	}
+
+	warehouse, err := s.warehouses.Get(ctx, location.CompanyID, location.WarehouseID)
+	if err != nil {
+		return err
+	}
+	if !warehouse.IsActive {
+		return repository.ErrNotFound
+	}
+
+	location.Path = location.Code
+	if depth == 0 {
+		if location.ParentID != nil {
+			return ErrInvalidParent
+		}
+	} else {
+		if location.ParentID == nil {
+			return ErrInvalidParent
+		}
+		parent, err := s.layout.Get(ctx, location.CompanyID, *location.ParentID)
+		if err == repository.ErrNotFound {
+			return ErrInvalidParent
+		}
+		if err != nil {
+			return err
+		}
+		if parent.WarehouseID != location.WarehouseID || kindDepth(parent.Kind) != depth-1 {
+			return ErrInvalidParent
+		}
+		location.Path = parent.Path + "-" + location.Code
+	}
+
+	now := time.Now()
+	location.CreatedAt = now
+	location.UpdatedAt = now
+	return s.layout.Create(ctx, location)
+}
+
+// Update renames a location or changes a bin's capacity. A capacity below
+// what the bin already holds is refused. warehouseID, when set, only matches
+// a location in that warehouse.
+func (s *Service) Update(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID, update repository.LayoutUpdate) (*models.StorageLocation, error) {
+	var updated *models.StorageLocation
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		location, err := s.get(ctx, companyID, id, warehouseID)
+		if err != nil {
+			return err
+		}
+		if capacity := update.Capacity; capacity != nil {
+			if *capacity < 0 || (*capacity > 0 && location.Kind != models.LocationBin) {
+				return ErrInvalidCapacity
+			}
+			if *capacity > 0 {
+				held, err := s.binQuantity(ctx, location)
+				if err != nil {
+					return err
+				}
+				if held > *capacity {
+					return ErrOverCapacity
+				}
+			}
+		}
+		updated, err = s.layout.Update(ctx, companyID, id, update)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
+}
+
+// Delete removes a location that holds no other locations and no stock
+func (s *Service) Delete(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID) (*models.StorageLocation, error) {
+	var location *models.StorageLocation
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if location, err = s.get(ctx, companyID, id, warehouseID); err != nil {
+			return err
+		}
+		children, err := s.layout.HasChildren(ctx, id)
+		if err != nil {
+			return err
+		}
+		if children {
+			return ErrNotEmpty
+		}
+		if location.Kind == models.LocationBin {
+			held, err := s.binQuantity(ctx, location)
+			if err != nil {
+				return err
+			}
+			if held > 0 {
+				return ErrNotEmpty
+			}
+		}
+		return s.layout.Delete(ctx, companyID, id)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return location, nil
+}
+
+// Tree returns a warehouse's zones with everything inside them
+func (s *Service) Tree(ctx context.Context, companyID, warehouseID primitive.ObjectID) ([]*Node, error) {
+	if _, err := s.warehouses.Get(ctx, companyID, warehouseID); err != nil {
+		return nil, err
+	}
+	locations, err := s.layout.List(ctx, companyID, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	stock, err := s.items.WarehouseLocations(ctx, warehouseID, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	held := map[primitive.ObjectID]int{}
+	for _, location := range stock {
+		if location.BinID != nil {
+			held[*location.BinID] += location.Quantity
+		}
+	}
+
+	nodes := make(map[primitive.ObjectID]*Node, len(locations))
+	for _, location := range locations {
+		nodes[location.ID] = &Node{StorageLocation: location, Children: []*Node{}}
+	}
+	roots := []*Node{}
+	// Locations are sorted by path, so parents come before their children
+	for _, location := range locations {
+		node := nodes[location.ID]
+		if location.ParentID == nil {
+			roots = append(roots, node)
+			continue
+		}
+		if parent, ok := nodes[*location.ParentID]; ok {
+			parent.Children = append(parent.Children, node)
+		}
+	}
+	for _, root := range roots {
+		sumQuantity(root, held)
+	}
+	return roots, nil
+}
+
+// get returns a location of the company, optionally restricted to a warehouse
+func (s *Service) get(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID) (*models.StorageLocation, error) {
+	location, err := s.layout.Get(ctx, companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if warehouseID != nil && location.WarehouseID != *warehouseID {
+		return nil, repository.ErrNotFound
+	}
+	return location, nil
+}
+
+// binQuantity sums the stock held in a bin
+func (s *Service) binQuantity(ctx context.Context, bin *models.StorageLocation) (int, error) {
+	locations, err := s.items.WarehouseLocations(ctx, bin.WarehouseID, &bin.ID)
+	if err != nil {
+		return 0, err
+	}
+	total := 0
+	for _, location := range locations {
+		total += location.Quantity
+	}
+	return total, nil
+}
+
+// sumQuantity totals the stock held below node into each node's Quantity
+func sumQuantity(node *Node, held map[primitive.ObjectID]int) int {
+	node.Quantity = held[node.ID]
+	for _, child := range node.Children {
+		node.Quantity += sumQuantity(child, held)
+	}
+	return node.Quantity
+}
+
+// kindDepth returns how deep a kind sits, zones being 0, or -1 for unknown kinds
+func kindDepth(kind string) int {
+	for i, k := range models.LocationKinds {
+		if k == kind {
+			return i
+		}
+	}
+	return -1
+}
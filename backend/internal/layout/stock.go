@@ -0,0 +1,245 @@
+package layout
+
+import (
+	"context"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// StockLine is one item location's stock
+type StockLine struct {
+	LocationID primitive.ObjectID `json:"location_id"`
+	ItemID     primitive.ObjectID `json:"item_id"`
+	SKU        string             `json:"sku"`
+	Name       string             `json:"name"`
+	Batch      string             `json:"batch,omitempty"`
+	Quantity   int                `json:"quantity"`
+	Held       int                `json:"held,omitempty"` // Part of Quantity on quality hold
+}
+
+// BinStock is the stock held in one bin
+type BinStock struct {
+	BinID    primitive.ObjectID `json:"bin_id"`
+	Path     string             `json:"path"`
+	Capacity int                `json:"capacity,omitempty"`
+	Quantity int                `json:"quantity"`
+	Items    []StockLine        `json:"items"`
+}
+
+// Stock is a warehouse's stock by bin. Unassigned is the stock not yet put
+// away, left empty when the view covers a single bin.
+type Stock struct {
+	WarehouseID primitive.ObjectID `json:"warehouse_id"`
+	Bins        []BinStock         `json:"bins"`
+	Unassigned  []StockLine        `json:"unassigned"`
+}
+
+// Movement moves some of one item location's stock into a bin. Quantity is
+// in Unit, or the item's base unit when Unit is empty.
+type Movement struct {
+	CompanyID  primitive.ObjectID
+	LocationID primitive.ObjectID
+	BinID      primitive.ObjectID
+	Quantity   float64
+	Unit       string
+	// WarehouseID, when set, only matches stock and bins in that warehouse
+	WarehouseID *primitive.ObjectID
+	UpdatedBy   primitive.ObjectID
+}
+
+// MoveResult is the stock location taken from and the one added to, and the
+// base units moved
+type MoveResult struct {
+	From     *models.ItemLocation `json:"from"`
+	To       *models.ItemLocation `json:"to"`
+	Quantity int                  `json:"quantity"`
+}
+
+// BinStock returns a warehouse's stock by bin; a bin restricts it to that bin
+func (s *Service) BinStock(ctx context.Context, companyID, warehouseID primitive.ObjectID, binID *primitive.ObjectID) (*Stock, error) {
+	if _, err := s.warehouses.Get(ctx, companyID, warehouseID); err != nil {
+		return nil, err
+	}
+
+	var bins []models.StorageLocation
+	if binID != nil {
+		bin, err := s.get(ctx, companyID, *binID, &warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		if bin.Kind != models.LocationBin {
+			return nil, ErrNotBin
+		}
+		bins = []models.StorageLocation{*bin}
+	} else {
+		locations, err := s.layout.List(ctx, companyID, warehouseID)
+		if err != nil {
+			return nil, err
+		}
+		for _, location := range locations {
+			if location.Kind == models.LocationBin {
+				bins = append(bins, location)
+			}
+		}
+	}
+
+	locations, err := s.items.WarehouseLocations(ctx, warehouseID, binID)
+	if err != nil {
+		return nil, err
+	}
+
+	stock := &Stock{WarehouseID: warehouseID, Bins: make([]BinStock, 0, len(bins)), Unassigned: []StockLine{}}
+	index := make(map[primitive.ObjectID]int, len(bins))
+	for i, bin := range bins {
+		index[bin.ID] = i
+		stock.Bins = append(stock.Bins, BinStock{BinID: bin.ID, Path: bin.Path, Capacity: bin.Capacity, Items: []StockLine{}})
+	}
+
+	items := map[primitive.ObjectID]*models.Item{}
+	for _, location := range locations {
+		if location.Quantity == 0 {
+			continue
+		}
+		item, ok := items[location.ItemID]
+		if !ok {
+			if item, err = s.items.Get(ctx, companyID, location.ItemID); err != nil && err != repository.ErrNotFound {
+				return nil, err
+			}
+			items[location.ItemID] = item
+		}
+		if item == nil {
+			continue
+		}
+
+		line := StockLine{
+			LocationID: location.ID,
+			ItemID:     item.ID,
+			SKU:        item.SKU,
+			Name:       item.Name,
+			Batch:      location.Batch,
+			Quantity:   location.Quantity,
+			Held:       location.Held,
+		}
+		if location.BinID == nil {
+			stock.Unassigned = append(stock.Unassigned, line)
+			continue
+		}
+		if i, ok := index[*location.BinID]; ok {
+			stock.Bins[i].Quantity += line.Quantity
+			stock.Bins[i].Items = append(stock.Bins[i].Items, line)
+		}
+	}
+	return stock, nil
+}
+
+// Putaway moves stock that is not yet in a bin into one
+func (s *Service) Putaway(ctx context.Context, movement Movement) (*MoveResult, error) {
+	return s.move(ctx, movement, false)
+}
+
+// Move moves stock from its bin into another bin of the same warehouse
+func (s *Service) Move(ctx context.Context, movement Movement) (*MoveResult, error) {
+	return s.move(ctx, movement, true)
+}
+
+func (s *Service) move(ctx context.Context, movement Movement, fromBin bool) (*MoveResult, error) {
+	if movement.Quantity <= 0 {
+		return nil, ErrInvalidQuantity
+	}
+
+	var result *MoveResult
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		from, err := s.items.Location(ctx, movement.LocationID)
+		if err == repository.ErrNotFound {
+			return ErrLocationNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if movement.WarehouseID != nil && from.WarehouseID != *movement.WarehouseID {
+			return ErrLocationNotFound
+		}
+		item, err := s.items.Get(ctx, movement.CompanyID, from.ItemID)
+		if err != nil {
+			if err == repository.ErrNotFound {
+				return ErrLocationNotFound
+			}
+			return err
+		}
+		quantity, err := uom.ToBase(item, movement.Quantity, movement.Unit)
+		if err != nil {
+			return err
+		}
+		if quantity <= 0 {
+			return ErrInvalidQuantity
+		}
+		switch {
+		case from.Held > 0 && quantity > from.Available():
+			return ErrOnHold
+		case fromBin && from.BinID == nil:
+			return ErrNotBinned
+		case !fromBin && from.BinID != nil:
+			return ErrAlreadyBinned
+		case from.BinID != nil && *from.BinID == movement.BinID:
+			return ErrSameBin
+		}
+
+		bin, err := s.layout.Get(ctx, movement.CompanyID, movement.BinID)
+		if err == repository.ErrNotFound {
+			return ErrBinNotFound
+		}
+		if err != nil {
+			return err
+		}
+		if bin.Kind != models.LocationBin {
+			return ErrNotBin
+		}
+		if bin.WarehouseID != from.WarehouseID {
+			return ErrOtherWarehouse
+		}
+
+		if bin.Capacity > 0 {
+			// Writing the bin first makes concurrent moves into it conflict,
+			// so two of them cannot both fit into the same free space
+			if _, err := s.layout.Update(ctx, movement.CompanyID, bin.ID, repository.LayoutUpdate{}); err != nil {
+				return err
+			}
+			held, err := s.binQuantity(ctx, bin)
+			if err != nil {
+				return err
+			}
+			if held+quantity > bin.Capacity {
+				return ErrOverCapacity
+			}
+		}
+
+		taken, err := s.items.AdjustQuantity(ctx, from.ItemID, from.ID, repository.QuantityChange{
+			Delta:       -quantity,
+			WarehouseID: &from.WarehouseID,
+			UpdatedBy:   movement.UpdatedBy,
+		})
+		if err != nil {
+			return err
+		}
+		to := &models.ItemLocation{
+			ItemID:      from.ItemID,
+			WarehouseID: from.WarehouseID,
+			Quantity:    quantity,
+			Batch:       from.Batch,
+			BinID:       &bin.ID,
+			UpdatedBy:   movement.UpdatedBy,
+		}
+		if err := s.items.AddToLocation(ctx, to); err != nil {
+			return err
+		}
+		result = &MoveResult{From: taken, To: to, Quantity: quantity}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
@@ -7,6 +7,13 @@ import (
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// AccessWindowStartHour is the first hour non-managers may use the system
+	AccessWindowStartHour = 8
+	// AccessWindowEndHour is the hour at which non-manager access closes
+	AccessWindowEndHour = 18
+)
+
 // TimeEnforcementMiddleware enforces 8AM-6PM access for non-managers
 func TimeEnforcementMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
@@ -20,7 +27,7 @@ func TimeEnforcementMiddleware() gin.HandlerFunc {
 		hour := now.Hour()
 
 		// 8:00 AM to 6:00 PM (18:00)
-		if hour < 8 || hour >= 18 {
+		if hour < AccessWindowStartHour || hour >= AccessWindowEndHour {
 			c.JSON(http.StatusForbidden, gin.H{
 				"error": "Access denied. System is only available between 8:00 AM and 6:00 PM.",
 			})
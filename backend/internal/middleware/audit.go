@@ -2,17 +2,142 @@ package middleware
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
+	"net/http"
 	"strings"
+	"time"
 
 	"github.com/a2sv/safeware/internal/audit"
 	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
-// AuditMiddleware intercepts requests and logs them
-func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
+const (
+	// RequestIDHeader carries the correlation ID for a request
+	RequestIDHeader = "X-Request-ID"
+	// maxLoggedBodySize caps how much of a request body is copied into the audit log
+	maxLoggedBodySize = 64 * 1024
+	redactedValue     = "[REDACTED]"
+)
+
+// DefaultRedactFields are body keys masked when no explicit list is configured.
+// Matching is case-insensitive on substrings, so "token" also covers "refresh_token".
+var DefaultRedactFields = []string{"password", "token", "secret", "authorization", "totp", "api_key"}
+
+// roleGroups are the top-level route groups that only express who is calling
+var roleGroups = map[string]bool{
+	"manager":    true,
+	"supervisor": true,
+	"staff":      true,
+	"auditor":    true,
+}
+
+// resourceSegments maps route template segments to audit resource types
+var resourceSegments = map[string]string{
+	"auth":            "USER",
+	"users":           "USER",
+	"item":            "ITEM",
+	"items":           "ITEM",
+	"warehouse":       "WAREHOUSE",
+	"warehouses":      "WAREHOUSE",
+	"staff":           "EMPLOYEE",
+	"supervisor":      "EMPLOYEE",
+	"auditor":         "EMPLOYEE",
+	"employees":       "EMPLOYEE",
+	"roles":           "ROLE",
+	"audit-logs":      "AUDIT_LOG",
+	"audit-retention": "RETENTION_POLICY",
+	"audit-archives":  "AUDIT_ARCHIVE",
+	"security-alerts": "SECURITY_ALERT",
+	"backups":         "BACKUP",
+	"data-export":     "COMPANY",
+	"reports":         "REPORT",
+	"valuation":       "VALUATION",
+	"layout":          "STORAGE_LOCATION",
+	"bins":            "BIN",
+	"stock":           "ITEM",
+	"labels":          "LABEL",
+	"scan":            "SCAN",
+	"category":        "CATEGORY",
+	"categories":      "CATEGORY",
+	"kit":             "KIT",
+	"kits":            "KIT",
+	"sku":             "SKU",
+	"quality":         "QUALITY_HOLD",
+}
+
+// idSegments name what an :id directly after them identifies, where that can
+// differ from the resource the route is classified under, as in
+// /items/warehouse/:id or /labels/item/:id
+var idSegments = map[string]string{
+	"warehouse": "WAREHOUSE",
+	"item":      "ITEM",
+	"bin":       "BIN",
+	"imports":   "IMPORT_JOB",
+	"holds":     "LEGAL_HOLD",
+}
+
+// actionSegments maps route template verbs to audit actions
+var actionSegments = map[string]string{
+	"login":    "LOGIN",
+	"logout":   "LOGOUT",
+	"register": "REGISTER",
+	"refresh":  "REFRESH",
+	"create":   "CREATE",
+	"add":      "CREATE",
+	"update":   "UPDATE",
+	"delete":   "DELETE",
+	"remove":   "DELETE",
+	"adjust":   "ADJUST",
+	"import":   "IMPORT",
+	"putaway":  "PUTAWAY",
+	"move":     "MOVE",
+	"resolve":  "RESOLVE",
+	"export":   "EXPORT",
+	"restore":  "RESTORE",
+	"purge":    "PURGE",
+	"reserve":  "RESERVE",
+	"hold":     "HOLD",
+	"inspect":  "INSPECT",
+	"release":  "RELEASE",
+	"scrap":    "SCRAP",
+	"return":   "RETURN",
+	"run":      "RUN",
+	"erase":    "ERASE",
+	// Kit builds
+	"assemble":    "ASSEMBLE",
+	"disassemble": "DISASSEMBLE",
+	// Exports are named after what they export
+	"data-export":   "EXPORT",
+	"personal-data": "EXPORT",
+}
+
+// AuditMiddleware intercepts requests and logs them.
+// Body fields whose names contain any of redactFields are masked before logging.
+func AuditMiddleware(auditService *audit.AuditService, redactFields []string) gin.HandlerFunc {
+	if len(redactFields) == 0 {
+		redactFields = DefaultRedactFields
+	}
+	fields := make([]string, 0, len(redactFields))
+	for _, field := range redactFields {
+		if field = strings.ToLower(strings.TrimSpace(field)); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
 	return func(c *gin.Context) {
+		start := time.Now()
+
+		// Correlate the request with its audit entry and the client
+		requestID := c.GetHeader(RequestIDHeader)
+		if requestID == "" {
+			requestID = uuid.New().String()
+		}
+		c.Set("request_id", requestID)
+		c.Writer.Header().Set(RequestIDHeader, requestID)
+
 		// Read body for logging (and restore it for handlers)
 		var bodyBytes []byte
 		if c.Request.Body != nil {
@@ -23,6 +148,8 @@ func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
 		// Process request
 		c.Next()
 
+		latency := time.Since(start)
+
 		// Extract info after request is processed
 		status := "SUCCESS"
 		if c.Writer.Status() >= 400 {
@@ -34,50 +161,26 @@ func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
 		companyIDStr := c.GetString("company_id")
 		email := c.GetString("email")
 
-		// Skip logging for unauthenticated requests (unless we want to log login failures, which is good practice)
-		// For MVP, we'll log if we have a user ID, or if it's a login/register attempt
 		path := c.Request.URL.Path
 		method := c.Request.Method
+		route := c.FullPath()
 
-		// Determine Action
-		action := method
-		if strings.Contains(path, "/login") {
-			action = "LOGIN"
-		} else if strings.Contains(path, "/register") {
-			action = "REGISTER"
-		} else if strings.Contains(path, "/logout") {
-			action = "LOGOUT"
-		} else {
-			// Map HTTP methods to actions
-			switch method {
-			case "POST":
-				action = "CREATE"
-			case "PUT", "PATCH":
-				action = "UPDATE"
-			case "DELETE":
-				action = "DELETE"
-			case "GET":
-				action = "READ"
-			}
-		}
-
-		// Determine Resource Type
-		resourceType := "API"
-		if strings.Contains(path, "/items") || strings.Contains(path, "/item") {
-			resourceType = "ITEM"
-		} else if strings.Contains(path, "/warehouses") || strings.Contains(path, "/warehouse") {
-			resourceType = "WAREHOUSE"
-		} else if strings.Contains(path, "/users") || strings.Contains(path, "/staff") || strings.Contains(path, "/supervisor") {
-			resourceType = "USER"
-		} else if strings.Contains(path, "/roles") {
-			resourceType = "ROLE"
-		}
+		resourceType, action := classifyRoute(route, method)
 
 		// Prepare details
 		details := map[string]interface{}{
-			"path":   path,
-			"method": method,
-			"status": c.Writer.Status(),
+			"path":       path,
+			"route":      route,
+			"method":     method,
+			"status":     c.Writer.Status(),
+			"request_id": requestID,
+			"latency_ms": latency.Milliseconds(),
+		}
+		if body := sanitizeBody(bodyBytes, c.ContentType(), fields); body != nil {
+			details["body"] = body
+		}
+		if c.GetBool("idempotent_replay") {
+			details["idempotent_replay"] = true
 		}
 
 		// Parse IDs
@@ -89,6 +192,15 @@ func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
 			companyObjID, _ = primitive.ObjectIDFromHex(companyIDStr)
 		}
 
+		// The :id is only recorded when it names the classified resource
+		// rather than a parent it is listed under
+		var resourceID *primitive.ObjectID
+		if idNamesResource(route, resourceType) {
+			if id, err := primitive.ObjectIDFromHex(c.Param("id")); err == nil {
+				resourceID = &id
+			}
+		}
+
 		// Log it
 		// If no user ID (e.g. failed login), we log with empty ID but capture IP/Email if possible
 		auditService.LogAction(
@@ -98,7 +210,7 @@ func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
 			email,
 			action,
 			resourceType,
-			nil, // Resource ID could be extracted from params if needed
+			resourceID,
 			details,
 			c.ClientIP(),
 			c.Request.UserAgent(),
@@ -106,3 +218,117 @@ func AuditMiddleware(auditService *audit.AuditService) gin.HandlerFunc {
 		)
 	}
 }
+
+// classifyRoute derives the resource type and action from a gin route template
+// such as /api/v1/supervisor/item/update/:id. Unmatched routes fall back to the
+// HTTP method and the generic API resource type.
+func classifyRoute(route, method string) (string, string) {
+	resourceType := "API"
+	action := ""
+
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	// Skip the /api/v1 prefix
+	if len(segments) >= 2 && segments[0] == "api" {
+		segments = segments[2:]
+	}
+	// The first segment of a role group names the caller, not the resource
+	if len(segments) > 1 && roleGroups[segments[0]] {
+		segments = segments[1:]
+	}
+
+	for _, segment := range segments {
+		if segment == "" || strings.HasPrefix(segment, ":") || strings.HasPrefix(segment, "*") {
+			continue
+		}
+		if rt, ok := resourceSegments[segment]; ok && resourceType == "API" {
+			resourceType = rt
+		}
+		if a, ok := actionSegments[segment]; ok && action == "" {
+			action = a
+		}
+	}
+
+	if action == "" {
+		switch method {
+		case http.MethodPost:
+			action = "CREATE"
+		case http.MethodPut, http.MethodPatch:
+			action = "UPDATE"
+		case http.MethodDelete:
+			action = "DELETE"
+		case http.MethodGet:
+			action = "READ"
+		default:
+			action = method
+		}
+	}
+
+	return resourceType, action
+}
+
+// idNamesResource reports whether the :id of a route template identifies a
+// resource of resourceType
+func idNamesResource(route, resourceType string) bool {
+	segments := strings.Split(strings.Trim(route, "/"), "/")
+	for i, segment := range segments {
+		if segment != ":id" {
+			continue
+		}
+		if i == 0 {
+			return true
+		}
+		named, ok := idSegments[segments[i-1]]
+		return !ok || named == resourceType
+	}
+	return false
+}
+
+// sanitizeBody decodes a JSON request body and masks sensitive fields.
+// Non-JSON bodies are summarized by size only.
+func sanitizeBody(body []byte, contentType string, redactFields []string) interface{} {
+	if len(body) == 0 {
+		return nil
+	}
+	if len(body) > maxLoggedBodySize || !strings.Contains(contentType, "json") {
+		return map[string]interface{}{"size": len(body), "content_type": contentType}
+	}
+
+	var decoded interface{}
+	if err := json.Unmarshal(body, &decoded); err != nil {
+		return map[string]interface{}{"size": len(body), "content_type": contentType}
+	}
+
+	return redact(decoded, redactFields)
+}
+
+// redact walks a decoded JSON value and replaces sensitive values in place
+func redact(value interface{}, redactFields []string) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, inner := range v {
+			if isSensitiveField(key, redactFields) {
+				v[key] = redactedValue
+				continue
+			}
+			v[key] = redact(inner, redactFields)
+		}
+		return v
+	case []interface{}:
+		for i, inner := range v {
+			v[i] = redact(inner, redactFields)
+		}
+		return v
+	default:
+		return v
+	}
+}
+
+func isSensitiveField(key string, redactFields []string) bool {
+	key = strings.ToLower(key)
+	for _, field := range redactFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestClassifyRouteResourceID(t *testing.T) {
+	cases := []struct {
+		route        string
+		method       string
+		resourceType string
+		action       string
+		hasID        bool
+	}{
+		{"/api/v1/manager/item/update/:id", http.MethodPut, "ITEM", "UPDATE", true},
+		{"/api/v1/supervisor/item/:id", http.MethodGet, "ITEM", "READ", true},
+		{"/api/v1/manager/items/warehouse/:id", http.MethodGet, "ITEM", "READ", false},
+		{"/api/v1/manager/items/imports/:id", http.MethodGet, "ITEM", "READ", false},
+		{"/api/v1/manager/labels/item/:id", http.MethodGet, "LABEL", "READ", false},
+		{"/api/v1/manager/labels/bin/:id", http.MethodGet, "LABEL", "READ", false},
+		{"/api/v1/manager/bins/stock/:id", http.MethodGet, "BIN", "READ", true},
+		{"/api/v1/manager/warehouse/delete/:id", http.MethodDelete, "WAREHOUSE", "DELETE", true},
+		{"/api/v1/manager/audit-retention/holds/:id", http.MethodDelete, "RETENTION_POLICY", "DELETE", false},
+		{"/api/v1/manager/employees/:id/erase", http.MethodPost, "EMPLOYEE", "ERASE", true},
+		{"/api/v1/manager/item/create", http.MethodPost, "ITEM", "CREATE", false},
+	}
+	for _, tc := range cases {
+		resourceType, action := classifyRoute(tc.route, tc.method)
+		if resourceType != tc.resourceType || action != tc.action {
+			t.Errorf("classifyRoute(%s) = %s %s, want %s %s", tc.route, resourceType, action, tc.resourceType, tc.action)
+		}
+		if got := idNamesResource(tc.route, resourceType); got != tc.hasID {
+			t.Errorf("idNamesResource(%s) = %v, want %v", tc.route, got, tc.hasID)
+		}
+	}
+}
@@ -0,0 +1,161 @@
+package middleware
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/a2sv/safeware/internal/idempotency"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	// IdempotencyKeyHeader carries the client-chosen key of a retryable write
+	IdempotencyKeyHeader = "Idempotency-Key"
+	// IdempotentReplayHeader marks a response served from the idempotency store
+	IdempotentReplayHeader = "Idempotent-Replayed"
+
+	maxIdempotencyKeyLength = 255
+	// maxStoredResponse caps the response bodies kept for replay
+	maxStoredResponse = 1 << 20
+)
+
+// replayedHeaders are restored along with the status and body of a stored response
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// IdempotencyMiddleware makes writes carrying an Idempotency-Key header safe
+// to retry. The first response per user and key is stored and replayed to
+// identical retries; reusing a key for a different request is rejected.
+// Only successes and validation errors are stored. Any other response, such
+// as a server error, a failed precondition or a conflict, releases the key so
+// the request can be retried for real. It must run after AuthMiddleware.
+func IdempotencyMiddleware(store *idempotency.Store) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		key := c.GetHeader(IdempotencyKeyHeader)
+		if key == "" || !isWrite(c.Request.Method) {
+			c.Next()
+			return
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Idempotency-Key must be at most 255 characters"})
+			c.Abort()
+			return
+		}
+
+		userID, _ := primitive.ObjectIDFromHex(c.GetString("user_id"))
+
+		var body []byte
+		if c.Request.Body != nil {
+			body, _ = io.ReadAll(c.Request.Body)
+			c.Request.Body = io.NopCloser(bytes.NewBuffer(body))
+		}
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.RequestURI() + "\n"))
+		hash.Write(body)
+		fingerprint := hex.EncodeToString(hash.Sum(nil))
+
+		record, err := store.Begin(c.Request.Context(), userID, key, fingerprint)
+		switch err {
+		case nil:
+		case idempotency.ErrMismatch:
+			c.JSON(http.StatusUnprocessableEntity, gin.H{"error": "Idempotency-Key was already used for a different request"})
+			c.Abort()
+			return
+		case idempotency.ErrInProgress:
+			c.JSON(http.StatusConflict, gin.H{"error": "A request with this Idempotency-Key is still being processed"})
+			c.Abort()
+			return
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check Idempotency-Key"})
+			c.Abort()
+			return
+		}
+
+		if record != nil {
+			c.Set("idempotent_replay", true)
+			for name, value := range record.Headers {
+				c.Header(name, value)
+			}
+			c.Header(IdempotentReplayHeader, "true")
+			c.Data(record.StatusCode, record.Headers["Content-Type"], record.Body)
+			c.Abort()
+			return
+		}
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+
+		// Store in the background context so a client disconnect cannot leave the key claimed
+		ctx := context.Background()
+		status := recorder.Status()
+		if !replayable(status) || recorder.overflow {
+			if err := store.Release(ctx, userID, key); err != nil {
+				log.Printf("Failed to release idempotency key: %v", err)
+			}
+			return
+		}
+
+		headers := map[string]string{}
+		for _, name := range replayedHeaders {
+			if value := recorder.Header().Get(name); value != "" {
+				headers[name] = value
+			}
+		}
+		if err := store.Complete(ctx, userID, key, status, headers, recorder.body.Bytes()); err != nil {
+			log.Printf("Failed to store idempotent response: %v", err)
+		}
+	}
+}
+
+// replayable reports whether a response depends only on the request, so an
+// identical retry must get it again. Auth failures, failed preconditions and
+// conflicts depend on state that can change before the retry.
+func replayable(status int) bool {
+	if status >= http.StatusOK && status < http.StatusMultipleChoices {
+		return true
+	}
+	return status == http.StatusBadRequest || status == http.StatusUnprocessableEntity
+}
+
+func isWrite(method string) bool {
+	switch method {
+	case http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// responseRecorder copies the response body as it is written
+type responseRecorder struct {
+	gin.ResponseWriter
+	body     bytes.Buffer
+	overflow bool
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.record(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.record([]byte(s))
+	return r.ResponseWriter.WriteString(s)
+}
+
+func (r *responseRecorder) record(data []byte) {
+	if r.overflow {
+		return
+	}
+	if r.body.Len()+len(data) > maxStoredResponse {
+		r.overflow = true
+		r.body.Reset()
+		return
+	}
+	r.body.Write(data)
+}
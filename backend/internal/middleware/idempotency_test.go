@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/idempotency"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// newIdempotentRouter serves POST /write with status, counting the calls that
+// reach the handler
+func newIdempotentRouter(status *int, calls *int) *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	store := idempotency.NewStore(repository.NewMemoryRepositories().Idempotency, 0)
+	userID := primitive.NewObjectID().Hex()
+
+	router := gin.New()
+	router.Use(func(c *gin.Context) {
+		c.Set("user_id", userID)
+		c.Next()
+	})
+	router.Use(IdempotencyMiddleware(store))
+	router.POST("/write", func(c *gin.Context) {
+		*calls++
+		c.Header("ETag", `"1"`)
+		c.JSON(*status, gin.H{"call": *calls})
+	})
+	return router
+}
+
+func send(router *gin.Engine, key, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/write", strings.NewReader(body))
+	req.Header.Set(IdempotencyKeyHeader, key)
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestIdempotencyReplaysSuccesses(t *testing.T) {
+	status, calls := http.StatusCreated, 0
+	router := newIdempotentRouter(&status, &calls)
+
+	first := send(router, "k1", `{"a":1}`)
+	second := send(router, "k1", `{"a":1}`)
+	if calls != 1 {
+		t.Fatalf("expected the handler to run once, ran %d times", calls)
+	}
+	if second.Code != http.StatusCreated || second.Body.String() != first.Body.String() {
+		t.Errorf("replay %d %s, want %d %s", second.Code, second.Body.String(), first.Code, first.Body.String())
+	}
+	if second.Header().Get(IdempotentReplayHeader) != "true" || second.Header().Get("ETag") != `"1"` {
+		t.Errorf("replay headers missing: %v", second.Header())
+	}
+
+	if w := send(router, "k1", `{"a":2}`); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("reused key: expected 422, got %d", w.Code)
+	}
+}
+
+func TestIdempotencyStoresValidationErrors(t *testing.T) {
+	status, calls := http.StatusBadRequest, 0
+	router := newIdempotentRouter(&status, &calls)
+
+	send(router, "k1", `{}`)
+	status = http.StatusOK
+	if w := send(router, "k1", `{}`); w.Code != http.StatusBadRequest || calls != 1 {
+		t.Errorf("expected the 400 to be replayed, got %d after %d calls", w.Code, calls)
+	}
+}
+
+func TestIdempotencyReleasesStateDependentFailures(t *testing.T) {
+	for _, failure := range []int{
+		http.StatusUnauthorized,
+		http.StatusForbidden,
+		http.StatusConflict,
+		http.StatusPreconditionFailed,
+		http.StatusInternalServerError,
+	} {
+		status, calls := failure, 0
+		router := newIdempotentRouter(&status, &calls)
+
+		send(router, "k1", `{}`)
+		status = http.StatusOK
+		if w := send(router, "k1", `{}`); w.Code != http.StatusOK || calls != 2 {
+			t.Errorf("after a %d: expected the retry to run, got %d after %d calls", failure, w.Code, calls)
+		}
+	}
+}
@@ -0,0 +1,633 @@
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// migrations is the ordered registry; append new versions, never renumber
+var migrations = []Migration{
+	{Version: 1, Description: "create query indexes", Up: createQueryIndexes},
+	{Version: 2, Description: "backfill timestamps and status flags", Up: backfillDefaults},
+	{Version: 3, Description: "create unique indexes on user email and company SKU", Up: createUniqueIndexes},
+	{Version: 4, Description: "add JSON schema validators", Up: addValidators},
+	{Version: 5, Description: "backfill document versions for optimistic concurrency", Up: backfillVersions},
+	{Version: 6, Description: "expire idempotency keys with a TTL index", Up: createIdempotencyTTLIndex},
+	{Version: 7, Description: "store prices in minor units and open cost layers for existing stock", Up: openCostLayers},
+	{Version: 8, Description: "start item price history from current prices", Up: startPriceHistory},
+	{Version: 9, Description: "index warehouse layouts and binned stock", Up: createLayoutIndexes},
+	{Version: 10, Description: "index item categories", Up: createCategoryIndexes},
+	{Version: 11, Description: "index kit bills of materials and builds", Up: createKitIndexes},
+	{Version: 12, Description: "date archived items and index them for the archive browser", Up: dateArchivedItems},
+	{Version: 13, Description: "make company SKUs unique regardless of case and index sequences", Up: createCaseInsensitiveSKUIndex},
+	{Version: 14, Description: "normalize item qualities and index quality holds", Up: normalizeQualities},
+}
+
+func createQueryIndexes(ctx context.Context, db *mongo.Database) error {
+	indexes := map[string][]mongo.IndexModel{
+		"users": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "role", Value: 1}}},
+			{Keys: bson.D{{Key: "warehouse_id", Value: 1}}},
+		},
+		"warehouses": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "is_active", Value: 1}}},
+			{Keys: bson.D{{Key: "supervisor_id", Value: 1}}},
+		},
+		"items": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "is_archived", Value: 1}}},
+		},
+		"item_locations": {
+			{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "warehouse_id", Value: 1}}},
+			{Keys: bson.D{{Key: "warehouse_id", Value: 1}}},
+		},
+		"transfers": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "status", Value: 1}}},
+		},
+		"sessions": {
+			{Keys: bson.D{{Key: "user_id", Value: 1}}},
+		},
+		"audit_logs": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "user_id", Value: 1}, {Key: "created_at", Value: -1}}},
+			{Keys: bson.D{{Key: "resource_id", Value: 1}}},
+		},
+		"security_alerts": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+		"backups": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "created_at", Value: -1}}},
+		},
+	}
+
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// backfillDefaults fills fields that older documents may lack, so that list
+// queries matching on them and the validators added later accept every document
+func backfillDefaults(ctx context.Context, db *mongo.Database) error {
+	type backfill struct {
+		collection string
+		filter     bson.M
+		update     interface{}
+	}
+	createdFromID := mongo.Pipeline{{{Key: "$set", Value: bson.M{"created_at": bson.M{"$toDate": "$_id"}}}}}
+	updatedFromCreated := mongo.Pipeline{{{Key: "$set", Value: bson.M{"updated_at": "$created_at"}}}}
+
+	backfills := []backfill{
+		{"items", bson.M{"is_archived": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"is_archived": false}}},
+		{"warehouses", bson.M{"is_active": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"is_active": true}}},
+		{"item_locations", bson.M{"quantity": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"quantity": 0}}},
+	}
+	for _, collection := range []string{"companies", "users", "warehouses", "items", "item_locations"} {
+		backfills = append(backfills,
+			backfill{collection, bson.M{"created_at": bson.M{"$exists": false}}, createdFromID},
+			backfill{collection, bson.M{"updated_at": bson.M{"$exists": false}}, updatedFromCreated},
+		)
+	}
+
+	for _, backfill := range backfills {
+		if _, err := db.Collection(backfill.collection).UpdateMany(ctx, backfill.filter, backfill.update); err != nil {
+			return fmt.Errorf("%s: %w", backfill.collection, err)
+		}
+	}
+	return nil
+}
+
+func createUniqueIndexes(ctx context.Context, db *mongo.Database) error {
+	unique := []struct {
+		collection string
+		keys       bson.D
+	}{
+		{"users", bson.D{{Key: "email", Value: 1}}},
+		{"items", bson.D{{Key: "company_id", Value: 1}, {Key: "sku", Value: 1}}},
+	}
+
+	for _, index := range unique {
+		// Report existing duplicates by value instead of the driver's first-collision error
+		duplicates, err := findDuplicates(ctx, db.Collection(index.collection), groupKeys(index.keys))
+		if err != nil {
+			return err
+		}
+		if len(duplicates) > 0 {
+			return fmt.Errorf("%s has duplicate values for a unique index, resolve them and re-run: %s",
+				index.collection, strings.Join(duplicates, "; "))
+		}
+
+		model := mongo.IndexModel{Keys: index.keys, Options: options.Index().SetUnique(true)}
+		if _, err := db.Collection(index.collection).Indexes().CreateOne(ctx, model); err != nil {
+			return fmt.Errorf("%s: %w", index.collection, err)
+		}
+	}
+	return nil
+}
+
+// groupKeys groups documents by the values of keys
+func groupKeys(keys bson.D) bson.M {
+	group := bson.M{}
+	for _, key := range keys {
+		group[key.Key] = "$" + key.Key
+	}
+	return group
+}
+
+// findDuplicates returns up to ten key combinations shared by several
+// documents, grouping them by the group expression
+func findDuplicates(ctx context.Context, collection *mongo.Collection, group bson.M) ([]string, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$group", Value: bson.M{"_id": group, "count": bson.M{"$sum": 1}}}},
+		{{Key: "$match", Value: bson.M{"count": bson.M{"$gt": 1}}}},
+		{{Key: "$limit", Value: 10}},
+	}
+	cursor, err := collection.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	var duplicates []string
+	for cursor.Next(ctx) {
+		var result struct {
+			ID    bson.M `bson:"_id"`
+			Count int    `bson:"count"`
+		}
+		if err := cursor.Decode(&result); err != nil {
+			return nil, err
+		}
+		duplicates = append(duplicates, fmt.Sprintf("%v (%d documents)", result.ID, result.Count))
+	}
+	return duplicates, cursor.Err()
+}
+
+var (
+	objectID = bson.M{"bsonType": "objectId"}
+	text     = bson.M{"bsonType": "string"}
+	nonEmpty = bson.M{"bsonType": "string", "minLength": 1}
+	flag     = bson.M{"bsonType": "bool"}
+	date     = bson.M{"bsonType": "date"}
+	number   = bson.M{"bsonType": bson.A{"int", "long", "double", "decimal"}}
+)
+
+// validators describe the fields every document must carry. Optional fields
+// are only typed, and additional fields are allowed.
+var validators = map[string]bson.M{
+	"users": {
+		"bsonType": "object",
+		"required": bson.A{"company_id", "email", "password_hash", "role", "created_at"},
+		"properties": bson.M{
+			"company_id":    objectID,
+			"email":         nonEmpty,
+			"password_hash": text,
+			"role":          bson.M{"enum": bson.A{"Manager", "Supervisor", "Staff", "Auditor"}},
+			"warehouse_id":  bson.M{"bsonType": bson.A{"objectId", "null"}},
+			"is_verified":   flag,
+			"created_at":    date,
+		},
+	},
+	"warehouses": {
+		"bsonType": "object",
+		"required": bson.A{"company_id", "name", "is_active", "created_at"},
+		"properties": bson.M{
+			"company_id":    objectID,
+			"name":          nonEmpty,
+			"location":      text,
+			"supervisor_id": bson.M{"bsonType": bson.A{"objectId", "null"}},
+			"is_active":     flag,
+			"created_at":    date,
+		},
+	},
+	"items": {
+		"bsonType": "object",
+		"required": bson.A{"company_id", "sku", "name", "is_archived", "created_at"},
+		"properties": bson.M{
+			"company_id":  objectID,
+			"sku":         nonEmpty,
+			"name":        nonEmpty,
+			"quality":     text,
+			"price":       number,
+			"is_archived": flag,
+			"created_at":  date,
+		},
+	},
+	"item_locations": {
+		"bsonType": "object",
+		"required": bson.A{"item_id", "warehouse_id", "quantity"},
+		"properties": bson.M{
+			"item_id":      objectID,
+			"warehouse_id": objectID,
+			"quantity":     bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0},
+		},
+	},
+}
+
+// addValidators attaches the validators with moderate validation, so writes
+// to documents that already violate them are not rejected
+func addValidators(ctx context.Context, db *mongo.Database) error {
+	for collection, schema := range validators {
+		if err := setValidator(ctx, db, collection, schema); err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// setValidator replaces a collection's validator, creating the collection if needed
+func setValidator(ctx context.Context, db *mongo.Database, collection string, schema bson.M) error {
+	validator := bson.M{"$jsonSchema": schema}
+	err := db.RunCommand(ctx, bson.D{
+		{Key: "collMod", Value: collection},
+		{Key: "validator", Value: validator},
+		{Key: "validationLevel", Value: "moderate"},
+		{Key: "validationAction", Value: "error"},
+	}).Err()
+
+	var cmdErr mongo.CommandError
+	if errors.As(err, &cmdErr) && cmdErr.Name == "NamespaceNotFound" {
+		return db.CreateCollection(ctx, collection, options.CreateCollection().
+			SetValidator(validator).
+			SetValidationLevel("moderate").
+			SetValidationAction("error"))
+	}
+	return err
+}
+
+// backfillVersions starts every document that predates versioning at version 0
+func backfillVersions(ctx context.Context, db *mongo.Database) error {
+	for _, collection := range []string{"warehouses", "items", "item_locations"} {
+		_, err := db.Collection(collection).UpdateMany(ctx,
+			bson.M{"version": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"version": 0}})
+		if err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+	return nil
+}
+
+// createIdempotencyTTLIndex lets MongoDB delete stored idempotent responses
+// once their expires_at has passed
+func createIdempotencyTTLIndex(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("idempotency_keys").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
+
+// openCostLayers converts item prices from major units to cents of USD, the
+// default currency, and values the stock already on hand at those prices so
+// that valuation starts from the current quantities
+func openCostLayers(ctx context.Context, db *mongo.Database) error {
+	// Items that already have a currency were written in minor units
+	_, err := db.Collection("items").UpdateMany(ctx,
+		bson.M{"currency": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{
+			"price":    bson.M{"$toLong": bson.M{"$round": bson.A{bson.M{"$multiply": bson.A{bson.M{"$ifNull": bson.A{"$price", 0}}, 100}}, 0}}},
+			"currency": "USD",
+		}}}},
+	)
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+
+	schema := bson.M{}
+	for key, value := range validators["items"] {
+		schema[key] = value
+	}
+	properties := bson.M{}
+	for key, value := range validators["items"]["properties"].(bson.M) {
+		properties[key] = value
+	}
+	properties["price"] = bson.M{"bsonType": bson.A{"int", "long"}, "minimum": 0}
+	properties["currency"] = bson.M{"bsonType": "string", "minLength": 3, "maxLength": 3}
+	schema["properties"] = properties
+	if err := setValidator(ctx, db, "items", schema); err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+
+	indexes := map[string][]mongo.IndexModel{
+		"cost_layers": {
+			{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "warehouse_id", Value: 1}, {Key: "received_at", Value: 1}}},
+			{Keys: bson.D{{Key: "company_id", Value: 1}}},
+		},
+		"cost_movements": {
+			{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "occurred_at", Value: 1}}},
+			{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "warehouse_id", Value: 1}}},
+		},
+	}
+	for collection, models := range indexes {
+		if _, err := db.Collection(collection).Indexes().CreateMany(ctx, models); err != nil {
+			return fmt.Errorf("%s: %w", collection, err)
+		}
+	}
+
+	// Sum stock per item and warehouse across batches
+	cursor, err := db.Collection("item_locations").Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"quantity": bson.M{"$gt": 0}}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"item_id": "$item_id", "warehouse_id": "$warehouse_id"},
+			"quantity": bson.M{"$sum": "$quantity"},
+		}}},
+		{{Key: "$lookup", Value: bson.M{"from": "items", "localField": "_id.item_id", "foreignField": "_id", "as": "item"}}},
+		{{Key: "$unwind", Value: "$item"}},
+	}, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return fmt.Errorf("item_locations: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	layers := db.Collection("cost_layers")
+	movements := db.Collection("cost_movements")
+	for cursor.Next(ctx) {
+		var stock struct {
+			ID struct {
+				ItemID      primitive.ObjectID `bson:"item_id"`
+				WarehouseID primitive.ObjectID `bson:"warehouse_id"`
+			} `bson:"_id"`
+			Quantity int `bson:"quantity"`
+			Item     struct {
+				CompanyID primitive.ObjectID `bson:"company_id"`
+				Price     int64              `bson:"price"`
+				Currency  string             `bson:"currency"`
+			} `bson:"item"`
+		}
+		if err := cursor.Decode(&stock); err != nil {
+			return err
+		}
+
+		// A re-run skips stock that was already opened
+		key := bson.M{"item_id": stock.ID.ItemID, "warehouse_id": stock.ID.WarehouseID}
+		if err := movements.FindOne(ctx, key).Err(); err == nil {
+			continue
+		} else if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		common := bson.M{
+			"company_id":   stock.Item.CompanyID,
+			"item_id":      stock.ID.ItemID,
+			"warehouse_id": stock.ID.WarehouseID,
+			"quantity":     stock.Quantity,
+			"unit_cost":    stock.Item.Price,
+			"currency":     stock.Item.Currency,
+			"source":       "opening",
+		}
+		layer := bson.M{"remaining": stock.Quantity, "received_at": now}
+		movement := bson.M{
+			"type":        "receipt",
+			"total_cost":  int64(stock.Quantity) * stock.Item.Price,
+			"method":      "fifo",
+			"occurred_at": now,
+		}
+		for key, value := range common {
+			layer[key] = value
+			movement[key] = value
+		}
+		if _, err := layers.InsertOne(ctx, layer); err != nil {
+			return fmt.Errorf("cost_layers: %w", err)
+		}
+		if _, err := movements.InsertOne(ctx, movement); err != nil {
+			return fmt.Errorf("cost_movements: %w", err)
+		}
+	}
+	return cursor.Err()
+}
+
+// startPriceHistory records each item's current price as in effect since the
+// item was created, and indexes the history for point-in-time lookups
+func startPriceHistory(ctx context.Context, db *mongo.Database) error {
+	prices := db.Collection("item_prices")
+	_, err := prices.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "item_id", Value: 1}, {Key: "effective_from", Value: 1}}},
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "effective_from", Value: 1}}},
+		{Keys: bson.D{{Key: "applied", Value: 1}, {Key: "effective_from", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("item_prices: %w", err)
+	}
+
+	cursor, err := db.Collection("items").Find(ctx, bson.M{})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	now := time.Now()
+	for cursor.Next(ctx) {
+		var item struct {
+			ID           primitive.ObjectID `bson:"_id"`
+			CompanyID    primitive.ObjectID `bson:"company_id"`
+			Price        int64              `bson:"price"`
+			StandardCost int64              `bson:"standard_cost"`
+			Currency     string             `bson:"currency"`
+			CreatedAt    time.Time          `bson:"created_at"`
+		}
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+
+		// A re-run skips items that already have history
+		if err := prices.FindOne(ctx, bson.M{"item_id": item.ID}).Err(); err == nil {
+			continue
+		} else if err != mongo.ErrNoDocuments {
+			return err
+		}
+
+		price := bson.M{
+			"company_id":     item.CompanyID,
+			"item_id":        item.ID,
+			"price":          item.Price,
+			"currency":       item.Currency,
+			"effective_from": item.CreatedAt,
+			"reason":         "Price before history was kept",
+			"applied":        true,
+			"created_at":     now,
+		}
+		if item.StandardCost > 0 {
+			price["standard_cost"] = item.StandardCost
+		}
+		if _, err := prices.InsertOne(ctx, price); err != nil {
+			return fmt.Errorf("item_prices: %w", err)
+		}
+	}
+	return cursor.Err()
+}
+
+// createLayoutIndexes keeps storage location codes unique among siblings and
+// indexes stock by bin. Existing stock has no bin and waits to be put away.
+func createLayoutIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("storage_locations").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{
+			Keys:    bson.D{{Key: "warehouse_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "code", Value: 1}},
+			Options: options.Index().SetUnique(true),
+		},
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "warehouse_id", Value: 1}, {Key: "path", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("storage_locations: %w", err)
+	}
+
+	_, err = db.Collection("item_locations").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "warehouse_id", Value: 1}, {Key: "bin_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("item_locations: %w", err)
+	}
+	return nil
+}
+
+// createCategoryIndexes keeps category names unique among siblings and
+// indexes items by category
+func createCategoryIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("categories").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "company_id", Value: 1}, {Key: "parent_id", Value: 1}, {Key: "name", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("categories: %w", err)
+	}
+
+	_, err = db.Collection("items").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "category_id", Value: 1}},
+	})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	return nil
+}
+
+// createKitIndexes allows one bill of materials per kit item and indexes
+// kit builds by kit
+func createKitIndexes(ctx context.Context, db *mongo.Database) error {
+	_, err := db.Collection("boms").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "company_id", Value: 1}, {Key: "kit_item_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("boms: %w", err)
+	}
+
+	_, err = db.Collection("kit_builds").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "kit_item_id", Value: 1}, {Key: "created_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("kit_builds: %w", err)
+	}
+	return nil
+}
+
+// dateArchivedItems dates items archived before archives were dated by
+// their last update, so the purge retention period applies to them too
+func dateArchivedItems(ctx context.Context, db *mongo.Database) error {
+	items := db.Collection("items")
+	_, err := items.UpdateMany(ctx,
+		bson.M{"is_archived": true, "archived_at": bson.M{"$exists": false}},
+		mongo.Pipeline{{{Key: "$set", Value: bson.M{"archived_at": bson.M{"$ifNull": bson.A{"$updated_at", "$created_at"}}}}}})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+
+	_, err = items.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "is_archived", Value: 1}, {Key: "archived_at", Value: -1}},
+	})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	return nil
+}
+
+// createCaseInsensitiveSKUIndex replaces the unique index on company and SKU
+// from migration 3 with one that ignores case, and makes sequence counters
+// unique per company
+func createCaseInsensitiveSKUIndex(ctx context.Context, db *mongo.Database) error {
+	items := db.Collection("items")
+	duplicates, err := findDuplicates(ctx, items, bson.M{"company_id": "$company_id", "sku": bson.M{"$toLower": "$sku"}})
+	if err != nil {
+		return err
+	}
+	if len(duplicates) > 0 {
+		return fmt.Errorf("items has SKUs that differ only by case, rename them and re-run: %s", strings.Join(duplicates, "; "))
+	}
+
+	_, err = items.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "sku", Value: 1}},
+		Options: options.Index().SetUnique(true).SetName("company_id_1_sku_1_ci").
+			SetCollation(&options.Collation{Locale: "en", Strength: 2}),
+	})
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	var cmdErr mongo.CommandError
+	if _, err := items.Indexes().DropOne(ctx, "company_id_1_sku_1"); err != nil &&
+		!(errors.As(err, &cmdErr) && cmdErr.Name == "IndexNotFound") {
+		return fmt.Errorf("items: %w", err)
+	}
+
+	_, err = db.Collection("sequences").Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "company_id", Value: 1}, {Key: "key", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return fmt.Errorf("sequences: %w", err)
+	}
+	return nil
+}
+
+// normalizeQualities rewrites item qualities that differ from the accepted
+// values only by case or surrounding spaces, and indexes quality holds by
+// status and by location
+func normalizeQualities(ctx context.Context, db *mongo.Database) error {
+	items := db.Collection("items")
+	for _, quality := range models.ItemQualities {
+		_, err := items.UpdateMany(ctx,
+			bson.M{"quality": bson.M{"$regex": "^\\s*" + quality + "\\s*$", "$options": "i", "$ne": quality}},
+			bson.M{"$set": bson.M{"quality": quality}})
+		if err != nil {
+			return fmt.Errorf("items: %w", err)
+		}
+	}
+
+	cursor, err := items.Find(ctx, bson.M{"quality": bson.M{"$nin": models.ItemQualities}},
+		options.Find().SetProjection(bson.M{"sku": 1, "quality": 1}).SetLimit(10))
+	if err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	var invalid []struct {
+		SKU     string      `bson:"sku"`
+		Quality interface{} `bson:"quality"`
+	}
+	if err := cursor.All(ctx, &invalid); err != nil {
+		return fmt.Errorf("items: %w", err)
+	}
+	if len(invalid) > 0 {
+		listed := make([]string, len(invalid))
+		for i, item := range invalid {
+			listed[i] = fmt.Sprintf("%s (%v)", item.SKU, item.Quality)
+		}
+		return fmt.Errorf("items have qualities other than %s, correct them and re-run: %s",
+			strings.Join(models.ItemQualities, ", "), strings.Join(listed, "; "))
+	}
+
+	_, err = db.Collection("quality_holds").Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "company_id", Value: 1}, {Key: "status", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "location_id", Value: 1}}},
+	})
+	if err != nil {
+		return fmt.Errorf("quality_holds: %w", err)
+	}
+	return nil
+}
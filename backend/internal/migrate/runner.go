@@ -0,0 +1,160 @@
+// Package migrate applies versioned MongoDB schema changes (indexes,
+// validators and data backfills) and records which versions have run.
+package migrate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// versionsCollection records applied migrations and holds the runner lock
+const versionsCollection = "schema_migrations"
+
+// lockTimeout lets a new runner take over the lock of one that crashed
+const lockTimeout = 10 * time.Minute
+
+var ErrLocked = errors.New("another migration run is in progress")
+
+// Migration is one schema change. Up must be safe to re-run after a partial
+// failure, since the version is only recorded once it succeeds.
+type Migration struct {
+	Version     int
+	Description string
+	Up          func(ctx context.Context, db *mongo.Database) error
+}
+
+// Status reports whether a migration has been applied
+type Status struct {
+	Version     int        `json:"version"`
+	Description string     `json:"description"`
+	AppliedAt   *time.Time `json:"applied_at,omitempty"`
+}
+
+type appliedVersion struct {
+	Version     int       `bson:"version"`
+	Description string    `bson:"description"`
+	AppliedAt   time.Time `bson:"applied_at"`
+	DurationMS  int64     `bson:"duration_ms"`
+}
+
+// Runner applies the registered migrations to a database
+type Runner struct {
+	db         *mongo.Database
+	migrations []Migration
+}
+
+func NewRunner(db *mongo.Database) *Runner {
+	return &Runner{db: db, migrations: migrations}
+}
+
+// Status lists every registered migration with its applied time, if any
+func (r *Runner) Status(ctx context.Context) ([]Status, error) {
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]Status, 0, len(r.migrations))
+	for _, m := range r.migrations {
+		status := Status{Version: m.Version, Description: m.Description}
+		if version, ok := applied[m.Version]; ok {
+			appliedAt := version.AppliedAt
+			status.AppliedAt = &appliedAt
+		}
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
+
+// Up applies pending migrations in version order and returns the ones it ran.
+// It stops at the first failure; earlier migrations stay recorded.
+func (r *Runner) Up(ctx context.Context) ([]Migration, error) {
+	if err := r.lock(ctx); err != nil {
+		return nil, err
+	}
+	defer r.unlock()
+
+	applied, err := r.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var ran []Migration
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+
+		start := time.Now()
+		if err := m.Up(ctx, r.db); err != nil {
+			return ran, fmt.Errorf("migration %d (%s): %w", m.Version, m.Description, err)
+		}
+		_, err := r.db.Collection(versionsCollection).InsertOne(ctx, appliedVersion{
+			Version:     m.Version,
+			Description: m.Description,
+			AppliedAt:   time.Now(),
+			DurationMS:  time.Since(start).Milliseconds(),
+		})
+		if err != nil {
+			return ran, fmt.Errorf("record migration %d: %w", m.Version, err)
+		}
+		log.Printf("Applied migration %d: %s", m.Version, m.Description)
+		ran = append(ran, m)
+	}
+	return ran, nil
+}
+
+func (r *Runner) applied(ctx context.Context) (map[int]appliedVersion, error) {
+	cursor, err := r.db.Collection(versionsCollection).Find(ctx, bson.M{"version": bson.M{"$exists": true}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	applied := map[int]appliedVersion{}
+	for cursor.Next(ctx) {
+		var version appliedVersion
+		if err := cursor.Decode(&version); err != nil {
+			return nil, err
+		}
+		applied[version.Version] = version
+	}
+	return applied, cursor.Err()
+}
+
+// lock takes the run lock. The upsert only inserts when the lock document is
+// missing, released or stale; otherwise the insert collides on _id.
+func (r *Runner) lock(ctx context.Context) error {
+	host, _ := os.Hostname()
+	now := time.Now()
+	_, err := r.db.Collection(versionsCollection).UpdateOne(ctx,
+		bson.M{"_id": "lock", "$or": bson.A{
+			bson.M{"locked": false},
+			bson.M{"locked_at": bson.M{"$lt": now.Add(-lockTimeout)}},
+		}},
+		bson.M{"$set": bson.M{"locked": true, "locked_at": now, "holder": fmt.Sprintf("%s:%d", host, os.Getpid())}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return ErrLocked
+	}
+	return err
+}
+
+func (r *Runner) unlock() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	_, err := r.db.Collection(versionsCollection).UpdateOne(ctx, bson.M{"_id": "lock"}, bson.M{"$set": bson.M{"locked": false}})
+	if err != nil {
+		log.Printf("Failed to release migration lock: %v", err)
+	}
+}
@@ -1,6 +1,7 @@
 package models
 
 import (
+	"strings"
 	"time"
 
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -16,37 +17,336 @@ type Warehouse struct {
 	IPWhitelist  []string               `bson:"ip_whitelist,omitempty" json:"ip_whitelist,omitempty"`
 	Attributes   map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"`
 	IsActive     bool                   `bson:"is_active" json:"is_active"`
+	Version      int64                  `bson:"version" json:"version"` // Incremented on every change, exposed as the ETag
 	CreatedAt    time.Time              `bson:"created_at" json:"created_at"`
 	UpdatedAt    time.Time              `bson:"updated_at" json:"updated_at"`
 }
 
+// Item qualities
+const (
+	QualityNew     = "New"
+	QualityUsed    = "Used"
+	QualityDamaged = "Damaged"
+)
+
+// ItemQualities are the accepted values of Item.Quality
+var ItemQualities = []string{QualityNew, QualityUsed, QualityDamaged}
+
+// NormalizeQuality returns the accepted quality matching value regardless of
+// case and surrounding spaces, or "" when there is none
+func NormalizeQuality(value string) string {
+	value = strings.TrimSpace(value)
+	for _, quality := range ItemQualities {
+		if strings.EqualFold(quality, value) {
+			return quality
+		}
+	}
+	return ""
+}
+
 // Item represents an inventory item
 type Item struct {
 	ID             primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
 	CompanyID      primitive.ObjectID     `bson:"company_id" json:"company_id"`
 	SKU            string                 `bson:"sku" json:"sku"`
 	Name           string                 `bson:"name" json:"name"`
-	Quality        string                 `bson:"quality" json:"quality"` // New, Used, Damaged
-	Price          float64                `bson:"price,omitempty" json:"price,omitempty"`
+	Quality        string                 `bson:"quality" json:"quality"`                                   // New, Used, Damaged
+	Price          int64                  `bson:"price" json:"price"`                                       // Minor units of Currency
+	Currency       string                 `bson:"currency,omitempty" json:"currency,omitempty"`             // Company currency when the price was set
+	StandardCost   int64                  `bson:"standard_cost,omitempty" json:"standard_cost,omitempty"`   // Minor units, used by standard costing
 	Classification string                 `bson:"classification,omitempty" json:"classification,omitempty"` // Deprecated
 	OwnerUserID    primitive.ObjectID     `bson:"owner_user_id,omitempty" json:"owner_user_id,omitempty"`
 	Department     string                 `bson:"department,omitempty" json:"department,omitempty"`
-	Attributes     map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"`
+	CategoryID     *primitive.ObjectID    `bson:"category_id,omitempty" json:"category_id,omitempty"`
+	Attributes     map[string]interface{} `bson:"attributes,omitempty" json:"attributes,omitempty"` // Checked against the category's schema
+	BaseUnit       string                 `bson:"base_unit,omitempty" json:"base_unit,omitempty"`   // Unit stock quantities are counted in; each when unset
+	Units          []UnitOfMeasure        `bson:"units,omitempty" json:"units,omitempty"`           // Other units quantities may be given in
 	IsArchived     bool                   `bson:"is_archived" json:"is_archived"`
+	ArchivedAt     *time.Time             `bson:"archived_at,omitempty" json:"archived_at,omitempty"`
+	ArchivedBy     *primitive.ObjectID    `bson:"archived_by,omitempty" json:"archived_by,omitempty"`
+	Version        int64                  `bson:"version" json:"version"` // Incremented on every change, exposed as the ETag
 	CreatedAt      time.Time              `bson:"created_at" json:"created_at"`
 	UpdatedAt      time.Time              `bson:"updated_at" json:"updated_at"`
 }
 
+// UnitOfMeasure is a unit an item is bought, issued or reported in, such as
+// an inner pack, case or pallet
+type UnitOfMeasure struct {
+	Name   string  `bson:"name" json:"name"`
+	Factor float64 `bson:"factor" json:"factor"` // Base units in one of this unit
+}
+
+// SKUPattern configures generated SKUs: the prefix, the department code and
+// a zero-padded sequence joined by Separator, e.g. ELC-TV-00042. A check
+// digit, when set, is computed over the sequence and appended to it.
+type SKUPattern struct {
+	Prefix          string            `bson:"prefix,omitempty" json:"prefix,omitempty"`
+	Separator       string            `bson:"separator" json:"separator"`
+	UseDepartment   bool              `bson:"use_department" json:"use_department"`
+	DepartmentCodes map[string]string `bson:"department_codes,omitempty" json:"department_codes,omitempty"` // Department name to code; others use their first letters
+	SequenceDigits  int               `bson:"sequence_digits" json:"sequence_digits"`
+	CheckDigit      string            `bson:"check_digit,omitempty" json:"check_digit,omitempty"` // luhn or gs1; none when empty
+}
+
+// Sequence is a per-company counter, such as the last SKU number generated
+// under one prefix
+type Sequence struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID primitive.ObjectID `bson:"company_id" json:"company_id"`
+	Key       string             `bson:"key" json:"key"`
+	Value     int64              `bson:"value" json:"value"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
 // ItemLocation tracks where items are stored
 type ItemLocation struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	ItemID      primitive.ObjectID  `bson:"item_id" json:"item_id"`
+	WarehouseID primitive.ObjectID  `bson:"warehouse_id" json:"warehouse_id"`
+	Quantity    int                 `bson:"quantity" json:"quantity"`             // In the item's base unit
+	Held        int                 `bson:"held,omitempty" json:"held,omitempty"` // Part of Quantity on quality hold
+	Batch       string              `bson:"batch,omitempty" json:"batch,omitempty"`
+	BinID       *primitive.ObjectID `bson:"bin_id,omitempty" json:"bin_id,omitempty"` // Unset until the stock is put away
+	UpdatedBy   primitive.ObjectID  `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	Version     int64               `bson:"version" json:"version"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Available is the location's stock that is not on quality hold
+func (l *ItemLocation) Available() int {
+	return l.Quantity - l.Held
+}
+
+// Quality hold statuses
+const (
+	HoldOpen     = "held"
+	HoldResolved = "resolved"
+)
+
+// Quality hold decisions
+const (
+	DecisionRelease = "release"
+	DecisionScrap   = "scrap"
+	DecisionReturn  = "return"
+)
+
+// QualityDecisions lists the accepted values of QualityDecision.Action
+var QualityDecisions = []string{DecisionRelease, DecisionScrap, DecisionReturn}
+
+// QualityInspection is one inspection of held stock
+type QualityInspection struct {
+	Notes       string             `bson:"notes" json:"notes"`
+	InspectedBy primitive.ObjectID `bson:"inspected_by" json:"inspected_by"`
+	InspectedAt time.Time          `bson:"inspected_at" json:"inspected_at"`
+}
+
+// QualityDecision settles some of a hold's stock: released back into
+// available stock, scrapped, or returned to the supplier
+type QualityDecision struct {
+	Action    string             `bson:"action" json:"action"` // release, scrap, return
+	Quantity  int                `bson:"quantity" json:"quantity"`
+	Notes     string             `bson:"notes,omitempty" json:"notes,omitempty"`
+	Supplier  string             `bson:"supplier,omitempty" json:"supplier,omitempty"`     // Returns only
+	Reference string             `bson:"reference,omitempty" json:"reference,omitempty"`   // Returns only, e.g. an RMA number
+	TotalCost int64              `bson:"total_cost,omitempty" json:"total_cost,omitempty"` // Value written off by scraps and returns
+	DecidedBy primitive.ObjectID `bson:"decided_by" json:"decided_by"`
+	DecidedAt time.Time          `bson:"decided_at" json:"decided_at"`
+}
+
+// QualityHold quarantines some of one item location's stock until it is
+// inspected and decided on. Remaining is what is still held; the hold is
+// resolved once decisions have settled all of it.
+type QualityHold struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID  `bson:"company_id" json:"company_id"`
+	ItemID      primitive.ObjectID  `bson:"item_id" json:"item_id"`
+	WarehouseID primitive.ObjectID  `bson:"warehouse_id" json:"warehouse_id"`
+	LocationID  primitive.ObjectID  `bson:"location_id" json:"location_id"`
+	Batch       string              `bson:"batch,omitempty" json:"batch,omitempty"`
+	Quantity    int                 `bson:"quantity" json:"quantity"` // Base units put on hold
+	Remaining   int                 `bson:"remaining" json:"remaining"`
+	Status      string              `bson:"status" json:"status"` // held, resolved
+	Reason      string              `bson:"reason" json:"reason"`
+	Notes       string              `bson:"notes,omitempty" json:"notes,omitempty"`
+	Inspections []QualityInspection `bson:"inspections" json:"inspections"`
+	Decisions   []QualityDecision   `bson:"decisions" json:"decisions"`
+	Currency    string              `bson:"currency,omitempty" json:"currency,omitempty"` // Of the decisions' costs
+	HeldBy      primitive.ObjectID  `bson:"held_by" json:"held_by"`
+	Version     int64               `bson:"version" json:"version"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// Attribute types
+const (
+	AttributeString = "string"
+	AttributeNumber = "number"
+	AttributeEnum   = "enum"
+	AttributeDate   = "date" // Stored as YYYY-MM-DD
+)
+
+// AttributeTypes lists the accepted values of AttributeDef.Type
+var AttributeTypes = []string{AttributeString, AttributeNumber, AttributeEnum, AttributeDate}
+
+// AttributeDef is one attribute of a category's schema
+type AttributeDef struct {
+	Key      string   `bson:"key" json:"key"`
+	Label    string   `bson:"label,omitempty" json:"label,omitempty"`
+	Type     string   `bson:"type" json:"type"`
+	Required bool     `bson:"required" json:"required"`
+	Unit     string   `bson:"unit,omitempty" json:"unit,omitempty"`       // Numbers only, e.g. kg
+	Options  []string `bson:"options,omitempty" json:"options,omitempty"` // Allowed values of enums
+}
+
+// Category groups items. A subcategory inherits the attributes of its
+// ancestors and may add its own.
+type Category struct {
+	ID         primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID  primitive.ObjectID  `bson:"company_id" json:"company_id"`
+	ParentID   *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"` // Unset for top-level categories
+	Name       string              `bson:"name" json:"name"`                               // Unique among its siblings
+	Attributes []AttributeDef      `bson:"attributes" json:"attributes"`
+	CreatedBy  primitive.ObjectID  `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt  time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// BOMComponent is an item that goes into a kit and how much of it, in the
+// component's base unit, one kit takes
+type BOMComponent struct {
+	ItemID   primitive.ObjectID `bson:"item_id" json:"item_id"`
+	Quantity int                `bson:"quantity" json:"quantity"`
+}
+
+// BOM is the bill of materials of a kit item. Each kit item has at most one.
+type BOM struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID  primitive.ObjectID `bson:"company_id" json:"company_id"`
+	KitItemID  primitive.ObjectID `bson:"kit_item_id" json:"kit_item_id"`
+	Components []BOMComponent     `bson:"components" json:"components"`
+	UpdatedBy  primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// Kit build types
+const (
+	BuildAssemble    = "assemble"
+	BuildDisassemble = "disassemble"
+)
+
+// KitBuildLine is the stock of one item a kit build took or added
+type KitBuildLine struct {
+	ItemID     primitive.ObjectID `bson:"item_id" json:"item_id"`
+	LocationID primitive.ObjectID `bson:"location_id" json:"location_id"`
+	Quantity   int                `bson:"quantity" json:"quantity"` // Negative when taken
+	TotalCost  int64              `bson:"total_cost" json:"total_cost"`
+}
+
+// KitBuild records one assembly or disassembly of kits at a warehouse
+type KitBuild struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID `bson:"company_id" json:"company_id"`
+	KitItemID   primitive.ObjectID `bson:"kit_item_id" json:"kit_item_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Type        string             `bson:"type" json:"type"`         // assemble, disassemble
+	Quantity    int                `bson:"quantity" json:"quantity"` // Kits built or taken apart
+	Lines       []KitBuildLine     `bson:"lines" json:"lines"`
+	Currency    string             `bson:"currency" json:"currency"`
+	CreatedBy   primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Storage location kinds, outermost first. Each kind sits inside the kind
+// before it, and only bins hold stock.
+const (
+	LocationZone  = "zone"
+	LocationAisle = "aisle"
+	LocationRack  = "rack"
+	LocationBin   = "bin"
+)
+
+// LocationKinds lists the storage location kinds, outermost first
+var LocationKinds = []string{LocationZone, LocationAisle, LocationRack, LocationBin}
+
+// StorageLocation is a zone, aisle, rack or bin inside a warehouse
+type StorageLocation struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID  `bson:"company_id" json:"company_id"`
+	WarehouseID primitive.ObjectID  `bson:"warehouse_id" json:"warehouse_id"`
+	ParentID    *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"` // Unset for zones
+	Kind        string              `bson:"kind" json:"kind"`
+	Code        string              `bson:"code" json:"code"` // Unique among its siblings
+	Path        string              `bson:"path" json:"path"` // Codes from the zone down, e.g. A-03-2-B
+	Name        string              `bson:"name,omitempty" json:"name,omitempty"`
+	Capacity    int                 `bson:"capacity,omitempty" json:"capacity,omitempty"` // Most units a bin may hold; 0 for no limit
+	CreatedBy   primitive.ObjectID  `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt   time.Time           `bson:"created_at" json:"created_at"`
+	UpdatedAt   time.Time           `bson:"updated_at" json:"updated_at"`
+}
+
+// ItemPrice is an item's price and standard cost over [EffectiveFrom,
+// EffectiveTo). The latest entry has no EffectiveTo. Entries dated in the
+// future are scheduled and become the item's price once Applied.
+type ItemPrice struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID     primitive.ObjectID `bson:"company_id" json:"company_id"`
+	ItemID        primitive.ObjectID `bson:"item_id" json:"item_id"`
+	Price         int64              `bson:"price" json:"price"` // Minor units of Currency
+	StandardCost  int64              `bson:"standard_cost,omitempty" json:"standard_cost,omitempty"`
+	Currency      string             `bson:"currency" json:"currency"`
+	EffectiveFrom time.Time          `bson:"effective_from" json:"effective_from"`
+	EffectiveTo   *time.Time         `bson:"effective_to,omitempty" json:"effective_to,omitempty"`
+	Reason        string             `bson:"reason,omitempty" json:"reason,omitempty"`
+	ChangedBy     primitive.ObjectID `bson:"changed_by,omitempty" json:"changed_by,omitempty"`
+	Applied       bool               `bson:"applied" json:"applied"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// CostLayer is the stock received into a warehouse at one unit cost.
+// Issues consume layers oldest first.
+type CostLayer struct {
 	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID `bson:"company_id" json:"company_id"`
 	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
 	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
 	Quantity    int                `bson:"quantity" json:"quantity"`
-	Batch       string             `bson:"batch,omitempty" json:"batch,omitempty"`
-	UpdatedBy   primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
-	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
-	UpdatedAt   time.Time          `bson:"updated_at" json:"updated_at"`
+	Remaining   int                `bson:"remaining" json:"remaining"`
+	UnitCost    int64              `bson:"unit_cost" json:"unit_cost"` // Minor units of Currency
+	Currency    string             `bson:"currency" json:"currency"`
+	Source      string             `bson:"source" json:"source"` // opening, create, adjust, import
+	CreatedBy   primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	ReceivedAt  time.Time          `bson:"received_at" json:"received_at"`
+}
+
+// Cost movement types
+const (
+	MovementReceipt = "receipt"
+	MovementIssue   = "issue"
+	// A revaluation changes the value of stock held without moving any, when
+	// the cost it will be issued at changes
+	MovementRevaluation = "revaluation"
+)
+
+// CostMovement values one receipt, issue or revaluation of stock. Summing
+// movements gives the quantity and value held at any point in time.
+type CostMovement struct {
+	ID          primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID `bson:"company_id" json:"company_id"`
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Type        string             `bson:"type" json:"type"` // receipt, issue, revaluation
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	UnitCost    int64              `bson:"unit_cost" json:"unit_cost"`                   // Actual cost for receipts, average issued cost for issues
+	TotalCost   int64              `bson:"total_cost" json:"total_cost"`                 // Value added by a receipt or revaluation, or removed by an issue
+	Variance    int64              `bson:"variance,omitempty" json:"variance,omitempty"` // Actual minus standard cost of a receipt under standard costing, or the value a revaluation adds
+	Currency    string             `bson:"currency" json:"currency"`
+	Method      string             `bson:"method" json:"method"`
+	Source      string             `bson:"source" json:"source"`
+	Note        string             `bson:"note,omitempty" json:"note,omitempty"` // Why the stock changed, e.g. a quality decision's notes
+	CreatedBy   primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	OccurredAt  time.Time          `bson:"occurred_at" json:"occurred_at"`
 }
 
 // Transfer represents an item transfer request
@@ -67,3 +367,38 @@ type Transfer struct {
 	CompletedAt     *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
 	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
 }
+
+// Import job statuses
+const (
+	ImportStatusRunning   = "running"
+	ImportStatusCompleted = "completed"
+	ImportStatusFailed    = "failed"
+)
+
+// ImportJob tracks a background bulk item import
+type ImportJob struct {
+	ID            primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID     primitive.ObjectID `bson:"company_id" json:"company_id"`
+	WarehouseID   primitive.ObjectID `bson:"warehouse_id,omitempty" json:"warehouse_id,omitempty"` // Default warehouse for rows without one
+	FileName      string             `bson:"file_name" json:"file_name"`
+	Status        string             `bson:"status" json:"status"` // running, completed, failed
+	TotalRows     int                `bson:"total_rows" json:"total_rows"`
+	ProcessedRows int                `bson:"processed_rows" json:"processed_rows"`
+	Created       int                `bson:"created" json:"created"`
+	Updated       int                `bson:"updated" json:"updated"`
+	Failed        int                `bson:"failed" json:"failed"`
+	Errors        []ImportRowError   `bson:"errors,omitempty" json:"errors,omitempty"`
+	Error         string             `bson:"error,omitempty" json:"error,omitempty"`
+	CreatedBy     primitive.ObjectID `bson:"created_by" json:"created_by"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+	CompletedAt   *time.Time         `bson:"completed_at,omitempty" json:"completed_at,omitempty"`
+	UpdatedAt     time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// ImportRowError reports a problem with one row of an import file. Rows are
+// numbered as in the file, with the header on row 1.
+type ImportRowError struct {
+	Row     int    `bson:"row" json:"row"`
+	Field   string `bson:"field,omitempty" json:"field,omitempty"`
+	Message string `bson:"message" json:"message"`
+}
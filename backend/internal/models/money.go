@@ -0,0 +1,92 @@
+package models
+
+import (
+	"errors"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is used by companies that have not chosen a currency
+const DefaultCurrency = "USD"
+
+// currencyExponents lists the ISO 4217 currencies accepted for prices and
+// costs, with the number of minor units per major unit as a power of ten
+var currencyExponents = map[string]int{
+	"AED": 2, "AUD": 2, "BHD": 3, "BRL": 2, "CAD": 2, "CHF": 2, "CNY": 2,
+	"CZK": 2, "DKK": 2, "EGP": 2, "ETB": 2, "EUR": 2, "GBP": 2, "GHS": 2,
+	"HKD": 2, "HUF": 2, "IDR": 2, "ILS": 2, "INR": 2, "JOD": 3, "JPY": 0,
+	"KES": 2, "KRW": 0, "KWD": 3, "MAD": 2, "MXN": 2, "NGN": 2, "NOK": 2,
+	"NZD": 2, "OMR": 3, "PHP": 2, "PKR": 2, "PLN": 2, "QAR": 2, "RWF": 0,
+	"SAR": 2, "SEK": 2, "SGD": 2, "THB": 2, "TND": 3, "TRY": 2, "TWD": 2,
+	"TZS": 2, "UGX": 0, "USD": 2, "VND": 0, "XAF": 0, "XOF": 0, "ZAR": 2,
+}
+
+var errInvalidAmount = errors.New("must be a non-negative amount")
+
+// ValidCurrency reports whether code is a supported ISO 4217 currency code
+func ValidCurrency(code string) bool {
+	_, ok := currencyExponents[code]
+	return ok
+}
+
+// CurrencyExponent returns the number of decimal places of a currency
+func CurrencyExponent(code string) int {
+	if exponent, ok := currencyExponents[code]; ok {
+		return exponent
+	}
+	return 2
+}
+
+// FormatMinor renders an amount in minor units as a decimal string, e.g.
+// 1250 USD as "12.50"
+func FormatMinor(amount int64, currency string) string {
+	exponent := CurrencyExponent(currency)
+	if exponent == 0 {
+		return strconv.FormatInt(amount, 10)
+	}
+	sign := ""
+	if amount < 0 {
+		sign = "-"
+		amount = -amount
+	}
+	scale := int64(math.Pow10(exponent))
+	return sign + strconv.FormatInt(amount/scale, 10) + "." + leftPad(strconv.FormatInt(amount%scale, 10), exponent)
+}
+
+// MajorUnits converts an amount in minor units to major units for display
+func MajorUnits(amount int64, currency string) float64 {
+	return float64(amount) / math.Pow10(CurrencyExponent(currency))
+}
+
+// ParseMinor parses a non-negative decimal amount in major units, such as
+// "12.5", into minor units. Amounts with more decimals than the currency has
+// are rejected rather than rounded.
+func ParseMinor(value, currency string) (int64, error) {
+	exponent := CurrencyExponent(currency)
+	whole, fraction, _ := strings.Cut(strings.TrimSpace(value), ".")
+	if whole == "" && fraction == "" || len(fraction) > exponent {
+		return 0, errInvalidAmount
+	}
+	if whole == "" {
+		whole = "0"
+	}
+	digits := whole + fraction + strings.Repeat("0", exponent-len(fraction))
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return 0, errInvalidAmount
+		}
+	}
+	amount, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return 0, errInvalidAmount
+	}
+	return amount, nil
+}
+
+func leftPad(s string, width int) string {
+	if len(s) >= width {
+		return s
+	}
+	return strings.Repeat("0", width-len(s)) + s
+}
@@ -42,10 +42,108 @@ type Backup struct {
 	CompanyID      primitive.ObjectID `bson:"company_id,omitempty" json:"company_id,omitempty"`
 	FilePath       string             `bson:"file_path" json:"file_path"`
 	FileSize       int64              `bson:"file_size,omitempty" json:"file_size,omitempty"`
-	BackupType     string             `bson:"backup_type" json:"backup_type"`
+	BackupType     string             `bson:"backup_type" json:"backup_type"` // company, full or pre_restore
 	Encrypted      bool               `bson:"encrypted" json:"encrypted"`
+	SHA256         string             `bson:"sha256,omitempty" json:"sha256,omitempty"`
+	RecordCount    int64              `bson:"record_count" json:"record_count"`
+	CreatedBy      primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
 	CreatedAt      time.Time          `bson:"created_at" json:"created_at"`
 	RetentionUntil time.Time          `bson:"retention_until" json:"retention_until"`
 	RestoredAt     *time.Time         `bson:"restored_at,omitempty" json:"restored_at,omitempty"`
 	Notes          string             `bson:"notes,omitempty" json:"notes,omitempty"`
 }
+
+// AuditRetentionPolicy controls how long a company's audit logs stay online
+type AuditRetentionPolicy struct {
+	ID              primitive.ObjectID `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID       primitive.ObjectID `bson:"company_id" json:"company_id"`
+	RetentionDays   int                `bson:"retention_days" json:"retention_days"` // 0 keeps logs forever
+	LegalHold       bool               `bson:"legal_hold" json:"legal_hold"`         // Company-wide hold blocks all archival
+	LegalHoldReason string             `bson:"legal_hold_reason,omitempty" json:"legal_hold_reason,omitempty"`
+	Holds           []LegalHold        `bson:"holds,omitempty" json:"holds,omitempty"`
+	LastRunAt       *time.Time         `bson:"last_run_at,omitempty" json:"last_run_at,omitempty"`
+	UpdatedBy       primitive.ObjectID `bson:"updated_by,omitempty" json:"updated_by,omitempty"`
+	CreatedAt       time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+// LegalHold preserves matching audit logs regardless of retention.
+// Empty fields widen the hold; a hold with no fields set covers every entry.
+type LegalHold struct {
+	ID         primitive.ObjectID `bson:"_id" json:"id"`
+	Reason     string             `bson:"reason" json:"reason"`
+	UserID     primitive.ObjectID `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	ResourceID primitive.ObjectID `bson:"resource_id,omitempty" json:"resource_id,omitempty"`
+	FromDate   *time.Time         `bson:"from_date,omitempty" json:"from_date,omitempty"`
+	ToDate     *time.Time         `bson:"to_date,omitempty" json:"to_date,omitempty"`
+	CreatedBy  primitive.ObjectID `bson:"created_by,omitempty" json:"created_by,omitempty"`
+	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Covers reports whether the hold preserves entry
+func (h LegalHold) Covers(entry AuditLog) bool {
+	switch {
+	case !h.UserID.IsZero() && entry.UserID != h.UserID:
+		return false
+	case !h.ResourceID.IsZero() && entry.ResourceID != h.ResourceID:
+		return false
+	case h.FromDate != nil && entry.CreatedAt.Before(*h.FromDate):
+		return false
+	case h.ToDate != nil && entry.CreatedAt.After(*h.ToDate):
+		return false
+	}
+	return true
+}
+
+// AuditArchive indexes an encrypted cold-storage file of archived audit logs
+type AuditArchive struct {
+	ID          primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID   primitive.ObjectID   `bson:"company_id" json:"company_id"`
+	FilePath    string               `bson:"file_path" json:"file_path"`
+	FileSize    int64                `bson:"file_size" json:"file_size"`
+	SHA256      string               `bson:"sha256" json:"sha256"`
+	RecordCount int                  `bson:"record_count" json:"record_count"`
+	FromDate    time.Time            `bson:"from_date" json:"from_date"`
+	ToDate      time.Time            `bson:"to_date" json:"to_date"`
+	Actions     []string             `bson:"actions,omitempty" json:"actions,omitempty"`
+	UserIDs     []primitive.ObjectID `bson:"user_ids,omitempty" json:"user_ids,omitempty"`
+	CreatedAt   time.Time            `bson:"created_at" json:"created_at"`
+	RestoredAt  *time.Time           `bson:"restored_at,omitempty" json:"restored_at,omitempty"`
+}
+
+// SecurityAlert is raised by the anomaly detector for suspicious audit activity
+type SecurityAlert struct {
+	ID             primitive.ObjectID   `bson:"_id,omitempty" json:"id,omitempty"`
+	CompanyID      primitive.ObjectID   `bson:"company_id" json:"company_id"`
+	Rule           string               `bson:"rule" json:"rule"`
+	Severity       string               `bson:"severity" json:"severity"` // low, medium, high, critical
+	Title          string               `bson:"title" json:"title"`
+	Description    string               `bson:"description" json:"description"`
+	UserID         primitive.ObjectID   `bson:"user_id,omitempty" json:"user_id,omitempty"`
+	Username       string               `bson:"username,omitempty" json:"username,omitempty"`
+	IPAddress      string               `bson:"ip_address,omitempty" json:"ip_address,omitempty"`
+	UserAgent      string               `bson:"user_agent,omitempty" json:"user_agent,omitempty"`
+	EventIDs       []primitive.ObjectID `bson:"event_ids,omitempty" json:"event_ids,omitempty"`
+	Count          int                  `bson:"count" json:"count"`
+	Status         string               `bson:"status" json:"status"` // open, acknowledged, resolved
+	ResolutionNote string               `bson:"resolution_note,omitempty" json:"resolution_note,omitempty"`
+	HandledBy      primitive.ObjectID   `bson:"handled_by,omitempty" json:"handled_by,omitempty"`
+	HandledAt      *time.Time           `bson:"handled_at,omitempty" json:"handled_at,omitempty"`
+	CreatedAt      time.Time            `bson:"created_at" json:"created_at"`
+	UpdatedAt      time.Time            `bson:"updated_at" json:"updated_at"`
+}
+
+// IdempotencyRecord stores the first response to a request made with an
+// Idempotency-Key, so retries of the same request can be answered from it
+type IdempotencyRecord struct {
+	ID          string             `bson:"_id" json:"id"` // user ID and key
+	UserID      primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Key         string             `bson:"key" json:"key"`
+	Fingerprint string             `bson:"fingerprint" json:"fingerprint"` // SHA-256 of method, URI and body
+	Completed   bool               `bson:"completed" json:"completed"`
+	StatusCode  int                `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Headers     map[string]string  `bson:"headers,omitempty" json:"headers,omitempty"`
+	Body        []byte             `bson:"body,omitempty" json:"-"`
+	CreatedAt   time.Time          `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time          `bson:"expires_at" json:"expires_at"` // TTL index
+}
@@ -8,12 +8,43 @@ import (
 
 // Company represents an organization using the system
 type Company struct {
-	ID        primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
-	Name      string                 `bson:"name" json:"name"`
-	Domain    string                 `bson:"domain,omitempty" json:"domain,omitempty"`
-	Settings  map[string]interface{} `bson:"settings,omitempty" json:"settings,omitempty"`
-	CreatedAt time.Time              `bson:"created_at" json:"created_at"`
-	UpdatedAt time.Time              `bson:"updated_at" json:"updated_at"`
+	ID              primitive.ObjectID     `bson:"_id,omitempty" json:"id,omitempty"`
+	Name            string                 `bson:"name" json:"name"`
+	Domain          string                 `bson:"domain,omitempty" json:"domain,omitempty"`
+	Settings        map[string]interface{} `bson:"settings,omitempty" json:"settings,omitempty"`
+	Currency        string                 `bson:"currency,omitempty" json:"currency,omitempty"`                 // ISO 4217 code of all prices and costs
+	ValuationMethod string                 `bson:"valuation_method,omitempty" json:"valuation_method,omitempty"` // fifo, average, standard
+	SKUPattern      *SKUPattern            `bson:"sku_pattern,omitempty" json:"sku_pattern,omitempty"`           // How item SKUs are generated
+	CreatedAt       time.Time              `bson:"created_at" json:"created_at"`
+	UpdatedAt       time.Time              `bson:"updated_at" json:"updated_at"`
+}
+
+// Inventory valuation methods
+const (
+	ValuationFIFO     = "fifo"
+	ValuationAverage  = "average"
+	ValuationStandard = "standard"
+)
+
+// ValidValuationMethod reports whether method is a supported valuation method
+func ValidValuationMethod(method string) bool {
+	return method == ValuationFIFO || method == ValuationAverage || method == ValuationStandard
+}
+
+// CurrencyCode returns the company currency, defaulting to USD
+func (c *Company) CurrencyCode() string {
+	if c.Currency == "" {
+		return DefaultCurrency
+	}
+	return c.Currency
+}
+
+// Valuation returns the company's valuation method, defaulting to FIFO
+func (c *Company) Valuation() string {
+	if c.ValuationMethod == "" {
+		return ValuationFIFO
+	}
+	return c.ValuationMethod
 }
 
 // User represents a system user
@@ -35,6 +66,7 @@ type User struct {
 	FailedLogins             int                    `bson:"failed_logins" json:"-"`
 	LockedUntil              *time.Time             `bson:"locked_until,omitempty" json:"-"`
 	LastLogin                *time.Time             `bson:"last_login,omitempty" json:"last_login,omitempty"`
+	ErasedAt                 *time.Time             `bson:"erased_at,omitempty" json:"erased_at,omitempty"` // Set when personal data was pseudonymized
 	CreatedAt                time.Time              `bson:"created_at" json:"created_at"`
 	UpdatedAt                time.Time              `bson:"updated_at" json:"updated_at"`
 	Role                     string                 `bson:"role" json:"role"` // Manager, Supervisor, Staff, Auditor
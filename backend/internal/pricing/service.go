@@ -0,0 +1,288 @@
+// Package pricing keeps the effective-dated price history of items. Every
+// price and standard cost change is kept with who made it and why, and
+// future-dated changes are applied to their items once they take effect.
+package pricing
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrNotFuture is returned when scheduling a price that takes effect now or earlier
+	ErrNotFuture = errors.New("effective_from must be in the future")
+	// ErrConflict is returned when another price takes effect at the same time
+	ErrConflict = errors.New("another price takes effect at that time")
+	// ErrApplied is returned when cancelling a price that has already taken effect
+	ErrApplied = errors.New("price has already taken effect")
+	// ErrNoPrice is returned for a time before the item's first price
+	ErrNoPrice = errors.New("item had no price at that time")
+)
+
+// Service records and schedules item prices
+type Service struct {
+	tx           repository.Transactor
+	items        repository.ItemRepository
+	prices       repository.PriceRepository
+	valuation    *valuation.Service
+	auditService *audit.AuditService
+}
+
+func NewService(tx repository.Transactor, items repository.ItemRepository, prices repository.PriceRepository, valuationService *valuation.Service, auditService *audit.AuditService) *Service {
+	return &Service{tx: tx, items: items, prices: prices, valuation: valuationService, auditService: auditService}
+}
+
+// Change is a future price of an item
+type Change struct {
+	Price int64
+	// StandardCost nil keeps the standard cost in effect before the change
+	StandardCost  *int64
+	EffectiveFrom time.Time
+	Reason        string
+	ChangedBy     primitive.ObjectID
+}
+
+// Record adds the item's price and standard cost to its history, effective
+// now. Call it in the same transaction as the write that set them; nothing
+// is recorded when they match the price already in effect.
+func (s *Service) Record(ctx context.Context, item *models.Item, reason string, changedBy primitive.ObjectID) error {
+	prices, err := s.prices.List(ctx, item.CompanyID, item.ID)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if current := effectiveAt(prices, now); current != nil && current.Price == item.Price && current.StandardCost == item.StandardCost {
+		return nil
+	}
+	return s.insert(ctx, prices, &models.ItemPrice{
+		CompanyID:     item.CompanyID,
+		ItemID:        item.ID,
+		Price:         item.Price,
+		StandardCost:  item.StandardCost,
+		Currency:      item.Currency,
+		EffectiveFrom: now,
+		Reason:        reason,
+		ChangedBy:     changedBy,
+		Applied:       true,
+	})
+}
+
+// Schedule adds a price that takes effect in the future
+func (s *Service) Schedule(ctx context.Context, companyID, itemID primitive.ObjectID, change Change) (*models.ItemPrice, error) {
+	if !change.EffectiveFrom.After(time.Now()) {
+		return nil, ErrNotFuture
+	}
+
+	var price *models.ItemPrice
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		item, err := s.items.Get(ctx, companyID, itemID)
+		if err != nil {
+			return err
+		}
+		prices, err := s.prices.List(ctx, companyID, itemID)
+		if err != nil {
+			return err
+		}
+
+		standardCost := item.StandardCost
+		if change.StandardCost != nil {
+			standardCost = *change.StandardCost
+		} else if before := effectiveAt(prices, change.EffectiveFrom); before != nil {
+			standardCost = before.StandardCost
+		}
+		price = &models.ItemPrice{
+			CompanyID:     companyID,
+			ItemID:        itemID,
+			Price:         change.Price,
+			StandardCost:  standardCost,
+			Currency:      item.Currency,
+			EffectiveFrom: change.EffectiveFrom,
+			Reason:        change.Reason,
+			ChangedBy:     change.ChangedBy,
+		}
+		return s.insert(ctx, prices, price)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// Cancel removes a scheduled price, extending the price before it
+func (s *Service) Cancel(ctx context.Context, companyID, itemID, priceID primitive.ObjectID) (*models.ItemPrice, error) {
+	var price *models.ItemPrice
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if price, err = s.prices.Get(ctx, companyID, priceID); err != nil {
+			return err
+		}
+		if price.ItemID != itemID {
+			return repository.ErrNotFound
+		}
+		if price.Applied {
+			return ErrApplied
+		}
+
+		prices, err := s.prices.List(ctx, companyID, itemID)
+		if err != nil {
+			return err
+		}
+		if before := effectiveAt(prices, price.EffectiveFrom.Add(-time.Nanosecond)); before != nil {
+			if err := s.prices.SetEffectiveTo(ctx, before.ID, price.EffectiveTo); err != nil {
+				return err
+			}
+		}
+		return s.prices.Delete(ctx, price.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return price, nil
+}
+
+// History returns an item's prices, earliest first, including scheduled ones
+func (s *Service) History(ctx context.Context, companyID, itemID primitive.ObjectID) ([]models.ItemPrice, error) {
+	if _, err := s.items.Get(ctx, companyID, itemID); err != nil {
+		return nil, err
+	}
+	return s.prices.List(ctx, companyID, itemID)
+}
+
+// PriceAt returns the item's price in effect at a time
+func (s *Service) PriceAt(ctx context.Context, companyID, itemID primitive.ObjectID, at time.Time) (*models.ItemPrice, error) {
+	prices, err := s.History(ctx, companyID, itemID)
+	if err != nil {
+		return nil, err
+	}
+	price := effectiveAt(prices, at)
+	if price == nil {
+		return nil, ErrNoPrice
+	}
+	return price, nil
+}
+
+// Effective returns the price in effect at a time of each of the company's
+// items, by item ID. Items without history are missing from it.
+func (s *Service) Effective(ctx context.Context, companyID primitive.ObjectID, at time.Time) (map[primitive.ObjectID]int64, error) {
+	prices, err := s.prices.Effective(ctx, companyID, at)
+	if err != nil {
+		return nil, err
+	}
+	byItem := make(map[primitive.ObjectID]int64, len(prices))
+	for _, price := range prices {
+		byItem[price.ItemID] = price.Price
+	}
+	return byItem, nil
+}
+
+// Start applies due prices every interval until ctx is cancelled
+func (s *Service) Start(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		interval = time.Minute
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.ApplyDue(ctx); err != nil {
+			log.Printf("Applying scheduled prices failed: %v", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyDue sets the price of items whose scheduled prices have taken effect
+// and revalues the stock they hold at the new cost
+func (s *Service) ApplyDue(ctx context.Context) error {
+	due, err := s.prices.Due(ctx, time.Now())
+	if err != nil {
+		return err
+	}
+	for _, price := range due {
+		err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+			// A price already replaced by a later change is history only
+			if price.EffectiveTo == nil || price.EffectiveTo.After(time.Now()) {
+				standardCost := price.StandardCost
+				item, err := s.items.Update(ctx, price.CompanyID, price.ItemID, repository.ItemUpdate{
+					Price:        &price.Price,
+					StandardCost: &standardCost,
+				})
+				switch {
+				case err == nil:
+					if err := s.valuation.Revalue(ctx, item, valuation.SourcePrice, price.ChangedBy); err != nil {
+						return err
+					}
+				// A deleted item keeps its history; there is nothing left to update
+				case err != repository.ErrNotFound:
+					return err
+				}
+			}
+			return s.prices.MarkApplied(ctx, price.ID)
+		})
+		if err != nil {
+			return err
+		}
+
+		s.auditService.LogAction(ctx, price.ChangedBy, price.CompanyID, "system", "UPDATE", "ITEM", &price.ItemID,
+			map[string]interface{}{
+				"price_id":       price.ID,
+				"price":          price.Price,
+				"standard_cost":  price.StandardCost,
+				"effective_from": price.EffectiveFrom,
+				"reason":         price.Reason,
+				"scheduled":      true,
+			}, "", "", "SUCCESS")
+	}
+	return nil
+}
+
+// insert adds a price to an item's timeline: the price before it now ends
+// where it starts, and it ends where the next price starts
+func (s *Service) insert(ctx context.Context, prices []models.ItemPrice, price *models.ItemPrice) error {
+	var next *time.Time
+	for _, existing := range prices {
+		switch {
+		case existing.EffectiveFrom.Equal(price.EffectiveFrom):
+			return ErrConflict
+		case existing.EffectiveFrom.Before(price.EffectiveFrom):
+			if existing.EffectiveTo == nil || existing.EffectiveTo.After(price.EffectiveFrom) {
+				if err := s.prices.SetEffectiveTo(ctx, existing.ID, &price.EffectiveFrom); err != nil {
+					return err
+				}
+			}
+		case next == nil:
+			from := existing.EffectiveFrom
+			next = &from
+		}
+	}
+	price.EffectiveTo = next
+	price.CreatedAt = time.Now()
+	return s.prices.Add(ctx, price)
+}
+
+// effectiveAt returns the price in effect at a time from prices sorted
+// earliest first
+func effectiveAt(prices []models.ItemPrice, at time.Time) *models.ItemPrice {
+	var found *models.ItemPrice
+	for i := range prices {
+		if prices[i].EffectiveFrom.After(at) {
+			break
+		}
+		found = &prices[i]
+	}
+	return found
+}
@@ -0,0 +1,428 @@
+package privacy
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// minIdentifierLength skips identifiers too short to replace safely inside free text
+const minIdentifierLength = 3
+
+var (
+	ErrCompanyNotFound = errors.New("company not found")
+	ErrUserNotFound    = errors.New("user not found")
+	ErrAlreadyErased   = errors.New("user has already been erased")
+)
+
+// Service produces tenant and personal data exports and pseudonymizes departed
+// users. Exports copy whole collections as raw documents, so they read db
+// directly; erasure goes through the repositories.
+type Service struct {
+	auditService *audit.AuditService
+	exporter     *audit.Exporter
+	tx           repository.Transactor
+	users        repository.UserRepository
+	alerts       repository.AlertRepository
+	db           *mongo.Database
+}
+
+func NewService(auditService *audit.AuditService, exporter *audit.Exporter, tx repository.Transactor, users repository.UserRepository, alerts repository.AlertRepository, db *mongo.Database) *Service {
+	return &Service{auditService: auditService, exporter: exporter, tx: tx, users: users, alerts: alerts, db: db}
+}
+
+// ExportFile describes one data file in a company export
+type ExportFile struct {
+	Name        string `json:"name"`
+	RecordCount int64  `json:"record_count"`
+	SHA256      string `json:"sha256"`
+}
+
+// ExportManifest is written as manifest.json and signed like audit exports
+type ExportManifest struct {
+	CompanyID     string       `json:"company_id"`
+	CompanyName   string       `json:"company_name"`
+	Files         []ExportFile `json:"files"`
+	GeneratedAt   time.Time    `json:"generated_at"`
+	GeneratedBy   string       `json:"generated_by"`
+	SignAlgorithm string       `json:"sign_algorithm"`
+}
+
+// exportSpec selects one collection into a JSON Lines file. Documents are decoded
+// into their model first, so fields hidden from the API (password hashes, TOTP
+// secrets, reset tokens) never reach the archive.
+type exportSpec struct {
+	file       string
+	collection string
+	newDoc     func() interface{}
+}
+
+var companyExports = []exportSpec{
+	{"users.jsonl", "users", func() interface{} { return &models.User{} }},
+	{"warehouses.jsonl", "warehouses", func() interface{} { return &models.Warehouse{} }},
+	{"items.jsonl", "items", func() interface{} { return &models.Item{} }},
+	{"item_locations.jsonl", "item_locations", func() interface{} { return &models.ItemLocation{} }},
+	{"transfers.jsonl", "transfers", func() interface{} { return &models.Transfer{} }},
+}
+
+// ExportCompany writes a zip archive of the company's users, warehouses, items,
+// item locations, transfers and decrypted audit logs, with a signed manifest
+func (s *Service) ExportCompany(ctx context.Context, w io.Writer, companyID primitive.ObjectID, generatedBy string) (*ExportManifest, error) {
+	var company models.Company
+	if err := s.db.Collection("companies").FindOne(ctx, bson.M{"_id": companyID}).Decode(&company); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return nil, ErrCompanyNotFound
+		}
+		return nil, err
+	}
+
+	archive := zip.NewWriter(w)
+	manifest := &ExportManifest{
+		CompanyID:     companyID.Hex(),
+		CompanyName:   company.Name,
+		GeneratedAt:   time.Now().UTC(),
+		GeneratedBy:   generatedBy,
+		SignAlgorithm: "Ed25519",
+	}
+
+	companyBytes, err := json.MarshalIndent(company, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(archive, "company.json", companyBytes); err != nil {
+		return nil, err
+	}
+
+	itemIDs, err := s.companyItemIDs(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, spec := range companyExports {
+		filter := bson.M{"company_id": companyID}
+		if spec.collection == "item_locations" {
+			filter = bson.M{"item_id": bson.M{"$in": itemIDs}}
+		}
+
+		file, err := s.exportCollection(ctx, archive, spec, filter)
+		if err != nil {
+			return nil, fmt.Errorf("exporting %s: %w", spec.collection, err)
+		}
+		manifest.Files = append(manifest.Files, *file)
+	}
+
+	file, err := s.exportAuditLogs(ctx, archive, companyID)
+	if err != nil {
+		return nil, fmt.Errorf("exporting audit_logs: %w", err)
+	}
+	manifest.Files = append(manifest.Files, *file)
+
+	manifestBytes, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeZipFile(archive, "manifest.json", manifestBytes); err != nil {
+		return nil, err
+	}
+	signature := base64.StdEncoding.EncodeToString(s.exporter.Sign(manifestBytes))
+	if err := writeZipFile(archive, "manifest.sig", []byte(signature)); err != nil {
+		return nil, err
+	}
+
+	return manifest, archive.Close()
+}
+
+func (s *Service) exportCollection(ctx context.Context, archive *zip.Writer, spec exportSpec, filter bson.M) (*ExportFile, error) {
+	cursor, err := s.db.Collection(spec.collection).Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	out, hasher, err := createHashed(archive, spec.file)
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ExportFile{Name: spec.file}
+	for cursor.Next(ctx) {
+		doc := spec.newDoc()
+		if err := cursor.Decode(doc); err != nil {
+			return nil, err
+		}
+		if err := writeJSONLine(out, doc); err != nil {
+			return nil, err
+		}
+		file.RecordCount++
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	file.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return file, nil
+}
+
+func (s *Service) exportAuditLogs(ctx context.Context, archive *zip.Writer, companyID primitive.ObjectID) (*ExportFile, error) {
+	out, hasher, err := createHashed(archive, "audit_logs.jsonl")
+	if err != nil {
+		return nil, err
+	}
+
+	file := &ExportFile{Name: "audit_logs.jsonl"}
+	err = s.auditService.EachLog(ctx, companyID, nil, func(entry map[string]interface{}) error {
+		file.RecordCount++
+		return writeJSONLine(out, entry)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	file.SHA256 = hex.EncodeToString(hasher.Sum(nil))
+	return file, nil
+}
+
+// PersonalDataReport gathers everything stored about one user
+type PersonalDataReport struct {
+	UserID               primitive.ObjectID       `json:"user_id"`
+	GeneratedAt          time.Time                `json:"generated_at"`
+	Profile              *models.User             `json:"profile"`
+	Sessions             []models.Session         `json:"sessions"`
+	Transfers            []models.Transfer        `json:"transfers"`
+	OwnedItems           []models.Item            `json:"owned_items"`
+	SupervisedWarehouses []models.Warehouse       `json:"supervised_warehouses"`
+	AccessGrants         []models.DACGrant        `json:"access_grants"`
+	SecurityAlerts       []models.SecurityAlert   `json:"security_alerts"`
+	AuditLogs            []map[string]interface{} `json:"audit_logs"`
+}
+
+// PersonalData builds the report for a current or former user of the company
+func (s *Service) PersonalData(ctx context.Context, companyID, userID primitive.ObjectID) (*PersonalDataReport, error) {
+	report := &PersonalDataReport{
+		UserID:               userID,
+		GeneratedAt:          time.Now().UTC(),
+		Sessions:             []models.Session{},
+		Transfers:            []models.Transfer{},
+		OwnedItems:           []models.Item{},
+		SupervisedWarehouses: []models.Warehouse{},
+		AccessGrants:         []models.DACGrant{},
+		SecurityAlerts:       []models.SecurityAlert{},
+		AuditLogs:            []map[string]interface{}{},
+	}
+
+	var user models.User
+	err := s.db.Collection("users").FindOne(ctx, bson.M{"_id": userID, "company_id": companyID}).Decode(&user)
+	switch {
+	case err == nil:
+		report.Profile = &user
+	case err != mongo.ErrNoDocuments:
+		return nil, err
+	}
+
+	// Former users are found through the audit trail they left behind
+	err = s.auditService.EachLog(ctx, companyID, map[string]interface{}{"user_id": userID.Hex()}, func(entry map[string]interface{}) error {
+		report.AuditLogs = append(report.AuditLogs, entry)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if report.Profile == nil && len(report.AuditLogs) == 0 {
+		return nil, ErrUserNotFound
+	}
+
+	queries := []struct {
+		collection string
+		filter     bson.M
+		out        interface{}
+	}{
+		{"sessions", bson.M{"user_id": userID}, &report.Sessions},
+		{"transfers", bson.M{"company_id": companyID, "$or": bson.A{bson.M{"requested_by": userID}, bson.M{"approved_by": userID}}}, &report.Transfers},
+		{"items", bson.M{"company_id": companyID, "owner_user_id": userID}, &report.OwnedItems},
+		{"warehouses", bson.M{"company_id": companyID, "supervisor_id": userID}, &report.SupervisedWarehouses},
+		{"dac_grants", bson.M{"company_id": companyID, "$or": bson.A{bson.M{"owner_user_id": userID}, bson.M{"target_user_id": userID}}}, &report.AccessGrants},
+		{"security_alerts", bson.M{"company_id": companyID, "user_id": userID}, &report.SecurityAlerts},
+	}
+	for _, q := range queries {
+		cursor, err := s.db.Collection(q.collection).Find(ctx, q.filter)
+		if err != nil {
+			return nil, err
+		}
+		if err := cursor.All(ctx, q.out); err != nil {
+			return nil, err
+		}
+	}
+
+	return report, nil
+}
+
+// ErasureResult summarizes what an erasure changed
+type ErasureResult struct {
+	UserID           primitive.ObjectID `json:"user_id"`
+	Alias            string             `json:"alias"`
+	ProfileErased    bool               `json:"profile_erased"`
+	SessionsRevoked  int64              `json:"sessions_revoked"`
+	AuditLogsUpdated int64              `json:"audit_logs_updated"`
+	AlertsUpdated    int64              `json:"alerts_updated"`
+}
+
+// EraseUser pseudonymizes a departed user's name and email. The user document, if
+// it still exists, keeps its ID and role but loses its credentials and contact
+// details; audit entries keep every field except the identifiers, which are
+// replaced with a stable alias derived from the user ID. Everything is changed
+// in one transaction, so a failure leaves the user as they were.
+func (s *Service) EraseUser(ctx context.Context, companyID, userID primitive.ObjectID) (*ErasureResult, error) {
+	aliasName := "Erased User " + userID.Hex()[len(userID.Hex())-6:]
+	aliasEmail := "erased-" + userID.Hex() + "@erased.invalid"
+
+	var result *ErasureResult
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		result = &ErasureResult{UserID: userID, Alias: aliasEmail}
+
+		aliases := map[string]string{}
+		addAlias := func(identifier, alias string) {
+			identifier = strings.TrimSpace(identifier)
+			if len(identifier) >= minIdentifierLength && identifier != alias {
+				aliases[identifier] = alias
+			}
+		}
+
+		user, err := s.users.Get(ctx, companyID, userID)
+		profileExists := err == nil
+		if err != nil && err != repository.ErrNotFound {
+			return err
+		}
+		if profileExists {
+			if user.ErasedAt != nil {
+				return ErrAlreadyErased
+			}
+			addAlias(user.Email, aliasEmail)
+			addAlias(user.FullName, aliasName)
+			addAlias(user.Phone, "[erased]")
+		}
+
+		// Audit entries record the email the user signed in with at the time
+		usernames, err := s.auditService.Usernames(ctx, companyID, userID)
+		if err != nil {
+			return err
+		}
+		for _, username := range usernames {
+			if username != "system" {
+				addAlias(username, aliasEmail)
+			}
+		}
+		if !profileExists && len(usernames) == 0 {
+			return ErrUserNotFound
+		}
+
+		if profileExists {
+			if err := s.users.Erase(ctx, userID, aliasName, aliasEmail, time.Now()); err != nil {
+				return err
+			}
+			result.ProfileErased = true
+		}
+
+		if result.SessionsRevoked, err = s.users.DeleteSessions(ctx, userID); err != nil {
+			return err
+		}
+		if result.AuditLogsUpdated, err = s.auditService.Pseudonymize(ctx, companyID, userID, aliases, aliasEmail); err != nil {
+			return err
+		}
+		result.AlertsUpdated, err = s.pseudonymizeAlerts(ctx, companyID, userID, aliases, aliasEmail)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return result, nil
+}
+
+// pseudonymizeAlerts rewrites identifiers in security alerts raised about the user
+func (s *Service) pseudonymizeAlerts(ctx context.Context, companyID, userID primitive.ObjectID, aliases map[string]string, usernameAlias string) (int64, error) {
+	alerts, err := s.alerts.List(ctx, companyID, repository.AlertFilter{UserID: userID}, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	var updated int64
+	for _, alert := range alerts {
+		title, description := alert.Title, alert.Description
+		for identifier, alias := range aliases {
+			title = strings.ReplaceAll(title, identifier, alias)
+			description = strings.ReplaceAll(description, identifier, alias)
+		}
+		update := repository.AlertUpdate{Username: &usernameAlias, Title: &title, Description: &description}
+		if err := s.alerts.Update(ctx, companyID, alert.ID, update); err != nil {
+			return updated, err
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// companyItemIDs lists the IDs scoping the item locations of a company export
+func (s *Service) companyItemIDs(ctx context.Context, companyID primitive.ObjectID) ([]primitive.ObjectID, error) {
+	cursor, err := s.db.Collection("items").Find(ctx, bson.M{"company_id": companyID},
+		options.Find().SetProjection(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+// createHashed starts a zip entry whose content is also fed into a SHA-256
+func createHashed(archive *zip.Writer, name string) (io.Writer, hash.Hash, error) {
+	entry, err := archive.Create(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	hasher := sha256.New()
+	return io.MultiWriter(entry, hasher), hasher, nil
+}
+
+func writeJSONLine(w io.Writer, v interface{}) error {
+	line, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+func writeZipFile(archive *zip.Writer, name string, data []byte) error {
+	f, err := archive.Create(name)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	return err
+}
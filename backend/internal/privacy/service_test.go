@@ -0,0 +1,79 @@
+package privacy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/audit"
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestEraseUser(t *testing.T) {
+	repos := repository.NewMemoryRepositories()
+	ctx := context.Background()
+	companyID := primitive.NewObjectID()
+
+	auditService := audit.NewAuditService("test-key", repos.Audit)
+	defer auditService.Close()
+	service := NewService(auditService, nil, repos.Tx, repos.Users, repos.Alerts, nil)
+
+	user := &models.User{CompanyID: companyID, FullName: "Ana Bekele", Email: "ana@example.com", Phone: "+251911000000", PasswordHash: "hash", Role: "Staff"}
+	if err := repos.Users.Create(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	// Entries are written in the background; closing a service waits for them
+	writer := audit.NewAuditService("test-key", repos.Audit)
+	writer.LogAction(ctx, user.ID, companyID, "ana@example.com", "LOGIN", "USER", nil, map[string]interface{}{"note": "Ana Bekele signed in"}, "", "", "SUCCESS")
+	writer.Close()
+	alert := &models.SecurityAlert{CompanyID: companyID, UserID: user.ID, Username: "ana@example.com", Title: "Login from new IP address", Description: "ana@example.com logged in from previously unseen IP 10.0.0.1"}
+	if err := repos.Alerts.Create(ctx, alert); err != nil {
+		t.Fatal(err)
+	}
+
+	result, err := service.EraseUser(ctx, companyID, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !result.ProfileErased || result.AuditLogsUpdated != 1 || result.AlertsUpdated != 1 {
+		t.Fatalf("unexpected result: %+v", result)
+	}
+
+	erased, err := repos.Users.GetByID(ctx, user.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if erased.Email != result.Alias || erased.PasswordHash != "" || erased.Phone != "" || erased.ErasedAt == nil {
+		t.Errorf("profile not erased: %+v", erased)
+	}
+
+	err = auditService.EachLog(ctx, companyID, nil, func(entry map[string]interface{}) error {
+		if entry["username"] != result.Alias {
+			t.Errorf("audit username = %v, want %s", entry["username"], result.Alias)
+		}
+		if details, _ := entry["details"].(map[string]interface{}); strings.Contains(details["note"].(string), "Ana Bekele") {
+			t.Errorf("audit details still name the user: %v", details)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	alerts, err := repos.Alerts.List(ctx, companyID, repository.AlertFilter{UserID: user.ID}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(alerts) != 1 || alerts[0].Username != result.Alias || strings.Contains(alerts[0].Description, "ana@example.com") {
+		t.Errorf("alert not pseudonymized: %+v", alerts)
+	}
+
+	if _, err := service.EraseUser(ctx, companyID, user.ID); err != ErrAlreadyErased {
+		t.Errorf("second erasure: got %v, want ErrAlreadyErased", err)
+	}
+	if _, err := service.EraseUser(ctx, companyID, primitive.NewObjectID()); err != ErrUserNotFound {
+		t.Errorf("unknown user: got %v, want ErrUserNotFound", err)
+	}
+}
@@ -0,0 +1,354 @@
+// Package quality quarantines stock for inspection. A hold takes some of an
+// item location's stock out of its available stock, so it can be neither
+// issued nor moved, until decisions release it, scrap it or return it to the
+// supplier. Scrapped and returned stock is written off in the valuation
+// ledger with the decision's notes.
+package quality
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	// ErrInvalidQuantity is returned for a negative quantity, or one under a base unit
+	ErrInvalidQuantity = errors.New("quantity must be greater than zero")
+	// ErrReasonRequired is returned when holding stock without a reason
+	ErrReasonRequired = errors.New("a reason is required to hold stock")
+	// ErrNotesRequired is returned for an inspection without notes
+	ErrNotesRequired = errors.New("inspection notes are required")
+	// ErrSupplierRequired is returned when returning stock without naming the supplier
+	ErrSupplierRequired = errors.New("the supplier is required to return stock")
+	// ErrInvalidDecision is returned for decisions other than release, scrap and return
+	ErrInvalidDecision = errors.New("decision must be one of release, scrap, return")
+	// ErrNothingToHold is returned when the stock to hold has none available
+	ErrNothingToHold = errors.New("no available stock to hold")
+	// ErrResolved is returned when inspecting or deciding on a resolved hold
+	ErrResolved = errors.New("hold is already resolved")
+	// ErrExceedsHold is returned when a decision covers more than the hold still holds
+	ErrExceedsHold = errors.New("quantity is more than the hold still holds")
+	// ErrLocationNotFound is returned for stock that does not exist in scope
+	ErrLocationNotFound = errors.New("stock location not found")
+)
+
+// Hold puts stock on quality hold. With LocationID it holds Quantity of
+// that location, or all of its available stock when Quantity is zero.
+// Otherwise it holds all available stock of ItemID in every location of
+// Batch, or of any batch when Batch is empty.
+type Hold struct {
+	CompanyID  primitive.ObjectID
+	LocationID *primitive.ObjectID
+	ItemID     *primitive.ObjectID
+	Batch      string
+	// Quantity is in Unit, or the item's base unit when Unit is empty
+	Quantity float64
+	Unit     string
+	Reason   string
+	Notes    string
+	// WarehouseID, when set, only matches stock in that warehouse
+	WarehouseID *primitive.ObjectID
+	HeldBy      primitive.ObjectID
+}
+
+// Decision settles Quantity of a hold, or all it still holds when Quantity
+// is zero
+type Decision struct {
+	CompanyID primitive.ObjectID
+	HoldID    primitive.ObjectID
+	Action    string
+	Quantity  float64
+	Unit      string
+	Notes     string
+	Supplier  string
+	Reference string
+	// WarehouseID, when set, only matches holds in that warehouse
+	WarehouseID *primitive.ObjectID
+	DecidedBy   primitive.ObjectID
+}
+
+// Service places holds and records inspections and decisions
+type Service struct {
+	tx        repository.Transactor
+	holds     repository.QualityHoldRepository
+	items     repository.ItemRepository
+	valuation *valuation.Service
+}
+
+func NewService(tx repository.Transactor, holds repository.QualityHoldRepository, items repository.ItemRepository, valuationService *valuation.Service) *Service {
+	return &Service{tx: tx, holds: holds, items: items, valuation: valuationService}
+}
+
+// List returns the company's holds matching filter, newest first
+func (s *Service) List(ctx context.Context, companyID primitive.ObjectID, filter repository.QualityHoldFilter) ([]models.QualityHold, error) {
+	return s.holds.List(ctx, companyID, filter)
+}
+
+// Get returns a hold; a warehouse limits it to holds there
+func (s *Service) Get(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID) (*models.QualityHold, error) {
+	hold, err := s.holds.Get(ctx, companyID, id)
+	if err != nil {
+		return nil, err
+	}
+	if warehouseID != nil && hold.WarehouseID != *warehouseID {
+		return nil, repository.ErrNotFound
+	}
+	return hold, nil
+}
+
+// Hold puts stock on hold, one hold per location, in one transaction
+func (s *Service) Hold(ctx context.Context, req Hold) ([]models.QualityHold, error) {
+	if req.Reason == "" {
+		return nil, ErrReasonRequired
+	}
+	if req.Quantity < 0 {
+		return nil, ErrInvalidQuantity
+	}
+	settings, err := s.valuation.Settings(ctx, req.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	var holds []models.QualityHold
+	err = s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		holds = nil
+		item, locations, err := s.holdable(ctx, req)
+		if err != nil {
+			return err
+		}
+
+		quantity := 0
+		if req.LocationID != nil && req.Quantity > 0 {
+			if quantity, err = uom.ToBase(item, req.Quantity, req.Unit); err != nil {
+				return err
+			}
+			if quantity <= 0 {
+				return ErrInvalidQuantity
+			}
+		}
+
+		now := time.Now()
+		for _, location := range locations {
+			held := quantity
+			if held == 0 {
+				held = location.Available()
+			}
+			if held <= 0 {
+				continue
+			}
+			if _, err := s.items.AdjustQuantity(ctx, item.ID, location.ID, repository.QuantityChange{
+				HeldDelta:   held,
+				WarehouseID: &location.WarehouseID,
+				UpdatedBy:   req.HeldBy,
+			}); err != nil {
+				return err
+			}
+			hold := models.QualityHold{
+				ID:          primitive.NewObjectID(),
+				CompanyID:   req.CompanyID,
+				ItemID:      item.ID,
+				WarehouseID: location.WarehouseID,
+				LocationID:  location.ID,
+				Batch:       location.Batch,
+				Quantity:    held,
+				Remaining:   held,
+				Status:      models.HoldOpen,
+				Reason:      req.Reason,
+				Notes:       req.Notes,
+				Inspections: []models.QualityInspection{},
+				Decisions:   []models.QualityDecision{},
+				Currency:    settings.Currency,
+				HeldBy:      req.HeldBy,
+				CreatedAt:   now,
+				UpdatedAt:   now,
+			}
+			if err := s.holds.Create(ctx, &hold); err != nil {
+				return err
+			}
+			holds = append(holds, hold)
+		}
+		if len(holds) == 0 {
+			return ErrNothingToHold
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// holdable returns the item and the locations a hold request is about
+func (s *Service) holdable(ctx context.Context, req Hold) (*models.Item, []models.ItemLocation, error) {
+	if req.LocationID != nil {
+		location, err := s.items.Location(ctx, *req.LocationID)
+		if err == repository.ErrNotFound {
+			return nil, nil, ErrLocationNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if req.WarehouseID != nil && location.WarehouseID != *req.WarehouseID {
+			return nil, nil, ErrLocationNotFound
+		}
+		item, err := s.items.Get(ctx, req.CompanyID, location.ItemID)
+		if err == repository.ErrNotFound {
+			return nil, nil, ErrLocationNotFound
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		return item, []models.ItemLocation{*location}, nil
+	}
+
+	if req.ItemID == nil {
+		return nil, nil, ErrLocationNotFound
+	}
+	item, err := s.items.Get(ctx, req.CompanyID, *req.ItemID)
+	if err != nil {
+		return nil, nil, err
+	}
+	all, err := s.items.Locations(ctx, item.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	var locations []models.ItemLocation
+	for _, location := range all {
+		if req.WarehouseID != nil && location.WarehouseID != *req.WarehouseID {
+			continue
+		}
+		if req.Batch != "" && location.Batch != req.Batch {
+			continue
+		}
+		locations = append(locations, location)
+	}
+	return item, locations, nil
+}
+
+// Inspect records an inspection of held stock
+func (s *Service) Inspect(ctx context.Context, companyID, id primitive.ObjectID, warehouseID *primitive.ObjectID, notes string, inspectedBy primitive.ObjectID) (*models.QualityHold, error) {
+	if notes == "" {
+		return nil, ErrNotesRequired
+	}
+	hold, err := s.Get(ctx, companyID, id, warehouseID)
+	if err != nil {
+		return nil, err
+	}
+	if hold.Status != models.HoldOpen {
+		return nil, ErrResolved
+	}
+	hold.Inspections = append(hold.Inspections, models.QualityInspection{
+		Notes:       notes,
+		InspectedBy: inspectedBy,
+		InspectedAt: time.Now(),
+	})
+	if err := s.holds.Save(ctx, hold); err != nil {
+		return nil, err
+	}
+	return hold, nil
+}
+
+// Decide settles some or all of a hold's stock. Released stock becomes
+// available again; scrapped and returned stock leaves the location and is
+// written off in the valuation ledger. The hold is resolved once nothing is
+// left on it.
+func (s *Service) Decide(ctx context.Context, req Decision) (*models.QualityHold, *models.QualityDecision, error) {
+	source := ""
+	switch req.Action {
+	case models.DecisionRelease:
+	case models.DecisionScrap:
+		source = valuation.SourceScrap
+	case models.DecisionReturn:
+		if req.Supplier == "" {
+			return nil, nil, ErrSupplierRequired
+		}
+		source = valuation.SourceReturn
+	default:
+		return nil, nil, ErrInvalidDecision
+	}
+	if req.Quantity < 0 {
+		return nil, nil, ErrInvalidQuantity
+	}
+
+	var hold *models.QualityHold
+	var decision *models.QualityDecision
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		var err error
+		if hold, err = s.Get(ctx, req.CompanyID, req.HoldID, req.WarehouseID); err != nil {
+			return err
+		}
+		if hold.Status != models.HoldOpen {
+			return ErrResolved
+		}
+		item, err := s.items.Get(ctx, req.CompanyID, hold.ItemID)
+		if err != nil {
+			return err
+		}
+
+		quantity := hold.Remaining
+		if req.Quantity > 0 {
+			if quantity, err = uom.ToBase(item, req.Quantity, req.Unit); err != nil {
+				return err
+			}
+			if quantity <= 0 {
+				return ErrInvalidQuantity
+			}
+			if quantity > hold.Remaining {
+				return ErrExceedsHold
+			}
+		}
+
+		change := repository.QuantityChange{
+			HeldDelta:   -quantity,
+			WarehouseID: &hold.WarehouseID,
+			UpdatedBy:   req.DecidedBy,
+		}
+		if source != "" {
+			change.Delta = -quantity
+		}
+		if _, err := s.items.AdjustQuantity(ctx, item.ID, hold.LocationID, change); err != nil {
+			return err
+		}
+
+		decision = &models.QualityDecision{
+			Action:    req.Action,
+			Quantity:  quantity,
+			Notes:     req.Notes,
+			Supplier:  req.Supplier,
+			Reference: req.Reference,
+			DecidedBy: req.DecidedBy,
+			DecidedAt: time.Now(),
+		}
+		if source != "" {
+			movement, err := s.valuation.Record(ctx, valuation.Change{
+				Item:        item,
+				WarehouseID: hold.WarehouseID,
+				Delta:       -quantity,
+				Source:      source,
+				Note:        req.Notes,
+				CreatedBy:   req.DecidedBy,
+			})
+			if err != nil {
+				return err
+			}
+			decision.TotalCost = movement.TotalCost
+		}
+
+		hold.Remaining -= quantity
+		hold.Decisions = append(hold.Decisions, *decision)
+		if hold.Remaining == 0 {
+			hold.Status = models.HoldResolved
+		}
+		return s.holds.Save(ctx, hold)
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+	return hold, decision, nil
+}
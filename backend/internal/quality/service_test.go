@@ -0,0 +1,117 @@
+package quality
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestHoldInspectAndDecide(t *testing.T) {
+	ctx := context.Background()
+	start := time.Now()
+	repos := repository.NewMemoryRepositories()
+	company := &models.Company{Name: "Acme", Currency: "USD"}
+	if err := repos.Companies.Create(ctx, company); err != nil {
+		t.Fatal(err)
+	}
+	warehouse := &models.Warehouse{CompanyID: company.ID, Name: "Main", IsActive: true}
+	if err := repos.Warehouses.Create(ctx, warehouse); err != nil {
+		t.Fatal(err)
+	}
+	valuationService := valuation.NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	service := NewService(repos.Tx, repos.QualityHolds, repos.Items, valuationService)
+
+	// 10 boxes received at 25 each
+	item := &models.Item{CompanyID: company.ID, SKU: "BOX-1", Name: "Box", Quality: "New", Price: 30, Currency: "USD"}
+	location := &models.ItemLocation{WarehouseID: warehouse.ID, Quantity: 10}
+	if err := repos.Items.Create(ctx, item, location); err != nil {
+		t.Fatal(err)
+	}
+	unitCost := int64(25)
+	if _, err := valuationService.Record(ctx, valuation.Change{Item: item, WarehouseID: warehouse.ID, Delta: 10, UnitCost: &unitCost, Source: valuation.SourceCreate}); err != nil {
+		t.Fatal(err)
+	}
+	userID := primitive.NewObjectID()
+
+	stock := func(wantQuantity, wantHeld int) {
+		t.Helper()
+		got, err := repos.Items.Location(ctx, location.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.Quantity != wantQuantity || got.Held != wantHeld {
+			t.Fatalf("location holds %d with %d held, want %d with %d held", got.Quantity, got.Held, wantQuantity, wantHeld)
+		}
+	}
+
+	if _, err := service.Hold(ctx, Hold{CompanyID: company.ID, LocationID: &location.ID, Quantity: 6}); err != ErrReasonRequired {
+		t.Fatalf("hold without a reason: error = %v, want %v", err, ErrReasonRequired)
+	}
+	holds, err := service.Hold(ctx, Hold{CompanyID: company.ID, LocationID: &location.ID, Quantity: 6, Reason: "Crushed in transit", HeldBy: userID})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(holds) != 1 || holds[0].Remaining != 6 || holds[0].Status != models.HoldOpen {
+		t.Fatalf("holds = %+v", holds)
+	}
+	hold := holds[0]
+	stock(10, 6)
+
+	if _, err := service.Inspect(ctx, company.ID, hold.ID, nil, "", userID); err != ErrNotesRequired {
+		t.Fatalf("inspection without notes: error = %v, want %v", err, ErrNotesRequired)
+	}
+	if _, err := service.Inspect(ctx, company.ID, hold.ID, nil, "Two boxes are fine", userID); err != nil {
+		t.Fatal(err)
+	}
+
+	decide := func(action string, quantity float64, supplier string) (*models.QualityHold, *models.QualityDecision, error) {
+		return service.Decide(ctx, Decision{CompanyID: company.ID, HoldID: hold.ID, Action: action, Quantity: quantity, Notes: "Checked", Supplier: supplier, DecidedBy: userID})
+	}
+
+	// Released stock is available again and nothing is written off
+	if _, decision, err := decide(models.DecisionRelease, 2, ""); err != nil || decision.TotalCost != 0 {
+		t.Fatalf("release: %+v, %v", decision, err)
+	}
+	stock(10, 4)
+
+	if _, _, err := decide(models.DecisionScrap, 5, ""); err != ErrExceedsHold {
+		t.Fatalf("scrapping more than held: error = %v, want %v", err, ErrExceedsHold)
+	}
+	if _, _, err := decide(models.DecisionReturn, 1, ""); err != ErrSupplierRequired {
+		t.Fatalf("return without a supplier: error = %v, want %v", err, ErrSupplierRequired)
+	}
+
+	// Scrapped and returned stock leaves the location and is written off at cost
+	if _, decision, err := decide(models.DecisionScrap, 3, ""); err != nil || decision.TotalCost != 3*25 {
+		t.Fatalf("scrap: %+v, %v", decision, err)
+	}
+	stock(7, 1)
+	resolved, decision, err := decide(models.DecisionReturn, 0, "Boxes Ltd")
+	if err != nil || decision.Quantity != 1 || decision.TotalCost != 25 {
+		t.Fatalf("return: %+v, %v", decision, err)
+	}
+	stock(6, 0)
+	if resolved.Status != models.HoldResolved || resolved.Remaining != 0 || len(resolved.Decisions) != 3 || len(resolved.Inspections) != 1 {
+		t.Fatalf("hold after the last decision = %+v", resolved)
+	}
+
+	if _, err := service.Inspect(ctx, company.ID, hold.ID, nil, "Again", userID); err != ErrResolved {
+		t.Fatalf("inspecting a resolved hold: error = %v, want %v", err, ErrResolved)
+	}
+	if _, _, err := decide(models.DecisionRelease, 0, ""); err != ErrResolved {
+		t.Fatalf("deciding on a resolved hold: error = %v, want %v", err, ErrResolved)
+	}
+
+	summary, err := valuationService.Summarize(ctx, company.ID, nil, start, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if totals := summary.Totals; totals.IssuedQuantity != 4 || totals.CostOfGoodsIssued != 4*25 || totals.ClosingQuantity != 6 || totals.ClosingValue != 6*25 {
+		t.Fatalf("valuation = %+v, want 4 written off at 25 and 6 left", totals)
+	}
+}
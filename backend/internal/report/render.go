@@ -0,0 +1,251 @@
+package report
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/go-pdf/fpdf"
+	"github.com/xuri/excelize/v2"
+)
+
+// Output formats
+const (
+	FormatCSV  = "csv"
+	FormatXLSX = "xlsx"
+	FormatPDF  = "pdf"
+)
+
+// ValidFormat reports whether format is a supported output format
+func ValidFormat(format string) bool {
+	return format == FormatCSV || format == FormatXLSX || format == FormatPDF
+}
+
+// ContentType returns the MIME type of an output format
+func ContentType(format string) string {
+	switch format {
+	case FormatXLSX:
+		return "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet"
+	case FormatPDF:
+		return "application/pdf"
+	}
+	return "text/csv; charset=utf-8"
+}
+
+// Render writes the table in the given format
+func Render(w io.Writer, t *Table, format string) error {
+	switch format {
+	case FormatCSV:
+		return writeCSV(w, t)
+	case FormatXLSX:
+		return writeXLSX(w, t)
+	case FormatPDF:
+		return writePDF(w, t)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// FileName names the download of a report
+func FileName(t *Table, format string) string {
+	return fmt.Sprintf("%s-%s.%s", t.Kind, t.GeneratedAt.Format("20060102T150405Z"), format)
+}
+
+func writeCSV(w io.Writer, t *Table) error {
+	writer := csv.NewWriter(w)
+	header := make([]string, len(t.Columns))
+	for i, column := range t.Columns {
+		header[i] = column.Name
+	}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+	for _, row := range t.rows() {
+		record := make([]string, len(row))
+		for i, cell := range row {
+			record[i] = t.formatCell(cell)
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+func writeXLSX(w io.Writer, t *Table) error {
+	file := excelize.NewFile()
+	defer file.Close()
+
+	sheet := t.Title
+	if len(sheet) > 31 {
+		sheet = sheet[:31]
+	}
+	if err := file.SetSheetName("Sheet1", sheet); err != nil {
+		return err
+	}
+	stream, err := file.NewStreamWriter(sheet)
+	if err != nil {
+		return err
+	}
+	bold, err := file.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return err
+	}
+	moneyFormat := "#,##0"
+	if exponent := models.CurrencyExponent(t.Currency); exponent > 0 {
+		moneyFormat += "." + strings.Repeat("0", exponent)
+	}
+	money, err := file.NewStyle(&excelize.Style{CustomNumFmt: &moneyFormat})
+	if err != nil {
+		return err
+	}
+
+	header := make([]interface{}, len(t.Columns))
+	for i, column := range t.Columns {
+		header[i] = excelize.Cell{StyleID: bold, Value: column.Name}
+		if err := stream.SetColWidth(i+1, i+1, column.Width*6); err != nil {
+			return err
+		}
+	}
+	if err := stream.SetRow("A1", header, excelize.RowOpts{StyleID: bold}); err != nil {
+		return err
+	}
+
+	rows := t.rows()
+	for r, row := range rows {
+		cells := make([]interface{}, len(row))
+		for i, value := range row {
+			cell := excelize.Cell{Value: value}
+			if amount, ok := value.(Amount); ok {
+				cell = excelize.Cell{StyleID: money, Value: models.MajorUnits(int64(amount), t.Currency)}
+			}
+			cells[i] = cell
+		}
+		axis, _ := excelize.CoordinatesToCellName(1, r+2)
+		opts := excelize.RowOpts{}
+		if t.Totals != nil && r == len(rows)-1 {
+			opts.StyleID = bold
+		}
+		if err := stream.SetRow(axis, cells, opts); err != nil {
+			return err
+		}
+	}
+	if err := stream.Flush(); err != nil {
+		return err
+	}
+	return file.Write(w)
+}
+
+const (
+	pdfMargin     = 10.0
+	pdfRowHeight  = 6.0
+	pdfFontSize   = 9.0
+	pdfHeaderFill = 230
+)
+
+// writePDF lays the table out on landscape A4 pages, repeating the company
+// header and column names on each page
+func writePDF(w io.Writer, t *Table) error {
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetMargins(pdfMargin, pdfMargin, pdfMargin)
+	pdf.SetAutoPageBreak(true, pdfMargin+5)
+	pdf.AliasNbPages("")
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+
+	pageWidth, _ := pdf.GetPageSize()
+	usable := pageWidth - 2*pdfMargin
+	totalWidth := 0.0
+	for _, column := range t.Columns {
+		totalWidth += column.Width
+	}
+	widths := make([]float64, len(t.Columns))
+	for i, column := range t.Columns {
+		widths[i] = usable * column.Width / totalWidth
+	}
+
+	pdf.SetHeaderFunc(func() {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(usable/2, 7, tr(t.Company), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(usable/2, 7, "Generated "+t.GeneratedAt.Format("2006-01-02 15:04 UTC"), "", 1, "R", false, 0, "")
+		pdf.SetFont("Helvetica", "B", 11)
+		pdf.CellFormat(usable/2, 6, tr(t.Title), "", 0, "L", false, 0, "")
+		pdf.SetFont("Helvetica", "", 9)
+		pdf.CellFormat(usable/2, 6, tr(t.Scope), "", 1, "R", false, 0, "")
+		pdf.Ln(3)
+
+		pdf.SetFont("Helvetica", "B", pdfFontSize)
+		pdf.SetFillColor(pdfHeaderFill, pdfHeaderFill, pdfHeaderFill)
+		for i, column := range t.Columns {
+			pdf.CellFormat(widths[i], pdfRowHeight, tr(column.Name), "1", 0, align(column), true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", pdfFontSize)
+	})
+	pdf.SetFooterFunc(func() {
+		pdf.SetY(-pdfMargin - 2)
+		pdf.SetFont("Helvetica", "", 8)
+		pdf.CellFormat(0, 5, fmt.Sprintf("Page %d of {nb}", pdf.PageNo()), "", 0, "C", false, 0, "")
+	})
+
+	pdf.AddPage()
+	rows := t.rows()
+	if len(rows) == 0 || (t.Totals != nil && len(rows) == 1) {
+		pdf.CellFormat(usable, pdfRowHeight, "No items", "1", 1, "C", false, 0, "")
+	}
+	for r, row := range rows {
+		if t.Totals != nil && r == len(rows)-1 {
+			pdf.SetFont("Helvetica", "B", pdfFontSize)
+		}
+		for i, cell := range row {
+			text := fitText(pdf, tr(t.formatCell(cell)), widths[i]-2)
+			pdf.CellFormat(widths[i], pdfRowHeight, text, "1", 0, align(t.Columns[i]), false, 0, "")
+		}
+		pdf.Ln(-1)
+	}
+	return pdf.Output(w)
+}
+
+// rows returns the data rows followed by the totals, if any
+func (t *Table) rows() [][]interface{} {
+	if t.Totals == nil {
+		return t.Rows
+	}
+	return append(t.Rows[:len(t.Rows):len(t.Rows)], t.Totals)
+}
+
+func (t *Table) formatCell(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case int:
+		return strconv.Itoa(v)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case Amount:
+		return models.FormatMinor(int64(v), t.Currency)
+	}
+	return fmt.Sprint(value)
+}
+
+func align(column Column) string {
+	if column.Numeric {
+		return "R"
+	}
+	return "L"
+}
+
+// fitText shortens text with an ellipsis until it fits width. Text is
+// already translated to the single-byte font encoding, so bytes are characters.
+func fitText(pdf *fpdf.Fpdf, text string, width float64) string {
+	if pdf.GetStringWidth(text) <= width {
+		return text
+	}
+	for len(text) > 0 && pdf.GetStringWidth(text+"...") > width {
+		text = text[:len(text)-1]
+	}
+	return text + "..."
+}
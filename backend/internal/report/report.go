@@ -0,0 +1,402 @@
+// Package report builds inventory reports from the same stock aggregation
+// as the item list, and the valuation report from the cost movements, and
+// renders them as CSV, XLSX or PDF.
+package report
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/pricing"
+	"github.com/a2sv/safeware/internal/repository"
+	"github.com/a2sv/safeware/internal/uom"
+	"github.com/a2sv/safeware/internal/valuation"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Report kinds
+const (
+	KindStock     = "stock-on-hand"
+	KindValuation = "valuation"
+	KindQuality   = "quality"
+	KindArchived  = "archived"
+)
+
+var titles = map[string]string{
+	KindStock:     "Stock on Hand",
+	KindValuation: "Valuation at Cost by Warehouse and Department",
+	KindQuality:   "Items by Quality",
+	KindArchived:  "Archived Items",
+}
+
+// ValidKind reports whether kind names a report
+func ValidKind(kind string) bool {
+	_, ok := titles[kind]
+	return ok
+}
+
+// Column describes one report column. Width is relative to the other
+// columns and only affects the PDF layout.
+type Column struct {
+	Name    string
+	Width   float64
+	Numeric bool
+}
+
+// Amount is a money cell in minor units of the table's currency
+type Amount int64
+
+// Table is a rendered-ready report. Cells are strings, ints, float64s or Amounts.
+type Table struct {
+	Kind        string
+	Title       string
+	Company     string
+	Currency    string
+	Scope       string
+	GeneratedAt time.Time
+	Columns     []Column
+	Rows        [][]interface{}
+	// Totals is an optional final row
+	Totals []interface{}
+
+	// prices are the item prices in effect for the report, by item ID
+	prices map[primitive.ObjectID]int64
+}
+
+// Scope limits a report to one warehouse when WarehouseID is set. The
+// valuation report values the stock held at AsOf, or now when it is nil, at
+// cost. The other reports show current stock, valued at the prices in effect
+// at AsOf. Reports listing single items show their quantities in Unit where
+// the item has it, and in the item's base unit otherwise; totals are always
+// in base units.
+type Scope struct {
+	CompanyID   primitive.ObjectID
+	WarehouseID *primitive.ObjectID
+	AsOf        *time.Time
+	Unit        string
+}
+
+// Service builds reports
+type Service struct {
+	items      repository.ItemRepository
+	warehouses repository.WarehouseRepository
+	companies  repository.CompanyRepository
+	pricing    *pricing.Service
+	valuation  *valuation.Service
+}
+
+func NewService(items repository.ItemRepository, warehouses repository.WarehouseRepository, companies repository.CompanyRepository, pricingService *pricing.Service, valuationService *valuation.Service) *Service {
+	return &Service{items: items, warehouses: warehouses, companies: companies, pricing: pricingService, valuation: valuationService}
+}
+
+// Build runs the report of the given kind. A scoped warehouse that does not
+// belong to the company returns repository.ErrNotFound.
+func (s *Service) Build(ctx context.Context, kind string, scope Scope) (*Table, error) {
+	company, err := s.companies.Get(ctx, scope.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	warehouses, err := s.scopeWarehouses(ctx, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &Table{
+		Kind:        kind,
+		Title:       titles[kind],
+		Company:     company.Name,
+		Currency:    company.CurrencyCode(),
+		Scope:       "All warehouses",
+		GeneratedAt: time.Now().UTC(),
+	}
+	if scope.WarehouseID != nil {
+		t.Scope = "Warehouse: " + warehouses[0].Name
+	}
+	asOf := t.GeneratedAt
+	switch {
+	case kind == KindValuation && scope.AsOf != nil:
+		asOf = *scope.AsOf
+		t.Scope += ", stock held as of " + asOf.UTC().Format("2006-01-02 15:04 UTC")
+	case scope.AsOf != nil:
+		asOf = *scope.AsOf
+		t.Scope += ", current stock at prices as of " + asOf.UTC().Format("2006-01-02 15:04 UTC")
+	}
+	if t.prices, err = s.pricing.Effective(ctx, scope.CompanyID, asOf); err != nil {
+		return nil, err
+	}
+
+	switch kind {
+	case KindStock:
+		err = s.stockOnHand(ctx, t, scope, warehouses)
+	case KindValuation:
+		err = s.valueAtCost(ctx, t, scope, warehouses, asOf)
+	case KindQuality:
+		err = s.quality(ctx, t, scope)
+	case KindArchived:
+		err = s.archived(ctx, t, scope)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+// scopeWarehouses returns the scoped warehouse, or every active warehouse
+func (s *Service) scopeWarehouses(ctx context.Context, scope Scope) ([]models.Warehouse, error) {
+	if scope.WarehouseID != nil {
+		warehouse, err := s.warehouses.Get(ctx, scope.CompanyID, *scope.WarehouseID)
+		if err != nil {
+			return nil, err
+		}
+		return []models.Warehouse{*warehouse}, nil
+	}
+	warehouses, err := s.warehouses.ListActive(ctx, scope.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(warehouses, func(i, j int) bool { return warehouses[i].Name < warehouses[j].Name })
+	return warehouses, nil
+}
+
+// stockOnHand lists each item's quantity and value per warehouse
+func (s *Service) stockOnHand(ctx context.Context, t *Table, scope Scope, warehouses []models.Warehouse) error {
+	t.Columns = []Column{
+		{Name: "Warehouse", Width: 3},
+		{Name: "SKU", Width: 2},
+		{Name: "Name", Width: 4},
+		{Name: "Quality", Width: 1.5},
+		{Name: "Department", Width: 2.5},
+		{Name: "Batch", Width: 2},
+		{Name: "Quantity", Width: 1.5, Numeric: true},
+		{Name: "Unit", Width: 1.2},
+		{Name: t.money("Unit Price"), Width: 1.8, Numeric: true},
+		{Name: t.money("Value"), Width: 2, Numeric: true},
+	}
+	quantity, value := 0, Amount(0)
+	for _, warehouse := range warehouses {
+		id := warehouse.ID
+		stock, err := s.items.ListStock(ctx, scope.CompanyID, repository.ItemFilter{WarehouseID: &id})
+		if err != nil {
+			return err
+		}
+		t.reprice(stock)
+		sortStock(stock)
+		for _, item := range stock {
+			itemValue := amount(item.Price, item.Quantity)
+			shown := uom.Present(&item.Item, item.Quantity, scope.Unit)
+			t.Rows = append(t.Rows, []interface{}{
+				warehouse.Name, item.SKU, item.Name, item.Quality, item.Department, item.Batch,
+				shown.Quantity, shown.Unit, Amount(item.Price), itemValue,
+			})
+			quantity += item.Quantity
+			value += itemValue
+		}
+	}
+	t.Totals = []interface{}{"Total", "", "", "", "", "", quantity, "", "", value}
+	return nil
+}
+
+// valueAtCost sums the quantity and cost of the stock held at asOf per
+// warehouse and department. Its totals match the closing valuation of
+// GET /valuation for a period ending at asOf.
+func (s *Service) valueAtCost(ctx context.Context, t *Table, scope Scope, warehouses []models.Warehouse, asOf time.Time) error {
+	t.Columns = []Column{
+		{Name: "Warehouse", Width: 3},
+		{Name: "Department", Width: 3},
+		{Name: "Items", Width: 1, Numeric: true},
+		{Name: "Quantity", Width: 1.5, Numeric: true},
+		{Name: t.money("Value at Cost"), Width: 2, Numeric: true},
+	}
+	holdings, err := s.valuation.Holdings(ctx, scope.CompanyID, scope.WarehouseID, asOf)
+	if err != nil {
+		return err
+	}
+
+	// Warehouses in scope come first in name order, then any inactive
+	// warehouse that held stock at the time
+	names := map[primitive.ObjectID]string{}
+	order := map[primitive.ObjectID]int{}
+	for i, warehouse := range warehouses {
+		names[warehouse.ID] = warehouse.Name
+		order[warehouse.ID] = i
+	}
+	type groupKey struct {
+		warehouseID primitive.ObjectID
+		department  string
+	}
+	departments := map[primitive.ObjectID]string{}
+	groups := map[groupKey]*stockGroup{}
+	var keys []groupKey
+	for _, holding := range holdings {
+		if _, ok := names[holding.WarehouseID]; !ok {
+			name := holding.WarehouseID.Hex()
+			warehouse, err := s.warehouses.Get(ctx, scope.CompanyID, holding.WarehouseID)
+			switch {
+			case err == nil:
+				name = warehouse.Name
+			case err != repository.ErrNotFound:
+				return err
+			}
+			names[holding.WarehouseID] = name
+			order[holding.WarehouseID] = len(warehouses) + len(order)
+		}
+		department, ok := departments[holding.ItemID]
+		if !ok {
+			item, err := s.items.Get(ctx, scope.CompanyID, holding.ItemID)
+			switch {
+			case err == nil:
+				department = item.Department
+			case err == repository.ErrNotFound:
+				department = "(deleted items)"
+			default:
+				return err
+			}
+			if department == "" {
+				department = "(none)"
+			}
+			departments[holding.ItemID] = department
+		}
+
+		k := groupKey{holding.WarehouseID, department}
+		group, ok := groups[k]
+		if !ok {
+			group = &stockGroup{key: department}
+			groups[k] = group
+			keys = append(keys, k)
+		}
+		group.items++
+		group.quantity += holding.Quantity
+		group.value += Amount(holding.Value)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].warehouseID != keys[j].warehouseID {
+			return order[keys[i].warehouseID] < order[keys[j].warehouseID]
+		}
+		return keys[i].department < keys[j].department
+	})
+
+	totalItems, totalQuantity, totalValue := 0, 0, Amount(0)
+	for _, k := range keys {
+		group := groups[k]
+		t.Rows = append(t.Rows, []interface{}{names[k.warehouseID], k.department, group.items, group.quantity, group.value})
+		totalItems += group.items
+		totalQuantity += group.quantity
+		totalValue += group.value
+	}
+	t.Totals = []interface{}{"Total", "", totalItems, totalQuantity, totalValue}
+	return nil
+}
+
+// quality sums items, quantity and value per quality grade
+func (s *Service) quality(ctx context.Context, t *Table, scope Scope) error {
+	t.Columns = []Column{
+		{Name: "Quality", Width: 3},
+		{Name: "Items", Width: 1, Numeric: true},
+		{Name: "Quantity", Width: 1.5, Numeric: true},
+		{Name: t.money("Value"), Width: 2, Numeric: true},
+	}
+	stock, err := s.items.ListStock(ctx, scope.CompanyID, repository.ItemFilter{WarehouseID: scope.WarehouseID})
+	if err != nil {
+		return err
+	}
+	t.reprice(stock)
+	totalItems, totalQuantity, totalValue := 0, 0, Amount(0)
+	for _, group := range groupStock(stock, func(item repository.ItemStock) string { return item.Quality }) {
+		t.Rows = append(t.Rows, []interface{}{group.key, group.items, group.quantity, group.value})
+		totalItems += group.items
+		totalQuantity += group.quantity
+		totalValue += group.value
+	}
+	t.Totals = []interface{}{"Total", totalItems, totalQuantity, totalValue}
+	return nil
+}
+
+// archived lists archived items with the stock they still hold
+func (s *Service) archived(ctx context.Context, t *Table, scope Scope) error {
+	t.Columns = []Column{
+		{Name: "SKU", Width: 2},
+		{Name: "Name", Width: 4},
+		{Name: "Quality", Width: 1.5},
+		{Name: "Department", Width: 2.5},
+		{Name: "Quantity", Width: 1.5, Numeric: true},
+		{Name: "Unit", Width: 1.2},
+		{Name: t.money("Value"), Width: 2, Numeric: true},
+		{Name: "Archived", Width: 2.5},
+	}
+	stock, err := s.items.ListArchived(ctx, scope.CompanyID, repository.ItemFilter{WarehouseID: scope.WarehouseID})
+	if err != nil {
+		return err
+	}
+	t.reprice(stock)
+	sortStock(stock)
+	quantity, value := 0, Amount(0)
+	for _, item := range stock {
+		itemValue := amount(item.Price, item.Quantity)
+		shown := uom.Present(&item.Item, item.Quantity, scope.Unit)
+		t.Rows = append(t.Rows, []interface{}{
+			item.SKU, item.Name, item.Quality, item.Department, shown.Quantity, shown.Unit, itemValue,
+			item.UpdatedAt.UTC().Format("2006-01-02"),
+		})
+		quantity += item.Quantity
+		value += itemValue
+	}
+	t.Totals = []interface{}{"Total", "", "", "", quantity, "", value, ""}
+	return nil
+}
+
+type stockGroup struct {
+	key      string
+	items    int
+	quantity int
+	value    Amount
+}
+
+// groupStock sums stock by key, ordered by key
+func groupStock(stock []repository.ItemStock, key func(repository.ItemStock) string) []stockGroup {
+	byKey := map[string]*stockGroup{}
+	var groups []*stockGroup
+	for _, item := range stock {
+		k := key(item)
+		group, ok := byKey[k]
+		if !ok {
+			group = &stockGroup{key: k}
+			byKey[k] = group
+			groups = append(groups, group)
+		}
+		group.items++
+		group.quantity += item.Quantity
+		group.value += amount(item.Price, item.Quantity)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].key < groups[j].key })
+
+	result := make([]stockGroup, len(groups))
+	for i, group := range groups {
+		result[i] = *group
+	}
+	return result
+}
+
+func sortStock(stock []repository.ItemStock) {
+	sort.Slice(stock, func(i, j int) bool { return stock[i].SKU < stock[j].SKU })
+}
+
+// reprice sets each item's price to the one in effect for the report.
+// Items without price history keep their current price.
+func (t *Table) reprice(stock []repository.ItemStock) {
+	for i := range stock {
+		if price, ok := t.prices[stock[i].ID]; ok {
+			stock[i].Price = price
+		}
+	}
+}
+
+// money names a column of amounts in the table's currency
+func (t *Table) money(name string) string {
+	return name + " (" + t.Currency + ")"
+}
+
+func amount(price int64, quantity int) Amount {
+	return Amount(price * int64(quantity))
+}
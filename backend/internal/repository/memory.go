@@ -0,0 +1,2141 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// memoryStore holds every collection of the in-memory backend behind one lock.
+// Documents are stored and returned by value, so callers never share state with it.
+type memoryStore struct {
+	mu         sync.RWMutex
+	companies  map[primitive.ObjectID]models.Company
+	users      map[primitive.ObjectID]models.User
+	warehouses map[primitive.ObjectID]models.Warehouse
+	items      map[primitive.ObjectID]models.Item
+	locations  map[primitive.ObjectID]models.ItemLocation
+	costLayers map[primitive.ObjectID]models.CostLayer
+	movements  []models.CostMovement
+	prices     map[primitive.ObjectID]models.ItemPrice
+	layout     map[primitive.ObjectID]models.StorageLocation
+	categories map[primitive.ObjectID]models.Category
+	boms       map[primitive.ObjectID]models.BOM
+	kitBuilds  []models.KitBuild
+	sequences  map[primitive.ObjectID]models.Sequence
+	holds      map[primitive.ObjectID]models.QualityHold
+	auditLogs  []models.AuditLog
+	// policies are keyed by company
+	policies   map[primitive.ObjectID]models.AuditRetentionPolicy
+	archives   map[primitive.ObjectID]models.AuditArchive
+	alerts     map[primitive.ObjectID]models.SecurityAlert
+	backups    map[primitive.ObjectID]models.Backup
+	importJobs map[primitive.ObjectID]models.ImportJob
+	// idempotencyKeys are keyed by user and key
+	idempotencyKeys map[string]models.IdempotencyRecord
+}
+
+// NewMemoryRepositories returns empty repositories backed by process memory,
+// for tests and local experiments
+func NewMemoryRepositories() *Repositories {
+	store := &memoryStore{
+		companies:  map[primitive.ObjectID]models.Company{},
+		users:      map[primitive.ObjectID]models.User{},
+		warehouses: map[primitive.ObjectID]models.Warehouse{},
+		items:      map[primitive.ObjectID]models.Item{},
+		locations:  map[primitive.ObjectID]models.ItemLocation{},
+		costLayers: map[primitive.ObjectID]models.CostLayer{},
+		prices:     map[primitive.ObjectID]models.ItemPrice{},
+		layout:     map[primitive.ObjectID]models.StorageLocation{},
+		categories: map[primitive.ObjectID]models.Category{},
+		boms:       map[primitive.ObjectID]models.BOM{},
+		sequences:  map[primitive.ObjectID]models.Sequence{},
+		holds:      map[primitive.ObjectID]models.QualityHold{},
+		policies:   map[primitive.ObjectID]models.AuditRetentionPolicy{},
+		archives:   map[primitive.ObjectID]models.AuditArchive{},
+		alerts:     map[primitive.ObjectID]models.SecurityAlert{},
+		backups:    map[primitive.ObjectID]models.Backup{},
+		importJobs: map[primitive.ObjectID]models.ImportJob{},
+
+		idempotencyKeys: map[string]models.IdempotencyRecord{},
+	}
+	return &Repositories{
+		Tx:           &memoryTransactor{store: store},
+		Companies:    &memoryCompanyRepository{store},
+		Users:        &memoryUserRepository{store},
+		Warehouses:   &memoryWarehouseRepository{store},
+		Items:        &memoryItemRepository{store},
+		Costs:        &memoryCostRepository{store},
+		Prices:       &memoryPriceRepository{store},
+		Layout:       &memoryLayoutRepository{store},
+		Categories:   &memoryCategoryRepository{store},
+		Kits:         &memoryKitRepository{store},
+		Sequences:    &memorySequenceRepository{store},
+		QualityHolds: &memoryQualityHoldRepository{store},
+		Audit:        &memoryAuditRepository{store},
+		Retention:    &memoryRetentionRepository{store},
+		Alerts:       &memoryAlertRepository{store},
+		Backups:      &memoryBackupRepository{store},
+		ImportJobs:   &memoryImportJobRepository{store},
+		Idempotency:  &memoryIdempotencyRepository{store},
+	}
+}
+
+type memoryCompanyRepository struct{ store *memoryStore }
+
+func (r *memoryCompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if company.ID.IsZero() {
+		company.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.companies[company.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.companies[company.ID] = *company
+	return nil
+}
+
+func (r *memoryCompanyRepository) Get(ctx context.Context, id primitive.ObjectID) (*models.Company, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	company, ok := r.store.companies[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &company, nil
+}
+
+func (r *memoryCompanyRepository) IDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	ids := make([]primitive.ObjectID, 0, len(r.store.companies))
+	for id := range r.store.companies {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return ids[i].Hex() < ids[j].Hex()
+	})
+	return ids, nil
+}
+
+func (r *memoryCompanyRepository) Update(ctx context.Context, id primitive.ObjectID, update CompanyUpdate) (*models.Company, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	company, ok := r.store.companies[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if update.Currency != nil {
+		company.Currency = *update.Currency
+	}
+	if update.ValuationMethod != nil {
+		company.ValuationMethod = *update.ValuationMethod
+	}
+	if update.SKUPattern != nil {
+		company.SKUPattern = update.SKUPattern
+	}
+	company.UpdatedAt = time.Now()
+	r.store.companies[id] = company
+	return &company, nil
+}
+
+type memoryUserRepository struct{ store *memoryStore }
+
+func (r *memoryUserRepository) Create(ctx context.Context, user *models.User) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.users[user.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.users[user.ID] = *user
+	return nil
+}
+
+func (r *memoryUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.find(func(u models.User) bool { return u.ID == id })
+}
+
+func (r *memoryUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.find(func(u models.User) bool { return u.Email == email })
+}
+
+func (r *memoryUserRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.User, error) {
+	return r.find(func(u models.User) bool { return u.ID == id && u.CompanyID == companyID })
+}
+
+func (r *memoryUserRepository) find(match func(models.User) bool) (*models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, user := range r.store.users {
+		if match(user) {
+			return &user, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	users := []models.User{}
+	for _, user := range r.store.users {
+		if userMatches(user, filter) {
+			users = append(users, user)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID.Hex() < users[j].ID.Hex() })
+	return users, nil
+}
+
+func (r *memoryUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	_, err := r.GetByEmail(ctx, email)
+	return err == nil, nil
+}
+
+func (r *memoryUserRepository) Update(ctx context.Context, filter UserFilter, id primitive.ObjectID, update UserUpdate) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || !userMatches(user, filter) {
+		return ErrNotFound
+	}
+	if update.FullName != nil {
+		user.FullName = *update.FullName
+	}
+	if update.Email != nil {
+		user.Email = *update.Email
+	}
+	if update.WarehouseID != nil {
+		warehouseID := *update.WarehouseID
+		user.WarehouseID = &warehouseID
+	}
+	user.UpdatedAt = time.Now()
+	r.store.users[id] = user
+	return nil
+}
+
+func (r *memoryUserRepository) Delete(ctx context.Context, filter UserFilter, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok || !userMatches(user, filter) {
+		return ErrNotFound
+	}
+	delete(r.store.users, id)
+	return nil
+}
+
+func (r *memoryUserRepository) SetLastLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if user, ok := r.store.users[id]; ok {
+		user.LastLogin = &at
+		r.store.users[id] = user
+	}
+	return nil
+}
+
+func (r *memoryUserRepository) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return r.modify(id, func(user *models.User) {
+		user.PasswordHash = passwordHash
+		user.ResetPasswordToken = ""
+		user.ResetPasswordExpires = nil
+	})
+}
+
+func (r *memoryUserRepository) ClearMFA(ctx context.Context, id primitive.ObjectID) error {
+	return r.modify(id, func(user *models.User) { user.TOTPSecret = "" })
+}
+
+func (r *memoryUserRepository) Unlock(ctx context.Context, id primitive.ObjectID) error {
+	return r.modify(id, func(user *models.User) {
+		user.FailedLogins = 0
+		user.LockedUntil = nil
+	})
+}
+
+func (r *memoryUserRepository) Erase(ctx context.Context, id primitive.ObjectID, fullName, email string, at time.Time) error {
+	return r.modify(id, func(user *models.User) {
+		user.FullName = fullName
+		user.Email = email
+		user.PasswordHash = ""
+		user.IsVerified = false
+		user.FailedLogins = 0
+		user.ErasedAt = &at
+		user.Phone = ""
+		user.TOTPSecret = ""
+		user.Attributes = nil
+		user.VerificationToken = ""
+		user.VerificationTokenExpires = nil
+		user.ResetPasswordToken = ""
+		user.ResetPasswordExpires = nil
+		user.LastLogin = nil
+	})
+}
+
+// DeleteSessions has nothing to revoke: the memory store keeps no sessions
+func (r *memoryUserRepository) DeleteSessions(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	return 0, nil
+}
+
+func (r *memoryUserRepository) modify(id primitive.ObjectID, change func(user *models.User)) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	user, ok := r.store.users[id]
+	if !ok {
+		return ErrNotFound
+	}
+	change(&user)
+	user.UpdatedAt = time.Now()
+	r.store.users[id] = user
+	return nil
+}
+
+func userMatches(user models.User, filter UserFilter) bool {
+	if !filter.CompanyID.IsZero() && user.CompanyID != filter.CompanyID {
+		return false
+	}
+	if filter.WarehouseID != nil && (user.WarehouseID == nil || *user.WarehouseID != *filter.WarehouseID) {
+		return false
+	}
+	if len(filter.Roles) > 0 {
+		for _, role := range filter.Roles {
+			if user.Role == role {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+type memoryWarehouseRepository struct{ store *memoryStore }
+
+func (r *memoryWarehouseRepository) Create(ctx context.Context, warehouse *models.Warehouse) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if warehouse.ID.IsZero() {
+		warehouse.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.warehouses[warehouse.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.warehouses[warehouse.ID] = *warehouse
+	return nil
+}
+
+func (r *memoryWarehouseRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Warehouse, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	warehouse, ok := r.store.warehouses[id]
+	if !ok || warehouse.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &warehouse, nil
+}
+
+func (r *memoryWarehouseRepository) ListActive(ctx context.Context, companyID primitive.ObjectID) ([]models.Warehouse, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	warehouses := []models.Warehouse{}
+	for _, warehouse := range r.store.warehouses {
+		if warehouse.CompanyID == companyID && warehouse.IsActive {
+			warehouses = append(warehouses, warehouse)
+		}
+	}
+	sort.Slice(warehouses, func(i, j int) bool { return warehouses[i].ID.Hex() < warehouses[j].ID.Hex() })
+	return warehouses, nil
+}
+
+func (r *memoryWarehouseRepository) Exists(ctx context.Context, companyID, id primitive.ObjectID) (bool, error) {
+	_, err := r.Get(ctx, companyID, id)
+	return err == nil, nil
+}
+
+func (r *memoryWarehouseRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update WarehouseUpdate) (*models.Warehouse, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	warehouse, ok := r.store.warehouses[id]
+	if !ok || warehouse.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	if update.IfVersion != nil && *update.IfVersion != warehouse.Version {
+		return nil, ErrVersionMismatch
+	}
+	if update.Name != nil {
+		warehouse.Name = *update.Name
+	}
+	if update.Location != nil {
+		warehouse.Location = *update.Location
+	}
+	if update.IPWhitelist != nil {
+		warehouse.IPWhitelist = append([]string(nil), update.IPWhitelist...)
+	}
+	if update.IsActive != nil {
+		warehouse.IsActive = *update.IsActive
+	}
+	warehouse.Version++
+	warehouse.UpdatedAt = time.Now()
+	r.store.warehouses[id] = warehouse
+	return &warehouse, nil
+}
+
+func (r *memoryWarehouseRepository) Deactivate(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) error {
+	inactive := false
+	_, err := r.Update(ctx, companyID, id, WarehouseUpdate{IsActive: &inactive, IfVersion: ifVersion})
+	return err
+}
+
+func (r *memoryWarehouseRepository) SetSupervisor(ctx context.Context, id, supervisorID primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	warehouse, ok := r.store.warehouses[id]
+	if !ok {
+		return ErrNotFound
+	}
+	warehouse.SupervisorID = &supervisorID
+	warehouse.Version++
+	warehouse.UpdatedAt = time.Now()
+	r.store.warehouses[id] = warehouse
+	return nil
+}
+
+func (r *memoryWarehouseRepository) ClearSupervisor(ctx context.Context, supervisorID primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, warehouse := range r.store.warehouses {
+		if warehouse.SupervisorID != nil && *warehouse.SupervisorID == supervisorID {
+			warehouse.SupervisorID = nil
+			warehouse.Version++
+			warehouse.UpdatedAt = time.Now()
+			r.store.warehouses[id] = warehouse
+		}
+	}
+	return nil
+}
+
+type memoryItemRepository struct{ store *memoryStore }
+
+func (r *memoryItemRepository) Create(ctx context.Context, item *models.Item, location *models.ItemLocation) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.items[item.ID]; exists {
+		return ErrDuplicate
+	}
+	for _, existing := range r.store.items {
+		if existing.CompanyID == item.CompanyID && strings.EqualFold(existing.SKU, item.SKU) {
+			return ErrDuplicate
+		}
+	}
+	r.store.items[item.ID] = *item
+
+	if location != nil {
+		if location.ID.IsZero() {
+			location.ID = primitive.NewObjectID()
+		}
+		location.ItemID = item.ID
+		r.store.locations[location.ID] = *location
+	}
+	return nil
+}
+
+func (r *memoryItemRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Item, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	item, ok := r.store.items[id]
+	if !ok || item.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &item, nil
+}
+
+func (r *memoryItemRepository) GetBySKU(ctx context.Context, companyID primitive.ObjectID, sku string) (*models.Item, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, item := range r.store.items {
+		if item.CompanyID == companyID && strings.EqualFold(item.SKU, sku) {
+			return &item, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryItemRepository) ListStock(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error) {
+	return r.stock(companyID, filter, false), nil
+}
+
+func (r *memoryItemRepository) ListArchived(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error) {
+	return r.stock(companyID, filter, true), nil
+}
+
+func (r *memoryItemRepository) InCategory(ctx context.Context, categoryID primitive.ObjectID) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, item := range r.store.items {
+		if item.CategoryID != nil && *item.CategoryID == categoryID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (r *memoryItemRepository) stock(companyID primitive.ObjectID, filter ItemFilter, archived bool) []ItemStock {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	warehouseID := filter.WarehouseID
+	stock := []ItemStock{}
+	for _, item := range r.store.items {
+		if item.CompanyID != companyID || item.IsArchived != archived || !matchItem(item, filter) {
+			continue
+		}
+
+		entry := ItemStock{Item: item}
+		batchSet := false
+		for _, location := range r.sortedLocations(item.ID) {
+			if warehouseID != nil && location.WarehouseID != *warehouseID {
+				continue
+			}
+			entry.Quantity += location.Quantity
+			entry.Held += location.Held
+			if warehouseID != nil && !batchSet {
+				entry.Batch = location.Batch
+				batchSet = true
+			}
+		}
+
+		// Only show items present in the requested warehouse
+		if warehouseID != nil && entry.Quantity <= 0 {
+			continue
+		}
+		entry.Available = entry.Quantity - entry.Held
+		stock = append(stock, entry)
+	}
+	sort.Slice(stock, func(i, j int) bool { return stock[i].ID.Hex() < stock[j].ID.Hex() })
+	return stock
+}
+
+func (r *memoryItemRepository) Locations(ctx context.Context, itemID primitive.ObjectID) ([]models.ItemLocation, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return r.sortedLocations(itemID), nil
+}
+
+// sortedLocations returns an item's locations in ID order; callers hold the lock
+func (r *memoryItemRepository) sortedLocations(itemID primitive.ObjectID) []models.ItemLocation {
+	locations := []models.ItemLocation{}
+	for _, location := range r.store.locations {
+		if location.ItemID == itemID {
+			locations = append(locations, location)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID.Hex() < locations[j].ID.Hex() })
+	return locations
+}
+
+// matchItem reports whether an item is in one of the filter's categories and
+// has the attribute values it asks for
+func matchItem(item models.Item, filter ItemFilter) bool {
+	if filter.CategoryIDs != nil {
+		if item.CategoryID == nil || !slices.Contains(filter.CategoryIDs, *item.CategoryID) {
+			return false
+		}
+	}
+	for _, attribute := range filter.Attributes {
+		value, ok := item.Attributes[attribute.Key]
+		if !ok {
+			return false
+		}
+		if attribute.Value != nil {
+			if order, ok := compareValues(value, attribute.Value); !ok || order != 0 {
+				return false
+			}
+			continue
+		}
+		if attribute.Min != nil {
+			if order, ok := compareValues(value, attribute.Min); !ok || order < 0 {
+				return false
+			}
+		}
+		if attribute.Max != nil {
+			if order, ok := compareValues(value, attribute.Max); !ok || order > 0 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// compareValues orders two numbers or two strings, reporting false for
+// values that cannot be compared, as MongoDB does not compare across types
+func compareValues(a, b interface{}) (int, bool) {
+	if x, ok := number(a); ok {
+		y, ok := number(b)
+		if !ok {
+			return 0, false
+		}
+		switch {
+		case x < y:
+			return -1, true
+		case x > y:
+			return 1, true
+		}
+		return 0, true
+	}
+	x, ok := a.(string)
+	y, ok2 := b.(string)
+	if !ok || !ok2 {
+		return 0, false
+	}
+	return strings.Compare(x, y), true
+}
+
+func number(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case int:
+		return float64(n), true
+	case int32:
+		return float64(n), true
+	case int64:
+		return float64(n), true
+	}
+	return 0, false
+}
+
+func (r *memoryItemRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update ItemUpdate) (*models.Item, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	item, ok := r.store.items[id]
+	if !ok || item.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	if update.IfVersion != nil && *update.IfVersion != item.Version {
+		return nil, ErrVersionMismatch
+	}
+	if update.Name != nil {
+		item.Name = *update.Name
+	}
+	if update.Quality != nil {
+		item.Quality = *update.Quality
+	}
+	if update.Price != nil {
+		item.Price = *update.Price
+	}
+	if update.Currency != nil {
+		item.Currency = *update.Currency
+	}
+	if update.StandardCost != nil {
+		item.StandardCost = *update.StandardCost
+	}
+	if update.Department != nil {
+		item.Department = *update.Department
+	}
+	if update.Attributes != nil {
+		item.Attributes = update.Attributes
+	}
+	if update.Units != nil {
+		item.Units = update.Units
+	}
+	if update.CategoryID != nil {
+		item.CategoryID = nil
+		if !update.CategoryID.IsZero() {
+			categoryID := *update.CategoryID
+			item.CategoryID = &categoryID
+		}
+	}
+	item.Version++
+	item.UpdatedAt = time.Now()
+	r.store.items[id] = item
+	return &item, nil
+}
+
+func (r *memoryItemRepository) Archive(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64, archivedBy primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	item, ok := r.store.items[id]
+	if !ok || item.CompanyID != companyID {
+		return ErrNotFound
+	}
+	if ifVersion != nil && *ifVersion != item.Version {
+		return ErrVersionMismatch
+	}
+	now := time.Now()
+	item.IsArchived = true
+	item.ArchivedAt = &now
+	item.ArchivedBy = &archivedBy
+	item.Version++
+	item.UpdatedAt = now
+	r.store.items[id] = item
+	return nil
+}
+
+func (r *memoryItemRepository) Restore(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) (*models.Item, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	item, ok := r.store.items[id]
+	if !ok || item.CompanyID != companyID || !item.IsArchived {
+		return nil, ErrNotFound
+	}
+	if ifVersion != nil && *ifVersion != item.Version {
+		return nil, ErrVersionMismatch
+	}
+	item.IsArchived = false
+	item.ArchivedAt = nil
+	item.ArchivedBy = nil
+	item.Version++
+	item.UpdatedAt = time.Now()
+	r.store.items[id] = item
+	return &item, nil
+}
+
+func (r *memoryItemRepository) Purge(ctx context.Context, companyID, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	item, ok := r.store.items[id]
+	if !ok || item.CompanyID != companyID || !item.IsArchived {
+		return ErrNotFound
+	}
+	delete(r.store.items, id)
+	for locationID, location := range r.store.locations {
+		if location.ItemID == id {
+			delete(r.store.locations, locationID)
+		}
+	}
+	return nil
+}
+
+func (r *memoryItemRepository) AdjustQuantity(ctx context.Context, itemID, locationID primitive.ObjectID, change QuantityChange) (*models.ItemLocation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	location, ok := r.store.locations[locationID]
+	if !ok || location.ItemID != itemID || (change.WarehouseID != nil && location.WarehouseID != *change.WarehouseID) {
+		return nil, ErrNotFound
+	}
+	if change.IfVersion != nil && *change.IfVersion != location.Version {
+		return nil, ErrVersionMismatch
+	}
+
+	quantity := location.Quantity + change.Delta
+	if change.Set != nil {
+		quantity = *change.Set
+	}
+	held := location.Held + change.HeldDelta
+	if quantity < 0 || held < 0 || quantity < held {
+		return nil, ErrInsufficientStock
+	}
+	location.Quantity = quantity
+	location.Held = held
+	location.UpdatedBy = change.UpdatedBy
+	location.Version++
+	location.UpdatedAt = time.Now()
+	r.store.locations[locationID] = location
+	return &location, nil
+}
+
+func (r *memoryItemRepository) UpsertBySKU(ctx context.Context, item *models.Item, location *models.ItemLocation) (UpsertResult, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	created := true
+	for _, existing := range r.store.items {
+		if existing.CompanyID != item.CompanyID || !strings.EqualFold(existing.SKU, item.SKU) {
+			continue
+		}
+		existing.Name = item.Name
+		existing.Quality = item.Quality
+		existing.Price = item.Price
+		existing.Currency = item.Currency
+		existing.Department = item.Department
+		if item.Attributes != nil {
+			existing.Attributes = item.Attributes
+		}
+		existing.IsArchived = false
+		existing.ArchivedAt = nil
+		existing.ArchivedBy = nil
+		existing.Version++
+		existing.UpdatedAt = now
+		*item = existing
+		created = false
+		break
+	}
+	if created && item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	r.store.items[item.ID] = *item
+
+	for id, existing := range r.store.locations {
+		if existing.ItemID == item.ID && existing.WarehouseID == location.WarehouseID && existing.Batch == location.Batch && existing.BinID == nil {
+			if location.Quantity < existing.Held {
+				return UpsertResult{}, ErrInsufficientStock
+			}
+			delta := location.Quantity - existing.Quantity
+			existing.Quantity = location.Quantity
+			existing.UpdatedBy = location.UpdatedBy
+			existing.Version++
+			existing.UpdatedAt = now
+			r.store.locations[id] = existing
+			*location = existing
+			return UpsertResult{Created: created, Delta: delta}, nil
+		}
+	}
+	location.ID = primitive.NewObjectID()
+	location.ItemID = item.ID
+	location.Version = 1
+	location.CreatedAt = now
+	location.UpdatedAt = now
+	r.store.locations[location.ID] = *location
+	return UpsertResult{Created: created, Delta: location.Quantity}, nil
+}
+
+func (r *memoryItemRepository) Location(ctx context.Context, id primitive.ObjectID) (*models.ItemLocation, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	location, ok := r.store.locations[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	return &location, nil
+}
+
+func (r *memoryItemRepository) WarehouseLocations(ctx context.Context, warehouseID primitive.ObjectID, binID *primitive.ObjectID) ([]models.ItemLocation, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	locations := []models.ItemLocation{}
+	for _, location := range r.store.locations {
+		if location.WarehouseID == warehouseID && (binID == nil || sameID(location.BinID, binID)) {
+			locations = append(locations, location)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].ID.Hex() < locations[j].ID.Hex() })
+	return locations, nil
+}
+
+func (r *memoryItemRepository) AddToLocation(ctx context.Context, location *models.ItemLocation) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	for id, existing := range r.store.locations {
+		if existing.ItemID == location.ItemID && existing.WarehouseID == location.WarehouseID &&
+			existing.Batch == location.Batch && sameID(existing.BinID, location.BinID) {
+			existing.Quantity += location.Quantity
+			existing.UpdatedBy = location.UpdatedBy
+			existing.Version++
+			existing.UpdatedAt = now
+			r.store.locations[id] = existing
+			*location = existing
+			return nil
+		}
+	}
+	location.ID = primitive.NewObjectID()
+	location.Version = 1
+	location.CreatedAt = now
+	location.UpdatedAt = now
+	r.store.locations[location.ID] = *location
+	return nil
+}
+
+// sameID reports whether two optional IDs are both unset or equal
+func sameID(a, b *primitive.ObjectID) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return *a == *b
+}
+
+type memoryAuditRepository struct{ store *memoryStore }
+
+func (r *memoryAuditRepository) Insert(ctx context.Context, entry *models.AuditLog) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if entry.ID.IsZero() {
+		entry.ID = primitive.NewObjectID()
+	}
+	r.store.auditLogs = append(r.store.auditLogs, *entry)
+	return nil
+}
+
+func (r *memoryAuditRepository) Update(ctx context.Context, id primitive.ObjectID, update AuditUpdate) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for i := range r.store.auditLogs {
+		entry := &r.store.auditLogs[i]
+		if entry.ID != id {
+			continue
+		}
+		if update.Username != nil {
+			entry.Username = *update.Username
+		}
+		if update.DetailsEncrypted != nil {
+			entry.DetailsEncrypted = *update.DetailsEncrypted
+		}
+		return nil
+	}
+	return ErrNotFound
+}
+
+func (r *memoryAuditRepository) Each(ctx context.Context, query AuditQuery, fn func(entry models.AuditLog) error) error {
+	matches, err := query.Matcher()
+	if err != nil {
+		return err
+	}
+
+	// Snapshot under the lock so fn may log new entries without deadlocking
+	r.store.mu.RLock()
+	entries := make([]models.AuditLog, 0, len(r.store.auditLogs))
+	for _, entry := range r.store.auditLogs {
+		if matches(entry) {
+			entries = append(entries, entry)
+		}
+	}
+	r.store.mu.RUnlock()
+
+	sort.SliceStable(entries, func(i, j int) bool {
+		if query.NewestFirst {
+			return entries[i].CreatedAt.After(entries[j].CreatedAt)
+		}
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	for _, entry := range entries {
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *memoryAuditRepository) Exists(ctx context.Context, query AuditQuery) (bool, error) {
+	matches, err := query.Matcher()
+	if err != nil {
+		return false, err
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+	return slices.ContainsFunc(r.store.auditLogs, matches), nil
+}
+
+func (r *memoryAuditRepository) Usernames(ctx context.Context, companyID, userID primitive.ObjectID) ([]string, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	usernames := []string{}
+	for _, entry := range r.store.auditLogs {
+		if entry.CompanyID == companyID && entry.UserID == userID && entry.Username != "" && !slices.Contains(usernames, entry.Username) {
+			usernames = append(usernames, entry.Username)
+		}
+	}
+	return usernames, nil
+}
+
+func (r *memoryAuditRepository) Expired(ctx context.Context, companyID primitive.ObjectID, cutoff time.Time, holds []models.LegalHold, limit int) ([]models.AuditLog, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	entries := []models.AuditLog{}
+	for _, entry := range r.store.auditLogs {
+		if entry.CompanyID != companyID || !entry.CreatedAt.Before(cutoff) {
+			continue
+		}
+		held := slices.ContainsFunc(holds, func(hold models.LegalHold) bool {
+			return hold.Covers(entry)
+		})
+		if !held {
+			entries = append(entries, entry)
+		}
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	if len(entries) > limit {
+		entries = entries[:limit]
+	}
+	return entries, nil
+}
+
+func (r *memoryAuditRepository) Delete(ctx context.Context, ids []primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	r.store.auditLogs = slices.DeleteFunc(r.store.auditLogs, func(entry models.AuditLog) bool {
+		return slices.Contains(ids, entry.ID)
+	})
+	return nil
+}
+
+func (r *memoryAuditRepository) Restore(ctx context.Context, entries []models.AuditLog) (int, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	restored := 0
+	for _, entry := range entries {
+		present := slices.ContainsFunc(r.store.auditLogs, func(existing models.AuditLog) bool {
+			return existing.ID == entry.ID
+		})
+		if !present {
+			r.store.auditLogs = append(r.store.auditLogs, entry)
+			restored++
+		}
+	}
+	return restored, nil
+}
+
+type memoryRetentionRepository struct{ store *memoryStore }
+
+func (r *memoryRetentionRepository) Policy(ctx context.Context, companyID primitive.ObjectID) (*models.AuditRetentionPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	policy, ok := r.store.policies[companyID]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	policy.Holds = slices.Clone(policy.Holds)
+	return &policy, nil
+}
+
+// policy returns the company's policy, or a new keep-forever one. Callers hold the lock.
+func (r *memoryRetentionRepository) policy(companyID primitive.ObjectID, now time.Time) models.AuditRetentionPolicy {
+	policy, ok := r.store.policies[companyID]
+	if !ok {
+		return models.AuditRetentionPolicy{ID: primitive.NewObjectID(), CompanyID: companyID, CreatedAt: now}
+	}
+	policy.Holds = slices.Clone(policy.Holds)
+	return policy
+}
+
+func (r *memoryRetentionRepository) SetPolicy(ctx context.Context, update *models.AuditRetentionPolicy) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	policy := r.policy(update.CompanyID, now)
+	policy.RetentionDays = update.RetentionDays
+	policy.LegalHold = update.LegalHold
+	policy.LegalHoldReason = update.LegalHoldReason
+	policy.UpdatedBy = update.UpdatedBy
+	policy.UpdatedAt = now
+	r.store.policies[update.CompanyID] = policy
+	return nil
+}
+
+func (r *memoryRetentionRepository) AddHold(ctx context.Context, companyID primitive.ObjectID, hold models.LegalHold) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	policy := r.policy(companyID, now)
+	policy.Holds = append(policy.Holds, hold)
+	policy.UpdatedAt = now
+	r.store.policies[companyID] = policy
+	return nil
+}
+
+func (r *memoryRetentionRepository) RemoveHold(ctx context.Context, companyID, holdID primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	policy, ok := r.store.policies[companyID]
+	if !ok {
+		return ErrNotFound
+	}
+	holds := slices.DeleteFunc(slices.Clone(policy.Holds), func(hold models.LegalHold) bool {
+		return hold.ID == holdID
+	})
+	if len(holds) == len(policy.Holds) {
+		return ErrNotFound
+	}
+	policy.Holds = holds
+	policy.UpdatedAt = time.Now()
+	r.store.policies[companyID] = policy
+	return nil
+}
+
+func (r *memoryRetentionRepository) Expiring(ctx context.Context) ([]models.AuditRetentionPolicy, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	policies := []models.AuditRetentionPolicy{}
+	for _, policy := range r.store.policies {
+		if policy.RetentionDays > 0 && !policy.LegalHold {
+			policy.Holds = slices.Clone(policy.Holds)
+			policies = append(policies, policy)
+		}
+	}
+	return policies, nil
+}
+
+func (r *memoryRetentionRepository) SetLastRun(ctx context.Context, companyID primitive.ObjectID, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	policy, ok := r.store.policies[companyID]
+	if !ok {
+		return nil
+	}
+	policy.LastRunAt = &at
+	r.store.policies[companyID] = policy
+	return nil
+}
+
+func (r *memoryRetentionRepository) AddArchive(ctx context.Context, archive *models.AuditArchive) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if archive.ID.IsZero() {
+		archive.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.archives[archive.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.archives[archive.ID] = *archive
+	return nil
+}
+
+func (r *memoryRetentionRepository) GetArchive(ctx context.Context, companyID, id primitive.ObjectID) (*models.AuditArchive, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	archive, ok := r.store.archives[id]
+	if !ok || archive.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &archive, nil
+}
+
+func (r *memoryRetentionRepository) ListArchives(ctx context.Context, filter ArchiveFilter) ([]models.AuditArchive, error) {
+	var action *regexp.Regexp
+	if filter.Action != "" {
+		var err error
+		if action, err = regexp.Compile("(?i)" + filter.Action); err != nil {
+			return nil, err
+		}
+	}
+
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	archives := []models.AuditArchive{}
+	for _, archive := range r.store.archives {
+		switch {
+		case !filter.CompanyID.IsZero() && archive.CompanyID != filter.CompanyID:
+			continue
+		case filter.From != nil && archive.ToDate.Before(*filter.From):
+			continue
+		case filter.To != nil && archive.FromDate.After(*filter.To):
+			continue
+		case action != nil && !slices.ContainsFunc(archive.Actions, action.MatchString):
+			continue
+		case !filter.UserID.IsZero() && !slices.Contains(archive.UserIDs, filter.UserID):
+			continue
+		}
+		archives = append(archives, archive)
+	}
+	sort.Slice(archives, func(i, j int) bool {
+		return archives[i].FromDate.After(archives[j].FromDate)
+	})
+	return archives, nil
+}
+
+func (r *memoryRetentionRepository) SaveArchive(ctx context.Context, archive *models.AuditArchive) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.archives[archive.ID]; !ok {
+		return ErrNotFound
+	}
+	r.store.archives[archive.ID] = *archive
+	return nil
+}
+
+type memoryAlertRepository struct{ store *memoryStore }
+
+func (r *memoryAlertRepository) Create(ctx context.Context, alert *models.SecurityAlert) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if alert.ID.IsZero() {
+		alert.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.alerts[alert.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.alerts[alert.ID] = *alert
+	return nil
+}
+
+func (r *memoryAlertRepository) List(ctx context.Context, companyID primitive.ObjectID, filter AlertFilter, limit int) ([]models.SecurityAlert, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	alerts := []models.SecurityAlert{}
+	for _, alert := range r.store.alerts {
+		switch {
+		case alert.CompanyID != companyID:
+			continue
+		case filter.Status != "" && alert.Status != filter.Status:
+			continue
+		case filter.Rule != "" && alert.Rule != filter.Rule:
+			continue
+		case filter.Severity != "" && alert.Severity != filter.Severity:
+			continue
+		case !filter.UserID.IsZero() && alert.UserID != filter.UserID:
+			continue
+		}
+		alerts = append(alerts, alert)
+	}
+	sort.Slice(alerts, func(i, j int) bool {
+		return alerts[i].CreatedAt.After(alerts[j].CreatedAt)
+	})
+	if limit > 0 && len(alerts) > limit {
+		alerts = alerts[:limit]
+	}
+	return alerts, nil
+}
+
+func (r *memoryAlertRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update AlertUpdate) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	alert, ok := r.store.alerts[id]
+	if !ok || alert.CompanyID != companyID {
+		return ErrNotFound
+	}
+	if update.Username != nil {
+		alert.Username = *update.Username
+	}
+	if update.Title != nil {
+		alert.Title = *update.Title
+	}
+	if update.Description != nil {
+		alert.Description = *update.Description
+	}
+	r.store.alerts[id] = alert
+	return nil
+}
+
+func (r *memoryAlertRepository) SetStatus(ctx context.Context, companyID, id primitive.ObjectID, status, note string, handledBy primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	alert, ok := r.store.alerts[id]
+	if !ok || alert.CompanyID != companyID {
+		return ErrNotFound
+	}
+	now := time.Now()
+	alert.Status = status
+	alert.ResolutionNote = note
+	alert.HandledBy = handledBy
+	alert.HandledAt = &now
+	alert.UpdatedAt = now
+	r.store.alerts[id] = alert
+	return nil
+}
+
+type memoryBackupRepository struct{ store *memoryStore }
+
+func (r *memoryBackupRepository) Create(ctx context.Context, backup *models.Backup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if backup.ID.IsZero() {
+		backup.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.backups[backup.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.backups[backup.ID] = *backup
+	return nil
+}
+
+func (r *memoryBackupRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Backup, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	backup, ok := r.store.backups[id]
+	if !ok || (!companyID.IsZero() && backup.CompanyID != companyID) {
+		return nil, ErrNotFound
+	}
+	return &backup, nil
+}
+
+func (r *memoryBackupRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.Backup, error) {
+	return r.filter(func(backup models.Backup) bool {
+		return backup.CompanyID == companyID
+	}), nil
+}
+
+func (r *memoryBackupRepository) All(ctx context.Context) ([]models.Backup, error) {
+	return r.filter(func(models.Backup) bool { return true }), nil
+}
+
+func (r *memoryBackupRepository) Expired(ctx context.Context, before time.Time) ([]models.Backup, error) {
+	return r.filter(func(backup models.Backup) bool {
+		return backup.RetentionUntil.Before(before)
+	}), nil
+}
+
+// filter returns the backups matching keep, newest first
+func (r *memoryBackupRepository) filter(keep func(models.Backup) bool) []models.Backup {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	backups := []models.Backup{}
+	for _, backup := range r.store.backups {
+		if keep(backup) {
+			backups = append(backups, backup)
+		}
+	}
+	sort.Slice(backups, func(i, j int) bool {
+		return backups[i].CreatedAt.After(backups[j].CreatedAt)
+	})
+	return backups
+}
+
+func (r *memoryBackupRepository) Save(ctx context.Context, backup *models.Backup) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.backups[backup.ID]; !ok {
+		return ErrNotFound
+	}
+	r.store.backups[backup.ID] = *backup
+	return nil
+}
+
+func (r *memoryBackupRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.backups[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.backups, id)
+	return nil
+}
+
+type memoryCostRepository struct{ store *memoryStore }
+
+func (r *memoryCostRepository) AddLayer(ctx context.Context, layer *models.CostLayer) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if layer.ID.IsZero() {
+		layer.ID = primitive.NewObjectID()
+	}
+	r.store.costLayers[layer.ID] = *layer
+	return nil
+}
+
+func (r *memoryCostRepository) OpenLayers(ctx context.Context, itemID, warehouseID primitive.ObjectID) ([]models.CostLayer, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	layers := []models.CostLayer{}
+	for _, layer := range r.store.costLayers {
+		if layer.ItemID == itemID && layer.WarehouseID == warehouseID && layer.Remaining > 0 {
+			layers = append(layers, layer)
+		}
+	}
+	sort.Slice(layers, func(i, j int) bool {
+		if !layers[i].ReceivedAt.Equal(layers[j].ReceivedAt) {
+			return layers[i].ReceivedAt.Before(layers[j].ReceivedAt)
+		}
+		return layers[i].ID.Hex() < layers[j].ID.Hex()
+	})
+	return layers, nil
+}
+
+func (r *memoryCostRepository) ConsumeLayer(ctx context.Context, id primitive.ObjectID, quantity int) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	layer, ok := r.store.costLayers[id]
+	if !ok || layer.Remaining < quantity {
+		return ErrInsufficientStock
+	}
+	layer.Remaining -= quantity
+	r.store.costLayers[id] = layer
+	return nil
+}
+
+func (r *memoryCostRepository) AddMovement(ctx context.Context, movement *models.CostMovement) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if movement.ID.IsZero() {
+		movement.ID = primitive.NewObjectID()
+	}
+	r.store.movements = append(r.store.movements, *movement)
+	return nil
+}
+
+func (r *memoryCostRepository) Position(ctx context.Context, itemID, warehouseID primitive.ObjectID) (int, int64, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	quantity, value := 0, int64(0)
+	for _, movement := range r.store.movements {
+		if movement.ItemID != itemID || movement.WarehouseID != warehouseID {
+			continue
+		}
+		movementQuantity, movementValue := signedMovement(movement)
+		quantity += movementQuantity
+		value += movementValue
+	}
+	return quantity, value, nil
+}
+
+func (r *memoryCostRepository) Positions(ctx context.Context, itemID primitive.ObjectID) ([]CostHolding, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	byWarehouse := map[primitive.ObjectID]*CostHolding{}
+	for _, movement := range r.store.movements {
+		if movement.ItemID != itemID {
+			continue
+		}
+		position, ok := byWarehouse[movement.WarehouseID]
+		if !ok {
+			position = &CostHolding{ItemID: itemID, WarehouseID: movement.WarehouseID}
+			byWarehouse[movement.WarehouseID] = position
+		}
+		quantity, value := signedMovement(movement)
+		position.Quantity += quantity
+		position.Value += value
+	}
+
+	positions := []CostHolding{}
+	for _, position := range byWarehouse {
+		positions = append(positions, *position)
+	}
+	sort.Slice(positions, func(i, j int) bool { return positions[i].WarehouseID.Hex() < positions[j].WarehouseID.Hex() })
+	return positions, nil
+}
+
+// signedMovement returns the quantity and value a movement adds to what is
+// held: issues take away, receipts and revaluations add
+func signedMovement(movement models.CostMovement) (int, int64) {
+	if movement.Type == models.MovementIssue {
+		return -movement.Quantity, -movement.TotalCost
+	}
+	return movement.Quantity, movement.TotalCost
+}
+
+func (r *memoryCostRepository) Summarize(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, from, to time.Time) ([]CostSummary, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	byWarehouse := map[primitive.ObjectID]*CostSummary{}
+	for _, movement := range r.store.movements {
+		if movement.CompanyID != companyID || !movement.OccurredAt.Before(to) {
+			continue
+		}
+		if warehouseID != nil && movement.WarehouseID != *warehouseID {
+			continue
+		}
+		summary, ok := byWarehouse[movement.WarehouseID]
+		if !ok {
+			summary = &CostSummary{WarehouseID: movement.WarehouseID}
+			byWarehouse[movement.WarehouseID] = summary
+		}
+		switch {
+		case movement.OccurredAt.Before(from):
+			quantity, value := signedMovement(movement)
+			summary.OpeningQuantity += quantity
+			summary.OpeningValue += value
+		case movement.Type == models.MovementReceipt:
+			summary.ReceivedQuantity += movement.Quantity
+			summary.ReceivedValue += movement.TotalCost
+		case movement.Type == models.MovementIssue:
+			summary.IssuedQuantity += movement.Quantity
+			summary.IssuedCost += movement.TotalCost
+		default:
+			summary.RevaluedValue += movement.TotalCost
+		}
+	}
+
+	summaries := []CostSummary{}
+	for _, summary := range byWarehouse {
+		summaries = append(summaries, *summary)
+	}
+	sort.Slice(summaries, func(i, j int) bool { return summaries[i].WarehouseID.Hex() < summaries[j].WarehouseID.Hex() })
+	return summaries, nil
+}
+
+func (r *memoryCostRepository) Holdings(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, at time.Time) ([]CostHolding, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	type key struct{ item, warehouse primitive.ObjectID }
+	byKey := map[key]*CostHolding{}
+	for _, movement := range r.store.movements {
+		if movement.CompanyID != companyID || !movement.OccurredAt.Before(at) {
+			continue
+		}
+		if warehouseID != nil && movement.WarehouseID != *warehouseID {
+			continue
+		}
+		k := key{movement.ItemID, movement.WarehouseID}
+		holding, ok := byKey[k]
+		if !ok {
+			holding = &CostHolding{ItemID: movement.ItemID, WarehouseID: movement.WarehouseID}
+			byKey[k] = holding
+		}
+		quantity, value := signedMovement(movement)
+		holding.Quantity += quantity
+		holding.Value += value
+	}
+
+	holdings := []CostHolding{}
+	for _, holding := range byKey {
+		holdings = append(holdings, *holding)
+	}
+	sort.Slice(holdings, func(i, j int) bool {
+		if holdings[i].WarehouseID != holdings[j].WarehouseID {
+			return holdings[i].WarehouseID.Hex() < holdings[j].WarehouseID.Hex()
+		}
+		return holdings[i].ItemID.Hex() < holdings[j].ItemID.Hex()
+	})
+	return holdings, nil
+}
+
+func (r *memoryCostRepository) HasMovements(ctx context.Context, companyID primitive.ObjectID) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, movement := range r.store.movements {
+		if movement.CompanyID == companyID {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryPriceRepository struct{ store *memoryStore }
+
+func (r *memoryPriceRepository) Add(ctx context.Context, price *models.ItemPrice) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if price.ID.IsZero() {
+		price.ID = primitive.NewObjectID()
+	}
+	r.store.prices[price.ID] = *price
+	return nil
+}
+
+func (r *memoryPriceRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ItemPrice, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	price, ok := r.store.prices[id]
+	if !ok || price.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &price, nil
+}
+
+func (r *memoryPriceRepository) List(ctx context.Context, companyID, itemID primitive.ObjectID) ([]models.ItemPrice, error) {
+	return r.filter(func(price models.ItemPrice) bool {
+		return price.CompanyID == companyID && price.ItemID == itemID
+	}), nil
+}
+
+func (r *memoryPriceRepository) SetEffectiveTo(ctx context.Context, id primitive.ObjectID, to *time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	price, ok := r.store.prices[id]
+	if !ok {
+		return ErrNotFound
+	}
+	price.EffectiveTo = to
+	r.store.prices[id] = price
+	return nil
+}
+
+func (r *memoryPriceRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.prices[id]; !ok {
+		return ErrNotFound
+	}
+	delete(r.store.prices, id)
+	return nil
+}
+
+func (r *memoryPriceRepository) Effective(ctx context.Context, companyID primitive.ObjectID, at time.Time) ([]models.ItemPrice, error) {
+	return r.filter(func(price models.ItemPrice) bool {
+		return price.CompanyID == companyID && !price.EffectiveFrom.After(at) &&
+			(price.EffectiveTo == nil || price.EffectiveTo.After(at))
+	}), nil
+}
+
+func (r *memoryPriceRepository) Due(ctx context.Context, at time.Time) ([]models.ItemPrice, error) {
+	return r.filter(func(price models.ItemPrice) bool {
+		return !price.Applied && !price.EffectiveFrom.After(at)
+	}), nil
+}
+
+func (r *memoryPriceRepository) MarkApplied(ctx context.Context, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	price, ok := r.store.prices[id]
+	if !ok {
+		return ErrNotFound
+	}
+	price.Applied = true
+	r.store.prices[id] = price
+	return nil
+}
+
+// filter returns the matching prices, earliest first
+func (r *memoryPriceRepository) filter(match func(models.ItemPrice) bool) []models.ItemPrice {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	prices := []models.ItemPrice{}
+	for _, price := range r.store.prices {
+		if match(price) {
+			prices = append(prices, price)
+		}
+	}
+	sort.Slice(prices, func(i, j int) bool { return prices[i].EffectiveFrom.Before(prices[j].EffectiveFrom) })
+	return prices
+}
+
+type memoryLayoutRepository struct{ store *memoryStore }
+
+func (r *memoryLayoutRepository) Create(ctx context.Context, location *models.StorageLocation) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if location.ID.IsZero() {
+		location.ID = primitive.NewObjectID()
+	}
+	for _, existing := range r.store.layout {
+		if existing.ID == location.ID || (existing.WarehouseID == location.WarehouseID &&
+			sameID(existing.ParentID, location.ParentID) && existing.Code == location.Code) {
+			return ErrDuplicate
+		}
+	}
+	r.store.layout[location.ID] = *location
+	return nil
+}
+
+func (r *memoryLayoutRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.StorageLocation, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	location, ok := r.store.layout[id]
+	if !ok || location.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &location, nil
+}
+
+func (r *memoryLayoutRepository) List(ctx context.Context, companyID, warehouseID primitive.ObjectID) ([]models.StorageLocation, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	locations := []models.StorageLocation{}
+	for _, location := range r.store.layout {
+		if location.CompanyID == companyID && location.WarehouseID == warehouseID {
+			locations = append(locations, location)
+		}
+	}
+	sort.Slice(locations, func(i, j int) bool { return locations[i].Path < locations[j].Path })
+	return locations, nil
+}
+
+func (r *memoryLayoutRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update LayoutUpdate) (*models.StorageLocation, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	location, ok := r.store.layout[id]
+	if !ok || location.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	if update.Name != nil {
+		location.Name = *update.Name
+	}
+	if update.Capacity != nil {
+		location.Capacity = *update.Capacity
+	}
+	location.UpdatedAt = time.Now()
+	r.store.layout[id] = location
+	return &location, nil
+}
+
+func (r *memoryLayoutRepository) Delete(ctx context.Context, companyID, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	location, ok := r.store.layout[id]
+	if !ok || location.CompanyID != companyID {
+		return ErrNotFound
+	}
+	delete(r.store.layout, id)
+	return nil
+}
+
+func (r *memoryLayoutRepository) HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, location := range r.store.layout {
+		if location.ParentID != nil && *location.ParentID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryCategoryRepository struct{ store *memoryStore }
+
+func (r *memoryCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if category.ID.IsZero() {
+		category.ID = primitive.NewObjectID()
+	}
+	for _, existing := range r.store.categories {
+		if existing.ID == category.ID || r.siblings(existing, *category) {
+			return ErrDuplicate
+		}
+	}
+	r.store.categories[category.ID] = *category
+	return nil
+}
+
+// siblings reports whether two categories would share a name under one
+// parent; callers hold the lock
+func (r *memoryCategoryRepository) siblings(a, b models.Category) bool {
+	return a.ID != b.ID && a.CompanyID == b.CompanyID && sameID(a.ParentID, b.ParentID) && a.Name == b.Name
+}
+
+func (r *memoryCategoryRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	category, ok := r.store.categories[id]
+	if !ok || category.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	return &category, nil
+}
+
+func (r *memoryCategoryRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.Category, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	categories := []models.Category{}
+	for _, category := range r.store.categories {
+		if category.CompanyID == companyID {
+			categories = append(categories, category)
+		}
+	}
+	sort.Slice(categories, func(i, j int) bool { return categories[i].Name < categories[j].Name })
+	return categories, nil
+}
+
+func (r *memoryCategoryRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update CategoryUpdate) (*models.Category, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	category, ok := r.store.categories[id]
+	if !ok || category.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	if update.Name != nil {
+		category.Name = *update.Name
+		for _, existing := range r.store.categories {
+			if r.siblings(existing, category) {
+				return nil, ErrDuplicate
+			}
+		}
+	}
+	if update.Attributes != nil {
+		category.Attributes = update.Attributes
+	}
+	category.UpdatedAt = time.Now()
+	r.store.categories[id] = category
+	return &category, nil
+}
+
+func (r *memoryCategoryRepository) Delete(ctx context.Context, companyID, id primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	category, ok := r.store.categories[id]
+	if !ok || category.CompanyID != companyID {
+		return ErrNotFound
+	}
+	delete(r.store.categories, id)
+	return nil
+}
+
+func (r *memoryCategoryRepository) HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, category := range r.store.categories {
+		if category.ParentID != nil && *category.ParentID == id {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+type memoryKitRepository struct{ store *memoryStore }
+
+func (r *memoryKitRepository) Save(ctx context.Context, bom *models.BOM) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	now := time.Now()
+	bom.ID = primitive.NewObjectID()
+	bom.CreatedAt = now
+	for _, existing := range r.store.boms {
+		if existing.CompanyID == bom.CompanyID && existing.KitItemID == bom.KitItemID {
+			bom.ID = existing.ID
+			bom.CreatedAt = existing.CreatedAt
+		}
+	}
+	bom.UpdatedAt = now
+	bom.Components = slices.Clone(bom.Components)
+	r.store.boms[bom.ID] = *bom
+	return nil
+}
+
+func (r *memoryKitRepository) Get(ctx context.Context, companyID, kitItemID primitive.ObjectID) (*models.BOM, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	for _, bom := range r.store.boms {
+		if bom.CompanyID == companyID && bom.KitItemID == kitItemID {
+			return &bom, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (r *memoryKitRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.BOM, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	boms := []models.BOM{}
+	for _, bom := range r.store.boms {
+		if bom.CompanyID == companyID {
+			boms = append(boms, bom)
+		}
+	}
+	return boms, nil
+}
+
+func (r *memoryKitRepository) Delete(ctx context.Context, companyID, kitItemID primitive.ObjectID) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, bom := range r.store.boms {
+		if bom.CompanyID == companyID && bom.KitItemID == kitItemID {
+			delete(r.store.boms, id)
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (r *memoryKitRepository) AddBuild(ctx context.Context, build *models.KitBuild) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if build.ID.IsZero() {
+		build.ID = primitive.NewObjectID()
+	}
+	r.store.kitBuilds = append(r.store.kitBuilds, *build)
+	return nil
+}
+
+func (r *memoryKitRepository) Builds(ctx context.Context, companyID, kitItemID primitive.ObjectID) ([]models.KitBuild, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	builds := []models.KitBuild{}
+	for _, build := range r.store.kitBuilds {
+		if build.CompanyID == companyID && build.KitItemID == kitItemID {
+			builds = append(builds, build)
+		}
+	}
+	sort.SliceStable(builds, func(i, j int) bool { return builds[i].CreatedAt.After(builds[j].CreatedAt) })
+	return builds, nil
+}
+
+type memorySequenceRepository struct{ store *memoryStore }
+
+func (r *memorySequenceRepository) Next(ctx context.Context, companyID primitive.ObjectID, key string) (int64, error) {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	sequence := models.Sequence{ID: primitive.NewObjectID(), CompanyID: companyID, Key: key}
+	for _, existing := range r.store.sequences {
+		if existing.CompanyID == companyID && existing.Key == key {
+			sequence = existing
+			break
+		}
+	}
+	sequence.Value++
+	sequence.UpdatedAt = time.Now()
+	r.store.sequences[sequence.ID] = sequence
+	return sequence.Value, nil
+}
+
+type memoryQualityHoldRepository struct{ store *memoryStore }
+
+func (r *memoryQualityHoldRepository) Create(ctx context.Context, hold *models.QualityHold) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if hold.ID.IsZero() {
+		hold.ID = primitive.NewObjectID()
+	}
+	r.store.holds[hold.ID] = cloneHold(*hold)
+	return nil
+}
+
+func (r *memoryQualityHoldRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.QualityHold, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	hold, ok := r.store.holds[id]
+	if !ok || hold.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	hold = cloneHold(hold)
+	return &hold, nil
+}
+
+func (r *memoryQualityHoldRepository) List(ctx context.Context, companyID primitive.ObjectID, filter QualityHoldFilter) ([]models.QualityHold, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	holds := []models.QualityHold{}
+	for _, hold := range r.store.holds {
+		switch {
+		case hold.CompanyID != companyID:
+		case filter.WarehouseID != nil && hold.WarehouseID != *filter.WarehouseID:
+		case filter.ItemID != nil && hold.ItemID != *filter.ItemID:
+		case filter.Status != "" && hold.Status != filter.Status:
+		default:
+			holds = append(holds, cloneHold(hold))
+		}
+	}
+	sort.Slice(holds, func(i, j int) bool {
+		if !holds[i].CreatedAt.Equal(holds[j].CreatedAt) {
+			return holds[i].CreatedAt.After(holds[j].CreatedAt)
+		}
+		return holds[i].ID.Hex() > holds[j].ID.Hex()
+	})
+	return holds, nil
+}
+
+func (r *memoryQualityHoldRepository) Save(ctx context.Context, hold *models.QualityHold) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	stored, ok := r.store.holds[hold.ID]
+	if !ok || stored.CompanyID != hold.CompanyID {
+		return ErrNotFound
+	}
+	if stored.Version != hold.Version {
+		return ErrVersionMismatch
+	}
+	hold.Version++
+	hold.UpdatedAt = time.Now()
+	r.store.holds[hold.ID] = cloneHold(*hold)
+	return nil
+}
+
+// cloneHold copies a hold's inspections and decisions so the store never
+// shares them with callers
+func cloneHold(hold models.QualityHold) models.QualityHold {
+	hold.Inspections = slices.Clone(hold.Inspections)
+	hold.Decisions = slices.Clone(hold.Decisions)
+	return hold
+}
+
+type memoryImportJobRepository struct{ store *memoryStore }
+
+func (r *memoryImportJobRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	if _, exists := r.store.importJobs[job.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.importJobs[job.ID] = cloneImportJob(*job)
+	return nil
+}
+
+func (r *memoryImportJobRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ImportJob, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	job, ok := r.store.importJobs[id]
+	if !ok || job.CompanyID != companyID {
+		return nil, ErrNotFound
+	}
+	job = cloneImportJob(job)
+	return &job, nil
+}
+
+func (r *memoryImportJobRepository) Save(ctx context.Context, job *models.ImportJob) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, ok := r.store.importJobs[job.ID]; !ok {
+		return ErrNotFound
+	}
+	r.store.importJobs[job.ID] = cloneImportJob(*job)
+	return nil
+}
+
+func (r *memoryImportJobRepository) FailRunning(ctx context.Context, message string, at time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	for id, job := range r.store.importJobs {
+		if job.Status != models.ImportStatusRunning {
+			continue
+		}
+		job.Status = models.ImportStatusFailed
+		job.Error = message
+		job.CompletedAt = &at
+		job.UpdatedAt = at
+		r.store.importJobs[id] = job
+	}
+	return nil
+}
+
+func cloneImportJob(job models.ImportJob) models.ImportJob {
+	job.Errors = slices.Clone(job.Errors)
+	return job
+}
+
+type memoryIdempotencyRepository struct{ store *memoryStore }
+
+func (r *memoryIdempotencyRepository) Claim(ctx context.Context, record *models.IdempotencyRecord) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if _, exists := r.store.idempotencyKeys[record.ID]; exists {
+		return ErrDuplicate
+	}
+	r.store.idempotencyKeys[record.ID] = *record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Get(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	r.store.mu.RLock()
+	defer r.store.mu.RUnlock()
+
+	record, ok := r.store.idempotencyKeys[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	record.Headers = maps.Clone(record.Headers)
+	record.Body = slices.Clone(record.Body)
+	return &record, nil
+}
+
+func (r *memoryIdempotencyRepository) Complete(ctx context.Context, id string, statusCode int, headers map[string]string, body []byte, expiresAt time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	record, ok := r.store.idempotencyKeys[id]
+	if !ok {
+		return nil
+	}
+	record.Completed = true
+	record.StatusCode = statusCode
+	record.Headers = maps.Clone(headers)
+	record.Body = slices.Clone(body)
+	record.ExpiresAt = expiresAt
+	r.store.idempotencyKeys[id] = record
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) Release(ctx context.Context, id string) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if record, ok := r.store.idempotencyKeys[id]; ok && !record.Completed {
+		delete(r.store.idempotencyKeys, id)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepository) DeleteExpired(ctx context.Context, id string, expiresAt time.Time) error {
+	r.store.mu.Lock()
+	defer r.store.mu.Unlock()
+
+	if record, ok := r.store.idempotencyKeys[id]; ok && record.ExpiresAt.Equal(expiresAt) {
+		delete(r.store.idempotencyKeys, id)
+	}
+	return nil
+}
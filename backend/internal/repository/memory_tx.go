@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"sync"
+)
+
+type memoryTxKey struct{}
+
+// memoryTransactor serializes transactions and rolls the store back to a
+// snapshot when fn fails. Writes made outside a transaction while one is
+// running are not isolated from it. Audit entries are append-only and kept,
+// and so are import jobs and idempotency keys, which are only written outside
+// transactions.
+type memoryTransactor struct {
+	mu    sync.Mutex
+	store *memoryStore
+}
+
+func (t *memoryTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if ctx.Value(memoryTxKey{}) != nil {
+		return fn(ctx)
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	snapshot := t.store.snapshot()
+	if err := fn(context.WithValue(ctx, memoryTxKey{}, t)); err != nil {
+		t.store.restore(snapshot)
+		return err
+	}
+	return nil
+}
+
+// snapshot copies every collection except the audit log, import jobs and
+// idempotency keys
+func (s *memoryStore) snapshot() *memoryStore {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return &memoryStore{
+		companies:  maps.Clone(s.companies),
+		users:      maps.Clone(s.users),
+		warehouses: maps.Clone(s.warehouses),
+		items:      maps.Clone(s.items),
+		locations:  maps.Clone(s.locations),
+		costLayers: maps.Clone(s.costLayers),
+		movements:  slices.Clone(s.movements),
+		prices:     maps.Clone(s.prices),
+		layout:     maps.Clone(s.layout),
+		categories: maps.Clone(s.categories),
+		boms:       maps.Clone(s.boms),
+		kitBuilds:  slices.Clone(s.kitBuilds),
+		sequences:  maps.Clone(s.sequences),
+		holds:      maps.Clone(s.holds),
+		policies:   maps.Clone(s.policies),
+		archives:   maps.Clone(s.archives),
+		alerts:     maps.Clone(s.alerts),
+		backups:    maps.Clone(s.backups),
+	}
+}
+
+func (s *memoryStore) restore(snapshot *memoryStore) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.companies = snapshot.companies
+	s.users = snapshot.users
+	s.warehouses = snapshot.warehouses
+	s.items = snapshot.items
+	s.locations = snapshot.locations
+	s.costLayers = snapshot.costLayers
+	s.movements = snapshot.movements
+	s.prices = snapshot.prices
+	s.layout = snapshot.layout
+	s.categories = snapshot.categories
+	s.boms = snapshot.boms
+	s.kitBuilds = snapshot.kitBuilds
+	s.sequences = snapshot.sequences
+	s.holds = snapshot.holds
+	s.policies = snapshot.policies
+	s.archives = snapshot.archives
+	s.alerts = snapshot.alerts
+	s.backups = snapshot.backups
+}
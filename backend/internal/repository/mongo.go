@@ -0,0 +1,162 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// NewMongoRepositories returns repositories backed by db
+func NewMongoRepositories(db *mongo.Database) *Repositories {
+	tx := &mongoTransactor{client: db.Client()}
+	return &Repositories{
+		Tx:        tx,
+		Companies: &mongoCompanyRepository{collection: db.Collection("companies")},
+		Users: &mongoUserRepository{
+			collection: db.Collection("users"),
+			sessions:   db.Collection("sessions"),
+		},
+		Warehouses: &mongoWarehouseRepository{collection: db.Collection("warehouses")},
+		Items: &mongoItemRepository{
+			tx:        tx,
+			items:     db.Collection("items"),
+			locations: db.Collection("item_locations"),
+		},
+		Costs: &mongoCostRepository{
+			layers:    db.Collection("cost_layers"),
+			movements: db.Collection("cost_movements"),
+		},
+		Prices:     &mongoPriceRepository{collection: db.Collection("item_prices")},
+		Layout:     &mongoLayoutRepository{collection: db.Collection("storage_locations")},
+		Categories: &mongoCategoryRepository{collection: db.Collection("categories")},
+		Kits: &mongoKitRepository{
+			boms:   db.Collection("boms"),
+			builds: db.Collection("kit_builds"),
+		},
+		Sequences:    &mongoSequenceRepository{collection: db.Collection("sequences")},
+		QualityHolds: &mongoQualityHoldRepository{collection: db.Collection("quality_holds")},
+		Audit:        &mongoAuditRepository{collection: db.Collection("audit_logs")},
+		Retention: &mongoRetentionRepository{
+			policies: db.Collection("audit_retention_policies"),
+			archives: db.Collection("audit_archives"),
+		},
+		Alerts:      &mongoAlertRepository{collection: db.Collection("security_alerts")},
+		Backups:     &mongoBackupRepository{collection: db.Collection("backups")},
+		ImportJobs:  &mongoImportJobRepository{collection: db.Collection("import_jobs")},
+		Idempotency: &mongoIdempotencyRepository{collection: db.Collection("idempotency_keys")},
+	}
+}
+
+// mongoError maps driver errors onto repository errors
+func mongoError(err error) error {
+	switch {
+	case err == mongo.ErrNoDocuments:
+		return ErrNotFound
+	case mongo.IsDuplicateKeyError(err):
+		return ErrDuplicate
+	}
+	return err
+}
+
+// withVersion copies filter and, when version is set, restricts it to that
+// version. Documents written before versioning have none and count as 0.
+func withVersion(filter bson.M, version *int64) bson.M {
+	conditional := bson.M{}
+	for key, value := range filter {
+		conditional[key] = value
+	}
+	if version != nil {
+		if *version == 0 {
+			conditional["version"] = bson.M{"$in": bson.A{0, nil}}
+		} else {
+			conditional["version"] = *version
+		}
+	}
+	return conditional
+}
+
+// conditionalError explains a conditional write that matched nothing: the
+// document is either gone or has moved on to another version
+func conditionalError(ctx context.Context, collection *mongo.Collection, filter bson.M) error {
+	found, err := exists(ctx, collection, filter)
+	if err != nil {
+		return err
+	}
+	if !found {
+		return ErrNotFound
+	}
+	return ErrVersionMismatch
+}
+
+func exists(ctx context.Context, collection *mongo.Collection, filter bson.M) (bool, error) {
+	count, err := collection.CountDocuments(ctx, filter, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+type mongoCompanyRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoCompanyRepository) Create(ctx context.Context, company *models.Company) error {
+	if company.ID.IsZero() {
+		company.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, company)
+	return mongoError(err)
+}
+
+func (r *mongoCompanyRepository) Get(ctx context.Context, id primitive.ObjectID) (*models.Company, error) {
+	var company models.Company
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&company); err != nil {
+		return nil, mongoError(err)
+	}
+	return &company, nil
+}
+
+func (r *mongoCompanyRepository) IDs(ctx context.Context) ([]primitive.ObjectID, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{},
+		options.Find().SetProjection(bson.M{"_id": 1}).SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	ids := []primitive.ObjectID{}
+	for cursor.Next(ctx) {
+		var doc struct {
+			ID primitive.ObjectID `bson:"_id"`
+		}
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, err
+		}
+		ids = append(ids, doc.ID)
+	}
+	return ids, cursor.Err()
+}
+
+func (r *mongoCompanyRepository) Update(ctx context.Context, id primitive.ObjectID, update CompanyUpdate) (*models.Company, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Currency != nil {
+		set["currency"] = *update.Currency
+	}
+	if update.ValuationMethod != nil {
+		set["valuation_method"] = *update.ValuationMethod
+	}
+	if update.SKUPattern != nil {
+		set["sku_pattern"] = update.SKUPattern
+	}
+
+	var company models.Company
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&company)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &company, nil
+}
@@ -0,0 +1,97 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAlertRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAlertRepository) Create(ctx context.Context, alert *models.SecurityAlert) error {
+	if alert.ID.IsZero() {
+		alert.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, alert)
+	return mongoError(err)
+}
+
+func (r *mongoAlertRepository) List(ctx context.Context, companyID primitive.ObjectID, filter AlertFilter, limit int) ([]models.SecurityAlert, error) {
+	query := bson.M{"company_id": companyID}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	if filter.Rule != "" {
+		query["rule"] = filter.Rule
+	}
+	if filter.Severity != "" {
+		query["severity"] = filter.Severity
+	}
+	if !filter.UserID.IsZero() {
+		query["user_id"] = filter.UserID
+	}
+
+	cursor, err := r.collection.Find(ctx, query,
+		options.Find().SetSort(bson.M{"created_at": -1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	alerts := []models.SecurityAlert{}
+	if err := cursor.All(ctx, &alerts); err != nil {
+		return nil, err
+	}
+	return alerts, nil
+}
+
+func (r *mongoAlertRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update AlertUpdate) error {
+	set := bson.M{}
+	if update.Username != nil {
+		set["username"] = *update.Username
+	}
+	if update.Title != nil {
+		set["title"] = *update.Title
+	}
+	if update.Description != nil {
+		set["description"] = *update.Description
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id, "company_id": companyID}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAlertRepository) SetStatus(ctx context.Context, companyID, id primitive.ObjectID, status, note string, handledBy primitive.ObjectID) error {
+	now := time.Now()
+	result, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id, "company_id": companyID},
+		bson.M{"$set": bson.M{
+			"status":          status,
+			"resolution_note": note,
+			"handled_by":      handledBy,
+			"handled_at":      now,
+			"updated_at":      now,
+		}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,197 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoAuditRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoAuditRepository) Insert(ctx context.Context, entry *models.AuditLog) error {
+	_, err := r.collection.InsertOne(ctx, entry)
+	return mongoError(err)
+}
+
+func (r *mongoAuditRepository) Update(ctx context.Context, id primitive.ObjectID, update AuditUpdate) error {
+	set := bson.M{}
+	if update.Username != nil {
+		set["username"] = *update.Username
+	}
+	if update.DetailsEncrypted != nil {
+		set["details_encrypted"] = *update.DetailsEncrypted
+	}
+	if len(set) == 0 {
+		return nil
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoAuditRepository) Each(ctx context.Context, query AuditQuery, fn func(entry models.AuditLog) error) error {
+	order := 1
+	if query.NewestFirst {
+		order = -1
+	}
+
+	cursor, err := r.collection.Find(ctx, auditFilter(query), options.Find().SetSort(bson.M{"created_at": order}))
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var entry models.AuditLog
+		if err := cursor.Decode(&entry); err != nil {
+			return err
+		}
+		if err := fn(entry); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func (r *mongoAuditRepository) Exists(ctx context.Context, query AuditQuery) (bool, error) {
+	return exists(ctx, r.collection, auditFilter(query))
+}
+
+// auditFilter translates a query into a Mongo filter with case-insensitive regexes
+func auditFilter(query AuditQuery) bson.M {
+	filter := bson.M{}
+	if !query.CompanyID.IsZero() {
+		filter["company_id"] = query.CompanyID
+	}
+	if query.Action != "" {
+		filter["action"] = bson.M{"$regex": query.Action, "$options": "i"}
+	}
+	if query.ResourceType != "" {
+		filter["resource_type"] = bson.M{"$regex": query.ResourceType, "$options": "i"}
+	}
+	if query.Status != "" {
+		filter["status"] = bson.M{"$regex": query.Status, "$options": "i"}
+	}
+	if !query.UserID.IsZero() {
+		filter["user_id"] = query.UserID
+	}
+	if query.IPAddress != "" {
+		filter["ip_address"] = query.IPAddress
+	}
+	if query.UserAgent != "" {
+		filter["user_agent"] = query.UserAgent
+	}
+	if !query.ExcludeID.IsZero() {
+		filter["_id"] = bson.M{"$ne": query.ExcludeID}
+	}
+
+	createdAt := bson.M{}
+	if query.From != nil {
+		createdAt["$gte"] = *query.From
+	}
+	if query.To != nil {
+		createdAt["$lte"] = *query.To
+	}
+	if len(createdAt) > 0 {
+		filter["created_at"] = createdAt
+	}
+	return filter
+}
+
+func (r *mongoAuditRepository) Usernames(ctx context.Context, companyID, userID primitive.ObjectID) ([]string, error) {
+	values, err := r.collection.Distinct(ctx, "username", bson.M{"company_id": companyID, "user_id": userID})
+	if err != nil {
+		return nil, err
+	}
+	usernames := []string{}
+	for _, value := range values {
+		if username, ok := value.(string); ok && username != "" {
+			usernames = append(usernames, username)
+		}
+	}
+	return usernames, nil
+}
+
+func (r *mongoAuditRepository) Expired(ctx context.Context, companyID primitive.ObjectID, cutoff time.Time, holds []models.LegalHold, limit int) ([]models.AuditLog, error) {
+	query := bson.M{
+		"company_id": companyID,
+		"created_at": bson.M{"$lt": cutoff},
+	}
+	if len(holds) > 0 {
+		conditions := make(bson.A, len(holds))
+		for i, hold := range holds {
+			conditions[i] = holdCondition(hold)
+		}
+		query["$nor"] = conditions
+	}
+
+	cursor, err := r.collection.Find(ctx, query, options.Find().SetSort(bson.M{"created_at": 1}).SetLimit(int64(limit)))
+	if err != nil {
+		return nil, err
+	}
+	entries := []models.AuditLog{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+// holdCondition converts a legal hold into a filter over the entries it covers
+func holdCondition(hold models.LegalHold) bson.M {
+	condition := bson.M{}
+	if !hold.UserID.IsZero() {
+		condition["user_id"] = hold.UserID
+	}
+	if !hold.ResourceID.IsZero() {
+		condition["resource_id"] = hold.ResourceID
+	}
+	dateRange := bson.M{}
+	if hold.FromDate != nil {
+		dateRange["$gte"] = *hold.FromDate
+	}
+	if hold.ToDate != nil {
+		dateRange["$lte"] = *hold.ToDate
+	}
+	if len(dateRange) > 0 {
+		condition["created_at"] = dateRange
+	}
+	return condition
+}
+
+func (r *mongoAuditRepository) Delete(ctx context.Context, ids []primitive.ObjectID) error {
+	_, err := r.collection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	return err
+}
+
+func (r *mongoAuditRepository) Restore(ctx context.Context, entries []models.AuditLog) (int, error) {
+	if len(entries) == 0 {
+		return 0, nil
+	}
+	docs := make([]interface{}, len(entries))
+	for i, entry := range entries {
+		docs[i] = entry
+	}
+
+	_, err := r.collection.InsertMany(ctx, docs, options.InsertMany().SetOrdered(false))
+	if err != nil {
+		var bulkErr mongo.BulkWriteException
+		if !errors.As(err, &bulkErr) || !mongo.IsDuplicateKeyError(err) {
+			return 0, err
+		}
+		return len(entries) - len(bulkErr.WriteErrors), nil
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,82 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoBackupRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoBackupRepository) Create(ctx context.Context, backup *models.Backup) error {
+	if backup.ID.IsZero() {
+		backup.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, backup)
+	return mongoError(err)
+}
+
+func (r *mongoBackupRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Backup, error) {
+	query := bson.M{"_id": id}
+	if !companyID.IsZero() {
+		query["company_id"] = companyID
+	}
+	var backup models.Backup
+	if err := r.collection.FindOne(ctx, query).Decode(&backup); err != nil {
+		return nil, mongoError(err)
+	}
+	return &backup, nil
+}
+
+func (r *mongoBackupRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.Backup, error) {
+	return r.find(ctx, bson.M{"company_id": companyID})
+}
+
+func (r *mongoBackupRepository) All(ctx context.Context) ([]models.Backup, error) {
+	return r.find(ctx, bson.M{})
+}
+
+func (r *mongoBackupRepository) Expired(ctx context.Context, before time.Time) ([]models.Backup, error) {
+	return r.find(ctx, bson.M{"retention_until": bson.M{"$lt": before}})
+}
+
+func (r *mongoBackupRepository) find(ctx context.Context, query bson.M) ([]models.Backup, error) {
+	cursor, err := r.collection.Find(ctx, query, options.Find().SetSort(bson.M{"created_at": -1}))
+	if err != nil {
+		return nil, err
+	}
+	backups := []models.Backup{}
+	if err := cursor.All(ctx, &backups); err != nil {
+		return nil, err
+	}
+	return backups, nil
+}
+
+func (r *mongoBackupRepository) Save(ctx context.Context, backup *models.Backup) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": backup.ID}, backup)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoBackupRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCategoryRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoCategoryRepository) Create(ctx context.Context, category *models.Category) error {
+	if category.ID.IsZero() {
+		category.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, category)
+	return mongoError(err)
+}
+
+func (r *mongoCategoryRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Category, error) {
+	var category models.Category
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&category); err != nil {
+		return nil, mongoError(err)
+	}
+	return &category, nil
+}
+
+func (r *mongoCategoryRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.Category, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"company_id": companyID},
+		options.Find().SetSort(bson.D{{Key: "name", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	categories := []models.Category{}
+	if err := cursor.All(ctx, &categories); err != nil {
+		return nil, err
+	}
+	return categories, nil
+}
+
+func (r *mongoCategoryRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update CategoryUpdate) (*models.Category, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Attributes != nil {
+		set["attributes"] = update.Attributes
+	}
+
+	var category models.Category
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "company_id": companyID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&category)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &category, nil
+}
+
+func (r *mongoCategoryRepository) Delete(ctx context.Context, companyID, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "company_id": companyID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoCategoryRepository) HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.collection, bson.M{"parent_id": id})
+}
@@ -0,0 +1,208 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoCostRepository struct {
+	layers    *mongo.Collection
+	movements *mongo.Collection
+}
+
+func (r *mongoCostRepository) AddLayer(ctx context.Context, layer *models.CostLayer) error {
+	if layer.ID.IsZero() {
+		layer.ID = primitive.NewObjectID()
+	}
+	_, err := r.layers.InsertOne(ctx, layer)
+	return mongoError(err)
+}
+
+func (r *mongoCostRepository) OpenLayers(ctx context.Context, itemID, warehouseID primitive.ObjectID) ([]models.CostLayer, error) {
+	cursor, err := r.layers.Find(ctx,
+		bson.M{"item_id": itemID, "warehouse_id": warehouseID, "remaining": bson.M{"$gt": 0}},
+		options.Find().SetSort(bson.D{{Key: "received_at", Value: 1}, {Key: "_id", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	layers := []models.CostLayer{}
+	if err := cursor.All(ctx, &layers); err != nil {
+		return nil, err
+	}
+	return layers, nil
+}
+
+func (r *mongoCostRepository) ConsumeLayer(ctx context.Context, id primitive.ObjectID, quantity int) error {
+	result, err := r.layers.UpdateOne(ctx,
+		bson.M{"_id": id, "remaining": bson.M{"$gte": quantity}},
+		bson.M{"$inc": bson.M{"remaining": -quantity}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrInsufficientStock
+	}
+	return nil
+}
+
+func (r *mongoCostRepository) AddMovement(ctx context.Context, movement *models.CostMovement) error {
+	if movement.ID.IsZero() {
+		movement.ID = primitive.NewObjectID()
+	}
+	_, err := r.movements.InsertOne(ctx, movement)
+	return mongoError(err)
+}
+
+// signed counts issues negatively, and receipts and revaluations positively
+func signed(field string) bson.M {
+	return bson.M{"$cond": bson.A{
+		bson.M{"$eq": bson.A{"$type", models.MovementIssue}},
+		bson.M{"$multiply": bson.A{-1, "$" + field}},
+		"$" + field,
+	}}
+}
+
+func (r *mongoCostRepository) Position(ctx context.Context, itemID, warehouseID primitive.ObjectID) (int, int64, error) {
+	cursor, err := r.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"item_id": itemID, "warehouse_id": warehouseID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      nil,
+			"quantity": bson.M{"$sum": signed("quantity")},
+			"value":    bson.M{"$sum": signed("total_cost")},
+		}}},
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var totals []struct {
+		Quantity int   `bson:"quantity"`
+		Value    int64 `bson:"value"`
+	}
+	if err := cursor.All(ctx, &totals); err != nil {
+		return 0, 0, err
+	}
+	if len(totals) == 0 {
+		return 0, 0, nil
+	}
+	return totals[0].Quantity, totals[0].Value, nil
+}
+
+func (r *mongoCostRepository) Positions(ctx context.Context, itemID primitive.ObjectID) ([]CostHolding, error) {
+	cursor, err := r.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"item_id": itemID}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      "$warehouse_id",
+			"quantity": bson.M{"$sum": signed("quantity")},
+			"value":    bson.M{"$sum": signed("total_cost")},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"item_id":      itemID,
+			"warehouse_id": "$_id",
+			"quantity":     1,
+			"value":        1,
+		}}},
+		{{Key: "$sort", Value: bson.M{"warehouse_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	positions := []CostHolding{}
+	if err := cursor.All(ctx, &positions); err != nil {
+		return nil, err
+	}
+	return positions, nil
+}
+
+func (r *mongoCostRepository) Summarize(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, from, to time.Time) ([]CostSummary, error) {
+	match := bson.M{"company_id": companyID, "occurred_at": bson.M{"$lt": to}}
+	if warehouseID != nil {
+		match["warehouse_id"] = *warehouseID
+	}
+	before := bson.M{"$lt": bson.A{"$occurred_at", from}}
+	receipt := bson.M{"$eq": bson.A{"$type", models.MovementReceipt}}
+	issue := bson.M{"$eq": bson.A{"$type", models.MovementIssue}}
+	revaluation := bson.M{"$eq": bson.A{"$type", models.MovementRevaluation}}
+	sumIf := func(cond interface{}, value interface{}) bson.M {
+		return bson.M{"$sum": bson.M{"$cond": bson.A{cond, value, 0}}}
+	}
+	inPeriod := func(cond bson.M) bson.M {
+		return bson.M{"$and": bson.A{bson.M{"$not": bson.A{before}}, cond}}
+	}
+
+	cursor, err := r.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":               "$warehouse_id",
+			"opening_quantity":  sumIf(before, signed("quantity")),
+			"opening_value":     sumIf(before, signed("total_cost")),
+			"received_quantity": sumIf(inPeriod(receipt), "$quantity"),
+			"received_value":    sumIf(inPeriod(receipt), "$total_cost"),
+			"issued_quantity":   sumIf(inPeriod(issue), "$quantity"),
+			"issued_cost":       sumIf(inPeriod(issue), "$total_cost"),
+			"revalued_value":    sumIf(inPeriod(revaluation), "$total_cost"),
+		}}},
+		{{Key: "$sort", Value: bson.M{"_id": 1}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	summaries := []CostSummary{}
+	if err := cursor.All(ctx, &summaries); err != nil {
+		return nil, err
+	}
+	return summaries, nil
+}
+
+func (r *mongoCostRepository) Holdings(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, at time.Time) ([]CostHolding, error) {
+	match := bson.M{"company_id": companyID, "occurred_at": bson.M{"$lt": at}}
+	if warehouseID != nil {
+		match["warehouse_id"] = *warehouseID
+	}
+	cursor, err := r.movements.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: match}},
+		{{Key: "$group", Value: bson.M{
+			"_id":      bson.M{"item_id": "$item_id", "warehouse_id": "$warehouse_id"},
+			"quantity": bson.M{"$sum": signed("quantity")},
+			"value":    bson.M{"$sum": signed("total_cost")},
+		}}},
+		{{Key: "$project", Value: bson.M{
+			"_id":          0,
+			"item_id":      "$_id.item_id",
+			"warehouse_id": "$_id.warehouse_id",
+			"quantity":     1,
+			"value":        1,
+		}}},
+		{{Key: "$sort", Value: bson.D{{Key: "warehouse_id", Value: 1}, {Key: "item_id", Value: 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	holdings := []CostHolding{}
+	if err := cursor.All(ctx, &holdings); err != nil {
+		return nil, err
+	}
+	return holdings, nil
+}
+
+func (r *mongoCostRepository) HasMovements(ctx context.Context, companyID primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.movements, bson.M{"company_id": companyID})
+}
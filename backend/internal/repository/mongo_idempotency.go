@@ -0,0 +1,50 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoIdempotencyRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoIdempotencyRepository) Claim(ctx context.Context, record *models.IdempotencyRecord) error {
+	_, err := r.collection.InsertOne(ctx, record)
+	return mongoError(err)
+}
+
+func (r *mongoIdempotencyRepository) Get(ctx context.Context, id string) (*models.IdempotencyRecord, error) {
+	var record models.IdempotencyRecord
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id}).Decode(&record); err != nil {
+		return nil, mongoError(err)
+	}
+	return &record, nil
+}
+
+func (r *mongoIdempotencyRepository) Complete(ctx context.Context, id string, statusCode int, headers map[string]string, body []byte, expiresAt time.Time) error {
+	_, err := r.collection.UpdateOne(ctx,
+		bson.M{"_id": id},
+		bson.M{"$set": bson.M{
+			"completed":   true,
+			"status_code": statusCode,
+			"headers":     headers,
+			"body":        body,
+			"expires_at":  expiresAt,
+		}})
+	return err
+}
+
+func (r *mongoIdempotencyRepository) Release(ctx context.Context, id string) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "completed": false})
+	return err
+}
+
+func (r *mongoIdempotencyRepository) DeleteExpired(ctx context.Context, id string, expiresAt time.Time) error {
+	_, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "expires_at": expiresAt})
+	return err
+}
@@ -0,0 +1,55 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoImportJobRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoImportJobRepository) Create(ctx context.Context, job *models.ImportJob) error {
+	if job.ID.IsZero() {
+		job.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, job)
+	return mongoError(err)
+}
+
+func (r *mongoImportJobRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ImportJob, error) {
+	var job models.ImportJob
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&job); err != nil {
+		return nil, mongoError(err)
+	}
+	return &job, nil
+}
+
+func (r *mongoImportJobRepository) Save(ctx context.Context, job *models.ImportJob) error {
+	result, err := r.collection.ReplaceOne(ctx, bson.M{"_id": job.ID}, job)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoImportJobRepository) FailRunning(ctx context.Context, message string, at time.Time) error {
+	_, err := r.collection.UpdateMany(ctx,
+		bson.M{"status": models.ImportStatusRunning},
+		bson.M{"$set": bson.M{
+			"status":       models.ImportStatusFailed,
+			"error":        message,
+			"completed_at": at,
+			"updated_at":   at,
+		}},
+	)
+	return err
+}
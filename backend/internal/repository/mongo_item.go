@@ -0,0 +1,482 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// skuCollation compares SKUs case-insensitively. Queries on the SKU use it
+// so they match the unique index on company and SKU.
+var skuCollation = &options.Collation{Locale: "en", Strength: 2}
+
+type mongoItemRepository struct {
+	tx        Transactor
+	items     *mongo.Collection
+	locations *mongo.Collection
+}
+
+func (r *mongoItemRepository) Create(ctx context.Context, item *models.Item, location *models.ItemLocation) error {
+	if item.ID.IsZero() {
+		item.ID = primitive.NewObjectID()
+	}
+	if location != nil {
+		if location.ID.IsZero() {
+			location.ID = primitive.NewObjectID()
+		}
+		location.ItemID = item.ID
+	}
+
+	// Item and location are written together so a failed location insert
+	// cannot leave an item without stock behind
+	return r.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		if _, err := r.items.InsertOne(ctx, item); err != nil {
+			return mongoError(err)
+		}
+		if location == nil {
+			return nil
+		}
+		_, err := r.locations.InsertOne(ctx, location)
+		return mongoError(err)
+	})
+}
+
+func (r *mongoItemRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Item, error) {
+	var item models.Item
+	if err := r.items.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&item); err != nil {
+		return nil, mongoError(err)
+	}
+	return &item, nil
+}
+
+func (r *mongoItemRepository) GetBySKU(ctx context.Context, companyID primitive.ObjectID, sku string) (*models.Item, error) {
+	var item models.Item
+	err := r.items.FindOne(ctx, bson.M{"company_id": companyID, "sku": sku},
+		options.FindOne().SetCollation(skuCollation)).Decode(&item)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &item, nil
+}
+
+func (r *mongoItemRepository) ListStock(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error) {
+	return r.stock(ctx, companyID, filter, false)
+}
+
+func (r *mongoItemRepository) ListArchived(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error) {
+	return r.stock(ctx, companyID, filter, true)
+}
+
+func (r *mongoItemRepository) InCategory(ctx context.Context, categoryID primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.items, bson.M{"category_id": categoryID})
+}
+
+// stock runs the stock aggregation over the company's active or archived items
+func (r *mongoItemRepository) stock(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter, archived bool) ([]ItemStock, error) {
+	match := bson.D{{Key: "company_id", Value: companyID}, {Key: "is_archived", Value: archived}}
+	if filter.CategoryIDs != nil {
+		match = append(match, bson.E{Key: "category_id", Value: bson.M{"$in": filter.CategoryIDs}})
+	}
+	for _, attribute := range filter.Attributes {
+		match = append(match, bson.E{Key: "attributes." + attribute.Key, Value: attributeCondition(attribute)})
+	}
+	pipeline := mongo.Pipeline{{{Key: "$match", Value: match}}}
+	warehouseID := filter.WarehouseID
+
+	// Lookup locations
+	pipeline = append(pipeline, bson.D{
+		{Key: "$lookup", Value: bson.D{
+			{Key: "from", Value: "item_locations"},
+			{Key: "localField", Value: "_id"},
+			{Key: "foreignField", Value: "item_id"},
+			{Key: "as", Value: "locations"},
+		}},
+	})
+
+	if warehouseID != nil {
+		inWarehouse := bson.D{
+			{Key: "$filter", Value: bson.D{
+				{Key: "input", Value: "$locations"},
+				{Key: "as", Value: "loc"},
+				{Key: "cond", Value: bson.D{{Key: "$eq", Value: bson.A{"$$loc.warehouse_id", *warehouseID}}}},
+			}},
+		}
+
+		// Filter locations to specific warehouse and sum quantity
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "quantity", Value: bson.D{
+				{Key: "$sum", Value: bson.D{
+					{Key: "$map", Value: bson.D{
+						{Key: "input", Value: inWarehouse},
+						{Key: "as", Value: "loc"},
+						{Key: "in", Value: "$$loc.quantity"},
+					}},
+				}},
+			}},
+			{Key: "held", Value: bson.D{
+				{Key: "$sum", Value: bson.D{
+					{Key: "$map", Value: bson.D{
+						{Key: "input", Value: inWarehouse},
+						{Key: "as", Value: "loc"},
+						{Key: "in", Value: "$$loc.held"},
+					}},
+				}},
+			}},
+			{Key: "batch", Value: bson.D{
+				{Key: "$let", Value: bson.D{
+					{Key: "vars", Value: bson.D{
+						{Key: "loc", Value: bson.D{
+							{Key: "$arrayElemAt", Value: bson.A{inWarehouse, 0}},
+						}},
+					}},
+					{Key: "in", Value: "$$loc.batch"},
+				}},
+			}},
+		}}})
+
+		// Only show items present in this warehouse
+		pipeline = append(pipeline, bson.D{{Key: "$match", Value: bson.D{{Key: "quantity", Value: bson.D{{Key: "$gt", Value: 0}}}}}})
+	} else {
+		// Sum all locations
+		pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+			{Key: "quantity", Value: bson.D{
+				{Key: "$sum", Value: "$locations.quantity"},
+			}},
+			{Key: "held", Value: bson.D{
+				{Key: "$sum", Value: "$locations.held"},
+			}},
+		}}})
+	}
+
+	// Held stock is not available
+	pipeline = append(pipeline, bson.D{{Key: "$addFields", Value: bson.D{
+		{Key: "available", Value: bson.D{{Key: "$subtract", Value: bson.A{"$quantity", "$held"}}}},
+	}}})
+
+	// Remove locations array
+	pipeline = append(pipeline, bson.D{{Key: "$project", Value: bson.D{{Key: "locations", Value: 0}}}})
+
+	cursor, err := r.items.Aggregate(ctx, pipeline)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := []ItemStock{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func (r *mongoItemRepository) Locations(ctx context.Context, itemID primitive.ObjectID) ([]models.ItemLocation, error) {
+	cursor, err := r.locations.Find(ctx, bson.M{"item_id": itemID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	locations := []models.ItemLocation{}
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (r *mongoItemRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update ItemUpdate) (*models.Item, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Quality != nil {
+		set["quality"] = *update.Quality
+	}
+	if update.Price != nil {
+		set["price"] = *update.Price
+	}
+	if update.Currency != nil {
+		set["currency"] = *update.Currency
+	}
+	if update.StandardCost != nil {
+		set["standard_cost"] = *update.StandardCost
+	}
+	if update.Department != nil {
+		set["department"] = *update.Department
+	}
+	if update.Attributes != nil {
+		set["attributes"] = update.Attributes
+	}
+	if update.Units != nil {
+		set["units"] = update.Units
+	}
+	changes := bson.M{"$set": set, "$inc": bson.M{"version": 1}}
+	if update.CategoryID != nil {
+		if update.CategoryID.IsZero() {
+			changes["$unset"] = bson.M{"category_id": ""}
+		} else {
+			set["category_id"] = *update.CategoryID
+		}
+	}
+
+	filter := bson.M{"_id": id, "company_id": companyID}
+	var item models.Item
+	err := r.items.FindOneAndUpdate(ctx, withVersion(filter, update.IfVersion), changes,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, conditionalError(ctx, r.items, filter)
+	}
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &item, nil
+}
+
+func (r *mongoItemRepository) Archive(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64, archivedBy primitive.ObjectID) error {
+	filter := bson.M{"_id": id, "company_id": companyID}
+	now := time.Now()
+	result, err := r.items.UpdateOne(ctx, withVersion(filter, ifVersion), bson.M{
+		"$set": bson.M{"is_archived": true, "archived_at": now, "archived_by": archivedBy, "updated_at": now},
+		"$inc": bson.M{"version": 1},
+	})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return conditionalError(ctx, r.items, filter)
+	}
+	return nil
+}
+
+func (r *mongoItemRepository) Restore(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) (*models.Item, error) {
+	filter := bson.M{"_id": id, "company_id": companyID, "is_archived": true}
+	var item models.Item
+	err := r.items.FindOneAndUpdate(ctx, withVersion(filter, ifVersion), bson.M{
+		"$set":   bson.M{"is_archived": false, "updated_at": time.Now()},
+		"$unset": bson.M{"archived_at": "", "archived_by": ""},
+		"$inc":   bson.M{"version": 1},
+	}, options.FindOneAndUpdate().SetReturnDocument(options.After)).Decode(&item)
+	if err == mongo.ErrNoDocuments {
+		return nil, conditionalError(ctx, r.items, filter)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (r *mongoItemRepository) Purge(ctx context.Context, companyID, id primitive.ObjectID) error {
+	return r.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		result, err := r.items.DeleteOne(ctx, bson.M{"_id": id, "company_id": companyID, "is_archived": true})
+		if err != nil {
+			return err
+		}
+		if result.DeletedCount == 0 {
+			return ErrNotFound
+		}
+		_, err = r.locations.DeleteMany(ctx, bson.M{"item_id": id})
+		return err
+	})
+}
+
+func (r *mongoItemRepository) AdjustQuantity(ctx context.Context, itemID, locationID primitive.ObjectID, change QuantityChange) (*models.ItemLocation, error) {
+	filter := bson.M{"_id": locationID, "item_id": itemID}
+	if change.WarehouseID != nil {
+		filter["warehouse_id"] = *change.WarehouseID
+	}
+
+	conditional := withVersion(filter, change.IfVersion)
+	update := bson.M{
+		"$set": bson.M{"updated_by": change.UpdatedBy, "updated_at": time.Now()},
+		"$inc": bson.M{"version": 1},
+	}
+	// The guards and the write are one atomic update: the new quantity may
+	// not be negative or below the new held quantity
+	held := bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$held", 0}}, change.HeldDelta}}
+	quantity := interface{}(bson.M{"$add": bson.A{"$quantity", change.Delta}})
+	if change.Set != nil {
+		if *change.Set < 0 {
+			return nil, ErrInsufficientStock
+		}
+		update["$set"].(bson.M)["quantity"] = *change.Set
+		quantity = *change.Set
+	} else {
+		update["$inc"].(bson.M)["quantity"] = change.Delta
+	}
+	if change.HeldDelta != 0 {
+		update["$inc"].(bson.M)["held"] = change.HeldDelta
+	}
+	if change.Set != nil || change.Delta < 0 || change.HeldDelta != 0 {
+		conditional["$expr"] = bson.M{"$and": bson.A{
+			bson.M{"$gte": bson.A{held, 0}},
+			bson.M{"$gte": bson.A{quantity, held}},
+		}}
+	}
+
+	var location models.ItemLocation
+	err := r.locations.FindOneAndUpdate(ctx, conditional, update,
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&location)
+	if err == mongo.ErrNoDocuments {
+		// Report the first condition that failed
+		if err := conditionalError(ctx, r.locations, filter); err != ErrVersionMismatch {
+			return nil, err
+		}
+		current, err := exists(ctx, r.locations, withVersion(filter, change.IfVersion))
+		if err != nil {
+			return nil, err
+		}
+		if !current {
+			return nil, ErrVersionMismatch
+		}
+		return nil, ErrInsufficientStock
+	}
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &location, nil
+}
+
+func (r *mongoItemRepository) UpsertBySKU(ctx context.Context, item *models.Item, location *models.ItemLocation) (UpsertResult, error) {
+	var result UpsertResult
+	err := r.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		result = UpsertResult{}
+		var existing models.Item
+		err := r.items.FindOne(ctx, bson.M{"company_id": item.CompanyID, "sku": item.SKU},
+			options.FindOne().SetCollation(skuCollation)).Decode(&existing)
+		switch {
+		case err == mongo.ErrNoDocuments:
+			if item.ID.IsZero() {
+				item.ID = primitive.NewObjectID()
+			}
+			if _, err := r.items.InsertOne(ctx, item); err != nil {
+				return mongoError(err)
+			}
+			result.Created = true
+		case err != nil:
+			return err
+		default:
+			set := bson.M{
+				"name":        item.Name,
+				"quality":     item.Quality,
+				"price":       item.Price,
+				"currency":    item.Currency,
+				"department":  item.Department,
+				"is_archived": false,
+				"updated_at":  time.Now(),
+			}
+			if item.Attributes != nil {
+				set["attributes"] = item.Attributes
+			}
+			err := r.items.FindOneAndUpdate(ctx, bson.M{"_id": existing.ID},
+				bson.M{"$set": set, "$unset": bson.M{"archived_at": "", "archived_by": ""}, "$inc": bson.M{"version": 1}},
+				options.FindOneAndUpdate().SetReturnDocument(options.After),
+			).Decode(item)
+			if err != nil {
+				return mongoError(err)
+			}
+		}
+
+		batch := interface{}(location.Batch)
+		if location.Batch == "" {
+			batch = bson.M{"$in": bson.A{"", nil}}
+		}
+		filter := bson.M{"item_id": item.ID, "warehouse_id": location.WarehouseID, "batch": batch, "bin_id": nil}
+		var previous models.ItemLocation
+		if err := r.locations.FindOne(ctx, filter).Decode(&previous); err != nil && err != mongo.ErrNoDocuments {
+			return err
+		}
+		if location.Quantity < previous.Held {
+			return ErrInsufficientStock
+		}
+		result.Delta = location.Quantity - previous.Quantity
+
+		setOnInsert := bson.M{"_id": primitive.NewObjectID(), "created_at": time.Now()}
+		if location.Batch != "" {
+			setOnInsert["batch"] = location.Batch
+		}
+		err = r.locations.FindOneAndUpdate(ctx, filter,
+			bson.M{
+				"$set":         bson.M{"quantity": location.Quantity, "updated_by": location.UpdatedBy, "updated_at": time.Now()},
+				"$inc":         bson.M{"version": 1},
+				"$setOnInsert": setOnInsert,
+			},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(location)
+		return mongoError(err)
+	})
+	return result, err
+}
+
+func (r *mongoItemRepository) Location(ctx context.Context, id primitive.ObjectID) (*models.ItemLocation, error) {
+	var location models.ItemLocation
+	if err := r.locations.FindOne(ctx, bson.M{"_id": id}).Decode(&location); err != nil {
+		return nil, mongoError(err)
+	}
+	return &location, nil
+}
+
+func (r *mongoItemRepository) WarehouseLocations(ctx context.Context, warehouseID primitive.ObjectID, binID *primitive.ObjectID) ([]models.ItemLocation, error) {
+	filter := bson.M{"warehouse_id": warehouseID}
+	if binID != nil {
+		filter["bin_id"] = *binID
+	}
+	cursor, err := r.locations.Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	locations := []models.ItemLocation{}
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (r *mongoItemRepository) AddToLocation(ctx context.Context, location *models.ItemLocation) error {
+	batch := interface{}(location.Batch)
+	if location.Batch == "" {
+		batch = bson.M{"$in": bson.A{"", nil}}
+	}
+	var bin interface{}
+	if location.BinID != nil {
+		bin = *location.BinID
+	}
+	filter := bson.M{"item_id": location.ItemID, "warehouse_id": location.WarehouseID, "batch": batch, "bin_id": bin}
+
+	now := time.Now()
+	setOnInsert := bson.M{"_id": primitive.NewObjectID(), "created_at": now}
+	if location.Batch != "" {
+		setOnInsert["batch"] = location.Batch
+	}
+	err := r.locations.FindOneAndUpdate(ctx, filter,
+		bson.M{
+			"$set":         bson.M{"updated_by": location.UpdatedBy, "updated_at": now},
+			"$inc":         bson.M{"quantity": location.Quantity, "version": 1},
+			"$setOnInsert": setOnInsert,
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(location)
+	return mongoError(err)
+}
+
+// attributeCondition is the query condition on an attribute's value
+func attributeCondition(attribute AttributeFilter) interface{} {
+	if attribute.Value != nil {
+		return attribute.Value
+	}
+	condition := bson.M{}
+	if attribute.Min != nil {
+		condition["$gte"] = attribute.Min
+	}
+	if attribute.Max != nil {
+		condition["$lte"] = attribute.Max
+	}
+	return condition
+}
@@ -0,0 +1,88 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoKitRepository struct {
+	boms   *mongo.Collection
+	builds *mongo.Collection
+}
+
+func (r *mongoKitRepository) Save(ctx context.Context, bom *models.BOM) error {
+	now := time.Now()
+	err := r.boms.FindOneAndUpdate(ctx,
+		bson.M{"company_id": bom.CompanyID, "kit_item_id": bom.KitItemID},
+		bson.M{
+			"$set":         bson.M{"components": bom.Components, "updated_by": bom.UpdatedBy, "updated_at": now},
+			"$setOnInsert": bson.M{"_id": primitive.NewObjectID(), "created_at": now},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(bom)
+	return mongoError(err)
+}
+
+func (r *mongoKitRepository) Get(ctx context.Context, companyID, kitItemID primitive.ObjectID) (*models.BOM, error) {
+	var bom models.BOM
+	if err := r.boms.FindOne(ctx, bson.M{"company_id": companyID, "kit_item_id": kitItemID}).Decode(&bom); err != nil {
+		return nil, mongoError(err)
+	}
+	return &bom, nil
+}
+
+func (r *mongoKitRepository) List(ctx context.Context, companyID primitive.ObjectID) ([]models.BOM, error) {
+	cursor, err := r.boms.Find(ctx, bson.M{"company_id": companyID})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	boms := []models.BOM{}
+	if err := cursor.All(ctx, &boms); err != nil {
+		return nil, err
+	}
+	return boms, nil
+}
+
+func (r *mongoKitRepository) Delete(ctx context.Context, companyID, kitItemID primitive.ObjectID) error {
+	result, err := r.boms.DeleteOne(ctx, bson.M{"company_id": companyID, "kit_item_id": kitItemID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoKitRepository) AddBuild(ctx context.Context, build *models.KitBuild) error {
+	if build.ID.IsZero() {
+		build.ID = primitive.NewObjectID()
+	}
+	_, err := r.builds.InsertOne(ctx, build)
+	return mongoError(err)
+}
+
+func (r *mongoKitRepository) Builds(ctx context.Context, companyID, kitItemID primitive.ObjectID) ([]models.KitBuild, error) {
+	cursor, err := r.builds.Find(ctx,
+		bson.M{"company_id": companyID, "kit_item_id": kitItemID},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	builds := []models.KitBuild{}
+	if err := cursor.All(ctx, &builds); err != nil {
+		return nil, err
+	}
+	return builds, nil
+}
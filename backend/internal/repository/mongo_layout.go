@@ -0,0 +1,83 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoLayoutRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoLayoutRepository) Create(ctx context.Context, location *models.StorageLocation) error {
+	if location.ID.IsZero() {
+		location.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, location)
+	return mongoError(err)
+}
+
+func (r *mongoLayoutRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.StorageLocation, error) {
+	var location models.StorageLocation
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&location); err != nil {
+		return nil, mongoError(err)
+	}
+	return &location, nil
+}
+
+func (r *mongoLayoutRepository) List(ctx context.Context, companyID, warehouseID primitive.ObjectID) ([]models.StorageLocation, error) {
+	cursor, err := r.collection.Find(ctx,
+		bson.M{"company_id": companyID, "warehouse_id": warehouseID},
+		options.Find().SetSort(bson.D{{Key: "path", Value: 1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	locations := []models.StorageLocation{}
+	if err := cursor.All(ctx, &locations); err != nil {
+		return nil, err
+	}
+	return locations, nil
+}
+
+func (r *mongoLayoutRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update LayoutUpdate) (*models.StorageLocation, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Capacity != nil {
+		set["capacity"] = *update.Capacity
+	}
+
+	var location models.StorageLocation
+	err := r.collection.FindOneAndUpdate(ctx, bson.M{"_id": id, "company_id": companyID}, bson.M{"$set": set},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&location)
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &location, nil
+}
+
+func (r *mongoLayoutRepository) Delete(ctx context.Context, companyID, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id, "company_id": companyID})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoLayoutRepository) HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error) {
+	return exists(ctx, r.collection, bson.M{"parent_id": id})
+}
@@ -0,0 +1,103 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoPriceRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoPriceRepository) Add(ctx context.Context, price *models.ItemPrice) error {
+	if price.ID.IsZero() {
+		price.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, price)
+	return mongoError(err)
+}
+
+func (r *mongoPriceRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ItemPrice, error) {
+	var price models.ItemPrice
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&price); err != nil {
+		return nil, mongoError(err)
+	}
+	return &price, nil
+}
+
+func (r *mongoPriceRepository) List(ctx context.Context, companyID, itemID primitive.ObjectID) ([]models.ItemPrice, error) {
+	return r.find(ctx, bson.M{"company_id": companyID, "item_id": itemID})
+}
+
+func (r *mongoPriceRepository) SetEffectiveTo(ctx context.Context, id primitive.ObjectID, to *time.Time) error {
+	update := bson.M{"$unset": bson.M{"effective_to": ""}}
+	if to != nil {
+		update = bson.M{"$set": bson.M{"effective_to": *to}}
+	}
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPriceRepository) Delete(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoPriceRepository) Effective(ctx context.Context, companyID primitive.ObjectID, at time.Time) ([]models.ItemPrice, error) {
+	return r.find(ctx, bson.M{
+		"company_id":     companyID,
+		"effective_from": bson.M{"$lte": at},
+		"$or": bson.A{
+			bson.M{"effective_to": bson.M{"$exists": false}},
+			bson.M{"effective_to": bson.M{"$gt": at}},
+		},
+	})
+}
+
+func (r *mongoPriceRepository) Due(ctx context.Context, at time.Time) ([]models.ItemPrice, error) {
+	return r.find(ctx, bson.M{"applied": false, "effective_from": bson.M{"$lte": at}})
+}
+
+func (r *mongoPriceRepository) MarkApplied(ctx context.Context, id primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"applied": true}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// find returns the matching prices, earliest first
+func (r *mongoPriceRepository) find(ctx context.Context, filter bson.M) ([]models.ItemPrice, error) {
+	cursor, err := r.collection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "effective_from", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	prices := []models.ItemPrice{}
+	if err := cursor.All(ctx, &prices); err != nil {
+		return nil, err
+	}
+	return prices, nil
+}
@@ -0,0 +1,73 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoQualityHoldRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoQualityHoldRepository) Create(ctx context.Context, hold *models.QualityHold) error {
+	if hold.ID.IsZero() {
+		hold.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, hold)
+	return mongoError(err)
+}
+
+func (r *mongoQualityHoldRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.QualityHold, error) {
+	var hold models.QualityHold
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&hold); err != nil {
+		return nil, mongoError(err)
+	}
+	return &hold, nil
+}
+
+func (r *mongoQualityHoldRepository) List(ctx context.Context, companyID primitive.ObjectID, filter QualityHoldFilter) ([]models.QualityHold, error) {
+	query := bson.M{"company_id": companyID}
+	if filter.WarehouseID != nil {
+		query["warehouse_id"] = *filter.WarehouseID
+	}
+	if filter.ItemID != nil {
+		query["item_id"] = *filter.ItemID
+	}
+	if filter.Status != "" {
+		query["status"] = filter.Status
+	}
+	cursor, err := r.collection.Find(ctx, query, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	holds := []models.QualityHold{}
+	if err := cursor.All(ctx, &holds); err != nil {
+		return nil, err
+	}
+	return holds, nil
+}
+
+func (r *mongoQualityHoldRepository) Save(ctx context.Context, hold *models.QualityHold) error {
+	filter := bson.M{"_id": hold.ID, "company_id": hold.CompanyID}
+	version := hold.Version
+	hold.Version++
+	hold.UpdatedAt = time.Now()
+	result, err := r.collection.ReplaceOne(ctx, withVersion(filter, &version), hold)
+	if err != nil {
+		hold.Version = version
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		hold.Version = version
+		return conditionalError(ctx, r.collection, filter)
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoRetentionRepository struct {
+	policies *mongo.Collection
+	archives *mongo.Collection
+}
+
+func (r *mongoRetentionRepository) Policy(ctx context.Context, companyID primitive.ObjectID) (*models.AuditRetentionPolicy, error) {
+	var policy models.AuditRetentionPolicy
+	if err := r.policies.FindOne(ctx, bson.M{"company_id": companyID}).Decode(&policy); err != nil {
+		return nil, mongoError(err)
+	}
+	return &policy, nil
+}
+
+func (r *mongoRetentionRepository) SetPolicy(ctx context.Context, policy *models.AuditRetentionPolicy) error {
+	now := time.Now()
+	update := bson.M{
+		"$set": bson.M{
+			"retention_days":    policy.RetentionDays,
+			"legal_hold":        policy.LegalHold,
+			"legal_hold_reason": policy.LegalHoldReason,
+			"updated_by":        policy.UpdatedBy,
+			"updated_at":        now,
+		},
+		"$setOnInsert": bson.M{"created_at": now},
+	}
+	_, err := r.policies.UpdateOne(ctx, bson.M{"company_id": policy.CompanyID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoRetentionRepository) AddHold(ctx context.Context, companyID primitive.ObjectID, hold models.LegalHold) error {
+	now := time.Now()
+	update := bson.M{
+		"$push":        bson.M{"holds": hold},
+		"$set":         bson.M{"updated_at": now},
+		"$setOnInsert": bson.M{"created_at": now, "retention_days": 0, "legal_hold": false},
+	}
+	_, err := r.policies.UpdateOne(ctx, bson.M{"company_id": companyID}, update, options.Update().SetUpsert(true))
+	return err
+}
+
+func (r *mongoRetentionRepository) RemoveHold(ctx context.Context, companyID, holdID primitive.ObjectID) error {
+	result, err := r.policies.UpdateOne(ctx,
+		bson.M{"company_id": companyID, "holds._id": holdID},
+		bson.M{"$pull": bson.M{"holds": bson.M{"_id": holdID}}, "$set": bson.M{"updated_at": time.Now()}},
+	)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoRetentionRepository) Expiring(ctx context.Context) ([]models.AuditRetentionPolicy, error) {
+	cursor, err := r.policies.Find(ctx, bson.M{"retention_days": bson.M{"$gt": 0}, "legal_hold": false})
+	if err != nil {
+		return nil, err
+	}
+	policies := []models.AuditRetentionPolicy{}
+	if err := cursor.All(ctx, &policies); err != nil {
+		return nil, err
+	}
+	return policies, nil
+}
+
+func (r *mongoRetentionRepository) SetLastRun(ctx context.Context, companyID primitive.ObjectID, at time.Time) error {
+	_, err := r.policies.UpdateOne(ctx, bson.M{"company_id": companyID}, bson.M{"$set": bson.M{"last_run_at": at}})
+	return err
+}
+
+func (r *mongoRetentionRepository) AddArchive(ctx context.Context, archive *models.AuditArchive) error {
+	if archive.ID.IsZero() {
+		archive.ID = primitive.NewObjectID()
+	}
+	_, err := r.archives.InsertOne(ctx, archive)
+	return mongoError(err)
+}
+
+func (r *mongoRetentionRepository) GetArchive(ctx context.Context, companyID, id primitive.ObjectID) (*models.AuditArchive, error) {
+	var archive models.AuditArchive
+	if err := r.archives.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&archive); err != nil {
+		return nil, mongoError(err)
+	}
+	return &archive, nil
+}
+
+func (r *mongoRetentionRepository) ListArchives(ctx context.Context, filter ArchiveFilter) ([]models.AuditArchive, error) {
+	query := bson.M{}
+	if !filter.CompanyID.IsZero() {
+		query["company_id"] = filter.CompanyID
+	}
+	if filter.From != nil {
+		query["to_date"] = bson.M{"$gte": *filter.From}
+	}
+	if filter.To != nil {
+		query["from_date"] = bson.M{"$lte": *filter.To}
+	}
+	if filter.Action != "" {
+		query["actions"] = bson.M{"$regex": filter.Action, "$options": "i"}
+	}
+	if !filter.UserID.IsZero() {
+		query["user_ids"] = filter.UserID
+	}
+
+	cursor, err := r.archives.Find(ctx, query, options.Find().SetSort(bson.M{"from_date": -1}))
+	if err != nil {
+		return nil, err
+	}
+	archives := []models.AuditArchive{}
+	if err := cursor.All(ctx, &archives); err != nil {
+		return nil, err
+	}
+	return archives, nil
+}
+
+func (r *mongoRetentionRepository) SaveArchive(ctx context.Context, archive *models.AuditArchive) error {
+	result, err := r.archives.ReplaceOne(ctx, bson.M{"_id": archive.ID}, archive)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
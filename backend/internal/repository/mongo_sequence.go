@@ -0,0 +1,29 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoSequenceRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoSequenceRepository) Next(ctx context.Context, companyID primitive.ObjectID, key string) (int64, error) {
+	var sequence models.Sequence
+	err := r.collection.FindOneAndUpdate(ctx,
+		bson.M{"company_id": companyID, "key": key},
+		bson.M{"$inc": bson.M{"value": 1}, "$set": bson.M{"updated_at": time.Now()}},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&sequence)
+	if err != nil {
+		return 0, mongoError(err)
+	}
+	return sequence.Value, nil
+}
@@ -0,0 +1,68 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// maxTransactionAttempts bounds retries of transactions aborted by transient errors
+const maxTransactionAttempts = 3
+
+type mongoTransactor struct {
+	client *mongo.Client
+}
+
+// WithTransaction runs fn in a multi-document transaction. Transactions aborted
+// by transient errors (elections, write conflicts) are retried with backoff, and
+// commits with an unknown result are retried until they resolve.
+// Transactions need a replica set or sharded cluster.
+func (t *mongoTransactor) WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error {
+	if mongo.SessionFromContext(ctx) != nil {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+	defer session.EndSession(context.Background())
+
+	for attempt := 1; ; attempt++ {
+		err = mongo.WithSession(ctx, session, func(sc mongo.SessionContext) error {
+			if err := sc.StartTransaction(); err != nil {
+				return err
+			}
+			if err := fn(sc); err != nil {
+				sc.AbortTransaction(context.Background())
+				return err
+			}
+			return commitWithRetry(sc)
+		})
+		if err == nil || !hasErrorLabel(err, "TransientTransactionError") || attempt == maxTransactionAttempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(time.Duration(attempt*50) * time.Millisecond):
+		}
+	}
+}
+
+func commitWithRetry(sc mongo.SessionContext) error {
+	for attempt := 1; ; attempt++ {
+		err := sc.CommitTransaction(sc)
+		if err == nil || !hasErrorLabel(err, "UnknownTransactionCommitResult") || attempt == maxTransactionAttempts {
+			return err
+		}
+	}
+}
+
+func hasErrorLabel(err error, label string) bool {
+	var labeled mongo.LabeledError
+	return errors.As(err, &labeled) && labeled.HasErrorLabel(label)
+}
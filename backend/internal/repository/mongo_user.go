@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type mongoUserRepository struct {
+	collection *mongo.Collection
+	sessions   *mongo.Collection
+}
+
+func (r *mongoUserRepository) Create(ctx context.Context, user *models.User) error {
+	if user.ID.IsZero() {
+		user.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, user)
+	return mongoError(err)
+}
+
+func (r *mongoUserRepository) GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id})
+}
+
+func (r *mongoUserRepository) GetByEmail(ctx context.Context, email string) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"email": email})
+}
+
+func (r *mongoUserRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.User, error) {
+	return r.findOne(ctx, bson.M{"_id": id, "company_id": companyID})
+}
+
+func (r *mongoUserRepository) findOne(ctx context.Context, filter bson.M) (*models.User, error) {
+	var user models.User
+	if err := r.collection.FindOne(ctx, filter).Decode(&user); err != nil {
+		return nil, mongoError(err)
+	}
+	return &user, nil
+}
+
+func (r *mongoUserRepository) List(ctx context.Context, filter UserFilter) ([]models.User, error) {
+	cursor, err := r.collection.Find(ctx, userQuery(filter))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	users := []models.User{}
+	if err := cursor.All(ctx, &users); err != nil {
+		return nil, err
+	}
+	return users, nil
+}
+
+func (r *mongoUserRepository) EmailExists(ctx context.Context, email string) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"email": email})
+	return count > 0, err
+}
+
+func (r *mongoUserRepository) Update(ctx context.Context, filter UserFilter, id primitive.ObjectID, update UserUpdate) error {
+	set := bson.M{"updated_at": time.Now()}
+	if update.FullName != nil {
+		set["full_name"] = *update.FullName
+	}
+	if update.Email != nil {
+		set["email"] = *update.Email
+	}
+	if update.WarehouseID != nil {
+		set["warehouse_id"] = *update.WarehouseID
+	}
+
+	query := userQuery(filter)
+	query["_id"] = id
+	result, err := r.collection.UpdateOne(ctx, query, bson.M{"$set": set})
+	if err != nil {
+		return mongoError(err)
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) Delete(ctx context.Context, filter UserFilter, id primitive.ObjectID) error {
+	query := userQuery(filter)
+	query["_id"] = id
+	result, err := r.collection.DeleteOne(ctx, query)
+	if err != nil {
+		return err
+	}
+	if result.DeletedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoUserRepository) SetLastLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error {
+	_, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"last_login": at}})
+	return err
+}
+
+func (r *mongoUserRepository) SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error {
+	return r.updateByID(ctx, id, bson.M{
+		"$set":   bson.M{"password_hash": passwordHash, "updated_at": time.Now()},
+		"$unset": bson.M{"reset_password_token": "", "reset_password_expires": ""},
+	})
+}
+
+func (r *mongoUserRepository) ClearMFA(ctx context.Context, id primitive.ObjectID) error {
+	return r.updateByID(ctx, id, bson.M{
+		"$set":   bson.M{"updated_at": time.Now()},
+		"$unset": bson.M{"totp_secret": ""},
+	})
+}
+
+func (r *mongoUserRepository) Unlock(ctx context.Context, id primitive.ObjectID) error {
+	return r.updateByID(ctx, id, bson.M{
+		"$set":   bson.M{"failed_logins": 0, "updated_at": time.Now()},
+		"$unset": bson.M{"locked_until": ""},
+	})
+}
+
+func (r *mongoUserRepository) Erase(ctx context.Context, id primitive.ObjectID, fullName, email string, at time.Time) error {
+	return r.updateByID(ctx, id, bson.M{
+		"$set": bson.M{
+			"full_name":     fullName,
+			"email":         email,
+			"password_hash": "",
+			"is_verified":   false,
+			"failed_logins": 0,
+			"erased_at":     at,
+			"updated_at":    at,
+		},
+		"$unset": bson.M{
+			"phone":                      "",
+			"totp_secret":                "",
+			"attributes":                 "",
+			"verification_token":         "",
+			"verification_token_expires": "",
+			"reset_password_token":       "",
+			"reset_password_expires":     "",
+			"last_login":                 "",
+		},
+	})
+}
+
+func (r *mongoUserRepository) DeleteSessions(ctx context.Context, userID primitive.ObjectID) (int64, error) {
+	result, err := r.sessions.DeleteMany(ctx, bson.M{"user_id": userID})
+	if err != nil {
+		return 0, err
+	}
+	return result.DeletedCount, nil
+}
+
+func (r *mongoUserRepository) updateByID(ctx context.Context, id primitive.ObjectID, update bson.M) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func userQuery(filter UserFilter) bson.M {
+	query := bson.M{}
+	if !filter.CompanyID.IsZero() {
+		query["company_id"] = filter.CompanyID
+	}
+	if filter.WarehouseID != nil {
+		query["warehouse_id"] = *filter.WarehouseID
+	}
+	if len(filter.Roles) > 0 {
+		query["role"] = bson.M{"$in": filter.Roles}
+	}
+	return query
+}
@@ -0,0 +1,112 @@
+package repository
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type mongoWarehouseRepository struct {
+	collection *mongo.Collection
+}
+
+func (r *mongoWarehouseRepository) Create(ctx context.Context, warehouse *models.Warehouse) error {
+	if warehouse.ID.IsZero() {
+		warehouse.ID = primitive.NewObjectID()
+	}
+	_, err := r.collection.InsertOne(ctx, warehouse)
+	return mongoError(err)
+}
+
+func (r *mongoWarehouseRepository) Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Warehouse, error) {
+	var warehouse models.Warehouse
+	if err := r.collection.FindOne(ctx, bson.M{"_id": id, "company_id": companyID}).Decode(&warehouse); err != nil {
+		return nil, mongoError(err)
+	}
+	return &warehouse, nil
+}
+
+func (r *mongoWarehouseRepository) ListActive(ctx context.Context, companyID primitive.ObjectID) ([]models.Warehouse, error) {
+	cursor, err := r.collection.Find(ctx, bson.M{"company_id": companyID, "is_active": true})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	warehouses := []models.Warehouse{}
+	if err := cursor.All(ctx, &warehouses); err != nil {
+		return nil, err
+	}
+	return warehouses, nil
+}
+
+func (r *mongoWarehouseRepository) Exists(ctx context.Context, companyID, id primitive.ObjectID) (bool, error) {
+	count, err := r.collection.CountDocuments(ctx, bson.M{"_id": id, "company_id": companyID})
+	return count > 0, err
+}
+
+func (r *mongoWarehouseRepository) Update(ctx context.Context, companyID, id primitive.ObjectID, update WarehouseUpdate) (*models.Warehouse, error) {
+	set := bson.M{"updated_at": time.Now()}
+	if update.Name != nil {
+		set["name"] = *update.Name
+	}
+	if update.Location != nil {
+		set["location"] = *update.Location
+	}
+	if update.IPWhitelist != nil {
+		set["ip_whitelist"] = update.IPWhitelist
+	}
+	if update.IsActive != nil {
+		set["is_active"] = *update.IsActive
+	}
+
+	filter := bson.M{"_id": id, "company_id": companyID}
+	var warehouse models.Warehouse
+	err := r.collection.FindOneAndUpdate(ctx, withVersion(filter, update.IfVersion),
+		bson.M{"$set": set, "$inc": bson.M{"version": 1}},
+		options.FindOneAndUpdate().SetReturnDocument(options.After),
+	).Decode(&warehouse)
+	if err == mongo.ErrNoDocuments {
+		return nil, conditionalError(ctx, r.collection, filter)
+	}
+	if err != nil {
+		return nil, mongoError(err)
+	}
+	return &warehouse, nil
+}
+
+func (r *mongoWarehouseRepository) Deactivate(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) error {
+	filter := bson.M{"_id": id, "company_id": companyID}
+	result, err := r.collection.UpdateOne(ctx, withVersion(filter, ifVersion),
+		bson.M{"$set": bson.M{"is_active": false, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return conditionalError(ctx, r.collection, filter)
+	}
+	return nil
+}
+
+func (r *mongoWarehouseRepository) SetSupervisor(ctx context.Context, id, supervisorID primitive.ObjectID) error {
+	result, err := r.collection.UpdateOne(ctx, bson.M{"_id": id},
+		bson.M{"$set": bson.M{"supervisor_id": supervisorID, "updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	if err != nil {
+		return err
+	}
+	if result.MatchedCount == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+func (r *mongoWarehouseRepository) ClearSupervisor(ctx context.Context, supervisorID primitive.ObjectID) error {
+	_, err := r.collection.UpdateMany(ctx, bson.M{"supervisor_id": supervisorID},
+		bson.M{"$unset": bson.M{"supervisor_id": ""}, "$set": bson.M{"updated_at": time.Now()}, "$inc": bson.M{"version": 1}})
+	return err
+}
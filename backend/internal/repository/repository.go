@@ -0,0 +1,592 @@
+// Package repository hides persistence behind interfaces so handlers can run
+// against MongoDB in production and an in-memory store in tests.
+//
+// Code that works on collections as raw documents rather than domain models
+// is exempt: backups, the consistency checker, personal data exports and
+// migrations take an injected *mongo.Database, since an in-memory store has
+// nothing for them to dump, check or migrate.
+package repository
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var (
+	ErrNotFound  = errors.New("not found")
+	ErrDuplicate = errors.New("duplicate key")
+	// ErrVersionMismatch is returned when a conditional write finds a newer version
+	ErrVersionMismatch = errors.New("version mismatch")
+	// ErrInsufficientStock is returned when an adjustment would make a quantity
+	// negative or leave less than the quantity on quality hold
+	ErrInsufficientStock = errors.New("insufficient stock")
+)
+
+// CompanyUpdate lists the company fields to change; nil fields are left as they are
+type CompanyUpdate struct {
+	Currency        *string
+	ValuationMethod *string
+	SKUPattern      *models.SKUPattern
+}
+
+// CompanyRepository stores tenant companies
+type CompanyRepository interface {
+	Create(ctx context.Context, company *models.Company) error
+	Get(ctx context.Context, id primitive.ObjectID) (*models.Company, error)
+	Update(ctx context.Context, id primitive.ObjectID, update CompanyUpdate) (*models.Company, error)
+	// IDs returns the ID of every company, in ascending order
+	IDs(ctx context.Context) ([]primitive.ObjectID, error)
+}
+
+// UserFilter selects users within a company. Empty fields match everything.
+type UserFilter struct {
+	CompanyID   primitive.ObjectID
+	WarehouseID *primitive.ObjectID
+	Roles       []string
+}
+
+// UserUpdate lists the user fields to change; nil fields are left as they are
+type UserUpdate struct {
+	FullName    *string
+	Email       *string
+	WarehouseID *primitive.ObjectID
+}
+
+// UserRepository stores user accounts
+type UserRepository interface {
+	Create(ctx context.Context, user *models.User) error
+	GetByID(ctx context.Context, id primitive.ObjectID) (*models.User, error)
+	GetByEmail(ctx context.Context, email string) (*models.User, error)
+	// Get returns a user only if it belongs to the company
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.User, error)
+	List(ctx context.Context, filter UserFilter) ([]models.User, error)
+	EmailExists(ctx context.Context, email string) (bool, error)
+	// Update and Delete match the user by ID within filter's company and warehouse
+	Update(ctx context.Context, filter UserFilter, id primitive.ObjectID, update UserUpdate) error
+	Delete(ctx context.Context, filter UserFilter, id primitive.ObjectID) error
+	SetLastLogin(ctx context.Context, id primitive.ObjectID, at time.Time) error
+	// SetPassword replaces the password hash and clears pending reset tokens
+	SetPassword(ctx context.Context, id primitive.ObjectID, passwordHash string) error
+	// ClearMFA removes the TOTP secret so the user enrolls again
+	ClearMFA(ctx context.Context, id primitive.ObjectID) error
+	// Unlock resets failed login attempts and lifts any lockout
+	Unlock(ctx context.Context, id primitive.ObjectID) error
+	// Erase replaces the user's name and email with aliases and clears the
+	// password, MFA secret, phone, attributes, pending tokens and last login
+	Erase(ctx context.Context, id primitive.ObjectID, fullName, email string, at time.Time) error
+	// DeleteSessions revokes every session of the user and returns how many
+	// there were
+	DeleteSessions(ctx context.Context, userID primitive.ObjectID) (int64, error)
+}
+
+// WarehouseUpdate lists the warehouse fields to change; nil fields are left as they are
+type WarehouseUpdate struct {
+	Name        *string
+	Location    *string
+	IPWhitelist []string
+	IsActive    *bool
+	// IfVersion makes the update conditional on the stored version
+	IfVersion *int64
+}
+
+// WarehouseRepository stores warehouses
+type WarehouseRepository interface {
+	Create(ctx context.Context, warehouse *models.Warehouse) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Warehouse, error)
+	ListActive(ctx context.Context, companyID primitive.ObjectID) ([]models.Warehouse, error)
+	Exists(ctx context.Context, companyID, id primitive.ObjectID) (bool, error)
+	Update(ctx context.Context, companyID, id primitive.ObjectID, update WarehouseUpdate) (*models.Warehouse, error)
+	// Deactivate fails with ErrVersionMismatch when ifVersion is set and stale
+	Deactivate(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) error
+	SetSupervisor(ctx context.Context, id, supervisorID primitive.ObjectID) error
+	// ClearSupervisor unassigns the user from every warehouse they supervise
+	ClearSupervisor(ctx context.Context, supervisorID primitive.ObjectID) error
+}
+
+// ItemStock is an item with its quantity summed over locations. Held is the
+// part of Quantity on quality hold, and Available the rest.
+type ItemStock struct {
+	models.Item `bson:",inline"`
+	Quantity    int    `bson:"quantity" json:"quantity"`
+	Held        int    `bson:"held" json:"held"`
+	Available   int    `bson:"available" json:"available"`
+	Batch       string `bson:"batch" json:"batch"`
+}
+
+// ItemUpdate lists the item fields to change; nil fields are left as they are
+type ItemUpdate struct {
+	Name         *string
+	Quality      *string
+	Price        *int64
+	Currency     *string
+	StandardCost *int64
+	Department   *string
+	// CategoryID moves the item to a category; NilObjectID takes it out of its category
+	CategoryID *primitive.ObjectID
+	Attributes map[string]interface{}
+	// Units replaces the item's units other than its base unit
+	Units []models.UnitOfMeasure
+	// IfVersion makes the update conditional on the stored version
+	IfVersion *int64
+}
+
+// QuantityChange adjusts the stock of one location. Delta is applied with an
+// atomic increment, so concurrent adjustments never overwrite each other; Set
+// replaces the quantity and should be paired with IfVersion. HeldDelta
+// changes the quantity on quality hold the same way.
+type QuantityChange struct {
+	Delta     int
+	Set       *int
+	HeldDelta int
+	IfVersion *int64
+	// WarehouseID, when set, only matches a location in that warehouse
+	WarehouseID *primitive.ObjectID
+	UpdatedBy   primitive.ObjectID
+}
+
+// AttributeFilter matches items by one attribute: equal to Value when it is
+// set, otherwise within whichever of the inclusive bounds Min and Max are set
+type AttributeFilter struct {
+	Key   string
+	Value interface{}
+	Min   interface{}
+	Max   interface{}
+}
+
+// ItemFilter narrows item listings; zero fields match every item
+type ItemFilter struct {
+	// WarehouseID restricts the result to items stocked there
+	WarehouseID *primitive.ObjectID
+	// CategoryIDs matches items in any of these categories
+	CategoryIDs []primitive.ObjectID
+	Attributes  []AttributeFilter
+}
+
+// ItemRepository stores items and their warehouse locations
+type ItemRepository interface {
+	// Create stores an item together with its initial location. A SKU already
+	// used in the company, in any case, is ErrDuplicate.
+	Create(ctx context.Context, item *models.Item, location *models.ItemLocation) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Item, error)
+	// GetBySKU matches SKUs case-insensitively, like the unique index on them
+	GetBySKU(ctx context.Context, companyID primitive.ObjectID, sku string) (*models.Item, error)
+	// ListStock returns the active items matching filter with their
+	// quantities, summed over the filter's warehouse when it has one
+	ListStock(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error)
+	// ListArchived is ListStock over archived items
+	ListArchived(ctx context.Context, companyID primitive.ObjectID, filter ItemFilter) ([]ItemStock, error)
+	// InCategory reports whether any item, archived or not, is in a category
+	InCategory(ctx context.Context, categoryID primitive.ObjectID) (bool, error)
+	Locations(ctx context.Context, itemID primitive.ObjectID) ([]models.ItemLocation, error)
+	Update(ctx context.Context, companyID, id primitive.ObjectID, update ItemUpdate) (*models.Item, error)
+	// Archive fails with ErrVersionMismatch when ifVersion is set and stale
+	Archive(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64, archivedBy primitive.ObjectID) error
+	// Restore unarchives an item, leaving its locations as they were. Items
+	// that are not archived are ErrNotFound.
+	Restore(ctx context.Context, companyID, id primitive.ObjectID, ifVersion *int64) (*models.Item, error)
+	// Purge deletes an archived item and its locations for good
+	Purge(ctx context.Context, companyID, id primitive.ObjectID) error
+	// AdjustQuantity changes one of the item's locations and returns it. A
+	// change that would leave a negative quantity, or less stock than is held,
+	// fails with ErrInsufficientStock. Callers check that the item belongs to
+	// their company.
+	AdjustQuantity(ctx context.Context, itemID, locationID primitive.ObjectID, change QuantityChange) (*models.ItemLocation, error)
+	// UpsertBySKU creates item, or updates and unarchives the company's item
+	// with the same SKU, then sets the quantity of its location with the same
+	// warehouse and batch that is not yet in a bin. Setting less than that
+	// location holds on quality hold fails with ErrInsufficientStock.
+	UpsertBySKU(ctx context.Context, item *models.Item, location *models.ItemLocation) (UpsertResult, error)
+	// Location returns one item location. Callers check that its item
+	// belongs to their company.
+	Location(ctx context.Context, id primitive.ObjectID) (*models.ItemLocation, error)
+	// WarehouseLocations returns a warehouse's item locations; a bin
+	// restricts them to the ones in that bin
+	WarehouseLocations(ctx context.Context, warehouseID primitive.ObjectID, binID *primitive.ObjectID) ([]models.ItemLocation, error)
+	// AddToLocation adds location's quantity to the item's location with the
+	// same warehouse, batch and bin, creating it when there is none, and
+	// returns the result in location
+	AddToLocation(ctx context.Context, location *models.ItemLocation) error
+}
+
+// UpsertResult reports what UpsertBySKU changed
+type UpsertResult struct {
+	Created bool
+	// Delta is the location's new quantity minus its previous one
+	Delta int
+}
+
+// CostSummary totals one warehouse's cost movements before a period and within it
+type CostSummary struct {
+	WarehouseID      primitive.ObjectID `bson:"_id" json:"warehouse_id"`
+	OpeningQuantity  int                `bson:"opening_quantity" json:"opening_quantity"`
+	OpeningValue     int64              `bson:"opening_value" json:"opening_value"`
+	ReceivedQuantity int                `bson:"received_quantity" json:"received_quantity"`
+	ReceivedValue    int64              `bson:"received_value" json:"received_value"`
+	IssuedQuantity   int                `bson:"issued_quantity" json:"issued_quantity"`
+	IssuedCost       int64              `bson:"issued_cost" json:"issued_cost"`
+	RevaluedValue    int64              `bson:"revalued_value" json:"revalued_value"`
+}
+
+// CostHolding is the stock of one item in one warehouse at cost
+type CostHolding struct {
+	ItemID      primitive.ObjectID `bson:"item_id" json:"item_id"`
+	WarehouseID primitive.ObjectID `bson:"warehouse_id" json:"warehouse_id"`
+	Quantity    int                `bson:"quantity" json:"quantity"`
+	Value       int64              `bson:"value" json:"value"`
+}
+
+// CostRepository stores cost layers and the movements valued from them
+type CostRepository interface {
+	AddLayer(ctx context.Context, layer *models.CostLayer) error
+	// OpenLayers returns the item's layers in a warehouse that still hold
+	// stock, oldest first
+	OpenLayers(ctx context.Context, itemID, warehouseID primitive.ObjectID) ([]models.CostLayer, error)
+	// ConsumeLayer takes quantity from a layer's remaining stock
+	ConsumeLayer(ctx context.Context, id primitive.ObjectID, quantity int) error
+	AddMovement(ctx context.Context, movement *models.CostMovement) error
+	// Position sums the item's movements in a warehouse into the quantity
+	// and value currently held
+	Position(ctx context.Context, itemID, warehouseID primitive.ObjectID) (int, int64, error)
+	// Positions sums the item's movements into the quantity and value
+	// currently held per warehouse
+	Positions(ctx context.Context, itemID primitive.ObjectID) ([]CostHolding, error)
+	// Summarize totals the company's movements per warehouse before from and
+	// in [from, to); a warehouse restricts it to that warehouse
+	Summarize(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, from, to time.Time) ([]CostSummary, error)
+	// Holdings sums the company's movements before at into the quantity and
+	// value held per item and warehouse; a warehouse restricts it to that
+	// warehouse
+	Holdings(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, at time.Time) ([]CostHolding, error)
+	// HasMovements reports whether the company has valued any stock
+	HasMovements(ctx context.Context, companyID primitive.ObjectID) (bool, error)
+}
+
+// LayoutUpdate lists the storage location fields to change; nil fields are
+// left as they are
+type LayoutUpdate struct {
+	Name     *string
+	Capacity *int
+}
+
+// LayoutRepository stores the zones, aisles, racks and bins of warehouses
+type LayoutRepository interface {
+	// Create fails with ErrDuplicate when the parent already has a child with the same code
+	Create(ctx context.Context, location *models.StorageLocation) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.StorageLocation, error)
+	// List returns a warehouse's storage locations ordered by path
+	List(ctx context.Context, companyID, warehouseID primitive.ObjectID) ([]models.StorageLocation, error)
+	// Update always sets updated_at, so an empty update still writes the location
+	Update(ctx context.Context, companyID, id primitive.ObjectID, update LayoutUpdate) (*models.StorageLocation, error)
+	Delete(ctx context.Context, companyID, id primitive.ObjectID) error
+	HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// CategoryUpdate lists the category fields to change; nil fields are left as they are
+type CategoryUpdate struct {
+	Name       *string
+	Attributes []models.AttributeDef
+}
+
+// CategoryRepository stores the item category tree of companies
+type CategoryRepository interface {
+	// Create fails with ErrDuplicate when the parent already has a child with the same name
+	Create(ctx context.Context, category *models.Category) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Category, error)
+	// List returns the company's categories ordered by name
+	List(ctx context.Context, companyID primitive.ObjectID) ([]models.Category, error)
+	// Update fails with ErrDuplicate when a sibling already has the new name
+	Update(ctx context.Context, companyID, id primitive.ObjectID, update CategoryUpdate) (*models.Category, error)
+	Delete(ctx context.Context, companyID, id primitive.ObjectID) error
+	HasChildren(ctx context.Context, id primitive.ObjectID) (bool, error)
+}
+
+// KitRepository stores the bills of materials of kit items and the record
+// of kits assembled and taken apart
+type KitRepository interface {
+	// Save creates the bill of materials of its kit item, or replaces the existing one
+	Save(ctx context.Context, bom *models.BOM) error
+	// Get returns the bill of materials of a kit item
+	Get(ctx context.Context, companyID, kitItemID primitive.ObjectID) (*models.BOM, error)
+	List(ctx context.Context, companyID primitive.ObjectID) ([]models.BOM, error)
+	Delete(ctx context.Context, companyID, kitItemID primitive.ObjectID) error
+	AddBuild(ctx context.Context, build *models.KitBuild) error
+	// Builds returns a kit item's builds, newest first
+	Builds(ctx context.Context, companyID, kitItemID primitive.ObjectID) ([]models.KitBuild, error)
+}
+
+// PriceRepository stores the price history of items
+type PriceRepository interface {
+	Add(ctx context.Context, price *models.ItemPrice) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ItemPrice, error)
+	// List returns an item's prices, earliest first
+	List(ctx context.Context, companyID, itemID primitive.ObjectID) ([]models.ItemPrice, error)
+	// SetEffectiveTo ends a price at to; nil leaves it open-ended
+	SetEffectiveTo(ctx context.Context, id primitive.ObjectID, to *time.Time) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+	// Effective returns the price of each of the company's items at a time
+	Effective(ctx context.Context, companyID primitive.ObjectID, at time.Time) ([]models.ItemPrice, error)
+	// Due returns prices of every company that took effect by a time but
+	// are not yet applied to their items, earliest first
+	Due(ctx context.Context, at time.Time) ([]models.ItemPrice, error)
+	MarkApplied(ctx context.Context, id primitive.ObjectID) error
+}
+
+// SequenceRepository hands out per-company counters
+type SequenceRepository interface {
+	// Next increments a counter and returns its new value; counters start at 1
+	Next(ctx context.Context, companyID primitive.ObjectID, key string) (int64, error)
+}
+
+// QualityHoldFilter narrows quality hold listings; zero fields match every hold
+type QualityHoldFilter struct {
+	WarehouseID *primitive.ObjectID
+	ItemID      *primitive.ObjectID
+	// Status is held or resolved
+	Status string
+}
+
+// QualityHoldRepository stores quality holds with their inspections and decisions
+type QualityHoldRepository interface {
+	Create(ctx context.Context, hold *models.QualityHold) error
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.QualityHold, error)
+	// List returns the company's holds matching filter, newest first
+	List(ctx context.Context, companyID primitive.ObjectID, filter QualityHoldFilter) ([]models.QualityHold, error)
+	// Save replaces a hold and increments its version. It fails with
+	// ErrVersionMismatch when the hold changed since it was read.
+	Save(ctx context.Context, hold *models.QualityHold) error
+}
+
+// AuditQuery selects audit log entries. Action, ResourceType and Status are
+// case-insensitive patterns; zero values match everything.
+type AuditQuery struct {
+	CompanyID    primitive.ObjectID
+	Action       string
+	ResourceType string
+	Status       string
+	UserID       primitive.ObjectID
+	// IPAddress and UserAgent match exactly when set
+	IPAddress   string
+	UserAgent   string
+	ExcludeID   primitive.ObjectID
+	From        *time.Time
+	To          *time.Time
+	NewestFirst bool
+}
+
+// AuditUpdate lists the audit entry fields to rewrite; nil fields are left as
+// they are. Entries are otherwise immutable.
+type AuditUpdate struct {
+	Username         *string
+	DetailsEncrypted *string
+}
+
+// AuditRepository stores audit log entries
+type AuditRepository interface {
+	Insert(ctx context.Context, entry *models.AuditLog) error
+	// Update rewrites one entry, for pseudonymization and key rotation
+	Update(ctx context.Context, id primitive.ObjectID, update AuditUpdate) error
+	// Each streams matching entries ordered by creation time
+	Each(ctx context.Context, query AuditQuery, fn func(entry models.AuditLog) error) error
+	// Exists reports whether any entry matches
+	Exists(ctx context.Context, query AuditQuery) (bool, error)
+	// Usernames returns the distinct usernames the user's entries in the
+	// company were logged under
+	Usernames(ctx context.Context, companyID, userID primitive.ObjectID) ([]string, error)
+	// Expired returns up to limit of the company's entries created before
+	// cutoff that none of holds covers, oldest first
+	Expired(ctx context.Context, companyID primitive.ObjectID, cutoff time.Time, holds []models.LegalHold, limit int) ([]models.AuditLog, error)
+	Delete(ctx context.Context, ids []primitive.ObjectID) error
+	// Restore inserts archived entries again, skipping those still present,
+	// and returns how many it inserted
+	Restore(ctx context.Context, entries []models.AuditLog) (int, error)
+}
+
+// ArchiveFilter selects audit archives; zero fields match every archive
+type ArchiveFilter struct {
+	CompanyID primitive.ObjectID
+	// From and To match archives whose date range overlaps them
+	From *time.Time
+	To   *time.Time
+	// Action is a case-insensitive pattern over the archived actions
+	Action string
+	UserID primitive.ObjectID
+}
+
+// AuditRetentionRepository stores retention policies with their legal holds
+// and the index of archived audit logs
+type AuditRetentionRepository interface {
+	// Policy returns the company's policy, or ErrNotFound when it has none
+	Policy(ctx context.Context, companyID primitive.ObjectID) (*models.AuditRetentionPolicy, error)
+	// SetPolicy creates or updates the company's retention period and
+	// company-wide legal hold, keeping its scoped holds
+	SetPolicy(ctx context.Context, policy *models.AuditRetentionPolicy) error
+	// AddHold adds a scoped legal hold, creating a keep-forever policy when
+	// the company has none
+	AddHold(ctx context.Context, companyID primitive.ObjectID, hold models.LegalHold) error
+	// RemoveHold fails with ErrNotFound when the company has no such hold
+	RemoveHold(ctx context.Context, companyID, holdID primitive.ObjectID) error
+	// Expiring returns the policies with a retention period and no
+	// company-wide legal hold
+	Expiring(ctx context.Context) ([]models.AuditRetentionPolicy, error)
+	SetLastRun(ctx context.Context, companyID primitive.ObjectID, at time.Time) error
+	AddArchive(ctx context.Context, archive *models.AuditArchive) error
+	GetArchive(ctx context.Context, companyID, id primitive.ObjectID) (*models.AuditArchive, error)
+	// ListArchives returns the archives matching filter, newest first
+	ListArchives(ctx context.Context, filter ArchiveFilter) ([]models.AuditArchive, error)
+	// SaveArchive replaces an archive's index entry
+	SaveArchive(ctx context.Context, archive *models.AuditArchive) error
+}
+
+// Matcher compiles the query into a predicate over decoded entries
+func (q AuditQuery) Matcher() (func(entry models.AuditLog) bool, error) {
+	compile := func(pattern string) (*regexp.Regexp, error) {
+		if pattern == "" {
+			return nil, nil
+		}
+		return regexp.Compile("(?i)" + pattern)
+	}
+	action, err := compile(q.Action)
+	if err != nil {
+		return nil, err
+	}
+	resourceType, err := compile(q.ResourceType)
+	if err != nil {
+		return nil, err
+	}
+	status, err := compile(q.Status)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(entry models.AuditLog) bool {
+		switch {
+		case !q.CompanyID.IsZero() && entry.CompanyID != q.CompanyID:
+			return false
+		case action != nil && !action.MatchString(entry.Action):
+			return false
+		case resourceType != nil && !resourceType.MatchString(entry.ResourceType):
+			return false
+		case status != nil && !status.MatchString(entry.Status):
+			return false
+		case !q.UserID.IsZero() && entry.UserID != q.UserID:
+			return false
+		case q.IPAddress != "" && entry.IPAddress != q.IPAddress:
+			return false
+		case q.UserAgent != "" && entry.UserAgent != q.UserAgent:
+			return false
+		case !q.ExcludeID.IsZero() && entry.ID == q.ExcludeID:
+			return false
+		case q.From != nil && entry.CreatedAt.Before(*q.From):
+			return false
+		case q.To != nil && entry.CreatedAt.After(*q.To):
+			return false
+		}
+		return true
+	}, nil
+}
+
+// BackupRepository stores the metadata of backup archives
+type BackupRepository interface {
+	Create(ctx context.Context, backup *models.Backup) error
+	// Get returns one backup; a zero companyID matches any backup, full ones included
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.Backup, error)
+	// List returns a company's backups, newest first
+	List(ctx context.Context, companyID primitive.ObjectID) ([]models.Backup, error)
+	// All returns every backup, full ones included
+	All(ctx context.Context) ([]models.Backup, error)
+	// Expired returns the backups whose retention ended before a time
+	Expired(ctx context.Context, before time.Time) ([]models.Backup, error)
+	// Save replaces a backup's metadata
+	Save(ctx context.Context, backup *models.Backup) error
+	Delete(ctx context.Context, id primitive.ObjectID) error
+}
+
+// AlertFilter narrows security alert listings; zero fields match every alert
+type AlertFilter struct {
+	Status   string
+	Rule     string
+	Severity string
+	UserID   primitive.ObjectID
+}
+
+// AlertUpdate holds the alert fields to change; nil fields are left as they are
+type AlertUpdate struct {
+	Username    *string
+	Title       *string
+	Description *string
+}
+
+// AlertRepository stores the security alerts raised by anomaly detection
+type AlertRepository interface {
+	Create(ctx context.Context, alert *models.SecurityAlert) error
+	// List returns up to limit of the company's alerts matching filter,
+	// newest first; a limit of 0 returns them all
+	List(ctx context.Context, companyID primitive.ObjectID, filter AlertFilter, limit int) ([]models.SecurityAlert, error)
+	// Update rewrites the text of one of the company's alerts, for
+	// pseudonymization
+	Update(ctx context.Context, companyID, id primitive.ObjectID, update AlertUpdate) error
+	// SetStatus records who handled an alert and how. It fails with
+	// ErrNotFound when the company has no such alert.
+	SetStatus(ctx context.Context, companyID, id primitive.ObjectID, status, note string, handledBy primitive.ObjectID) error
+}
+
+// ImportJobRepository stores the progress of bulk item imports
+type ImportJobRepository interface {
+	Create(ctx context.Context, job *models.ImportJob) error
+	// Get returns one of the company's jobs
+	Get(ctx context.Context, companyID, id primitive.ObjectID) (*models.ImportJob, error)
+	// Save replaces a job's progress
+	Save(ctx context.Context, job *models.ImportJob) error
+	// FailRunning marks every running job as failed with message
+	FailRunning(ctx context.Context, message string, at time.Time) error
+}
+
+// IdempotencyRepository stores the responses to requests sent with an
+// Idempotency-Key. Records are keyed by user and key; expired ones are
+// removed by a TTL index in MongoDB and must be ignored until then.
+type IdempotencyRepository interface {
+	// Claim inserts an unfinished record, failing with ErrDuplicate when the
+	// ID is already taken
+	Claim(ctx context.Context, record *models.IdempotencyRecord) error
+	Get(ctx context.Context, id string) (*models.IdempotencyRecord, error)
+	// Complete stores the response to a claimed record until expiresAt
+	Complete(ctx context.Context, id string, statusCode int, headers map[string]string, body []byte, expiresAt time.Time) error
+	// Release deletes a record that is not completed
+	Release(ctx context.Context, id string) error
+	// DeleteExpired deletes a record if it still expires at expiresAt
+	DeleteExpired(ctx context.Context, id string, expiresAt time.Time) error
+}
+
+// Transactor runs fn atomically. Repository calls made with the context passed
+// to fn take part in the transaction; calls made inside an already running
+// transaction join it instead of starting a new one.
+type Transactor interface {
+	WithTransaction(ctx context.Context, fn func(ctx context.Context) error) error
+}
+
+// Repositories bundles the stores handlers depend on
+type Repositories struct {
+	Tx           Transactor
+	Companies    CompanyRepository
+	Users        UserRepository
+	Warehouses   WarehouseRepository
+	Items        ItemRepository
+	Costs        CostRepository
+	Prices       PriceRepository
+	Layout       LayoutRepository
+	Categories   CategoryRepository
+	Kits         KitRepository
+	Sequences    SequenceRepository
+	QualityHolds QualityHoldRepository
+	Audit        AuditRepository
+	Retention    AuditRetentionRepository
+	Alerts       AlertRepository
+	Backups      BackupRepository
+	ImportJobs   ImportJobRepository
+	Idempotency  IdempotencyRepository
+}
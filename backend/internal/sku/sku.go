@@ -0,0 +1,265 @@
+// Package sku generates item SKUs from a company's pattern. A generated SKU
+// joins the pattern's prefix, the item's department code and a zero-padded
+// sequence number with the separator, e.g. ELC-TV-00042. Each prefix and
+// department code combination counts on its own, and a check digit can be
+// appended to the sequence to catch typing errors.
+package sku
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Check digit schemes
+const (
+	CheckDigitLuhn = "luhn" // Luhn mod 10, as on payment cards
+	CheckDigitGS1  = "gs1"  // GS1 mod 10 with weights 3 and 1, as on EAN and UPC barcodes
+)
+
+const (
+	// DefaultSequenceDigits pads sequences of patterns that do not say
+	DefaultSequenceDigits = 5
+	maxSequenceDigits     = 12
+	maxCodeLength         = 12
+	// departmentCodeLength is the length of codes derived from department names
+	departmentCodeLength = 3
+	// maxAttempts caps how many taken SKUs are skipped when generating one
+	maxAttempts = 100
+)
+
+// separators are the characters patterns may join their parts with
+var separators = []string{"", "-", "_", "."}
+
+var (
+	// ErrEmpty is returned for a blank SKU
+	ErrEmpty = errors.New("SKU cannot be empty")
+	// ErrInvalidPattern is returned for a pattern that cannot generate SKUs
+	ErrInvalidPattern = errors.New("invalid SKU pattern")
+	// ErrNoPattern is returned when generating a SKU for a company without a pattern
+	ErrNoPattern = errors.New("no SKU pattern is configured; set one or give the SKU")
+	// ErrDepartmentRequired is returned when the pattern uses a department code and none is given
+	ErrDepartmentRequired = errors.New("the SKU pattern needs the item's department")
+	// ErrExhausted is returned when the sequence has no free numbers left
+	ErrExhausted = errors.New("no free SKU is left in the sequence; widen sequence_digits")
+)
+
+// Normalize trims a SKU given by a user, failing when nothing is left
+func Normalize(sku string) (string, error) {
+	sku = strings.TrimSpace(sku)
+	if sku == "" {
+		return "", ErrEmpty
+	}
+	return sku, nil
+}
+
+// ValidatePattern checks a pattern and returns it with its codes
+// upper-cased and its defaults filled in
+func ValidatePattern(pattern models.SKUPattern) (models.SKUPattern, error) {
+	pattern.Prefix = strings.ToUpper(strings.TrimSpace(pattern.Prefix))
+	if err := checkCode("prefix", pattern.Prefix); err != nil {
+		return pattern, err
+	}
+	valid := false
+	for _, separator := range separators {
+		valid = valid || pattern.Separator == separator
+	}
+	if !valid {
+		return pattern, fmt.Errorf("%w: separator must be one of \"\", \"-\", \"_\" or \".\"", ErrInvalidPattern)
+	}
+
+	if pattern.SequenceDigits == 0 {
+		pattern.SequenceDigits = DefaultSequenceDigits
+	}
+	if pattern.SequenceDigits < 1 || pattern.SequenceDigits > maxSequenceDigits {
+		return pattern, fmt.Errorf("%w: sequence_digits must be between 1 and %d", ErrInvalidPattern, maxSequenceDigits)
+	}
+	if pattern.CheckDigit != "" && pattern.CheckDigit != CheckDigitLuhn && pattern.CheckDigit != CheckDigitGS1 {
+		return pattern, fmt.Errorf("%w: check_digit must be %s or %s", ErrInvalidPattern, CheckDigitLuhn, CheckDigitGS1)
+	}
+
+	codes := make(map[string]string, len(pattern.DepartmentCodes))
+	for department, code := range pattern.DepartmentCodes {
+		department = strings.TrimSpace(department)
+		code = strings.ToUpper(strings.TrimSpace(code))
+		if department == "" || code == "" {
+			return pattern, fmt.Errorf("%w: department codes need a department and a code", ErrInvalidPattern)
+		}
+		if err := checkCode("code of "+department, code); err != nil {
+			return pattern, err
+		}
+		codes[department] = code
+	}
+	pattern.DepartmentCodes = codes
+	if len(codes) == 0 {
+		pattern.DepartmentCodes = nil
+	}
+	return pattern, nil
+}
+
+// checkCode accepts short codes of letters and digits
+func checkCode(name, code string) error {
+	if len(code) > maxCodeLength {
+		return fmt.Errorf("%w: %s is longer than %d characters", ErrInvalidPattern, name, maxCodeLength)
+	}
+	for _, r := range code {
+		if (r < 'A' || r > 'Z') && (r < '0' || r > '9') {
+			return fmt.Errorf("%w: %s may only hold letters and digits", ErrInvalidPattern, name)
+		}
+	}
+	return nil
+}
+
+// DepartmentCode returns the code of a department: the pattern's code for
+// it, matched regardless of case, or else its first letters and digits
+func DepartmentCode(pattern models.SKUPattern, department string) (string, error) {
+	department = strings.TrimSpace(department)
+	if department == "" {
+		return "", ErrDepartmentRequired
+	}
+	for name, code := range pattern.DepartmentCodes {
+		if strings.EqualFold(name, department) {
+			return code, nil
+		}
+	}
+
+	var code strings.Builder
+	for _, r := range strings.ToUpper(department) {
+		if (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9') {
+			code.WriteRune(r)
+			if code.Len() == departmentCodeLength {
+				break
+			}
+		}
+	}
+	if code.Len() == 0 {
+		return "", fmt.Errorf("%w: department %q has no letters or digits to derive a code from; add it to department_codes", ErrInvalidPattern, department)
+	}
+	return code.String(), nil
+}
+
+// Format builds the SKU with a sequence number. key is the prefix and
+// department code part, which has a sequence of its own.
+func Format(pattern models.SKUPattern, department string, sequence int64) (sku, key string, err error) {
+	var parts []string
+	if pattern.Prefix != "" {
+		parts = append(parts, pattern.Prefix)
+	}
+	if pattern.UseDepartment {
+		code, err := DepartmentCode(pattern, department)
+		if err != nil {
+			return "", "", err
+		}
+		parts = append(parts, code)
+	}
+	key = strings.Join(parts, pattern.Separator)
+
+	number := fmt.Sprintf("%0*d", pattern.SequenceDigits, sequence)
+	if len(number) > pattern.SequenceDigits {
+		return "", key, ErrExhausted
+	}
+	if pattern.CheckDigit != "" {
+		number += strconv.Itoa(CheckDigit(pattern.CheckDigit, number))
+	}
+	return strings.Join(append(parts, number), pattern.Separator), key, nil
+}
+
+// CheckDigit computes the check digit of a string of digits
+func CheckDigit(scheme, digits string) int {
+	sum := 0
+	for i := range digits {
+		// Weigh digits from the right, where the check digit will go
+		digit := int(digits[len(digits)-1-i] - '0')
+		switch scheme {
+		case CheckDigitGS1:
+			if i%2 == 0 {
+				digit *= 3
+			}
+		default:
+			if i%2 == 0 {
+				if digit *= 2; digit > 9 {
+					digit -= 9
+				}
+			}
+		}
+		sum += digit
+	}
+	return (10 - sum%10) % 10
+}
+
+// Service generates SKUs from company patterns
+type Service struct {
+	companies repository.CompanyRepository
+	items     repository.ItemRepository
+	sequences repository.SequenceRepository
+}
+
+func NewService(companies repository.CompanyRepository, items repository.ItemRepository, sequences repository.SequenceRepository) *Service {
+	return &Service{companies: companies, items: items, sequences: sequences}
+}
+
+// Pattern returns the company's SKU pattern, or nil when it has none
+func (s *Service) Pattern(ctx context.Context, companyID primitive.ObjectID) (*models.SKUPattern, error) {
+	company, err := s.companies.Get(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return company.SKUPattern, nil
+}
+
+// SetPattern validates and stores the company's SKU pattern. SKUs already
+// generated keep their numbers; a changed prefix or code starts a new sequence.
+func (s *Service) SetPattern(ctx context.Context, companyID primitive.ObjectID, pattern models.SKUPattern) (*models.SKUPattern, error) {
+	pattern, err := ValidatePattern(pattern)
+	if err != nil {
+		return nil, err
+	}
+	company, err := s.companies.Update(ctx, companyID, repository.CompanyUpdate{SKUPattern: &pattern})
+	if err != nil {
+		return nil, err
+	}
+	return company.SKUPattern, nil
+}
+
+// Reserve takes the next number of the sequence for the department and
+// returns its SKU. Numbers are never handed out twice, and numbers whose SKU
+// was already given to an item by hand are skipped.
+func (s *Service) Reserve(ctx context.Context, companyID primitive.ObjectID, department string) (string, error) {
+	pattern, err := s.Pattern(ctx, companyID)
+	if err != nil {
+		return "", err
+	}
+	if pattern == nil {
+		return "", ErrNoPattern
+	}
+	// Validate the department before taking a number
+	_, key, err := Format(*pattern, department, 0)
+	if err != nil {
+		return "", err
+	}
+
+	for attempt := 0; attempt < maxAttempts; attempt++ {
+		sequence, err := s.sequences.Next(ctx, companyID, "sku:"+key)
+		if err != nil {
+			return "", err
+		}
+		sku, _, err := Format(*pattern, department, sequence)
+		if err != nil {
+			return "", err
+		}
+		_, err = s.items.GetBySKU(ctx, companyID, sku)
+		if err == repository.ErrNotFound {
+			return sku, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return "", ErrExhausted
+}
@@ -0,0 +1,133 @@
+package sku
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+)
+
+func TestCheckDigit(t *testing.T) {
+	tests := []struct {
+		scheme string
+		digits string
+		want   int
+	}{
+		{CheckDigitLuhn, "7992739871", 3},
+		{CheckDigitLuhn, "4992739871", 6},
+		{CheckDigitLuhn, "0", 0},
+		{CheckDigitGS1, "629104150021", 3}, // GTIN-13
+		{CheckDigitGS1, "400638133393", 1}, // EAN-13
+		{CheckDigitGS1, "03600029145", 2},  // UPC-A
+	}
+	for _, tt := range tests {
+		if got := CheckDigit(tt.scheme, tt.digits); got != tt.want {
+			t.Errorf("%s check digit of %s = %d, want %d", tt.scheme, tt.digits, got, tt.want)
+		}
+	}
+}
+
+func TestFormat(t *testing.T) {
+	tests := []struct {
+		name       string
+		pattern    models.SKUPattern
+		department string
+		sequence   int64
+		want       string
+		err        error
+	}{
+		{
+			name:       "mapped department code",
+			pattern:    models.SKUPattern{Prefix: "ELC", Separator: "-", UseDepartment: true, DepartmentCodes: map[string]string{"Television": "TV"}, SequenceDigits: 5},
+			department: "television",
+			sequence:   42,
+			want:       "ELC-TV-00042",
+		},
+		{
+			name:       "derived department code",
+			pattern:    models.SKUPattern{Separator: ".", UseDepartment: true, SequenceDigits: 3},
+			department: "Home & Garden",
+			sequence:   7,
+			want:       "HOM.007",
+		},
+		{
+			name:     "luhn check digit",
+			pattern:  models.SKUPattern{Prefix: "A", SequenceDigits: 10, CheckDigit: CheckDigitLuhn},
+			sequence: 7992739871,
+			want:     "A79927398713",
+		},
+		{
+			name:     "gs1 check digit",
+			pattern:  models.SKUPattern{SequenceDigits: 12, CheckDigit: CheckDigitGS1},
+			sequence: 629104150021,
+			want:     "6291041500213",
+		},
+		{
+			name:     "sequence overflowing its digits",
+			pattern:  models.SKUPattern{Prefix: "BX", SequenceDigits: 2},
+			sequence: 100,
+			err:      ErrExhausted,
+		},
+		{
+			name:    "department required",
+			pattern: models.SKUPattern{UseDepartment: true, SequenceDigits: 5},
+			err:     ErrDepartmentRequired,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, _, err := Format(tt.pattern, tt.department, tt.sequence)
+			if !errors.Is(err, tt.err) || got != tt.want {
+				t.Fatalf("Format = %q, %v; want %q, %v", got, err, tt.want, tt.err)
+			}
+		})
+	}
+}
+
+func TestReserve(t *testing.T) {
+	ctx := context.Background()
+	repos := repository.NewMemoryRepositories()
+	company := &models.Company{Name: "Acme"}
+	if err := repos.Companies.Create(ctx, company); err != nil {
+		t.Fatal(err)
+	}
+	service := NewService(repos.Companies, repos.Items, repos.Sequences)
+
+	if _, err := service.Reserve(ctx, company.ID, ""); err != ErrNoPattern {
+		t.Fatalf("without a pattern: error = %v, want %v", err, ErrNoPattern)
+	}
+	if _, err := service.SetPattern(ctx, company.ID, models.SKUPattern{Prefix: "bx", Separator: "-", SequenceDigits: 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// SKUs given by hand, in any case, are skipped
+	for _, taken := range []string{"BX-1", "bx-2", "BX-4"} {
+		if err := repos.Items.Create(ctx, &models.Item{CompanyID: company.ID, SKU: taken, Name: "Box"}, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var reserved []string
+	for {
+		sku, err := service.Reserve(ctx, company.ID, "")
+		if err == ErrExhausted {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		reserved = append(reserved, sku)
+	}
+
+	// One digit runs out after 9
+	want := []string{"BX-3", "BX-5", "BX-6", "BX-7", "BX-8", "BX-9"}
+	if len(reserved) != len(want) {
+		t.Fatalf("reserved %v, want %v", reserved, want)
+	}
+	for i := range want {
+		if reserved[i] != want[i] {
+			t.Fatalf("reserved %v, want %v", reserved, want)
+		}
+	}
+}
@@ -0,0 +1,209 @@
+// Package uom converts quantities between an item's units of measure. Stock
+// is always stored as a whole number of the item's base unit; other units
+// are a whole number of base units each. Items counted in a weight or volume
+// unit also convert between the standard units of that measure. Quantities
+// that are not a whole number of base units are refused rather than rounded,
+// so new measured items must use a base unit of g or ml, or smaller.
+package uom
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/a2sv/safeware/internal/models"
+)
+
+// DefaultUnit is the base unit of items that do not name one
+const DefaultUnit = "each"
+
+// maxUnits caps the units an item defines besides its base unit
+const maxUnits = 20
+
+// maxQuantity keeps converted quantities exact in a float64 and within int
+const maxQuantity = 1 << 50
+
+var (
+	// ErrUnknownUnit is returned for a unit the item does not have
+	ErrUnknownUnit = errors.New("unit is not configured for this item")
+	// ErrFractional is returned when a quantity is not a whole number of the item's base unit
+	ErrFractional = errors.New("quantity is not a whole number of the item's base unit")
+	// ErrTooLarge is returned for quantities too large to store
+	ErrTooLarge = errors.New("quantity is too large")
+	// ErrInvalidUnits is returned for an invalid unit configuration
+	ErrInvalidUnits = errors.New("invalid units of measure")
+)
+
+// standardUnit is a weight unit in grams or a volume unit in millilitres
+type standardUnit struct {
+	name string
+	size float64
+}
+
+// measures are the standard weight and volume units
+var measures = [][]standardUnit{
+	{{"mg", 0.001}, {"g", 1}, {"kg", 1000}, {"t", 1e6}, {"oz", 28.349523125}, {"lb", 453.59237}},
+	{{"ml", 1}, {"cl", 10}, {"l", 1000}, {"m3", 1e6}, {"fl_oz", 29.5735295625}, {"gal", 3785.411784}},
+}
+
+// Amount is a quantity in a named unit
+type Amount struct {
+	Quantity float64 `json:"quantity"`
+	Unit     string  `json:"unit"`
+}
+
+// Base returns the unit an item's stock is counted in
+func Base(item *models.Item) string {
+	if item.BaseUnit == "" {
+		return DefaultUnit
+	}
+	return item.BaseUnit
+}
+
+// measure returns the standard units of the measure unit belongs to
+func measure(unit string) []standardUnit {
+	for _, units := range measures {
+		if size(units, unit) > 0 {
+			return units
+		}
+	}
+	return nil
+}
+
+// size returns the size of a standard unit, or 0 when it is not one
+func size(units []standardUnit, name string) float64 {
+	for _, unit := range units {
+		if unit.name == name {
+			return unit.size
+		}
+	}
+	return 0
+}
+
+// Normalize checks a base unit and the item's other units, returning them
+// trimmed and lower-cased. An empty base is DefaultUnit. Units must hold a
+// whole number of base units, and units of measured items may not redefine a
+// standard unit of the same measure.
+func Normalize(base string, units []models.UnitOfMeasure) (string, []models.UnitOfMeasure, error) {
+	base = strings.ToLower(strings.TrimSpace(base))
+	if base == "" {
+		base = DefaultUnit
+	}
+	if len(units) > maxUnits {
+		return "", nil, fmt.Errorf("%w: an item has at most %d units besides its base unit", ErrInvalidUnits, maxUnits)
+	}
+	standard := measure(base)
+
+	normalized := make([]models.UnitOfMeasure, 0, len(units))
+	seen := map[string]bool{base: true}
+	for _, unit := range units {
+		unit.Name = strings.ToLower(strings.TrimSpace(unit.Name))
+		switch {
+		case unit.Name == "":
+			return "", nil, fmt.Errorf("%w: units need a name", ErrInvalidUnits)
+		case seen[unit.Name]:
+			return "", nil, fmt.Errorf("%w: unit %q is defined twice", ErrInvalidUnits, unit.Name)
+		case size(standard, unit.Name) > 0:
+			return "", nil, fmt.Errorf("%w: %q is a standard unit and converts on its own", ErrInvalidUnits, unit.Name)
+		case unit.Factor <= 0 || unit.Factor >= maxQuantity || math.IsNaN(unit.Factor):
+			return "", nil, fmt.Errorf("%w: factor of %q must be a positive number of %s", ErrInvalidUnits, unit.Name, base)
+		case unit.Factor != math.Trunc(unit.Factor):
+			return "", nil, fmt.Errorf("%w: %q must hold a whole number of %s", ErrInvalidUnits, unit.Name, base)
+		}
+		seen[unit.Name] = true
+		normalized = append(normalized, unit)
+	}
+	return base, normalized, nil
+}
+
+// CheckBase refuses a weight or volume unit larger than g or ml as the base
+// unit of a new item. Stock in kg could not take 500 g, so every smaller
+// amount would later be refused as fractional; counted in g, the item still
+// takes quantities in kg.
+func CheckBase(base string) error {
+	if standard := measure(base); standard != nil && size(standard, base) > 1 {
+		return fmt.Errorf("%w: %q is too coarse a base unit; count weights in g and volumes in ml, which still take quantities in %s", ErrInvalidUnits, base, base)
+	}
+	return nil
+}
+
+// Units lists every unit an item's quantities can be given in, its base
+// unit first, then its own units and the standard units of its measure
+func Units(item *models.Item) []models.UnitOfMeasure {
+	base := Base(item)
+	units := []models.UnitOfMeasure{{Name: base, Factor: 1}}
+	units = append(units, item.Units...)
+	standard := measure(base)
+	for _, unit := range standard {
+		if unit.name != base {
+			units = append(units, models.UnitOfMeasure{Name: unit.name, Factor: unit.size / size(standard, base)})
+		}
+	}
+	return units
+}
+
+// Factor returns how many base units one unit of an item holds. An empty
+// unit is the base unit.
+func Factor(item *models.Item, unit string) (float64, error) {
+	unit = strings.ToLower(strings.TrimSpace(unit))
+	if unit == "" {
+		return 1, nil
+	}
+	for _, u := range Units(item) {
+		if u.Name == unit {
+			return u.Factor, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownUnit, unit)
+}
+
+// ToBase converts a quantity in a unit to whole base units. Quantities that
+// do not convert exactly, such as 1.5 g of an item counted in g or 1 oz of
+// one counted in g, fail with ErrFractional.
+func ToBase(item *models.Item, quantity float64, unit string) (int, error) {
+	factor, err := Factor(item, unit)
+	if err != nil {
+		return 0, err
+	}
+	converted := quantity * factor
+	if math.IsNaN(converted) || math.Abs(converted) >= maxQuantity {
+		return 0, ErrTooLarge
+	}
+	rounded := math.Round(converted)
+	if math.Abs(converted-rounded) > 1e-9*math.Max(1, math.Abs(converted)) {
+		return 0, ErrFractional
+	}
+	return int(rounded), nil
+}
+
+// FromBase presents a quantity of base units in another unit, to six decimals
+func FromBase(item *models.Item, quantity int, unit string) (Amount, error) {
+	factor, err := Factor(item, unit)
+	if err != nil {
+		return Amount{}, err
+	}
+	if unit = strings.ToLower(strings.TrimSpace(unit)); unit == "" {
+		unit = Base(item)
+	}
+	return Amount{Quantity: math.Round(float64(quantity)/factor*1e6) / 1e6, Unit: unit}, nil
+}
+
+// Present is FromBase falling back to the base unit for items that do not
+// have the unit, so mixed lists can be shown in one unit where it applies
+func Present(item *models.Item, quantity int, unit string) Amount {
+	amount, err := FromBase(item, quantity, unit)
+	if err != nil {
+		amount = Amount{Quantity: float64(quantity), Unit: Base(item)}
+	}
+	return amount
+}
+
+// UnitCost converts a cost per unit to a cost per base unit, in minor units
+func UnitCost(item *models.Item, cost int64, unit string) (int64, error) {
+	factor, err := Factor(item, unit)
+	if err != nil {
+		return 0, err
+	}
+	return int64(math.Round(float64(cost) / factor)), nil
+}
@@ -0,0 +1,63 @@
+package uom
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/a2sv/safeware/internal/models"
+)
+
+func TestToBaseRefusesFractionalQuantities(t *testing.T) {
+	grams := &models.Item{BaseUnit: "g", Units: []models.UnitOfMeasure{{Name: "bag", Factor: 2500}}}
+	each := &models.Item{Units: []models.UnitOfMeasure{{Name: "case", Factor: 12}}}
+
+	for _, tc := range []struct {
+		item     *models.Item
+		quantity float64
+		unit     string
+		want     int
+		err      error
+	}{
+		{grams, 2.5, "kg", 2500, nil},
+		{grams, 2, "bag", 5000, nil},
+		{grams, 0.001, "t", 1000, nil},
+		{grams, 1.5, "", 0, ErrFractional},
+		{grams, 0.0005, "kg", 0, ErrFractional},
+		{grams, 1, "oz", 0, ErrFractional},
+		{grams, 500, "mg", 0, ErrFractional},
+		{each, 0.5, "case", 6, nil},
+		{each, 0.1, "case", 0, ErrFractional},
+		{each, 1, "kg", 0, ErrUnknownUnit},
+	} {
+		got, err := ToBase(tc.item, tc.quantity, tc.unit)
+		if !errors.Is(err, tc.err) || got != tc.want {
+			t.Errorf("ToBase(%s, %v %s) = %d, %v; want %d, %v", Base(tc.item), tc.quantity, tc.unit, got, err, tc.want, tc.err)
+		}
+	}
+}
+
+func TestNormalizeRequiresWholeFactors(t *testing.T) {
+	if _, _, err := Normalize("kg", []models.UnitOfMeasure{{Name: "sack", Factor: 2.5}}); !errors.Is(err, ErrInvalidUnits) {
+		t.Errorf("fractional factor of a measured item: got %v", err)
+	}
+	if _, _, err := Normalize("kg", []models.UnitOfMeasure{{Name: "g", Factor: 1}}); !errors.Is(err, ErrInvalidUnits) {
+		t.Errorf("redefined standard unit: got %v", err)
+	}
+	base, units, err := Normalize(" G ", []models.UnitOfMeasure{{Name: " Sack ", Factor: 2500}})
+	if err != nil || base != "g" || units[0].Name != "sack" {
+		t.Errorf("got %q %+v %v", base, units, err)
+	}
+}
+
+func TestCheckBaseRefusesCoarseMeasuredUnits(t *testing.T) {
+	for _, base := range []string{"each", "box", "mg", "g", "ml"} {
+		if err := CheckBase(base); err != nil {
+			t.Errorf("%s: got %v", base, err)
+		}
+	}
+	for _, base := range []string{"kg", "t", "oz", "lb", "cl", "l", "m3", "fl_oz", "gal"} {
+		if err := CheckBase(base); !errors.Is(err, ErrInvalidUnits) {
+			t.Errorf("%s: got %v, want %v", base, err, ErrInvalidUnits)
+		}
+	}
+}
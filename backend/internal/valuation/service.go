@@ -0,0 +1,375 @@
+// Package valuation values stock with cost layers under each company's
+// valuation method: FIFO, moving weighted average or standard cost. Every
+// receipt and issue is recorded as a cost movement, so the cost of goods
+// issued and the closing valuation of any period can be summed from them.
+// When the cost stock will be issued at changes, the difference is recorded
+// as a revaluation so that the value held still matches it.
+package valuation
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Movement sources
+const (
+	SourceOpening = "opening"
+	SourceCreate  = "create"
+	SourceAdjust  = "adjust"
+	SourceImport  = "import"
+	// Kit builds issue what they consume and receive what they produce
+	SourceAssemble    = "assemble"
+	SourceDisassemble = "disassemble"
+	// Purging an archived item writes off the stock it still held
+	SourcePurge = "purge"
+	// Quality decisions write off held stock that is scrapped or returned
+	// to the supplier
+	SourceScrap  = "scrap"
+	SourceReturn = "return"
+	// Revaluations follow a change of an item's price or standard cost, or
+	// of the company's valuation method
+	SourcePrice  = "price"
+	SourceMethod = "method"
+)
+
+var (
+	// ErrCurrencyLocked is returned when changing the currency of a company
+	// that has already valued stock
+	ErrCurrencyLocked = errors.New("currency cannot change once stock has been valued")
+	// ErrInvalidCurrency is returned for codes that are not supported ISO 4217 currencies
+	ErrInvalidCurrency = errors.New("unsupported currency")
+	// ErrInvalidMethod is returned for unknown valuation methods
+	ErrInvalidMethod = errors.New("valuation method must be one of fifo, average, standard")
+)
+
+// Settings are a company's currency and valuation method
+type Settings struct {
+	Currency string `json:"currency"`
+	Method   string `json:"method"`
+}
+
+// Service records cost movements and summarizes them
+type Service struct {
+	tx         repository.Transactor
+	companies  repository.CompanyRepository
+	warehouses repository.WarehouseRepository
+	items      repository.ItemRepository
+	costs      repository.CostRepository
+}
+
+func NewService(tx repository.Transactor, companies repository.CompanyRepository, warehouses repository.WarehouseRepository, items repository.ItemRepository, costs repository.CostRepository) *Service {
+	return &Service{tx: tx, companies: companies, warehouses: warehouses, items: items, costs: costs}
+}
+
+// Settings returns the company's currency and valuation method
+func (s *Service) Settings(ctx context.Context, companyID primitive.ObjectID) (*Settings, error) {
+	company, err := s.companies.Get(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	return &Settings{Currency: company.CurrencyCode(), Method: company.Valuation()}, nil
+}
+
+// UpdateSettings changes the currency or valuation method; nil leaves one as
+// it is. A new method applies to movements recorded from then on, and the
+// stock already held is revalued at the cost the new method issues it at.
+func (s *Service) UpdateSettings(ctx context.Context, companyID primitive.ObjectID, currency, method *string, changedBy primitive.ObjectID) (*Settings, error) {
+	if method != nil && !models.ValidValuationMethod(*method) {
+		return nil, ErrInvalidMethod
+	}
+	if currency != nil && !models.ValidCurrency(*currency) {
+		return nil, ErrInvalidCurrency
+	}
+
+	var settings *Settings
+	err := s.tx.WithTransaction(ctx, func(ctx context.Context) error {
+		current, err := s.Settings(ctx, companyID)
+		if err != nil {
+			return err
+		}
+		if currency != nil && *currency != current.Currency {
+			valued, err := s.costs.HasMovements(ctx, companyID)
+			if err != nil {
+				return err
+			}
+			if valued {
+				return ErrCurrencyLocked
+			}
+		}
+
+		company, err := s.companies.Update(ctx, companyID, repository.CompanyUpdate{Currency: currency, ValuationMethod: method})
+		if err != nil {
+			return err
+		}
+		settings = &Settings{Currency: company.CurrencyCode(), Method: company.Valuation()}
+		if settings.Method == current.Method {
+			return nil
+		}
+		return s.revalueCompany(ctx, companyID, settings, changedBy)
+	})
+	if err != nil {
+		return nil, err
+	}
+	return settings, nil
+}
+
+// Revalue brings the value of the item's stock in each warehouse to the cost
+// the company's method will issue it at, recording any difference as a
+// revaluation. Call it in the same transaction as a change to the item's
+// price or standard cost.
+func (s *Service) Revalue(ctx context.Context, item *models.Item, source string, createdBy primitive.ObjectID) error {
+	settings, err := s.Settings(ctx, item.CompanyID)
+	if err != nil {
+		return err
+	}
+	positions, err := s.costs.Positions(ctx, item.ID)
+	if err != nil {
+		return err
+	}
+	for _, position := range positions {
+		if err := s.revalue(ctx, settings, item, position, source, createdBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revalueCompany revalues all stock the company holds after a method change
+func (s *Service) revalueCompany(ctx context.Context, companyID primitive.ObjectID, settings *Settings, createdBy primitive.ObjectID) error {
+	holdings, err := s.costs.Holdings(ctx, companyID, nil, time.Now())
+	if err != nil {
+		return err
+	}
+	items := map[primitive.ObjectID]*models.Item{}
+	for _, holding := range holdings {
+		item, ok := items[holding.ItemID]
+		if !ok {
+			item, err = s.items.Get(ctx, companyID, holding.ItemID)
+			// Purged items have written off their stock
+			if err == repository.ErrNotFound {
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			items[holding.ItemID] = item
+		}
+		if err := s.revalue(ctx, settings, item, holding, SourceMethod, createdBy); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// revalue records the difference between the value held in one warehouse
+// and the cost the method will issue it at. Standard costing issues at the
+// standard cost, and FIFO at the cost of the open layers, with any stock
+// beyond them at the standard cost or price. Average costing issues at the
+// value held, so it never needs revaluing.
+func (s *Service) revalue(ctx context.Context, settings *Settings, item *models.Item, held repository.CostHolding, source string, createdBy primitive.ObjectID) error {
+	var value int64
+	switch settings.Method {
+	case models.ValuationAverage:
+		return nil
+	case models.ValuationStandard:
+		value = int64(held.Quantity) * FallbackCost(item)
+	default:
+		layers, err := s.costs.OpenLayers(ctx, held.ItemID, held.WarehouseID)
+		if err != nil {
+			return err
+		}
+		layered := 0
+		for _, layer := range layers {
+			value += int64(layer.Remaining) * layer.UnitCost
+			layered += layer.Remaining
+		}
+		value += int64(held.Quantity-layered) * FallbackCost(item)
+	}
+
+	difference := value - held.Value
+	if difference == 0 {
+		return nil
+	}
+	return s.costs.AddMovement(ctx, &models.CostMovement{
+		CompanyID:   item.CompanyID,
+		ItemID:      item.ID,
+		WarehouseID: held.WarehouseID,
+		Type:        models.MovementRevaluation,
+		TotalCost:   difference,
+		Variance:    difference,
+		Currency:    settings.Currency,
+		Method:      settings.Method,
+		Source:      source,
+		CreatedBy:   createdBy,
+		OccurredAt:  time.Now(),
+	})
+}
+
+// Change is a change in an item's stock in one warehouse
+type Change struct {
+	Item        *models.Item
+	WarehouseID primitive.ObjectID
+	Delta       int
+	// UnitCost is what received stock cost; nil uses the item's standard
+	// cost, or else its price
+	UnitCost  *int64
+	Source    string
+	Note      string
+	CreatedBy primitive.ObjectID
+}
+
+// Record values a stock change as a receipt or an issue. Call it in the same
+// transaction as the stock write. A zero delta records nothing.
+func (s *Service) Record(ctx context.Context, change Change) (*models.CostMovement, error) {
+	if change.Delta == 0 {
+		return nil, nil
+	}
+	settings, err := s.Settings(ctx, change.Item.CompanyID)
+	if err != nil {
+		return nil, err
+	}
+
+	movement := &models.CostMovement{
+		CompanyID:   change.Item.CompanyID,
+		ItemID:      change.Item.ID,
+		WarehouseID: change.WarehouseID,
+		Currency:    settings.Currency,
+		Method:      settings.Method,
+		Source:      change.Source,
+		Note:        change.Note,
+		CreatedBy:   change.CreatedBy,
+		OccurredAt:  time.Now(),
+	}
+	if change.Delta > 0 {
+		err = s.receive(ctx, change, movement)
+	} else {
+		err = s.issue(ctx, change, movement)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := s.costs.AddMovement(ctx, movement); err != nil {
+		return nil, err
+	}
+	return movement, nil
+}
+
+// receive adds a cost layer at the actual cost. Standard costing values the
+// receipt at standard and keeps the difference as a variance.
+func (s *Service) receive(ctx context.Context, change Change, movement *models.CostMovement) error {
+	quantity := int64(change.Delta)
+	unitCost := FallbackCost(change.Item)
+	if change.UnitCost != nil {
+		unitCost = *change.UnitCost
+	}
+
+	layer := &models.CostLayer{
+		CompanyID:   movement.CompanyID,
+		ItemID:      movement.ItemID,
+		WarehouseID: movement.WarehouseID,
+		Quantity:    change.Delta,
+		Remaining:   change.Delta,
+		UnitCost:    unitCost,
+		Currency:    movement.Currency,
+		Source:      change.Source,
+		CreatedBy:   change.CreatedBy,
+		ReceivedAt:  movement.OccurredAt,
+	}
+	if err := s.costs.AddLayer(ctx, layer); err != nil {
+		return err
+	}
+
+	movement.Type = models.MovementReceipt
+	movement.Quantity = change.Delta
+	movement.UnitCost = unitCost
+	movement.TotalCost = quantity * unitCost
+	if movement.Method == models.ValuationStandard && change.Item.StandardCost > 0 {
+		movement.TotalCost = quantity * change.Item.StandardCost
+		movement.Variance = quantity * (unitCost - change.Item.StandardCost)
+	}
+	return nil
+}
+
+// issue consumes layers oldest first and costs the quantity by the method.
+// Stock issued beyond the open layers, such as stock that predates cost
+// tracking, is costed at the item's standard cost or price.
+func (s *Service) issue(ctx context.Context, change Change, movement *models.CostMovement) error {
+	quantity := -change.Delta
+	fallback := FallbackCost(change.Item)
+
+	// Average costing reads the position before this issue changes it
+	var heldQuantity int
+	var heldValue int64
+	if movement.Method == models.ValuationAverage {
+		var err error
+		if heldQuantity, heldValue, err = s.costs.Position(ctx, movement.ItemID, movement.WarehouseID); err != nil {
+			return err
+		}
+	}
+
+	layers, err := s.costs.OpenLayers(ctx, movement.ItemID, movement.WarehouseID)
+	if err != nil {
+		return err
+	}
+	remaining := quantity
+	var layerCost int64
+	for _, layer := range layers {
+		if remaining == 0 {
+			break
+		}
+		take := layer.Remaining
+		if take > remaining {
+			take = remaining
+		}
+		if err := s.costs.ConsumeLayer(ctx, layer.ID, take); err != nil {
+			return err
+		}
+		layerCost += int64(take) * layer.UnitCost
+		remaining -= take
+	}
+
+	var cost int64
+	switch movement.Method {
+	case models.ValuationAverage:
+		switch {
+		case heldQuantity <= 0:
+			cost = int64(quantity) * fallback
+		case quantity >= heldQuantity:
+			cost = heldValue + int64(quantity-heldQuantity)*fallback
+		default:
+			cost = DivideRounded(int64(quantity)*heldValue, int64(heldQuantity))
+		}
+	case models.ValuationStandard:
+		cost = int64(quantity) * fallback
+	default:
+		cost = layerCost + int64(remaining)*fallback
+	}
+
+	movement.Type = models.MovementIssue
+	movement.Quantity = quantity
+	movement.TotalCost = cost
+	movement.UnitCost = DivideRounded(cost, int64(quantity))
+	return nil
+}
+
+// FallbackCost is the unit cost used when no actual cost is known: the
+// standard cost, or the price when there is none
+func FallbackCost(item *models.Item) int64 {
+	if item.StandardCost > 0 {
+		return item.StandardCost
+	}
+	return item.Price
+}
+
+// DivideRounded divides by a positive denominator, rounding halves away from zero
+func DivideRounded(numerator, denominator int64) int64 {
+	if numerator < 0 {
+		return -DivideRounded(-numerator, denominator)
+	}
+	return (numerator*2 + denominator) / (denominator * 2)
+}
@@ -0,0 +1,256 @@
+package valuation
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/a2sv/safeware/internal/models"
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// valuationEnv is a company with one warehouse and one item
+type valuationEnv struct {
+	repos     *repository.Repositories
+	service   *Service
+	company   *models.Company
+	warehouse *models.Warehouse
+	item      *models.Item
+	start     time.Time
+}
+
+func newValuationEnv(t *testing.T, method string, item models.Item) *valuationEnv {
+	t.Helper()
+	ctx := context.Background()
+	env := &valuationEnv{repos: repository.NewMemoryRepositories(), start: time.Now()}
+	repos := env.repos
+	env.company = &models.Company{Name: "Acme", Currency: "USD", ValuationMethod: method}
+	if err := repos.Companies.Create(ctx, env.company); err != nil {
+		t.Fatal(err)
+	}
+	env.warehouse = &models.Warehouse{CompanyID: env.company.ID, Name: "Main", IsActive: true}
+	if err := repos.Warehouses.Create(ctx, env.warehouse); err != nil {
+		t.Fatal(err)
+	}
+	item.CompanyID = env.company.ID
+	item.SKU, item.Name, item.Quality, item.Currency = "BOX-1", "Box", "New", "USD"
+	env.item = &item
+	if err := repos.Items.Create(ctx, env.item, &models.ItemLocation{WarehouseID: env.warehouse.ID}); err != nil {
+		t.Fatal(err)
+	}
+	env.service = NewService(repos.Tx, repos.Companies, repos.Warehouses, repos.Items, repos.Costs)
+	return env
+}
+
+func (env *valuationEnv) summarize(t *testing.T) Valuation {
+	t.Helper()
+	summary, err := env.service.Summarize(context.Background(), env.company.ID, nil, env.start, time.Now().Add(time.Second))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return summary.Totals
+}
+
+func cost(unitCost int64) *int64 {
+	return &unitCost
+}
+
+// step receives (positive delta) or issues stock, or changes the item's
+// price or standard cost and revalues its stock
+type step struct {
+	delta        int
+	unitCost     *int64
+	price        *int64
+	standardCost *int64
+}
+
+func TestRecord(t *testing.T) {
+	tests := []struct {
+		name        string
+		method      string
+		item        models.Item
+		steps       []step
+		variance    int64 // Of all receipts
+		issued      int64
+		revaluation int64
+		closing     int64
+		closingQty  int
+	}{
+		{
+			name:   "fifo consumes the oldest layers first",
+			method: models.ValuationFIFO,
+			item:   models.Item{Price: 100},
+			steps: []step{
+				{delta: 10, unitCost: cost(5)},
+				{delta: 10, unitCost: cost(8)},
+				{delta: -15},
+			},
+			issued:     10*5 + 5*8,
+			closing:    5 * 8,
+			closingQty: 5,
+		},
+		{
+			name:   "average issues at the rounded average of the value held",
+			method: models.ValuationAverage,
+			item:   models.Item{Price: 100},
+			steps: []step{
+				{delta: 1, unitCost: cost(10)},
+				{delta: 2, unitCost: cost(15)},
+				{delta: -1}, // 40 / 3 = 13.33
+				{delta: -2}, // The rest of the value held
+			},
+			issued:  40,
+			closing: 0,
+		},
+		{
+			name:   "fifo issues beyond the open layers at the price",
+			method: models.ValuationFIFO,
+			item:   models.Item{Price: 9},
+			steps: []step{
+				{delta: 2, unitCost: cost(5)},
+				{delta: -5},
+			},
+			issued:     2*5 + 3*9,
+			closing:    -3 * 9,
+			closingQty: -3,
+		},
+		{
+			name:   "fifo issues beyond the open layers at the standard cost before the price",
+			method: models.ValuationFIFO,
+			item:   models.Item{Price: 9, StandardCost: 6},
+			steps: []step{
+				{delta: 2, unitCost: cost(5)},
+				{delta: -5},
+			},
+			issued:     2*5 + 3*6,
+			closing:    -3 * 6,
+			closingQty: -3,
+		},
+		{
+			name:   "standard values receipts at standard and keeps the variance",
+			method: models.ValuationStandard,
+			item:   models.Item{Price: 9, StandardCost: 5},
+			steps: []step{
+				{delta: 10, unitCost: cost(6)},
+				{delta: -4},
+			},
+			variance:   10,
+			issued:     4 * 5,
+			closing:    6 * 5,
+			closingQty: 6,
+		},
+		{
+			name:   "standard revalues stock held when the standard cost changes",
+			method: models.ValuationStandard,
+			item:   models.Item{Price: 9, StandardCost: 5},
+			steps: []step{
+				{delta: 10, unitCost: cost(5)},
+				{standardCost: cost(7)},
+				{delta: -10},
+			},
+			issued:      10 * 7,
+			revaluation: 10 * 2,
+			closing:     0,
+		},
+		{
+			name:   "fifo keeps layer costs when the price changes",
+			method: models.ValuationFIFO,
+			item:   models.Item{Price: 9},
+			steps: []step{
+				{delta: 10, unitCost: cost(5)},
+				{price: cost(12)},
+				{delta: -10},
+			},
+			issued:  10 * 5,
+			closing: 0,
+		},
+		{
+			name:   "average never revalues",
+			method: models.ValuationAverage,
+			item:   models.Item{Price: 9, StandardCost: 5},
+			steps: []step{
+				{delta: 10, unitCost: cost(5)},
+				{standardCost: cost(7)},
+				{delta: -10},
+			},
+			issued:  10 * 5,
+			closing: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			env := newValuationEnv(t, tt.method, tt.item)
+
+			var variance int64
+			for _, step := range tt.steps {
+				if step.price != nil || step.standardCost != nil {
+					item, err := env.repos.Items.Update(ctx, env.company.ID, env.item.ID, repository.ItemUpdate{Price: step.price, StandardCost: step.standardCost})
+					if err != nil {
+						t.Fatal(err)
+					}
+					env.item = item
+					if err := env.service.Revalue(ctx, item, SourcePrice, primitive.NilObjectID); err != nil {
+						t.Fatal(err)
+					}
+					continue
+				}
+				movement, err := env.service.Record(ctx, Change{Item: env.item, WarehouseID: env.warehouse.ID, Delta: step.delta, UnitCost: step.unitCost, Source: SourceAdjust})
+				if err != nil {
+					t.Fatal(err)
+				}
+				if movement.Type == models.MovementReceipt {
+					variance += movement.Variance
+				}
+			}
+
+			totals := env.summarize(t)
+			if variance != tt.variance {
+				t.Errorf("variance = %d, want %d", variance, tt.variance)
+			}
+			if totals.CostOfGoodsIssued != tt.issued {
+				t.Errorf("cost of goods issued = %d, want %d", totals.CostOfGoodsIssued, tt.issued)
+			}
+			if totals.Revaluation != tt.revaluation {
+				t.Errorf("revaluation = %d, want %d", totals.Revaluation, tt.revaluation)
+			}
+			if totals.ClosingValue != tt.closing || totals.ClosingQuantity != tt.closingQty {
+				t.Errorf("closing = %d at %d, want %d at %d", totals.ClosingQuantity, totals.ClosingValue, tt.closingQty, tt.closing)
+			}
+		})
+	}
+}
+
+func TestUpdateSettingsRevaluesStockForTheNewMethod(t *testing.T) {
+	ctx := context.Background()
+	env := newValuationEnv(t, models.ValuationFIFO, models.Item{Price: 9, StandardCost: 6})
+	for _, unitCost := range []int64{5, 8} {
+		if _, err := env.service.Record(ctx, Change{Item: env.item, WarehouseID: env.warehouse.ID, Delta: 10, UnitCost: cost(unitCost), Source: SourceAdjust}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// FIFO holds 10 at 5 and 10 at 8; standard issues all 20 at 6
+	method := models.ValuationStandard
+	if _, err := env.service.UpdateSettings(ctx, env.company.ID, nil, &method, primitive.NilObjectID); err != nil {
+		t.Fatal(err)
+	}
+	if totals := env.summarize(t); totals.Revaluation != 20*6-130 || totals.ClosingValue != 20*6 {
+		t.Fatalf("after switching to standard: revaluation %d, closing %d", totals.Revaluation, totals.ClosingValue)
+	}
+
+	// Back on FIFO the open layers are worth what they cost again
+	method = models.ValuationFIFO
+	if _, err := env.service.UpdateSettings(ctx, env.company.ID, nil, &method, primitive.NilObjectID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := env.service.Record(ctx, Change{Item: env.item, WarehouseID: env.warehouse.ID, Delta: -20, Source: SourceAdjust}); err != nil {
+		t.Fatal(err)
+	}
+	totals := env.summarize(t)
+	if totals.Revaluation != 0 || totals.CostOfGoodsIssued != 130 || totals.ClosingValue != 0 {
+		t.Fatalf("after switching back: revaluation %d, issued %d, closing %d", totals.Revaluation, totals.CostOfGoodsIssued, totals.ClosingValue)
+	}
+}
@@ -0,0 +1,127 @@
+package valuation
+
+import (
+	"context"
+	"time"
+
+	"github.com/a2sv/safeware/internal/repository"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Valuation is stock movement over a period, in minor units of the company currency
+type Valuation struct {
+	OpeningQuantity   int   `json:"opening_quantity"`
+	OpeningValue      int64 `json:"opening_value"`
+	ReceivedQuantity  int   `json:"received_quantity"`
+	ReceivedValue     int64 `json:"received_value"`
+	IssuedQuantity    int   `json:"issued_quantity"`
+	CostOfGoodsIssued int64 `json:"cost_of_goods_issued"`
+	// Revaluation is the value added, or taken away when negative, by
+	// changes to the cost the stock held is issued at
+	Revaluation     int64 `json:"revaluation"`
+	ClosingQuantity int   `json:"closing_quantity"`
+	ClosingValue    int64 `json:"closing_value"`
+}
+
+func (v *Valuation) add(other Valuation) {
+	v.OpeningQuantity += other.OpeningQuantity
+	v.OpeningValue += other.OpeningValue
+	v.ReceivedQuantity += other.ReceivedQuantity
+	v.ReceivedValue += other.ReceivedValue
+	v.IssuedQuantity += other.IssuedQuantity
+	v.CostOfGoodsIssued += other.CostOfGoodsIssued
+	v.Revaluation += other.Revaluation
+	v.ClosingQuantity += other.ClosingQuantity
+	v.ClosingValue += other.ClosingValue
+}
+
+// WarehouseValuation is the valuation of one warehouse
+type WarehouseValuation struct {
+	WarehouseID   primitive.ObjectID `json:"warehouse_id"`
+	WarehouseName string             `json:"warehouse_name"`
+	Valuation
+}
+
+// Summary values a company's stock over [From, To)
+type Summary struct {
+	Currency   string               `json:"currency"`
+	Method     string               `json:"method"`
+	From       time.Time            `json:"from"`
+	To         time.Time            `json:"to"`
+	Warehouses []WarehouseValuation `json:"warehouses"`
+	Totals     Valuation            `json:"totals"`
+}
+
+// Summarize returns the opening and closing valuation, the cost of goods
+// issued and revaluations per warehouse for a period. A warehouse restricts it to that
+// warehouse, which must belong to the company.
+func (s *Service) Summarize(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, from, to time.Time) (*Summary, error) {
+	settings, err := s.Settings(ctx, companyID)
+	if err != nil {
+		return nil, err
+	}
+	if warehouseID != nil {
+		if _, err := s.warehouses.Get(ctx, companyID, *warehouseID); err != nil {
+			return nil, err
+		}
+	}
+
+	totals, err := s.costs.Summarize(ctx, companyID, warehouseID, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := &Summary{
+		Currency:   settings.Currency,
+		Method:     settings.Method,
+		From:       from,
+		To:         to,
+		Warehouses: []WarehouseValuation{},
+	}
+	for _, total := range totals {
+		row := WarehouseValuation{
+			WarehouseID: total.WarehouseID,
+			Valuation: Valuation{
+				OpeningQuantity:   total.OpeningQuantity,
+				OpeningValue:      total.OpeningValue,
+				ReceivedQuantity:  total.ReceivedQuantity,
+				ReceivedValue:     total.ReceivedValue,
+				IssuedQuantity:    total.IssuedQuantity,
+				CostOfGoodsIssued: total.IssuedCost,
+				Revaluation:       total.RevaluedValue,
+			},
+		}
+		row.ClosingQuantity = row.OpeningQuantity + row.ReceivedQuantity - row.IssuedQuantity
+		row.ClosingValue = row.OpeningValue + row.ReceivedValue - row.CostOfGoodsIssued + row.Revaluation
+
+		warehouse, err := s.warehouses.Get(ctx, companyID, total.WarehouseID)
+		switch {
+		case err == nil:
+			row.WarehouseName = warehouse.Name
+		case err != repository.ErrNotFound:
+			return nil, err
+		}
+
+		summary.Warehouses = append(summary.Warehouses, row)
+		summary.Totals.add(row.Valuation)
+	}
+	return summary, nil
+}
+
+// Holdings returns the company's stock at cost at a point in time, per item
+// and warehouse, leaving out items that held nothing. Its totals per
+// warehouse are the closing valuation Summarize reports for a period ending
+// at the same time.
+func (s *Service) Holdings(ctx context.Context, companyID primitive.ObjectID, warehouseID *primitive.ObjectID, at time.Time) ([]repository.CostHolding, error) {
+	holdings, err := s.costs.Holdings(ctx, companyID, warehouseID, at)
+	if err != nil {
+		return nil, err
+	}
+	held := holdings[:0]
+	for _, holding := range holdings {
+		if holding.Quantity != 0 || holding.Value != 0 {
+			held = append(held, holding)
+		}
+	}
+	return held, nil
+}